@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/git"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/tasks"
+)
+
+// blameCmd represents the blame command
+var blameCmd = &cobra.Command{
+	Use:   "blame [project-id] [file[:line]]",
+	Short: "Show which steps last changed the lines of a file",
+	Long: `Show which steps last changed the lines of a file on the project's main branch.
+
+Each run of lines is mapped back to the step that committed it, with the step's
+agent configuration and the tasks leased in the step. Commits are linked to steps
+by the "Step-id: S<N>" git note written on step commits, by "Automerge step-S<N>"
+merge messages, and by the commits recorded in the step database, which is how
+squashed steps are found. Lines changed outside LaForge have no step.
+
+Pass file:line or file:start-end to blame only those lines; the steps that
+changed them are then shown in detail.
+
+Examples:
+  laforge blame my-project cmd/main.go
+  laforge blame my-project cmd/main.go:42
+  laforge blame my-project cmd/main.go:40-60`,
+	Args: cobra.ExactArgs(2),
+	RunE: runBlame,
+}
+
+// stepWhichCmd represents the step which command
+var stepWhichCmd = &cobra.Command{
+	Use:   "which [project-id] [commit]",
+	Short: "Show the step that made a commit",
+	Long: `Show the step that made a commit of the project's repository, with its
+agent configuration and the tasks leased in the step.
+
+The commit may be a SHA, a prefix of one, or any revision git understands. It is
+linked to a step like in laforge blame.
+
+Examples:
+  laforge step which my-project 3f2a9c1
+  laforge step which my-project main~2`,
+	Args: cobra.ExactArgs(2),
+	RunE: runStepWhich,
+}
+
+func init() {
+	rootCmd.AddCommand(blameCmd)
+	stepCmd.AddCommand(stepWhichCmd)
+}
+
+// stepSourceDescriptions explains how a commit was linked to its step
+var stepSourceDescriptions = map[string]string{
+	git.StepSourceNote:            "Step-id note",
+	git.StepSourceMergeMessage:    "Automerge message",
+	projects.StepSourceStepRecord: "step record",
+}
+
+// parseBlameTarget splits a file[:line] or file[:start-end] argument into the
+// path and line range. Both lines are 0 if no line was given.
+func parseBlameTarget(target string) (string, int, int, error) {
+	index := strings.LastIndex(target, ":")
+	if index < 0 {
+		return target, 0, 0, nil
+	}
+	path, lines := target[:index], target[index+1:]
+
+	startStr, endStr, isRange := strings.Cut(lines, "-")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		// Not a line number, so the colon is part of the path
+		return target, 0, 0, nil
+	}
+	end := start
+	if isRange {
+		if end, err = strconv.Atoi(endStr); err != nil {
+			return "", 0, 0, errors.NewInvalidInputError(fmt.Sprintf("invalid line range: %s", lines))
+		}
+	}
+	if path == "" || start < 1 || end < start {
+		return "", 0, 0, errors.NewInvalidInputError(fmt.Sprintf("invalid line range: %s", lines))
+	}
+	return path, start, end, nil
+}
+
+func runBlame(cmd *cobra.Command, args []string) error {
+	projectID := args[0]
+
+	// Validate project ID
+	if projectID == "" {
+		return errors.NewInvalidInputError("project ID cannot be empty")
+	}
+
+	path, startLine, endLine, err := parseBlameTarget(args[1])
+	if err != nil {
+		return err
+	}
+
+	// Check if project exists
+	exists, err := projects.ProjectExists(projectID)
+	if err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to check if project exists")
+	}
+	if !exists {
+		return errors.NewProjectNotFoundError(projectID)
+	}
+
+	ranges, err := projects.BlameFile(projectID, path, startLine, endLine)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-12s %-8s %-10s %-20s %-16s %s\n", "LINES", "STEP", "COMMIT", "AGENT CONFIG", "TASKS", "SUBJECT")
+	fmt.Printf("%-12s %-8s %-10s %-20s %-16s %s\n", "------------", "--------", "----------", "--------------------", "----------------", "--------------------")
+	for _, r := range ranges {
+		lines := fmt.Sprintf("%d", r.StartLine)
+		if r.EndLine != r.StartLine {
+			lines = fmt.Sprintf("%d-%d", r.StartLine, r.EndLine)
+		}
+
+		step, agentConfig, taskIDs := "-", "-", "-"
+		if commitStep := r.CommitStep; commitStep.StepID != 0 {
+			step = fmt.Sprintf("S%d", commitStep.StepID)
+			if commitStep.Step != nil && commitStep.Step.AgentConfigName != "" {
+				agentConfig = commitStep.Step.AgentConfigName
+			}
+			if len(commitStep.TaskIDs) > 0 {
+				taskIDs = formatTaskIDs(commitStep.TaskIDs)
+			}
+		}
+
+		fmt.Printf("%-12s %-8s %-10s %-20s %-16s %s\n",
+			lines, step, r.CommitStep.Commit.SHA[:8], agentConfig, taskIDs, r.CommitStep.Commit.Subject)
+	}
+
+	// Show the steps behind specific lines in detail
+	if startLine > 0 {
+		shown := map[string]bool{}
+		for _, r := range ranges {
+			if shown[r.CommitStep.Commit.SHA] {
+				continue
+			}
+			shown[r.CommitStep.Commit.SHA] = true
+			fmt.Println()
+			if err := printCommitStep(projectID, r.CommitStep); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func runStepWhich(cmd *cobra.Command, args []string) error {
+	projectID := args[0]
+	commit := args[1]
+
+	// Validate project ID
+	if projectID == "" {
+		return errors.NewInvalidInputError("project ID cannot be empty")
+	}
+
+	// Check if project exists
+	exists, err := projects.ProjectExists(projectID)
+	if err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to check if project exists")
+	}
+	if !exists {
+		return errors.NewProjectNotFoundError(projectID)
+	}
+
+	commitStep, err := projects.FindCommitStep(projectID, commit)
+	if err != nil {
+		return err
+	}
+
+	return printCommitStep(projectID, commitStep)
+}
+
+// printCommitStep prints a commit with the step that made it, its agent
+// configuration and the tasks leased in the step
+func printCommitStep(projectID string, commitStep *projects.CommitStep) error {
+	fmt.Printf("Commit: %s\n", commitStep.Commit.SHA)
+	fmt.Printf("Subject: %s\n", commitStep.Commit.Subject)
+
+	if commitStep.StepID == 0 {
+		fmt.Printf("Step: none (not made by a LaForge step)\n")
+		return nil
+	}
+	fmt.Printf("Step: S%d (from %s)\n", commitStep.StepID, stepSourceDescriptions[commitStep.Source])
+
+	step := commitStep.Step
+	if step == nil {
+		fmt.Printf("Status: not found in the step database\n")
+		return nil
+	}
+	fmt.Printf("Status: %s\n", stepStatus(step))
+	fmt.Printf("Started: %s\n", step.StartTime.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Agent Configuration: %s\n", step.AgentConfigName)
+	if step.PullRequestURL != "" {
+		fmt.Printf("Pull Request: %s\n", step.PullRequestURL)
+	}
+
+	if len(commitStep.TaskIDs) == 0 {
+		return nil
+	}
+
+	db, err := projects.OpenProjectTaskDatabase(projectID)
+	if err != nil {
+		return errors.Wrap(errors.ErrDatabaseConnectionFailed, err, "failed to open project task database")
+	}
+	defer db.Close()
+
+	fmt.Printf("Tasks Leased:\n")
+	for _, taskID := range commitStep.TaskIDs {
+		task, err := tasks.GetTask(db, taskID)
+		if err != nil {
+			return errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to get task")
+		}
+		if task == nil {
+			fmt.Printf("  T%d (deleted)\n", taskID)
+			continue
+		}
+		fmt.Printf("  T%d [%s] %s\n", task.ID, task.Status, task.Title)
+	}
+	return nil
+}
+
+// formatTaskIDs formats task IDs as a comma-separated list, e.g. "T3,T4"
+func formatTaskIDs(taskIDs []int) string {
+	ids := make([]string, len(taskIDs))
+	for i, id := range taskIDs {
+		ids[i] = fmt.Sprintf("T%d", id)
+	}
+	return strings.Join(ids, ",")
+}
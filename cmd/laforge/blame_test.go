@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestParseBlameTarget(t *testing.T) {
+	tests := []struct {
+		target    string
+		path      string
+		startLine int
+		endLine   int
+		wantErr   bool
+	}{
+		{target: "cmd/main.go", path: "cmd/main.go"},
+		{target: "cmd/main.go:42", path: "cmd/main.go", startLine: 42, endLine: 42},
+		{target: "cmd/main.go:40-60", path: "cmd/main.go", startLine: 40, endLine: 60},
+		{target: "docs/a:b.md", path: "docs/a:b.md"},
+		{target: "cmd/main.go:0", wantErr: true},
+		{target: "cmd/main.go:60-40", wantErr: true},
+		{target: "cmd/main.go:40-x", wantErr: true},
+		{target: ":12", wantErr: true},
+	}
+
+	for _, test := range tests {
+		path, startLine, endLine, err := parseBlameTarget(test.target)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseBlameTarget(%q) expected an error", test.target)
+			}
+			continue
+		}
+		if err != nil || path != test.path || startLine != test.startLine || endLine != test.endLine {
+			t.Errorf("parseBlameTarget(%q) = %q, %d, %d, %v; expected %q, %d, %d",
+				test.target, path, startLine, endLine, err, test.path, test.startLine, test.endLine)
+		}
+	}
+}
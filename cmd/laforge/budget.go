@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomyedwab/laforge/lib/costs"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// budgetCmd represents the budget command
+var budgetCmd = &cobra.Command{
+	Use:   "budget [project-id]",
+	Short: "Show or set the spending budget for a project",
+	Long: `Show or set the spending budget for a project.
+
+Without flags, prints the configured limits and the current spending. With
+flags, updates only the given limits; a limit of 0 removes it. Limits are in
+USD and are checked by laserve before each step is leased. The per-step limit
+must fit within the remaining daily and total budgets for a step to start.
+
+Examples:
+  laforge budget my-project
+  laforge budget my-project --max-cost-per-day 20 --max-cost-per-step 2
+  laforge budget my-project --max-total-cost 0`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBudget,
+}
+
+func init() {
+	budgetCmd.Flags().Float64("max-cost-per-day", 0, "Maximum spend per calendar day in USD (0 for no limit)")
+	budgetCmd.Flags().Float64("max-cost-per-step", 0, "Maximum spend per step in USD (0 for no limit)")
+	budgetCmd.Flags().Float64("max-total-cost", 0, "Maximum total spend for the project in USD (0 for no limit)")
+	rootCmd.AddCommand(budgetCmd)
+}
+
+func runBudget(cmd *cobra.Command, args []string) error {
+	projectID := args[0]
+
+	// Validate project ID
+	if projectID == "" {
+		return errors.NewInvalidInputError("project ID cannot be empty")
+	}
+
+	// Check if project exists
+	exists, err := projects.ProjectExists(projectID)
+	if err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to check if project exists")
+	}
+	if !exists {
+		return errors.NewProjectNotFoundError(projectID)
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("max-cost-per-day") || flags.Changed("max-cost-per-step") || flags.Changed("max-total-cost") {
+		project, err := projects.LoadProject(projectID)
+		if err != nil {
+			return err
+		}
+
+		budget := project.Budget
+		if flags.Changed("max-cost-per-day") {
+			budget.MaxCostPerDay, _ = flags.GetFloat64("max-cost-per-day")
+		}
+		if flags.Changed("max-cost-per-step") {
+			budget.MaxCostPerStep, _ = flags.GetFloat64("max-cost-per-step")
+		}
+		if flags.Changed("max-total-cost") {
+			budget.MaxTotalCost, _ = flags.GetFloat64("max-total-cost")
+		}
+
+		if _, err := projects.UpdateProjectBudget(projectID, budget); err != nil {
+			return err
+		}
+		fmt.Printf("Updated budget for project '%s'\n", projectID)
+	}
+
+	status, checkErr := costs.CheckProjectBudget(projectID)
+	if status == nil {
+		return checkErr
+	}
+
+	fmt.Printf("Budget for project '%s':\n", projectID)
+	fmt.Printf("  Max Cost Per Day: %s\n", formatBudgetLimit(status.Budget.MaxCostPerDay))
+	fmt.Printf("  Max Cost Per Step: %s\n", formatBudgetLimit(status.Budget.MaxCostPerStep))
+	fmt.Printf("  Max Total Cost: %s\n", formatBudgetLimit(status.Budget.MaxTotalCost))
+	fmt.Printf("  Spent Today: $%.4f\n", status.SpentToday)
+	fmt.Printf("  Spent Total: $%.4f\n", status.SpentTotal)
+	if status.RunningSteps > 0 {
+		fmt.Printf("  Reserved by %d Running Step(s): $%.4f\n", status.RunningSteps, status.ReservedTotal)
+	}
+	if checkErr != nil {
+		fmt.Printf("  Status: exhausted (%s)\n", checkErr.Error())
+	} else {
+		fmt.Printf("  Status: ok\n")
+	}
+
+	return nil
+}
+
+// formatBudgetLimit formats a budget limit, where 0 means no limit
+func formatBudgetLimit(limit float64) string {
+	if limit <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("$%.2f", limit)
+}
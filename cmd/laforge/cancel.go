@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// cancelPollInterval is how often a running step asks laserve whether it has been cancelled
+var cancelPollInterval = 5 * time.Second
+
+// cancelGracePeriod is how many seconds a cancelled agent gets to exit before it is killed
+const cancelGracePeriod = 10
+
+// stepCancelResponse is the part of the GET /steps/{step_id} response that
+// reports whether the step has been cancelled
+type stepCancelResponse struct {
+	Data struct {
+		Step struct {
+			CancelRequestedAt *time.Time `json:"cancel_requested_at"`
+		} `json:"step"`
+	} `json:"data"`
+}
+
+// cancelWatcher polls laserve for a cancellation request for a running step
+type cancelWatcher struct {
+	done      chan struct{}
+	wg        sync.WaitGroup
+	cancelled bool
+}
+
+// watchForCancel polls laserve until the step is cancelled or the watcher is
+// stopped, and calls onCancel once when a cancellation is requested. Failed
+// polls are ignored, since laserve may be briefly unavailable.
+func watchForCancel(projectID string, stepID int, onCancel func()) *cancelWatcher {
+	w := &cancelWatcher{done: make(chan struct{})}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(cancelPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+
+			var response stepCancelResponse
+			if err := sendRequest(projectID, fmt.Sprintf("/steps/%d", stepID), "GET", nil, &response); err != nil {
+				continue
+			}
+			if response.Data.Step.CancelRequestedAt != nil {
+				w.cancelled = true
+				onCancel()
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// Stop stops polling and reports whether the step was cancelled
+func (w *cancelWatcher) Stop() bool {
+	close(w.done)
+	w.wg.Wait()
+	return w.cancelled
+}
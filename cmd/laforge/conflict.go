@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/tasks"
+)
+
+// promptEnvVar passes instructions to the agent in place of the default
+// "Work on the next task." of the agent scripts
+const promptEnvVar = "LAFORGE_PROMPT"
+
+// defaultConflictPrompt instructs the agent of a conflict resolution step. See
+// projects.ConflictResolutionConfig for the placeholders.
+const defaultConflictPrompt = `Task T{task_id}: a merge of the branch {branch} into {main_branch} is in progress in this directory and stopped on conflicts in these files:
+
+{files}
+
+Resolve every conflict, keeping the intent of the changes on both sides, and remove all conflict markers. Make sure the project still builds and its tests pass. Do not work on any other task. Write a commit message describing how the conflicts were resolved to COMMIT.md.`
+
+// mergeConflict is a step branch that could not be merged into the main branch,
+// and the task created for the step that resolves it
+type mergeConflict struct {
+	StepID int
+	Branch string
+	TaskID int
+}
+
+// createConflictTask creates the task tracking the resolution of a step branch
+// that conflicts with the main branch
+func createConflictTask(projectID string, stepID int, mainBranch string) (*mergeConflict, error) {
+	db, err := projects.OpenProjectTaskDatabase(projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	branch := fmt.Sprintf("step-S%d", stepID)
+	description := fmt.Sprintf("The branch %s of step S%d conflicts with %s. LaForge resolves the conflicts in a dedicated step, "+
+		"which runs with the merge in progress. If that step fails, merge %s into %s and resolve the conflicts by hand.",
+		branch, stepID, mainBranch, branch, mainBranch)
+	taskID, err := tasks.AddTaskWithDetails(db,
+		fmt.Sprintf("Resolve merge conflict for %s", branch),
+		description,
+		fmt.Sprintf("%s is merged into %s and no conflict markers remain", branch, mainBranch),
+		nil, false, nil)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to create merge conflict task")
+	}
+
+	return &mergeConflict{StepID: stepID, Branch: branch, TaskID: taskID}, nil
+}
+
+// leaseStepTask leases the task a step was assigned, such as the task of the
+// conflict it resolves, so the task is shown as being worked on and the step's
+// updates to it are applied when the step is finalized
+func leaseStepTask(projectID string, taskID int, stepID int) error {
+	db, err := projects.OpenProjectTaskDatabase(projectID)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return tasks.LeaseTask(db, taskID, stepID)
+}
+
+// updateConflictTask queues a log message, and a status change unless status is
+// empty, for the conflict's task. They are applied when the step is finalized.
+func updateConflictTask(projectID string, conflict *mergeConflict, stepID int, status string, message string) error {
+	db, err := projects.OpenProjectTaskDatabase(projectID)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := tasks.QueueTaskLogUpdate(db, conflict.TaskID, stepID, &tasks.TaskQueuedLogRequest{
+		Message:   message,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if status != "" {
+		return tasks.QueueTaskStatusUpdate(db, conflict.TaskID, stepID, status)
+	}
+	return nil
+}
+
+// conflictPrompt fills in the placeholders of a conflict resolution prompt,
+// using the default prompt if template is empty
+func conflictPrompt(template string, conflict *mergeConflict, mainBranch string, files []string) string {
+	if template == "" {
+		template = defaultConflictPrompt
+	}
+
+	fileList := make([]string, len(files))
+	for i, file := range files {
+		fileList[i] = "- " + file
+	}
+
+	return strings.NewReplacer(
+		"{branch}", conflict.Branch,
+		"{main_branch}", mainBranch,
+		"{task_id}", strconv.Itoa(conflict.TaskID),
+		"{files}", strings.Join(fileList, "\n"),
+	).Replace(template)
+}
+
+// executeConflictResolution runs the step that resolves a conflict left behind
+// by a previous step, with the conflicted merge in progress in its worktree
+func executeConflictResolution(ctx context.Context, projectID string, opts stepOptions, conflict *mergeConflict) (*stepResult, error) {
+	fmt.Printf("Step S%d conflicts with the main branch, running a step to resolve it (task T%d)\n", conflict.StepID, conflict.TaskID)
+	opts.Conflict = conflict
+	return executeStep(ctx, projectID, opts)
+}
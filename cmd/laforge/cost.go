@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomyedwab/laforge/lib/costs"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// costCmd represents the cost command
+var costCmd = &cobra.Command{
+	Use:   "cost [project-id]",
+	Short: "Show token usage and cost for a project",
+	Long: `Show token usage and cost for a project, rolled up per day, per agent
+configuration and per task.
+
+Costs reported by the agent are used as-is. Steps without a reported cost are
+priced from ~/.laforge/pricing.yml using the model named by the agent config's
+MODELNAME environment variable. Rates are in USD per million tokens:
+
+  models:
+    claude-sonnet-4-5:
+      prompt: 3.00
+      completion: 15.00
+      cache_read: 0.30
+      cache_write: 3.75
+
+Examples:
+  laforge cost my-project`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCost,
+}
+
+func init() {
+	rootCmd.AddCommand(costCmd)
+}
+
+func runCost(cmd *cobra.Command, args []string) error {
+	projectID := args[0]
+
+	// Validate project ID
+	if projectID == "" {
+		return errors.NewInvalidInputError("project ID cannot be empty")
+	}
+
+	// Check if project exists
+	exists, err := projects.ProjectExists(projectID)
+	if err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to check if project exists")
+	}
+	if !exists {
+		return errors.NewProjectNotFoundError(projectID)
+	}
+
+	report, err := costs.GenerateCostReport(projectID)
+	if err != nil {
+		return err
+	}
+
+	if report.Steps == 0 {
+		fmt.Printf("No steps found for project '%s'\n", projectID)
+		return nil
+	}
+
+	fmt.Printf("Costs for project '%s':\n", projectID)
+	fmt.Printf("  Steps: %d\n", report.Steps)
+	fmt.Printf("  Total Tokens: %d\n", report.TotalTokens)
+	fmt.Printf("  Total Cost: $%.4f\n", report.TotalCost)
+	if report.UnpricedSteps > 0 {
+		fmt.Printf("  Unpriced Steps: %d (add their models to ~/.laforge/pricing.yml)\n", report.UnpricedSteps)
+	}
+
+	printCostRollups("DAY", report.ByDay)
+	printCostRollups("AGENT CONFIG", report.ByAgentConfig)
+	printCostRollups("TASK", report.ByTask)
+
+	return nil
+}
+
+// printCostRollups prints a table of cost rollups
+func printCostRollups(title string, rollups []costs.CostRollup) {
+	fmt.Println()
+	fmt.Printf("%-20s %-8s %-14s %-12s\n", title, "STEPS", "TOKENS", "COST")
+	fmt.Printf("%-20s %-8s %-14s %-12s\n", "--------------------", "--------", "--------------", "------------")
+	for _, rollup := range rollups {
+		cost := fmt.Sprintf("$%.4f", rollup.Cost)
+		if rollup.UnpricedSteps > 0 {
+			cost += "*"
+		}
+		fmt.Printf("%-20s %-8d %-14d %-12s\n", rollup.Key, rollup.Steps, rollup.TotalTokens, cost)
+	}
+}
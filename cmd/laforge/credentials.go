@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+	"gopkg.in/yaml.v3"
+)
+
+// credentials are the laserve account or API key laforge authenticates with
+type credentials struct {
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+
+	// APIKey is used as the bearer token directly instead of logging in
+	APIKey string `yaml:"api_key" json:"-"`
+}
+
+// getCredentialsPath returns the path to the credentials file (~/.laforge/credentials.yml)
+func getCredentialsPath() (string, error) {
+	laforgeDir, err := projects.GetLaForgeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(laforgeDir, "credentials.yml"), nil
+}
+
+// loadCredentials returns the laserve credentials from the LAFORGE_API_KEY or the
+// LAFORGE_USERNAME and LAFORGE_PASSWORD environment variables, falling back to
+// ~/.laforge/credentials.yml
+func loadCredentials() (*credentials, error) {
+	if apiKey := os.Getenv("LAFORGE_API_KEY"); apiKey != "" {
+		return &credentials{APIKey: apiKey}, nil
+	}
+
+	username := os.Getenv("LAFORGE_USERNAME")
+	password := os.Getenv("LAFORGE_PASSWORD")
+	if username != "" && password != "" {
+		return &credentials{Username: username, Password: password}, nil
+	}
+
+	credentialsPath, err := getCredentialsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(credentialsPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: set LAFORGE_API_KEY, or LAFORGE_USERNAME and LAFORGE_PASSWORD, or create %s", MissingCredentialsError, credentialsPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	var creds credentials
+	if err := yaml.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file %s: %w", credentialsPath, err)
+	}
+	if creds.APIKey == "" && (creds.Username == "" || creds.Password == "") {
+		return nil, fmt.Errorf("%w: %s must set api_key, or username and password", MissingCredentialsError, credentialsPath)
+	}
+
+	return &creds, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tomyedwab/laforge/lib/egress"
+	"github.com/tomyedwab/laforge/lib/errors"
+)
+
+// egressProxyCmd runs the egress proxy inside the sidecar container of an agent
+// with an egress policy. It is started by laforge step, not by users.
+var egressProxyCmd = &cobra.Command{
+	Use:   "egress-proxy",
+	Short: "Run the egress proxy for an agent container",
+	Long: `Run an HTTP(S) proxy that only connects to the allowed destinations.
+
+HTTPS is tunneled with CONNECT and plain HTTP requests are forwarded. Every
+allowed and blocked connection is logged to stdout as a JSON line. laforge step
+runs this command in a sidecar container when the agent configuration has an
+egress policy.`,
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE:   runEgressProxy,
+}
+
+func init() {
+	egressProxyCmd.Flags().String("listen", ":3128", "Address to listen on")
+	egressProxyCmd.Flags().StringArray("allow", nil, "Allowed destination as host[:port] or *.domain[:port] (repeatable)")
+	rootCmd.AddCommand(egressProxyCmd)
+}
+
+func runEgressProxy(cmd *cobra.Command, args []string) error {
+	listenAddr, _ := cmd.Flags().GetString("listen")
+	allow, _ := cmd.Flags().GetStringArray("allow")
+
+	policy, err := egress.NewPolicy(allow)
+	if err != nil {
+		return errors.NewInvalidInputError(err.Error())
+	}
+
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return errors.Wrapf(errors.ErrUnknown, err, "failed to listen on %s", listenAddr)
+	}
+
+	proxy := &egress.Proxy{Policy: policy, Log: os.Stdout}
+	proxy.LogEvent(egress.Event{Event: egress.EventListening, Addr: listener.Addr().String()})
+
+	return http.Serve(listener, proxy)
+}
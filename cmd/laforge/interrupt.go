@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// forceKillKey is the context key of the context cancelled on a second interrupt
+type forceKillKey struct{}
+
+// withInterrupts returns a context that is cancelled on the first SIGINT or
+// SIGTERM, so the running step can stop its agent and finalize cleanly. A second
+// signal cancels the context returned by forceKillContext, which kills the agent
+// container without waiting. Any later signal gets the default behavior and
+// terminates laforge. The returned function stops handling signals.
+func withInterrupts(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	forceCtx, forceKill := context.WithCancel(context.Background())
+	ctx = context.WithValue(ctx, forceKillKey{}, forceCtx)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		defer signal.Stop(signals)
+
+		var sig os.Signal
+		select {
+		case <-done:
+			return
+		case sig = <-signals:
+		}
+		fmt.Fprintf(os.Stderr, "\nReceived %s, stopping the step (repeat to kill the agent immediately)\n", sig)
+		cancel()
+
+		select {
+		case <-done:
+			return
+		case sig = <-signals:
+		}
+		fmt.Fprintf(os.Stderr, "\nReceived %s again, killing the agent container\n", sig)
+		forceKill()
+	}()
+
+	return ctx, func() {
+		close(done)
+		cancel()
+		forceKill()
+	}
+}
+
+// forceKillContext returns the context that is cancelled when a step run with
+// ctx should kill its agent without waiting, after a second interrupt
+func forceKillContext(ctx context.Context) context.Context {
+	if forceCtx, ok := ctx.Value(forceKillKey{}).(context.Context); ok {
+		return forceCtx
+	}
+	return context.Background()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+// logStreamInterval is how often buffered step output is pushed to laserve
+var logStreamInterval = time.Second
+
+// logStreamMaxChunk is the most output sent to laserve in a single request
+const logStreamMaxChunk = 64 * 1024
+
+// logStreamer pushes a running step's formatted output to laserve, so it can be
+// watched live from the web UI. Output is buffered and sent in the background,
+// so a slow or unavailable laserve never holds up the agent. Chunks that fail to
+// send are dropped; the full log is still in the step's log file.
+type logStreamer struct {
+	projectID string
+	stepID    int
+
+	mu      sync.Mutex
+	buffer  []byte
+	offset  int64 // log file offset of the start of buffer
+	flushed chan struct{}
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newLogStreamer starts streaming output written to the returned writer
+func newLogStreamer(projectID string, stepID int) *logStreamer {
+	s := &logStreamer{
+		projectID: projectID,
+		stepID:    stepID,
+		flushed:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(logStreamInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				s.flush()
+				return
+			case <-ticker.C:
+			case <-s.flushed:
+			}
+			s.flush()
+		}
+	}()
+	return s
+}
+
+// Write buffers output to send to laserve. It never fails.
+func (s *logStreamer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	s.buffer = append(s.buffer, p...)
+	full := len(s.buffer) >= logStreamMaxChunk
+	s.mu.Unlock()
+
+	// Send a large burst of output without waiting for the next tick
+	if full {
+		select {
+		case s.flushed <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// flush sends the buffered output to laserve
+func (s *logStreamer) flush() {
+	for {
+		s.mu.Lock()
+		if len(s.buffer) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		n := min(len(s.buffer), logStreamMaxChunk)
+		request := &steps.AppendStepLogRequest{Offset: s.offset, Content: string(s.buffer[:n])}
+		s.buffer = s.buffer[n:]
+		s.offset += int64(n)
+		s.mu.Unlock()
+
+		var response map[string]interface{}
+		_ = sendRequest(s.projectID, fmt.Sprintf("/steps/%d/logs", s.stepID), "POST", request, &response)
+	}
+}
+
+// Close sends any remaining output and stops streaming
+func (s *logStreamer) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	return nil
+}
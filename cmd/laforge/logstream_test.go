@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+func TestLogStreamer(t *testing.T) {
+	var mu sync.Mutex
+	var chunks []steps.AppendStepLogRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/projects/test-project/steps/4/logs" {
+			http.NotFound(w, r)
+			return
+		}
+		var chunk steps.AppendStepLogRequest
+		json.NewDecoder(r.Body).Decode(&chunk)
+		mu.Lock()
+		chunks = append(chunks, chunk)
+		mu.Unlock()
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer server.Close()
+	t.Setenv("LAFORGE_URLPATH", server.URL+"/api/v1")
+	t.Setenv("LAFORGE_API_KEY", "test-key")
+
+	streamer := newLogStreamer("test-project", 4)
+	streamer.Write([]byte("first line\n"))
+	streamer.Write([]byte(strings.Repeat("x", logStreamMaxChunk)))
+	streamer.Write([]byte("last line\n"))
+	streamer.Close()
+
+	// Every byte is sent exactly once, with the offsets of the log file
+	var content strings.Builder
+	for _, chunk := range chunks {
+		if chunk.Offset != int64(content.Len()) {
+			t.Fatalf("Expected chunk at offset %d, got %d", content.Len(), chunk.Offset)
+		}
+		if len(chunk.Content) > logStreamMaxChunk {
+			t.Errorf("Expected chunks of at most %d bytes, got %d", logStreamMaxChunk, len(chunk.Content))
+		}
+		content.WriteString(chunk.Content)
+	}
+	if want := "first line\n" + strings.Repeat("x", logStreamMaxChunk) + "last line\n"; content.String() != want {
+		t.Errorf("Expected the streamed content to match the output, got %d bytes", content.Len())
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	nativeerrors "errors"
@@ -12,6 +13,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -21,6 +23,7 @@ import (
 	"github.com/tomyedwab/laforge/lib/logging"
 	"github.com/tomyedwab/laforge/lib/projects"
 	"github.com/tomyedwab/laforge/lib/steps"
+	"github.com/tomyedwab/laforge/lib/transcript"
 )
 
 var (
@@ -28,8 +31,25 @@ var (
 	commit   = "none"
 	date     = "unknown"
 	apiToken = ""
+
+	// apiTokenMu guards apiToken, which the steps of a parallel run share
+	apiTokenMu sync.Mutex
 )
 
+// currentAPIToken returns the token sent with requests to laserve
+func currentAPIToken() string {
+	apiTokenMu.Lock()
+	defer apiTokenMu.Unlock()
+	return apiToken
+}
+
+// setAPIToken replaces the token sent with requests to laserve
+func setAPIToken(token string) {
+	apiTokenMu.Lock()
+	defer apiTokenMu.Unlock()
+	apiToken = token
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "laforge",
 	Short: "LaForge - A long-running collaborative coding agent",
@@ -66,6 +86,7 @@ func init() {
 	rootCmd.AddCommand(stepCmd)
 	rootCmd.AddCommand(stepsCmd)
 	rootCmd.AddCommand(stepInfoCmd)
+	stepCmd.AddCommand(stepRollbackCmd)
 }
 
 // initCmd represents the init command
@@ -88,7 +109,11 @@ var stepCmd = &cobra.Command{
 
 This command creates a temporary git worktree, copies the task database for isolation,
 launches an agent container with proper mounts, captures and commits changes, and
-cleans up resources.`,
+cleans up resources.
+
+Press Ctrl-C (or send SIGTERM) to interrupt the step: the agent container gets 10
+seconds to exit, its changes are committed to the step branch without merging, and
+the step is finalized as interrupted. Press Ctrl-C again to kill the agent at once.`,
 	Args: cobra.ExactArgs(1),
 	RunE: runStep,
 }
@@ -137,12 +162,31 @@ Information displayed:
   - Git commit SHAs before and after execution
   - Complete agent configuration (model, temperature, tools, etc.)
   - Token usage statistics (prompt, completion, total, cost)
+  - Peak and average container memory and CPU usage
   - Exit code and any error information
   - Project ID and creation timestamp`,
 	Args: cobra.ExactArgs(2),
 	RunE: runStepInfo,
 }
 
+// stepRollbackCmd represents the step rollback command
+var stepRollbackCmd = &cobra.Command{
+	Use:   "rollback [project-id] [step-id]",
+	Short: "Roll back a project to the state before a step",
+	Long: `Roll back a project to the state before the specified step ran.
+
+This command resets the project's main branch to the commit the step started from,
+restores the task database snapshot taken when the step was leased, and marks the
+step and every later step as inactive. It refuses to run while any step is still
+running.
+
+Examples:
+  laforge step rollback my-project S5
+  laforge step rollback my-project 5 --yes`,
+	Args: cobra.ExactArgs(2),
+	RunE: runStepRollback,
+}
+
 func init() {
 	// Add flags for init command
 	initCmd.Flags().String("name", "", "project name")
@@ -150,10 +194,14 @@ func init() {
 	initCmd.Flags().String("agent-image", "", "default Docker image for the agent container")
 	initCmd.Flags().String("agent-config-file", "", "path to custom agents.yml configuration file")
 	initCmd.Flags().String("main-branch", "main", "main branch name for automerging step commits")
+	initCmd.Flags().String("merge-strategy", string(git.DefaultMergeStrategy), "how step branches are merged into the main branch: merge, squash, rebase, ff-only or none")
 
 	// Add flags for step command
 	stepCmd.Flags().String("agent-config", "", "agent configuration name from agents.yml (overrides --agent-image)")
 	stepCmd.Flags().Duration("timeout", 0, "timeout for step execution (0 means no timeout)")
+
+	// Add flags for step rollback command
+	stepRollbackCmd.Flags().BoolP("yes", "y", false, "skip the confirmation prompt")
 }
 
 var (
@@ -161,7 +209,44 @@ var (
 	InvalidCredentialsError = nativeerrors.New("invalid credentials")
 )
 
-func sendRequestAttempt(url, method string, body interface{}, response interface{}) error {
+// APIError is an error response returned by laserve
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d. Message: %s", e.StatusCode, e.Body)
+}
+
+// newAPIError parses an error response body in the standard laserve error format
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Body: string(body)}
+	var errorResponse struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errorResponse); err == nil {
+		apiErr.Code = errorResponse.Error.Code
+		apiErr.Message = errorResponse.Error.Message
+	}
+	return apiErr
+}
+
+// apiErrorCode returns the laserve error code of err, or "" if err is not an API error
+func apiErrorCode(err error) string {
+	var apiErr *APIError
+	if nativeerrors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+func sendRequestAttempt(url, method, token string, body interface{}, response interface{}) error {
 	client := &http.Client{}
 	var reqBody io.Reader
 	if body != nil {
@@ -176,8 +261,8 @@ func sendRequestAttempt(url, method string, body interface{}, response interface
 	if err != nil {
 		return err
 	}
-	if apiToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiToken))
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 	}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -193,7 +278,7 @@ func sendRequestAttempt(url, method string, body interface{}, response interface
 		if err != nil {
 			return err
 		}
-		return fmt.Errorf("unexpected status code: %d. Message: %s", resp.StatusCode, string(bodyText))
+		return newAPIError(resp.StatusCode, bodyText)
 	}
 	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
 		return err
@@ -210,21 +295,41 @@ func sendRequest(project, endpoint, method string, body interface{}, response in
 
 	var err error
 	for _ = range 3 {
-		err = sendRequestAttempt(fmt.Sprintf("%s%s", urlPath, endpoint), method, body, response)
+		token := currentAPIToken()
+		err = sendRequestAttempt(fmt.Sprintf("%s%s", urlPath, endpoint), method, token, body, response)
 		if err == nil {
 			return nil
 		}
 		if err == InvalidCredentialsError || err == MissingCredentialsError {
-			log.Printf("Logging in...")
+			creds, err := loadCredentials()
+			if err != nil {
+				return err
+			}
+
+			if creds.APIKey != "" {
+				if token == creds.APIKey {
+					return fmt.Errorf("%w: laserve rejected the API key", InvalidCredentialsError)
+				}
+				setAPIToken(creds.APIKey)
+				err = nativeerrors.New("Failed after three login attempts")
+				continue
+			}
+
+			log.Printf("Logging in as %s...", creds.Username)
 			var loginResponse struct {
-				Token  string `json:"token"`
-				UserID string `json:"user_id"`
+				Data struct {
+					Token  string `json:"token"`
+					UserID string `json:"user_id"`
+				} `json:"data"`
+			}
+			err = sendRequestAttempt(fmt.Sprintf("%s/public/login", urlPrefix), "POST", token, creds, &loginResponse)
+			if err == InvalidCredentialsError {
+				return fmt.Errorf("%w: laserve rejected the login for user '%s'", InvalidCredentialsError, creds.Username)
 			}
-			err = sendRequestAttempt(fmt.Sprintf("%s/public/login", urlPrefix), "POST", nil, &loginResponse)
 			if err != nil {
 				return err
 			}
-			apiToken = loginResponse.Token
+			setAPIToken(loginResponse.Data.Token)
 			err = nativeerrors.New("Failed after three login attempts")
 		} else {
 			return err
@@ -248,6 +353,12 @@ func runInit(cmd *cobra.Command, args []string) error {
 	agentImage, _ := cmd.Flags().GetString("agent-image")
 	agentConfigFile, _ := cmd.Flags().GetString("agent-config-file")
 	mainBranch, _ := cmd.Flags().GetString("main-branch")
+	mergeStrategy, _ := cmd.Flags().GetString("merge-strategy")
+
+	// Validate the merge strategy before anything is created
+	if _, err := git.ParseMergeStrategy(mergeStrategy); err != nil {
+		return errors.NewInvalidInputError(err.Error())
+	}
 
 	// Use project ID as name if name is not provided
 	if name == "" {
@@ -265,6 +376,11 @@ func runInit(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return errors.Wrap(errors.ErrProjectAlreadyExists, err, "failed to create project")
 	}
+	if git.MergeStrategy(mergeStrategy) != project.MergeStrategy {
+		if project, err = projects.UpdateProjectMergeStrategy(projectID, mergeStrategy); err != nil {
+			return err
+		}
+	}
 
 	// Handle custom agent configuration if provided
 	if agentConfigFile != "" {
@@ -292,390 +408,129 @@ func runInit(cmd *cobra.Command, args []string) error {
 	if project.Description != "" {
 		fmt.Printf("Description: %s\n", project.Description)
 	}
+	fmt.Printf("Merge strategy: %s\n", project.MergeStrategy)
 	fmt.Printf("Location: %s\n", projectDir)
 
 	return nil
 }
 
-// runStep is the handler for the step command
-func runStep(cmd *cobra.Command, args []string) error {
-	projectID := args[0]
+// stepOptions holds the settings used to execute a single step
+type stepOptions struct {
+	AgentConfigName string
+	Timeout         time.Duration
+	Verbose         bool
+	Quiet           bool
+
+	// Conflict makes the step resolve the merge conflict of an earlier step
+	// instead of working on the next task
+	Conflict *mergeConflict
+
+	// TaskID assigns the step a task instead of letting the agent take the next
+	// one; ParallelGroup and MergeQueue are shared by the steps of a parallel run
+	TaskID        int
+	ParallelGroup string
+	MergeQueue    *mergeQueue
+}
 
-	// Validate project ID
-	if projectID == "" {
-		return errors.NewInvalidInputError("project ID cannot be empty")
-	}
+// stepResult summarizes the outcome of an executed step
+type stepResult struct {
+	StepID        int
+	Duration      time.Duration
+	ExitCode      int
+	LeasedTaskIDs []int
 
-	// Get flags
+	// MergeConflict is set when the step's branch conflicted with the main
+	// branch and a step should be run to resolve it
+	MergeConflict *mergeConflict
+}
+
+// getStepOptions reads the step execution flags shared by the step and run commands
+func getStepOptions(cmd *cobra.Command) stepOptions {
 	agentConfigName, _ := cmd.Flags().GetString("agent-config")
 	timeout, _ := cmd.Flags().GetDuration("timeout")
 	verbose, _ := cmd.Flags().GetBool("verbose")
 	quiet, _ := cmd.Flags().GetBool("quiet")
 
-	sourceDir, _ := os.Getwd()
-
-	// Check if project exists
-	exists, err := projects.ProjectExists(projectID)
-	if err != nil {
-		return errors.Wrap(errors.ErrUnknown, err, "failed to check if project exists")
-	}
-	if !exists {
-		return errors.NewProjectNotFoundError(projectID)
-	}
-
-	// Load project configuration to get main branch
-	project, err := projects.LoadProject(projectID)
-	if err != nil {
-		return errors.Wrap(errors.ErrUnknown, err, "failed to load project configuration")
-	}
-
-	// Load agents configuration from file
-	agentsConfig, err := projects.LoadAgentsConfig(projectID)
-	if err != nil {
-		return errors.Wrap(errors.ErrUnknown, err, "failed to load agents configuration")
-	}
-
-	var agentConfig *projects.AgentConfig
-	if agentConfigName != "" {
-		// Get the specified agent configuration
-		agent, exists := agentsConfig.GetAgent(agentConfigName)
-		if !exists {
-			return errors.NewInvalidInputError(fmt.Sprintf("agent configuration '%s' not found", agentConfigName))
-		}
-		agentConfig = &agent
-	} else {
-		// Get the specified agent configuration
-		agent, exists := agentsConfig.GetDefaultAgent()
-		if !exists {
-			return errors.NewInvalidInputError(fmt.Sprintf("agent configuration '%s' not found", agentConfigName))
-		}
-		agentConfig = &agent
+	return stepOptions{
+		AgentConfigName: agentConfigName,
+		Timeout:         timeout,
+		Verbose:         verbose,
+		Quiet:           quiet,
 	}
+}
 
-	// Override timeout if provided via flag
-	if timeout > 0 {
-		agentConfig.Runtime.Timeout = timeout.String()
-	}
+// runStep is the handler for the step command
+func runStep(cmd *cobra.Command, args []string) error {
+	projectID := args[0]
 
-	// Set up logging
-	logger := logging.GetLogger()
-	if verbose {
-		// Set debug level for verbose output
-		logger = logging.NewLogger(logging.DEBUG, "")
-	} else if quiet {
-		// Set warn level for quiet output
-		logger = logging.NewLogger(logging.WARN, "")
+	// Validate project ID
+	if projectID == "" {
+		return errors.NewInvalidInputError("project ID cannot be empty")
 	}
 
-	// Get current commit SHA before step execution
-	commitSHABefore, err := git.GetCurrentCommitSHA(sourceDir)
-	if err != nil {
-		return errors.Wrap(errors.ErrUnknown, err, "failed to get current commit SHA")
-	}
+	// Stop the agent and finalize the step if laforge is interrupted
+	ctx, stopInterrupts := withInterrupts(cmd.Context())
+	defer stopInterrupts()
 
-	var leaseResponse steps.LeaseStepResponse
-	err = sendRequest(projectID, "/steps/lease", "POST", &steps.LeaseStepRequest{
-		CommitSHABefore: commitSHABefore,
-		AgentConfigName: agentConfig.Name,
-	}, &leaseResponse)
-	if err != nil {
-		return errors.Wrap(errors.ErrUnknown, err, "failed to lease step")
+	opts := getStepOptions(cmd)
+	result, err := executeStep(ctx, projectID, opts)
+	if err == nil && result.MergeConflict != nil {
+		_, err = executeConflictResolution(ctx, projectID, opts, result.MergeConflict)
 	}
+	return err
+}
 
-	stepID := leaseResponse.StepID
-	dbStepID := fmt.Sprintf("S%d", stepID)
-	stepLogger := logging.NewStepLogger(logger, projectID, dbStepID)
-
-	// Log step start
-	stepLogger.LogStepStart(projectID)
-	stepStartTime := time.Now()
-
-	// Declare worktree variable for use in defer
-	var worktree *git.Worktree
-
-	defer func() {
-		// Update step record with completion data
-		exitCode := int(0)
-		if err != nil {
-			exitCode = 1
-		}
-
-		// Get commit SHA after step execution (if there were changes and worktree exists)
-		commitSHAAfter := commitSHABefore
-		if worktree != nil {
-			if hasChanges, _ := hasGitChanges(worktree.Path); hasChanges {
-				if sha, err := git.GetCurrentCommitSHA(worktree.Path); err == nil {
-					commitSHAAfter = sha
-				}
-			}
-		}
-
-		var successResponse struct {
-			Status string `json:"status"`
-		}
-		err = sendRequest(projectID, "/steps/finalize", "POST", &steps.FinalizeStepRequest{
-			StepID:         stepID,
-			CommitSHAAfter: commitSHAAfter,
-			ExitCode:       exitCode,
-		}, &successResponse)
-		if err != nil {
-			stepLogger.LogError("database", "Failed to update step record", err, map[string]interface{}{
-				"step_id": stepID,
-			})
-		}
-
-		// Log step completion
-		stepLogger.LogStepEnd(err == nil, exitCode)
-	}()
+// newContainerClient creates the client used to run agent containers. Tests
+// replace it to run steps against a fake runtime.
+var newContainerClient = docker.NewClient
 
-	// Step 1: Create temporary git worktree
-	stepLogger.LogStepPhase("worktree", "Creating temporary git worktree")
-	worktree, err = git.CreateTempWorktreeWithStep(sourceDir, stepID)
+// recordStepCommit returns the commit checked out in a step's worktree and the
+// changes it makes on top of base, and keeps refs to both so the step's diff
+// survives the deletion of its branch. If nothing was committed on top of base,
+// or the commit cannot be read, base and no changes are returned.
+func recordStepCommit(stepLogger *logging.StepLogger, worktreeDir string, stepID int, base string) (string, *steps.DiffStats) {
+	sha, err := git.GetCurrentCommitSHA(worktreeDir)
 	if err != nil {
-		stepLogger.LogError("git", "Failed to create temporary worktree", err, map[string]interface{}{
-			"source_dir": sourceDir,
+		stepLogger.LogWarning("git", "Failed to get step commit SHA", map[string]interface{}{
+			"error": err.Error(),
 		})
-		return errors.Wrap(errors.ErrUnknown, err, "failed to create temporary worktree")
-	}
-	stepLogger.LogWorktreeCreation(worktree.Path, fmt.Sprintf("step-S%d", stepID))
-	worktreeRemoved := false
-	defer func() {
-		// Clean up worktree only if it hasn't been removed yet
-		if !worktreeRemoved {
-			stepLogger.LogWorktreeCleanup(worktree.Path)
-			if cleanupErr := git.RemoveWorktree(worktree); cleanupErr != nil {
-				stepLogger.LogWarning("git", "Failed to remove worktree", map[string]interface{}{
-					"error": cleanupErr.Error(),
-				})
-			}
-		}
-	}()
-
-	// Step 2: Create Docker client
-	stepLogger.LogStepPhase("docker", "Initializing Docker client")
-	dockerClient, err := docker.NewClient()
-	if err != nil {
-		stepLogger.LogError("docker", "Failed to create Docker client", err, nil)
-		return errors.Wrap(errors.ErrUnknown, err, "failed to create Docker client")
+		return base, nil
 	}
-	stepLogger.LogDockerClientInit()
-	defer dockerClient.Close()
-
-	// Step 3: Create log file for streaming container output
-	stepLogger.LogStepPhase("logs", "Setting up log file")
-	projectDir, err := projects.GetProjectDir(projectID)
-	if err != nil {
-		stepLogger.LogError("logs", "Failed to get project directory", err, nil)
-		return errors.Wrap(errors.ErrUnknown, err, "failed to get project directory")
+	if sha == base {
+		return base, nil
 	}
 
-	// Create logs directory if it doesn't exist
-	logsDir := filepath.Join(projectDir, "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		stepLogger.LogError("logs", "Failed to create logs directory", err, map[string]interface{}{
-			"logs_dir": logsDir,
+	if err := git.KeepStepCommit(worktreeDir, stepID, base, sha); err != nil {
+		stepLogger.LogWarning("git", "Failed to keep refs to the step commit", map[string]interface{}{
+			"error": err.Error(),
 		})
-		return errors.Wrap(errors.ErrUnknown, err, "failed to create logs directory")
 	}
 
-	// Create log file with step ID and timestamp
-	logFileName := fmt.Sprintf("step-%s-%s.log", dbStepID, time.Now().Format("20060102-150405"))
-	logFilePath := filepath.Join(logsDir, logFileName)
-	logFile, err := os.Create(logFilePath)
+	stats, err := git.GetDiffStats(worktreeDir, base, sha)
 	if err != nil {
-		stepLogger.LogError("logs", "Failed to create log file", err, map[string]interface{}{
-			"log_file_path": logFilePath,
+		stepLogger.LogWarning("git", "Failed to compute step diff stats", map[string]interface{}{
+			"error": err.Error(),
 		})
-		return errors.Wrap(errors.ErrUnknown, err, "failed to create log file")
 	}
-	defer logFile.Close()
-
-	logger.Info("logs", "Log file created", map[string]interface{}{
-		"log_file_path": logFilePath,
-		"project_id":    projectID,
-		"step_id":       stepID,
-	})
-
-	// Create multi-writer to stream to both stdout and file
-	multiWriter := io.MultiWriter(os.Stdout, logFile)
-
-	// Wrap with formatting writer to convert JSON output to markdown
-	formattedWriter := docker.NewFormattingWriter(multiWriter)
-
-	// Step 4: Launch agent container
-	stepLogger.LogStepPhase("container", "Launching agent container")
-	containerMetrics := &docker.ContainerMetrics{}
-
-	var exitCode int64
-	var logs string
-
-	// Use agent configuration from agents.yml
-	stepLogger.LogContainerLaunch(agentConfig.Image, fmt.Sprintf("laforge-agent-%s-%s-%d", projectID, agentConfig.Name, time.Now().Unix()), map[string]interface{}{
-		"work_dir":     worktree.Path,
-		"agent_config": agentConfigName,
-		"timeout":      agentConfig.Runtime.Timeout,
-		"log_file":     logFilePath,
-	})
+	return sha, stats
+}
 
-	// Run container using AgentConfig with streaming logs (formatted as markdown)
-	exitCode, logs, err = dockerClient.RunAgentContainerFromConfigWithStreamingLogs(agentConfig, worktree.Path, projectID, leaseResponse.Token, formattedWriter, containerMetrics)
-	if err != nil {
-		stepLogger.LogError("docker", "Failed to run agent container", err, map[string]interface{}{
-			"exit_code": exitCode,
-		})
-		return errors.Wrap(errors.ErrUnknown, err, "failed to run agent container")
+// writeStepTranscript parses the agent's raw output into a transcript and stores
+// it beside the step log, with secret values redacted. Nothing is written for
+// agents whose output is not stream-json.
+func writeStepTranscript(logFilePath string, logs string, secretValues []string) error {
+	entries := transcript.Parse(logging.NewRedactor(secretValues).Redact(logs))
+	if len(entries) == 0 {
+		return nil
 	}
 
-	stepLogger.LogContainerCompletion(exitCode, logs)
-
-	// Log resource usage
-	stepLogger.LogResourceUsage("container", map[string]interface{}{
-		"duration_ms":   containerMetrics.EndTime.Sub(containerMetrics.StartTime).Milliseconds(),
-		"exit_code":     containerMetrics.ExitCode,
-		"log_size":      containerMetrics.LogSize,
-		"error_count":   containerMetrics.ErrorCount,
-		"warning_count": containerMetrics.WarningCount,
-	})
-
-	// Step 5: Check if there are changes to commit
-	stepLogger.LogStepPhase("git", "Checking for changes to commit")
-	hasChanges, err := hasGitChanges(worktree.Path)
+	file, err := os.Create(projects.StepTranscriptPath(logFilePath))
 	if err != nil {
-		stepLogger.LogError("git", "Failed to check for git changes", err, map[string]interface{}{
-			"repo_path": worktree.Path,
-		})
-		return errors.Wrap(errors.ErrUnknown, err, "failed to check for git changes")
+		return fmt.Errorf("failed to create transcript file: %w", err)
 	}
+	defer file.Close()
 
-	stepLogger.LogGitChanges(hasChanges, worktree.Path)
-
-	if hasChanges {
-		// Check if there are actual changes besides COMMIT.md
-		hasActualChanges, err := hasGitChangesExcludingCommitMD(worktree.Path)
-		if err != nil {
-			stepLogger.LogWarning("git", "Failed to check for git changes excluding COMMIT.md", map[string]interface{}{
-				"error": err.Error(),
-			})
-			// Continue anyway - try to commit
-			hasActualChanges = true
-		}
-
-		if hasActualChanges {
-			commitMessage := fmt.Sprintf("LaForge step %s - Automated changes", dbStepID)
-
-			// Check for COMMIT.md and use its contents if it exists
-			if customMessage, err := getCommitMessageFromFile(worktree.Path); err != nil {
-				stepLogger.LogWarning("git", "Failed to read COMMIT.md", map[string]interface{}{
-					"error": err.Error(),
-				})
-			} else if customMessage != "" {
-				commitMessage = customMessage
-			}
-
-			stepLogger.LogGitCommit(commitMessage, worktree.Path)
-			if err := commitChanges(worktree.Path, commitMessage, dbStepID); err != nil {
-				stepLogger.LogError("git", "Failed to commit changes", err, map[string]interface{}{
-					"repo_path": worktree.Path,
-				})
-				return errors.Wrap(errors.ErrUnknown, err, "failed to commit changes")
-			}
-			logger.Info("git", "Changes committed successfully", map[string]interface{}{
-				"project_id": projectID,
-				"step_id":    stepID,
-			})
-
-		} else {
-			logger.Info("git", "No changes to commit (only COMMIT.md was modified)", map[string]interface{}{
-				"project_id": projectID,
-				"step_id":    stepID,
-			})
-		}
-	} else {
-		logger.Info("git", "No changes to commit", map[string]interface{}{
-			"project_id": projectID,
-			"step_id":    stepID,
-		})
-	}
-
-	// Delete the COMMIT.md file if it exists
-	commitMDPath := filepath.Join(worktree.Path, "COMMIT.md")
-	if err := os.Remove(commitMDPath); err != nil {
-		stepLogger.LogWarning("git", "Failed to delete COMMIT.md", map[string]interface{}{
-			"error": err.Error(),
-		})
-	}
-
-	// Step 6: Automerge step branch into main branch (only if step completed successfully)
-	if exitCode == 0 && hasChanges {
-		stepLogger.LogStepPhase("git", fmt.Sprintf("Automerging step branch into %s branch", project.MainBranch))
-
-		stepBranch := fmt.Sprintf("step-S%d", stepID)
-		mergeMessage := fmt.Sprintf("Automerge %s into %s", stepBranch, project.MainBranch)
-
-		if mergeErr := git.MergeBranch(sourceDir, stepBranch, project.MainBranch, mergeMessage); mergeErr != nil {
-			// Check if it's a merge conflict
-			if errors.IsErrorType(mergeErr, errors.ErrGitMergeConflict) {
-				// Log merge conflict but don't fail the step - keep branch for manual resolution
-				stepLogger.LogWarning("git", "Merge conflict detected, keeping step branch for manual resolution", map[string]interface{}{
-					"step_branch": stepBranch,
-					"error":       mergeErr.Error(),
-				})
-				logger.Info("git", fmt.Sprintf("Merge conflict in %s, branch preserved for manual resolution", stepBranch), map[string]interface{}{
-					"project_id":  projectID,
-					"step_id":     stepID,
-					"step_branch": stepBranch,
-					"error_type":  "merge_conflict",
-				})
-			} else {
-				// Log other merge failures but don't fail the step - keep branch for manual resolution
-				stepLogger.LogWarning("git", "Automerge failed, keeping step branch for manual resolution", map[string]interface{}{
-					"step_branch": stepBranch,
-					"error":       mergeErr.Error(),
-				})
-				logger.Info("git", fmt.Sprintf("Automerge failed for %s, branch preserved for manual resolution", stepBranch), map[string]interface{}{
-					"project_id":  projectID,
-					"step_id":     stepID,
-					"step_branch": stepBranch,
-					"error":       mergeErr.Error(),
-				})
-			}
-		} else {
-			// Merge successful, clean up worktree first, then delete step branch
-			stepLogger.LogStepPhase("git", "Merge successful, cleaning up worktree and step branch")
-
-			// Remove worktree before attempting branch deletion
-			stepLogger.LogWorktreeCleanup(worktree.Path)
-			if cleanupErr := git.RemoveWorktree(worktree); cleanupErr != nil {
-				stepLogger.LogWarning("git", "Failed to remove worktree after successful merge", map[string]interface{}{
-					"error": cleanupErr.Error(),
-				})
-			} else {
-				worktreeRemoved = true // Mark worktree as removed to prevent double cleanup in defer
-			}
-
-			// Now delete the step branch
-			if deleteErr := git.DeleteBranch(sourceDir, stepBranch); deleteErr != nil {
-				stepLogger.LogWarning("git", "Failed to delete step branch after successful merge", map[string]interface{}{
-					"step_branch": stepBranch,
-					"error":       deleteErr.Error(),
-				})
-			} else {
-				logger.Info("git", fmt.Sprintf("Successfully automerged %s into %s and deleted step branch", stepBranch, project.MainBranch), map[string]interface{}{
-					"project_id":  projectID,
-					"step_id":     stepID,
-					"step_branch": stepBranch,
-				})
-			}
-		}
-	}
-
-	logger.Info("step", fmt.Sprintf("LaForge step completed successfully for project '%s'", projectID), map[string]interface{}{
-		"project_id": projectID,
-		"step_id":    stepID,
-		"duration":   time.Since(stepStartTime).String(),
-	})
-
-	return nil
+	return transcript.Write(file, entries)
 }
 
 // getCommitMessageFromFile checks for COMMIT.md in the repository and returns its contents
@@ -801,17 +656,12 @@ func runSteps(cmd *cobra.Command, args []string) error {
 
 	// Print header
 	fmt.Printf("Steps for project '%s':\n", projectID)
-	fmt.Printf("%-8s %-10s %-12s %-10s %-20s %-20s\n", "STEP ID", "STATUS", "DURATION", "EXIT CODE", "STARTED", "COMMIT BEFORE")
-	fmt.Printf("%-8s %-10s %-12s %-10s %-20s %-20s\n", "--------", "----------", "------------", "----------", "--------------------", "--------------------")
+	fmt.Printf("%-8s %-11s %-12s %-11s %-20s %-20s %-20s\n", "STEP ID", "STATUS", "DURATION", "EXIT CODE", "CHANGES", "STARTED", "COMMIT BEFORE")
+	fmt.Printf("%-8s %-11s %-12s %-11s %-20s %-20s %-20s\n", "--------", "-----------", "------------", "-----------", "--------------------", "--------------------", "--------------------")
 
 	// Print each step
 	for _, step := range steps {
-		status := "COMPLETED"
-		if step.Active && step.EndTime == nil {
-			status = "RUNNING"
-		} else if !step.Active {
-			status = "ROLLED BACK"
-		}
+		status := stepStatus(step)
 
 		duration := "N/A"
 		if step.DurationMs != nil && *step.DurationMs > 0 {
@@ -819,20 +669,57 @@ func runSteps(cmd *cobra.Command, args []string) error {
 		}
 
 		exitCode := "N/A"
-		if step.ExitCode != nil {
+		if step.IsCancelled() {
+			exitCode = "cancelled"
+		} else if step.IsInterrupted() {
+			exitCode = "interrupted"
+		} else if step.ExitCode != nil {
 			exitCode = fmt.Sprintf("%d", *step.ExitCode)
 		}
 
+		changes := "N/A"
+		if step.DiffStats.FilesChanged > 0 {
+			changes = formatDiffStats(step.DiffStats)
+		}
+
 		started := step.StartTime.Format("2006-01-02 15:04:05")
 		commitBefore := step.CommitSHABefore[:8] // Show first 8 characters of SHA
 
-		fmt.Printf("%-8s %-10s %-12s %-10s %-20s %-20s\n",
-			fmt.Sprintf("S%d", step.ID), status, duration, exitCode, started, commitBefore)
+		fmt.Printf("%-8s %-11s %-12s %-11s %-20s %-20s %-20s\n",
+			fmt.Sprintf("S%d", step.ID), status, duration, exitCode, changes, started, commitBefore)
 	}
 
 	return nil
 }
 
+// formatDiffStats summarizes a step's changes as file count, insertions and
+// deletions, e.g. "3 files +120 -4"
+func formatDiffStats(stats steps.DiffStats) string {
+	files := "files"
+	if stats.FilesChanged == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("%d %s +%d -%d", stats.FilesChanged, files, stats.Insertions, stats.Deletions)
+}
+
+// stepStatus returns the status of a step as shown by the steps commands
+func stepStatus(step *steps.Step) string {
+	switch {
+	case !step.Active:
+		return "ROLLED BACK"
+	case step.EndTime == nil && step.CancelRequestedAt != nil:
+		return "CANCELLING"
+	case step.EndTime == nil:
+		return "RUNNING"
+	case step.IsCancelled():
+		return "CANCELLED"
+	case step.IsInterrupted():
+		return "INTERRUPTED"
+	default:
+		return "COMPLETED"
+	}
+}
+
 // runStepInfo is the handler for the step info command
 func runStepInfo(cmd *cobra.Command, args []string) error {
 	projectID := args[0]
@@ -844,12 +731,9 @@ func runStepInfo(cmd *cobra.Command, args []string) error {
 	}
 
 	// Parse step ID
-	var stepID int
-	if _, err := fmt.Sscanf(stepIDStr, "S%d", &stepID); err != nil {
-		// Try parsing as plain integer
-		if _, err := fmt.Sscanf(stepIDStr, "%d", &stepID); err != nil {
-			return errors.NewInvalidInputError(fmt.Sprintf("invalid step ID format: %s. Use format like 'S1' or '1'", stepIDStr))
-		}
+	stepID, err := parseStepID(stepIDStr)
+	if err != nil {
+		return err
 	}
 
 	// Check if project exists
@@ -883,13 +767,7 @@ func runStepInfo(cmd *cobra.Command, args []string) error {
 	fmt.Printf("%s\n", strings.Repeat("=", 55))
 
 	// Basic information
-	status := "COMPLETED"
-	if step.Active && step.EndTime == nil {
-		status = "RUNNING"
-	} else if !step.Active {
-		status = "ROLLED BACK"
-	}
-	fmt.Printf("Status: %s\n", status)
+	fmt.Printf("Status: %s\n", stepStatus(step))
 
 	// Timing information
 	fmt.Printf("Started: %s\n", step.StartTime.Format("2006-01-02 15:04:05"))
@@ -901,21 +779,51 @@ func runStepInfo(cmd *cobra.Command, args []string) error {
 	}
 
 	// Exit information
-	if step.ExitCode != nil {
+	if step.IsCancelled() {
+		fmt.Printf("Exit Code: cancelled\n")
+	} else if step.IsInterrupted() {
+		fmt.Printf("Exit Code: interrupted\n")
+	} else if step.ExitCode != nil {
 		fmt.Printf("Exit Code: %d\n", *step.ExitCode)
 	}
+	if step.CancelRequestedAt != nil {
+		fmt.Printf("Cancel Requested: %s\n", step.CancelRequestedAt.Format("2006-01-02 15:04:05"))
+	}
 
 	// Commit information
 	fmt.Printf("Commit SHA (Before): %s\n", step.CommitSHABefore)
 	if step.CommitSHAAfter != "" {
 		fmt.Printf("Commit SHA (After): %s\n", step.CommitSHAAfter)
 	}
+	if step.MergeStrategy != "" {
+		if step.MergeCommitSHA != "" {
+			fmt.Printf("Merged: %s (%s)\n", step.MergeCommitSHA, step.MergeStrategy)
+		} else {
+			fmt.Printf("Merged: no (%s)\n", step.MergeStrategy)
+		}
+	}
+	if step.PullRequestURL != "" {
+		fmt.Printf("Pull Request: %s\n", step.PullRequestURL)
+	}
 
 	// Parent step
 	if step.ParentStepID != nil {
 		fmt.Printf("Parent Step: S%d\n", *step.ParentStepID)
 	}
 
+	// Steps that ran concurrently with this one in a parallel run
+	siblingIDs, err := stepDB.GetSiblingStepIDs(step)
+	if err != nil {
+		return errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to get sibling steps")
+	}
+	if len(siblingIDs) > 0 {
+		siblings := make([]string, len(siblingIDs))
+		for i, id := range siblingIDs {
+			siblings[i] = fmt.Sprintf("S%d", id)
+		}
+		fmt.Printf("Parallel With: %s\n", strings.Join(siblings, ", "))
+	}
+
 	// Agent configuration
 	fmt.Printf("\nAgent Configuration: %s\n", step.AgentConfigName)
 
@@ -924,14 +832,132 @@ func runStepInfo(cmd *cobra.Command, args []string) error {
 		fmt.Printf("\nToken Usage:\n")
 		fmt.Printf("  Prompt Tokens: %d\n", step.TokenUsage.PromptTokens)
 		fmt.Printf("  Completion Tokens: %d\n", step.TokenUsage.CompletionTokens)
+		if step.TokenUsage.CacheReadTokens > 0 || step.TokenUsage.CacheWriteTokens > 0 {
+			fmt.Printf("  Cache Read Tokens: %d\n", step.TokenUsage.CacheReadTokens)
+			fmt.Printf("  Cache Write Tokens: %d\n", step.TokenUsage.CacheWriteTokens)
+		}
 		fmt.Printf("  Total Tokens: %d\n", step.TokenUsage.TotalTokens)
 		if step.TokenUsage.Cost > 0 {
 			fmt.Printf("  Estimated Cost: $%.4f\n", step.TokenUsage.Cost)
 		}
 	}
 
+	// Changes committed by the step
+	if step.DiffStats.FilesChanged > 0 {
+		fmt.Printf("\nChanges: %s\n", formatDiffStats(step.DiffStats))
+		for _, file := range step.DiffStats.Files {
+			path := file.Path
+			if file.OldPath != "" {
+				path = fmt.Sprintf("%s -> %s", file.OldPath, file.Path)
+			}
+			if file.Binary {
+				fmt.Printf("  %-12s %-12s %s\n", file.Status, "binary", path)
+			} else {
+				fmt.Printf("  %-12s %-12s %s\n", file.Status, fmt.Sprintf("+%d -%d", file.Insertions, file.Deletions), path)
+			}
+		}
+	}
+
+	// Resource usage
+	if step.ResourceUsage.Samples > 0 {
+		fmt.Printf("\nResource Usage (%d samples):\n", step.ResourceUsage.Samples)
+		fmt.Printf("  Peak Memory: %s\n", docker.FormatBytes(step.ResourceUsage.PeakMemoryBytes))
+		fmt.Printf("  Average Memory: %s\n", docker.FormatBytes(step.ResourceUsage.AvgMemoryBytes))
+		fmt.Printf("  Peak CPU: %.1f%%\n", step.ResourceUsage.PeakCPUPercent)
+		fmt.Printf("  Average CPU: %.1f%%\n", step.ResourceUsage.AvgCPUPercent)
+	}
+
 	// Creation information
 	fmt.Printf("\nCreated: %s\n", step.CreatedAt.Format("2006-01-02 15:04:05"))
 
 	return nil
 }
+
+// parseStepID parses a step ID given either as "S5" or "5"
+func parseStepID(stepIDStr string) (int, error) {
+	var stepID int
+	if _, err := fmt.Sscanf(stepIDStr, "S%d", &stepID); err != nil {
+		// Try parsing as plain integer
+		if _, err := fmt.Sscanf(stepIDStr, "%d", &stepID); err != nil {
+			return 0, errors.NewInvalidInputError(fmt.Sprintf("invalid step ID format: %s. Use format like 'S1' or '1'", stepIDStr))
+		}
+	}
+	return stepID, nil
+}
+
+// runStepRollback is the handler for the step rollback command
+func runStepRollback(cmd *cobra.Command, args []string) error {
+	projectID := args[0]
+
+	// Validate project ID
+	if projectID == "" {
+		return errors.NewInvalidInputError("project ID cannot be empty")
+	}
+
+	stepID, err := parseStepID(args[1])
+	if err != nil {
+		return err
+	}
+
+	skipConfirm, _ := cmd.Flags().GetBool("yes")
+
+	// Check if project exists
+	exists, err := projects.ProjectExists(projectID)
+	if err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to check if project exists")
+	}
+	if !exists {
+		return errors.NewProjectNotFoundError(projectID)
+	}
+
+	plan, err := projects.PlanRollback(projectID, stepID)
+	if err != nil {
+		return err
+	}
+
+	// Describe what is about to happen
+	fmt.Printf("Rolling back project '%s' to the state before S%d\n", projectID, stepID)
+	fmt.Printf("  Repository: %s (branch %s)\n", plan.Project.RepositoryPath, plan.Project.MainBranch)
+	fmt.Printf("  Reset to commit: %s\n", plan.ResetCommitSHA)
+	if plan.HasTaskSnapshot {
+		fmt.Printf("  Task database: restore snapshot from S%d\n", stepID)
+	} else {
+		fmt.Printf("  Task database: no snapshot for S%d, tasks will not be restored\n", stepID)
+	}
+	stepIDs := make([]string, len(plan.StepsToDeactivate))
+	for i, step := range plan.StepsToDeactivate {
+		stepIDs[i] = fmt.Sprintf("S%d", step.ID)
+	}
+	fmt.Printf("  Steps to deactivate: %s\n", strings.Join(stepIDs, ", "))
+
+	if !skipConfirm {
+		fmt.Printf("\nThis discards all commits on %s after %s. Continue? [y/N] ", plan.Project.MainBranch, shortSHA(plan.ResetCommitSHA))
+		reader := bufio.NewReader(os.Stdin)
+		answer, _ := reader.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Println("Rollback cancelled")
+			return nil
+		}
+	}
+
+	result, err := projects.ExecuteRollback(plan)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rolled back to %s, deactivated %d step(s)\n", shortSHA(result.ResetCommitSHA), len(result.DeactivatedStepIDs))
+	if result.TaskDatabaseRestored {
+		fmt.Printf("Task database restored from S%d snapshot\n", result.TargetStepID)
+	}
+
+	return nil
+}
+
+// shortSHA returns the first 8 characters of a commit SHA
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// mergeStrategyCmd represents the merge-strategy command
+var mergeStrategyCmd = &cobra.Command{
+	Use:   "merge-strategy [project-id] [strategy]",
+	Short: "Show or set how steps are merged into the main branch",
+	Long: `Show or set how the branch of a successful step is merged into the project's
+main branch.
+
+Strategies:
+  merge    merge the step branch, fast-forwarding when possible (the default)
+  squash   squash the step's commits into one commit with the agent's message
+  rebase   replay the step's commits onto the main branch
+  ff-only  only fast-forward the main branch, leaving diverged steps unmerged
+  none     never merge, leaving the step branch for a human to review
+
+Step branches that cannot be merged cleanly are handed to a follow-up step that
+resolves the conflicts, unless conflict_resolution is disabled in agents.yml, in
+which case they are kept for manual resolution.
+
+Examples:
+  laforge merge-strategy my-project
+  laforge merge-strategy my-project squash`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runMergeStrategy,
+}
+
+func init() {
+	rootCmd.AddCommand(mergeStrategyCmd)
+}
+
+func runMergeStrategy(cmd *cobra.Command, args []string) error {
+	projectID := args[0]
+
+	// Validate project ID
+	if projectID == "" {
+		return errors.NewInvalidInputError("project ID cannot be empty")
+	}
+
+	if len(args) == 1 {
+		project, err := projects.LoadProject(projectID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Merge strategy for project '%s': %s\n", projectID, project.MergeStrategy)
+		return nil
+	}
+
+	project, err := projects.UpdateProjectMergeStrategy(projectID, args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Set merge strategy for project '%s' to %s\n", projectID, project.MergeStrategy)
+	return nil
+}
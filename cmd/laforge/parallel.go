@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/git"
+	"github.com/tomyedwab/laforge/lib/tasks"
+)
+
+// taskPromptTemplate points the agent of a parallel step at the task it was
+// assigned, since the other ready tasks are being worked on by its siblings
+const taskPromptTemplate = "Work on task T%d. It is already leased to this step; view it with `latasks view %d` rather than taking the next task, which other steps running in parallel are working on."
+
+// mergeQueue serializes the changes the steps of a parallel run make to the
+// shared repository. Each step works in its own worktree, but creating and
+// removing worktrees, committing (which also writes git notes) and merging into
+// the main branch all take locks in the main repository, so the steps wait
+// their turn. A nil queue does nothing, for steps that run on their own.
+type mergeQueue struct {
+	mu sync.Mutex
+}
+
+// Lock waits for the repository to be free
+func (q *mergeQueue) Lock() {
+	if q != nil {
+		q.mu.Lock()
+	}
+}
+
+// Unlock lets the next step use the repository
+func (q *mergeQueue) Unlock() {
+	if q != nil {
+		q.mu.Unlock()
+	}
+}
+
+// merge merges a step branch into the main branch with the given strategy and
+// returns the resulting main branch commit, like git.MergeBranchWithStrategy.
+// It must be called with the queue locked. In a parallel run the main branch
+// may have moved on since the step's worktree was created, because a sibling
+// merged first; if the merge conflicts, the step's commits are rebased onto the
+// main branch in its worktree and the merge is retried once. The main branch
+// commit the step was rebased onto is returned as well, or an empty string if
+// it was not rebased. The original conflict is returned if the rebase
+// conflicts too.
+func (q *mergeQueue) merge(ctx context.Context, repoDir string, worktreeDir string, stepBranch string, mainBranch string, message string, strategy git.MergeStrategy) (sha string, rebasedOnto string, err error) {
+	sha, err = git.MergeBranchWithStrategy(ctx, repoDir, stepBranch, mainBranch, message, strategy)
+	if q == nil || !errors.IsErrorType(err, errors.ErrGitMergeConflict) {
+		return sha, "", err
+	}
+
+	main, infoErr := git.GetCommitInfo(repoDir, mainBranch)
+	if infoErr != nil {
+		return "", "", err
+	}
+	if rebaseErr := git.RebaseWorktree(ctx, worktreeDir, mainBranch); rebaseErr != nil {
+		return "", "", err
+	}
+	sha, err = git.MergeBranchWithStrategy(ctx, repoDir, stepBranch, mainBranch, message, strategy)
+	return sha, main.SHA, err
+}
+
+// stepOutcome is the result and error of a step executed by the run loop
+type stepOutcome struct {
+	Result *stepResult
+	Err    error
+}
+
+// newParallelGroup returns an identifier shared by the steps of one parallel batch
+func newParallelGroup() string {
+	return fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102T150405"), os.Getpid())
+}
+
+// executeParallelSteps runs one step per task concurrently, each in its own
+// worktree and container, and merges their branches through a merge queue. The
+// outcomes are returned in the order of readyTasks once every step has finished.
+func executeParallelSteps(ctx context.Context, projectID string, opts stepOptions, readyTasks []tasks.Task) []stepOutcome {
+	group := newParallelGroup()
+	queue := &mergeQueue{}
+
+	taskIDs := make([]string, len(readyTasks))
+	for i, task := range readyTasks {
+		taskIDs[i] = fmt.Sprintf("T%d", task.ID)
+	}
+	fmt.Printf("Running %d step(s) in parallel for task %s\n", len(readyTasks), strings.Join(taskIDs, ", "))
+
+	outcomes := make([]stepOutcome, len(readyTasks))
+	var wg sync.WaitGroup
+	for i, task := range readyTasks {
+		stepOpts := opts
+		stepOpts.TaskID = task.ID
+		stepOpts.ParallelGroup = group
+		stepOpts.MergeQueue = queue
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := executeStep(ctx, projectID, stepOpts)
+			outcomes[i] = stepOutcome{Result: result, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	return outcomes
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/forge"
+	"github.com/tomyedwab/laforge/lib/git"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/secrets"
+)
+
+// pullRequestCmd represents the pull-request command
+var pullRequestCmd = &cobra.Command{
+	Use:   "pull-request [project-id]",
+	Short: "Show or set how step branches are pushed for review",
+	Long: `Show or set how the branch of each successful step is pushed to a remote and
+opened as a pull request.
+
+Without flags, prints the current configuration. With flags, updates only the
+given settings. Once a remote is set, every step that commits changes pushes
+its step-S<N> branch there and opens a pull request on the forge if one is
+configured. The step branch is then left for the pull request instead of being
+merged locally, whatever the project's merge strategy.
+
+Forges: github, gitea (also Forgejo). Gitea requires --api-url, such as
+https://gitea.example.com/api/v1. Store the token with 'laforge secret set' and
+reference it as ${secret:NAME} so it is never written to project.json.
+
+Examples:
+  laforge pull-request my-project
+  laforge pull-request my-project --remote origin --forge github \
+    --repository owner/repo --token '${secret:GITHUB_TOKEN}'
+  laforge pull-request my-project --disable`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPullRequest,
+}
+
+func init() {
+	pullRequestCmd.Flags().String("remote", "", "Git remote name or URL to push step branches to")
+	pullRequestCmd.Flags().String("forge", "", fmt.Sprintf("Forge to open pull requests on (%s), empty to only push", strings.Join(forge.Names(), ", ")))
+	pullRequestCmd.Flags().String("api-url", "", "Base URL of the forge's REST API")
+	pullRequestCmd.Flags().String("repository", "", "Forge repository to open pull requests in, as owner/name")
+	pullRequestCmd.Flags().String("token", "", "Forge API token, preferably a ${secret:NAME} reference")
+	pullRequestCmd.Flags().String("base-branch", "", "Branch pull requests target (default: the project's main branch)")
+	pullRequestCmd.Flags().Bool("disable", false, "Stop pushing step branches and opening pull requests")
+	rootCmd.AddCommand(pullRequestCmd)
+}
+
+func runPullRequest(cmd *cobra.Command, args []string) error {
+	projectID := args[0]
+
+	// Validate project ID
+	if projectID == "" {
+		return errors.NewInvalidInputError("project ID cannot be empty")
+	}
+
+	project, err := projects.LoadProject(projectID)
+	if err != nil {
+		return err
+	}
+
+	flags := cmd.Flags()
+	if disable, _ := flags.GetBool("disable"); disable {
+		if _, err := projects.UpdateProjectPullRequest(projectID, projects.PullRequestConfig{}); err != nil {
+			return err
+		}
+		fmt.Printf("Disabled pull requests for project '%s'\n", projectID)
+		return nil
+	}
+
+	config := project.PullRequest
+	changed := false
+	for flag, value := range map[string]*string{
+		"remote":      &config.Remote,
+		"forge":       &config.Forge,
+		"api-url":     &config.APIURL,
+		"repository":  &config.Repository,
+		"token":       &config.Token,
+		"base-branch": &config.BaseBranch,
+	} {
+		if flags.Changed(flag) {
+			*value, _ = flags.GetString(flag)
+			changed = true
+		}
+	}
+	if changed {
+		if project, err = projects.UpdateProjectPullRequest(projectID, config); err != nil {
+			return err
+		}
+		fmt.Printf("Updated pull requests for project '%s'\n", projectID)
+	}
+
+	config = project.PullRequest
+	fmt.Printf("Pull requests for project '%s':\n", projectID)
+	if !config.IsSet() {
+		fmt.Printf("  Remote: none (step branches are not pushed)\n")
+		return nil
+	}
+	baseBranch := config.BaseBranch
+	if baseBranch == "" {
+		baseBranch = project.MainBranch
+	}
+	fmt.Printf("  Remote: %s\n", config.Remote)
+	if config.Forge == "" {
+		fmt.Printf("  Forge: none (step branches are pushed without a pull request)\n")
+		return nil
+	}
+	fmt.Printf("  Forge: %s\n", config.Forge)
+	if config.APIURL != "" {
+		fmt.Printf("  API URL: %s\n", config.APIURL)
+	}
+	fmt.Printf("  Repository: %s\n", config.Repository)
+	fmt.Printf("  Token: %s\n", formatForgeToken(config.Token))
+	fmt.Printf("  Base Branch: %s\n", baseBranch)
+
+	return nil
+}
+
+// formatForgeToken shows a token's secret references, but never a literal token
+func formatForgeToken(token string) string {
+	if token == "" {
+		return "none"
+	}
+	if secrets.HasReferences(map[string]string{"token": token}) {
+		return token
+	}
+	return "(set)"
+}
+
+// newProjectForge creates the forge that pull requests for the project's steps
+// are opened on, resolving secret references in its token. It returns nil if
+// the project does not open pull requests, and the secret values to redact.
+func newProjectForge(project *projects.Project) (forge.Forge, []string, error) {
+	config := project.PullRequest
+	if !config.IsSet() || config.Forge == "" {
+		return nil, nil, nil
+	}
+
+	token, secretValues, err := resolveSecretValue("pull request token", config.Token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := forge.New(forge.Config{
+		Type:       config.Forge,
+		APIURL:     config.APIURL,
+		Repository: config.Repository,
+		Token:      token,
+	})
+	if err != nil {
+		return nil, nil, errors.NewInvalidInputError(fmt.Sprintf("project '%s' pull requests: %v", project.ID, err))
+	}
+	return f, secretValues, nil
+}
+
+// publishStepBranch pushes a step's branch to the project's remote and opens a
+// pull request for it if the project has a forge, returning the pull request's
+// URL. The pull request is titled with the first line of the step's commit
+// message and described by the rest of it.
+func publishStepBranch(ctx context.Context, project *projects.Project, pullRequestForge forge.Forge, repoDir string, stepID int, commitMessage string) (string, error) {
+	stepBranch := fmt.Sprintf("step-S%d", stepID)
+	if err := git.PushBranch(ctx, repoDir, project.PullRequest.Remote, stepBranch); err != nil {
+		return "", err
+	}
+	if pullRequestForge == nil {
+		return "", nil
+	}
+
+	title, body, _ := strings.Cut(strings.TrimSpace(commitMessage), "\n")
+	body = strings.TrimSpace(body)
+	if body != "" {
+		body += "\n\n"
+	}
+	body += fmt.Sprintf("Opened by LaForge step S%d.", stepID)
+
+	baseBranch := project.PullRequest.BaseBranch
+	if baseBranch == "" {
+		baseBranch = project.MainBranch
+	}
+
+	pr, err := pullRequestForge.CreatePullRequest(ctx, forge.PullRequest{
+		Title: strings.TrimSpace(title),
+		Body:  body,
+		Head:  stepBranch,
+		Base:  baseBranch,
+	})
+	if err != nil {
+		return "", err
+	}
+	return pr.URL, nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+	"github.com/tomyedwab/laforge/lib/tasks"
+)
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run [project-id]",
+	Short: "Run LaForge steps continuously until no task is ready",
+	Long: `Run LaForge steps in a loop until the project runs out of work.
+
+Before each step the task database is checked for a ready task. The loop stops
+when no task is ready, for example because every task is completed or all
+remaining tasks are waiting on a pending review. Steps that fail or exit with a
+non-zero exit code are retried after an exponential backoff.
+
+With --parallel N, up to N ready tasks are leased at a time and each is worked
+on by its own step, in its own worktree and container. The steps' branches are
+merged one at a time through a merge queue; a branch that no longer merges
+because a sibling changed the main branch is rebased and merged again, and
+otherwise resolved by a conflict resolution step. The output of the agents is
+not printed, but can be followed in the web UI or the step log files.
+
+Examples:
+  laforge run my-project
+  laforge run my-project --max-steps 10 --max-duration 2h
+  laforge run my-project --parallel 3`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRun,
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().String("agent-config", "", "agent configuration name from agents.yml")
+	runCmd.Flags().Duration("timeout", 0, "timeout for each step's execution (0 means no timeout)")
+	runCmd.Flags().Int("max-steps", 0, "maximum number of steps to run (0 means no limit)")
+	runCmd.Flags().Duration("max-duration", 0, "stop starting new steps after this much time (0 means no limit)")
+	runCmd.Flags().Duration("backoff", 30*time.Second, "initial delay after a failed step, doubled after each consecutive failure")
+	runCmd.Flags().Duration("max-backoff", 10*time.Minute, "maximum delay between consecutive failed steps")
+	runCmd.Flags().Int("parallel", 1, "number of ready tasks to work on concurrently, each in its own step")
+}
+
+func runRun(cmd *cobra.Command, args []string) error {
+	projectID := args[0]
+
+	// Validate project ID
+	if projectID == "" {
+		return errors.NewInvalidInputError("project ID cannot be empty")
+	}
+
+	opts := getStepOptions(cmd)
+	maxSteps, _ := cmd.Flags().GetInt("max-steps")
+	maxDuration, _ := cmd.Flags().GetDuration("max-duration")
+	backoff, _ := cmd.Flags().GetDuration("backoff")
+	maxBackoff, _ := cmd.Flags().GetDuration("max-backoff")
+	parallel, _ := cmd.Flags().GetInt("parallel")
+
+	if maxSteps < 0 {
+		return errors.NewInvalidInputError("--max-steps cannot be negative")
+	}
+	if parallel < 1 {
+		return errors.NewInvalidInputError("--parallel must be at least 1")
+	}
+
+	// Check if project exists
+	exists, err := projects.ProjectExists(projectID)
+	if err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to check if project exists")
+	}
+	if !exists {
+		return errors.NewProjectNotFoundError(projectID)
+	}
+
+	// Stop the loop, and the step that is running, if laforge is interrupted
+	ctx, stopInterrupts := withInterrupts(cmd.Context())
+	defer stopInterrupts()
+
+	runStartTime := time.Now()
+	stepsRun := 0
+	consecutiveFailures := 0
+
+	for {
+		if ctx.Err() != nil {
+			fmt.Println("Stopping: interrupted")
+			break
+		}
+		if maxSteps > 0 && stepsRun >= maxSteps {
+			fmt.Printf("Stopping: reached the maximum of %d step(s)\n", maxSteps)
+			break
+		}
+		if maxDuration > 0 && time.Since(runStartTime) >= maxDuration {
+			fmt.Printf("Stopping: reached the maximum run duration of %s\n", maxDuration)
+			break
+		}
+
+		batchSize := 1
+		if parallel > 1 {
+			batchSize = parallel
+			if maxSteps > 0 && maxSteps-stepsRun < batchSize {
+				batchSize = maxSteps - stepsRun
+			}
+		}
+		readyTasks, reason, err := findReadyTasks(projectID, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(readyTasks) == 0 {
+			fmt.Printf("Stopping: %s\n", reason)
+			break
+		}
+
+		var outcomes []stepOutcome
+		if parallel > 1 {
+			outcomes = executeParallelSteps(ctx, projectID, opts, readyTasks)
+		} else {
+			result, stepErr := executeStep(ctx, projectID, opts)
+			outcomes = []stepOutcome{{Result: result, Err: stepErr}}
+		}
+
+		interrupted := false
+		cancelledStepID := 0
+		failed := false
+		for _, outcome := range outcomes {
+			result, stepErr := outcome.Result, outcome.Err
+			if result == nil && (errors.IsErrorType(stepErr, errors.ErrInvalidInput) || errors.IsErrorType(stepErr, errors.ErrProjectNotFound) || errors.IsErrorType(stepErr, errors.ErrBudgetExceeded) || errors.IsErrorType(stepErr, errors.ErrAuthenticationFailed)) {
+				// Configuration problems, bad credentials and exhausted budgets will not go away by retrying
+				fmt.Printf("Ran %d step(s) in %s\n", stepsRun, time.Since(runStartTime).Round(time.Second))
+				return stepErr
+			}
+			stepsRun++
+
+			fmt.Println(formatStepSummary(result, stepErr))
+
+			// Resolve a conflict with the main branch before other steps build on it
+			if stepErr == nil && result.MergeConflict != nil && ctx.Err() == nil {
+				result, stepErr = executeConflictResolution(ctx, projectID, opts, result.MergeConflict)
+				if result != nil {
+					stepsRun++
+				}
+
+				fmt.Println(formatStepSummary(result, stepErr))
+			}
+
+			if errors.IsErrorType(stepErr, errors.ErrStepInterrupted) {
+				interrupted = true
+			} else if errors.IsErrorType(stepErr, errors.ErrStepCancelled) {
+				cancelledStepID = result.StepID
+			} else if stepErr != nil || result.ExitCode != 0 {
+				failed = true
+			}
+		}
+
+		if interrupted || ctx.Err() != nil {
+			fmt.Println("Stopping: interrupted")
+			break
+		}
+		if cancelledStepID != 0 {
+			// A cancelled step means the user wants the agent to stop working
+			fmt.Printf("Stopping: step S%d was cancelled\n", cancelledStepID)
+			break
+		}
+
+		if !failed {
+			consecutiveFailures = 0
+			continue
+		}
+
+		consecutiveFailures++
+		delay := failureBackoff(backoff, maxBackoff, consecutiveFailures)
+		if maxDuration > 0 && time.Since(runStartTime)+delay >= maxDuration {
+			fmt.Printf("Stopping: backoff of %s would exceed the maximum run duration of %s\n", delay, maxDuration)
+			break
+		}
+		fmt.Printf("%d consecutive failed step(s), waiting %s before the next step\n", consecutiveFailures, delay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+
+	fmt.Printf("Ran %d step(s) in %s\n", stepsRun, time.Since(runStartTime).Round(time.Second))
+	return nil
+}
+
+// findReadyTasks returns up to limit tasks of the project that are ready to be
+// worked on. If none are, it also returns a human-readable reason.
+func findReadyTasks(projectID string, limit int) ([]tasks.Task, string, error) {
+	db, err := projects.OpenProjectTaskDatabase(projectID)
+	if err != nil {
+		return nil, "", err
+	}
+	defer db.Close()
+
+	readyTasks, err := tasks.GetReadyTasks(db, limit)
+	if err != nil {
+		return nil, "", errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to get ready tasks")
+	}
+	if len(readyTasks) > 0 {
+		return readyTasks, "", nil
+	}
+
+	taskList, err := tasks.ListTasks(db)
+	if err != nil {
+		return nil, "", errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to list tasks")
+	}
+	remaining := 0
+	for _, task := range taskList {
+		if task.Status != "completed" {
+			remaining++
+		}
+	}
+	if remaining == 0 {
+		return nil, "all tasks are completed", nil
+	}
+
+	pendingReviews, err := tasks.GetPendingReviews(db)
+	if err != nil {
+		return nil, "", errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to get pending reviews")
+	}
+	if len(pendingReviews) > 0 {
+		return nil, fmt.Sprintf("%d remaining task(s) are blocked on %d pending review(s)", remaining, len(pendingReviews)), nil
+	}
+
+	return nil, fmt.Sprintf("none of the %d remaining task(s) are ready", remaining), nil
+}
+
+// failureBackoff returns the delay before the next step after the given number of
+// consecutive failures, doubling from initial and capped at max
+func failureBackoff(initial, max time.Duration, failures int) time.Duration {
+	if failures <= 0 || initial <= 0 {
+		return 0
+	}
+	delay := initial
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if max > 0 && delay >= max {
+			return max
+		}
+	}
+	if max > 0 && delay > max {
+		return max
+	}
+	return delay
+}
+
+// formatStepSummary returns a one-line summary of a step run by the run loop
+func formatStepSummary(result *stepResult, stepErr error) string {
+	if result == nil {
+		return fmt.Sprintf("Step failed before it was leased: %s", stepErr.Error())
+	}
+
+	taskDesc := "no task leased"
+	if len(result.LeasedTaskIDs) > 0 {
+		taskIDs := make([]string, len(result.LeasedTaskIDs))
+		for i, id := range result.LeasedTaskIDs {
+			taskIDs[i] = fmt.Sprintf("T%d", id)
+		}
+		taskDesc = "task " + strings.Join(taskIDs, ", ")
+	}
+
+	if result.ExitCode == steps.ExitCodeInterrupted {
+		return fmt.Sprintf("Step S%d was interrupted after %s (%s)",
+			result.StepID, result.Duration.Round(time.Second), taskDesc)
+	}
+	if result.ExitCode == steps.ExitCodeCancelled {
+		return fmt.Sprintf("Step S%d was cancelled after %s (%s)",
+			result.StepID, result.Duration.Round(time.Second), taskDesc)
+	}
+
+	summary := fmt.Sprintf("Step S%d finished in %s with exit code %d (%s)",
+		result.StepID, result.Duration.Round(time.Second), result.ExitCode, taskDesc)
+	if stepErr != nil {
+		summary += fmt.Sprintf(": %s", stepErr.Error())
+	}
+	return summary
+}
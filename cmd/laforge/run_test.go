@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 0},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+
+	for _, test := range tests {
+		if got := failureBackoff(30*time.Second, 10*time.Minute, test.failures); got != test.expected {
+			t.Errorf("failureBackoff after %d failures = %s, expected %s", test.failures, got, test.expected)
+		}
+	}
+}
+
+func TestFormatStepSummary(t *testing.T) {
+	summary := formatStepSummary(&stepResult{
+		StepID:        4,
+		Duration:      90 * time.Second,
+		ExitCode:      0,
+		LeasedTaskIDs: []int{12},
+	}, nil)
+	if expected := "Step S4 finished in 1m30s with exit code 0 (task T12)"; summary != expected {
+		t.Errorf("Expected %q, got %q", expected, summary)
+	}
+
+	summary = formatStepSummary(&stepResult{StepID: 5, ExitCode: 2}, nil)
+	if expected := "Step S5 finished in 0s with exit code 2 (no task leased)"; summary != expected {
+		t.Errorf("Expected %q, got %q", expected, summary)
+	}
+
+	summary = formatStepSummary(&stepResult{StepID: 6, Duration: 5 * time.Second, ExitCode: steps.ExitCodeCancelled, LeasedTaskIDs: []int{3}}, nil)
+	if expected := "Step S6 was cancelled after 5s (task T3)"; summary != expected {
+		t.Errorf("Expected %q, got %q", expected, summary)
+	}
+
+	summary = formatStepSummary(&stepResult{StepID: 7, Duration: 2 * time.Second, ExitCode: steps.ExitCodeInterrupted}, nil)
+	if expected := "Step S7 was interrupted after 2s (no task leased)"; summary != expected {
+		t.Errorf("Expected %q, got %q", expected, summary)
+	}
+
+	summary = formatStepSummary(nil, fmt.Errorf("connection refused"))
+	if expected := "Step failed before it was leased: connection refused"; summary != expected {
+		t.Errorf("Expected %q, got %q", expected, summary)
+	}
+}
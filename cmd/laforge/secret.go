@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/secrets"
+	"golang.org/x/term"
+)
+
+// secretCmd represents the secret command
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage secrets for agent configurations",
+	Long: `Manage the encrypted secrets store in ~/.laforge/secrets.
+
+Agent configurations reference secrets in their environment as ${secret:NAME}
+instead of storing values in agents.yml. When a step runs, referenced secrets
+are passed to the agent container in an env-file on a tmpfs rather than on the
+container command line, and their values are redacted from the step logs.
+
+The store is encrypted with a passphrase, read from the
+LAFORGE_SECRETS_PASSPHRASE environment variable or prompted for on the terminal.
+
+Examples:
+  laforge secret set ANTHROPIC_API_KEY
+  echo "$TOKEN" | laforge secret set GITHUB_TOKEN
+  laforge secret list
+  laforge secret rm GITHUB_TOKEN`,
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set NAME",
+	Short: "Set the value of a secret",
+	Long: `Set the value of a secret, prompting for it on the terminal or reading the
+first line of standard input when it is not a terminal.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSecretSet,
+}
+
+var secretListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the names of all secrets",
+	Args:  cobra.NoArgs,
+	RunE:  runSecretList,
+}
+
+var secretRmCmd = &cobra.Command{
+	Use:   "rm NAME",
+	Short: "Remove a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSecretRm,
+}
+
+func init() {
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretListCmd)
+	secretCmd.AddCommand(secretRmCmd)
+	rootCmd.AddCommand(secretCmd)
+}
+
+func runSecretSet(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if err := secrets.ValidateName(name); err != nil {
+		return errors.NewInvalidInputError(err.Error())
+	}
+
+	store, err := openSecretStore(true)
+	if err != nil {
+		return err
+	}
+
+	value, err := readSecretValue(name)
+	if err != nil {
+		return err
+	}
+	if err := store.Set(name, value); err != nil {
+		return errors.NewInvalidInputError(err.Error())
+	}
+	if err := store.Save(); err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to save secrets")
+	}
+
+	fmt.Printf("Set secret '%s'\n", name)
+	return nil
+}
+
+func runSecretList(cmd *cobra.Command, args []string) error {
+	storePath, err := secrets.GetStorePath()
+	if err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to get secrets store path")
+	}
+	if !secrets.StoreExists(storePath) {
+		fmt.Println("No secrets found")
+		return nil
+	}
+
+	store, err := openSecretStore(false)
+	if err != nil {
+		return err
+	}
+	names := store.Names()
+	if len(names) == 0 {
+		fmt.Println("No secrets found")
+		return nil
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func runSecretRm(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	storePath, err := secrets.GetStorePath()
+	if err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to get secrets store path")
+	}
+	if !secrets.StoreExists(storePath) {
+		return errors.NewInvalidInputError(fmt.Sprintf("secret '%s' not found", name))
+	}
+
+	store, err := openSecretStore(false)
+	if err != nil {
+		return err
+	}
+	if !store.Delete(name) {
+		return errors.NewInvalidInputError(fmt.Sprintf("secret '%s' not found", name))
+	}
+	if err := store.Save(); err != nil {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to save secrets")
+	}
+
+	fmt.Printf("Removed secret '%s'\n", name)
+	return nil
+}
+
+// openSecretStore opens the secrets store with the passphrase from the
+// LAFORGE_SECRETS_PASSPHRASE environment variable, or prompts for it. When
+// create is true and the store does not exist yet, the new passphrase is
+// prompted for twice.
+func openSecretStore(create bool) (*secrets.Store, error) {
+	storePath, err := secrets.GetStorePath()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to get secrets store path")
+	}
+
+	passphrase := os.Getenv(secrets.PassphraseEnvVar)
+	if passphrase == "" {
+		confirm := create && !secrets.StoreExists(storePath)
+		passphrase, err = readSecretsPassphrase(confirm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	store, err := secrets.Open(storePath, passphrase)
+	if err != nil {
+		if err == secrets.ErrInvalidPassphrase {
+			return nil, errors.NewInvalidInputError(err.Error())
+		}
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to open secrets store")
+	}
+	return store, nil
+}
+
+// readSecretsPassphrase prompts for the store passphrase on the terminal
+func readSecretsPassphrase(confirm bool) (string, error) {
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		return "", errors.NewInvalidInputError(fmt.Sprintf("set %s to access secrets without a terminal", secrets.PassphraseEnvVar))
+	}
+
+	fmt.Fprint(os.Stderr, "Secrets passphrase: ")
+	passphrase, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if !confirm {
+		return string(passphrase), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+	confirmation, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if string(passphrase) != string(confirmation) {
+		return "", errors.NewInvalidInputError("passphrases do not match")
+	}
+	return string(passphrase), nil
+}
+
+// readSecretValue prompts for a secret value on the terminal, or reads the
+// first line of standard input when it is not a terminal
+func readSecretValue(name string) (string, error) {
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to read secret value: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Value for %s: ", name)
+	value, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret value: %w", err)
+	}
+	return string(value), nil
+}
+
+// resolveAgentSecrets replaces the ${secret:NAME} references in an agent
+// configuration's environment. The configuration is left with only the plain
+// variables; the variables with secrets and the secret values are returned
+// separately. The store is only opened if the configuration references secrets.
+func resolveAgentSecrets(agentConfig *projects.AgentConfig) (map[string]string, []string, error) {
+	if !secrets.HasReferences(agentConfig.Environment) {
+		return nil, nil, nil
+	}
+
+	storePath, err := secrets.GetStorePath()
+	if err != nil {
+		return nil, nil, errors.Wrap(errors.ErrUnknown, err, "failed to get secrets store path")
+	}
+	if !secrets.StoreExists(storePath) {
+		return nil, nil, errors.NewInvalidInputError(fmt.Sprintf("agent configuration '%s' references secrets %s, but no secrets have been set (use 'laforge secret set')",
+			agentConfig.Name, strings.Join(secrets.References(agentConfig.Environment), ", ")))
+	}
+
+	store, err := openSecretStore(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, secretEnv, values, err := secrets.ResolveEnvironment(agentConfig.Environment, store.Get)
+	if err != nil {
+		return nil, nil, errors.NewInvalidInputError(err.Error())
+	}
+	agentConfig.Environment = plain
+	return secretEnv, values, nil
+}
+
+// resolveSecretValue substitutes secret references in a single configuration
+// value, such as a forge token, and returns the resolved value together with the
+// secret values to redact. what names the value in error messages.
+func resolveSecretValue(what string, value string) (string, []string, error) {
+	env := map[string]string{"value": value}
+	if !secrets.HasReferences(env) {
+		return value, nil, nil
+	}
+
+	storePath, err := secrets.GetStorePath()
+	if err != nil {
+		return "", nil, errors.Wrap(errors.ErrUnknown, err, "failed to get secrets store path")
+	}
+	if !secrets.StoreExists(storePath) {
+		return "", nil, errors.NewInvalidInputError(fmt.Sprintf("%s references secrets %s, but no secrets have been set (use 'laforge secret set')",
+			what, strings.Join(secrets.References(env), ", ")))
+	}
+
+	store, err := openSecretStore(false)
+	if err != nil {
+		return "", nil, err
+	}
+	_, resolved, values, err := secrets.ResolveEnvironment(env, store.Get)
+	if err != nil {
+		return "", nil, errors.NewInvalidInputError(fmt.Sprintf("%s: %v", what, err))
+	}
+	return resolved["value"], values, nil
+}
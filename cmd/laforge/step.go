@@ -0,0 +1,867 @@
+package main
+
+import (
+	"context"
+	nativeerrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/docker"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/forge"
+	"github.com/tomyedwab/laforge/lib/git"
+	"github.com/tomyedwab/laforge/lib/logging"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+// stepRun holds the state of a step while executeStep runs it. Everything the
+// step records, from the container's exit code to how its branch was merged,
+// is sent to laserve when the step is finalized.
+type stepRun struct {
+	projectID string
+	opts      stepOptions
+	sourceDir string
+
+	project         *projects.Project
+	agentsConfig    *projects.AgentsConfig
+	agentConfig     *projects.AgentConfig
+	agentConfigName string
+	outputFormatter docker.OutputFormatter
+	secretEnv       map[string]string
+	secretValues    []string
+	forge           forge.Forge
+	logger          *logging.Logger
+
+	// Set once the step is leased
+	stepID     int
+	leaseToken string
+	stepLogger *logging.StepLogger
+	result     *stepResult
+	startTime  time.Time
+
+	// The step's worktree, and whether it was already removed after a merge
+	worktree        *git.Worktree
+	worktreeRemoved bool
+
+	// The files left in conflict by the merge a conflict resolution step starts with
+	conflictedFiles []string
+
+	// Container exit code and metrics, reported when the step is finalized
+	exitCode int64
+	metrics  *docker.ContainerMetrics
+
+	// Set when the step is cancelled from the web UI or API while the agent runs
+	cancelled bool
+
+	// The step branch commit and the changes made since commitSHABefore
+	commitSHABefore string
+	commitSHAAfter  string
+	diffStats       *steps.DiffStats
+
+	// How the step branch was merged, and the pull request opened for it
+	mergeStrategy  git.MergeStrategy
+	mergeCommitSHA string
+	pullRequestURL string
+}
+
+// executeStep runs a single step cycle for the project. The returned result is
+// non-nil once a step has been leased, even if the step later fails. If ctx is
+// done while the step runs, the agent is stopped, its work is kept on the step
+// branch without merging and the step is finalized as interrupted.
+func executeStep(ctx context.Context, projectID string, opts stepOptions) (result *stepResult, err error) {
+	run, err := prepareStep(projectID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := run.leaseStep(); err != nil {
+		return nil, err
+	}
+	result = run.result
+	defer func() {
+		run.finalizeStep(ctx, err)
+	}()
+
+	if err := run.leaseAssignedTask(); err != nil {
+		return result, err
+	}
+
+	defer run.removeWorktree()
+	if err := run.createWorktree(ctx); err != nil {
+		return result, err
+	}
+
+	if err := run.runAgent(ctx); err != nil {
+		return result, err
+	}
+
+	hasChanges, stepCommitMessage, unresolvedFiles, err := run.commitStepChanges()
+	if err != nil {
+		return result, err
+	}
+
+	// Interrupted and cancelled steps keep their branch for inspection instead of being merged
+	if ctx.Err() != nil {
+		run.stepLogger.LogWarning("step", "Step was interrupted, skipping automerge", map[string]interface{}{
+			"step_branch": run.stepBranch(),
+		})
+		return result, errors.NewStepInterruptedError(run.stepID, ctx.Err())
+	}
+	if run.cancelled {
+		run.stepLogger.LogWarning("step", "Step was cancelled, skipping automerge", map[string]interface{}{
+			"step_branch": run.stepBranch(),
+		})
+		return result, errors.NewStepCancelledError(run.stepID)
+	}
+	if len(unresolvedFiles) > 0 {
+		return result, run.keepUnresolvedConflicts(unresolvedFiles)
+	}
+
+	// Parallel steps push and merge one at a time, each onto the main branch
+	// left by the step before it
+	opts.MergeQueue.Lock()
+	defer opts.MergeQueue.Unlock()
+
+	run.publishAndMerge(ctx, hasChanges, stepCommitMessage)
+
+	run.logger.Info("step", fmt.Sprintf("LaForge step completed successfully for project '%s'", projectID), map[string]interface{}{
+		"project_id": projectID,
+		"step_id":    run.stepID,
+		"duration":   time.Since(run.startTime).String(),
+	})
+
+	return result, nil
+}
+
+// prepareStep loads the project and agent configuration of a step and checks
+// everything that can be misconfigured, so a bad output format, missing secret
+// or forge setting fails without consuming a step
+func prepareStep(projectID string, opts stepOptions) (*stepRun, error) {
+	agentConfigName := opts.AgentConfigName
+	sourceDir, _ := os.Getwd()
+
+	// Check if project exists
+	exists, err := projects.ProjectExists(projectID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to check if project exists")
+	}
+	if !exists {
+		return nil, errors.NewProjectNotFoundError(projectID)
+	}
+
+	// Load project configuration to get main branch
+	project, err := projects.LoadProject(projectID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to load project configuration")
+	}
+
+	// Load agents configuration from file
+	agentsConfig, err := projects.LoadAgentsConfig(projectID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to load agents configuration")
+	}
+
+	// Conflict resolution steps may use a dedicated agent configuration
+	if opts.Conflict != nil && agentsConfig.ConflictResolution != nil && agentsConfig.ConflictResolution.Agent != "" {
+		agentConfigName = agentsConfig.ConflictResolution.Agent
+	}
+
+	var agentConfig *projects.AgentConfig
+	if agentConfigName != "" {
+		// Get the specified agent configuration
+		agent, exists := agentsConfig.GetAgent(agentConfigName)
+		if !exists {
+			return nil, errors.NewInvalidInputError(fmt.Sprintf("agent configuration '%s' not found", agentConfigName))
+		}
+		agentConfig = &agent
+	} else {
+		// Get the specified agent configuration
+		agent, exists := agentsConfig.GetDefaultAgent()
+		if !exists {
+			return nil, errors.NewInvalidInputError(fmt.Sprintf("agent configuration '%s' not found", agentConfigName))
+		}
+		agentConfig = &agent
+	}
+
+	// Override timeout if provided via flag
+	if opts.Timeout > 0 {
+		agentConfig.Runtime.Timeout = opts.Timeout.String()
+	}
+
+	// Select the formatter for the agent's output
+	outputFormatter, err := docker.GetOutputFormatter(agentConfig.OutputFormat)
+	if err != nil {
+		return nil, errors.NewInvalidInputError(fmt.Sprintf("agent configuration '%s': %v", agentConfig.Name, err))
+	}
+
+	// Resolve secret references
+	secretEnv, secretValues, err := resolveAgentSecrets(agentConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up the forge, redacting its token from the logs like the agent's secrets
+	pullRequestForge, forgeSecretValues, err := newProjectForge(project)
+	if err != nil {
+		return nil, err
+	}
+	secretValues = append(secretValues, forgeSecretValues...)
+
+	// Set up logging
+	logger := logging.GetLogger()
+	if opts.Verbose {
+		// Set debug level for verbose output
+		logger = logging.NewLogger(logging.DEBUG, "")
+	} else if opts.Quiet {
+		// Set warn level for quiet output
+		logger = logging.NewLogger(logging.WARN, "")
+	}
+	logger.SetRedactedValues(secretValues)
+
+	// Get current commit SHA before step execution
+	commitSHABefore, err := git.GetCurrentCommitSHA(sourceDir)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to get current commit SHA")
+	}
+
+	return &stepRun{
+		projectID:       projectID,
+		opts:            opts,
+		sourceDir:       sourceDir,
+		project:         project,
+		agentsConfig:    agentsConfig,
+		agentConfig:     agentConfig,
+		agentConfigName: agentConfigName,
+		outputFormatter: outputFormatter,
+		secretEnv:       secretEnv,
+		secretValues:    secretValues,
+		forge:           pullRequestForge,
+		logger:          logger,
+		metrics:         &docker.ContainerMetrics{},
+		commitSHABefore: commitSHABefore,
+		commitSHAAfter:  commitSHABefore,
+	}, nil
+}
+
+// leaseStep leases the next step from laserve and starts the step's log
+func (r *stepRun) leaseStep() error {
+	var leaseResponse steps.LeaseStepResponse
+	err := sendRequest(r.projectID, "/steps/lease", "POST", &steps.LeaseStepRequest{
+		CommitSHABefore: r.commitSHABefore,
+		AgentConfigName: r.agentConfig.Name,
+		ParallelGroup:   r.opts.ParallelGroup,
+	}, &leaseResponse)
+	if err != nil {
+		if apiErrorCode(err) == "BUDGET_EXCEEDED" {
+			var apiErr *APIError
+			nativeerrors.As(err, &apiErr)
+			return errors.New(errors.ErrBudgetExceeded, apiErr.Message)
+		}
+		if nativeerrors.Is(err, MissingCredentialsError) || nativeerrors.Is(err, InvalidCredentialsError) {
+			return errors.NewAuthenticationFailedError(err)
+		}
+		return errors.Wrap(errors.ErrUnknown, err, "failed to lease step")
+	}
+
+	r.stepID = leaseResponse.StepID
+	r.leaseToken = leaseResponse.Token
+	r.stepLogger = logging.NewStepLogger(r.logger, r.projectID, fmt.Sprintf("S%d", r.stepID))
+	r.result = &stepResult{StepID: r.stepID}
+
+	// Log step start
+	r.stepLogger.LogStepStart(r.projectID)
+	r.startTime = time.Now()
+	return nil
+}
+
+// leaseAssignedTask leases the task the step was assigned. The agent is told
+// that its task is already leased to the step, so the step fails if another
+// run took the task first. The task of a conflict was created for this step,
+// so failing to lease it only leaves it shown as not being worked on.
+func (r *stepRun) leaseAssignedTask() error {
+	if r.opts.Conflict != nil {
+		if leaseErr := leaseStepTask(r.projectID, r.opts.Conflict.TaskID, r.stepID); leaseErr != nil {
+			r.logger.Warn("tasks", "Failed to lease merge conflict task", map[string]interface{}{
+				"task_id": r.opts.Conflict.TaskID,
+				"error":   leaseErr.Error(),
+			})
+		}
+	} else if r.opts.TaskID != 0 {
+		if err := leaseStepTask(r.projectID, r.opts.TaskID, r.stepID); err != nil {
+			r.stepLogger.LogError("tasks", "Failed to lease assigned task", err, map[string]interface{}{
+				"task_id": r.opts.TaskID,
+			})
+			return errors.Wrapf(errors.ErrUnknown, err, "failed to lease assigned task T%d", r.opts.TaskID)
+		}
+	}
+	return nil
+}
+
+// stepBranch returns the name of the step's branch
+func (r *stepRun) stepBranch() string {
+	return fmt.Sprintf("step-S%d", r.stepID)
+}
+
+// finalizeStep sends the step's completion data to laserve and fills in the
+// result. err is the error the step failed with, if any.
+func (r *stepRun) finalizeStep(ctx context.Context, err error) {
+	// Update step record with completion data
+	finalExitCode := int(r.exitCode)
+	if err != nil && finalExitCode == 0 {
+		finalExitCode = 1
+	}
+	if err != nil && ctx.Err() != nil {
+		finalExitCode = steps.ExitCodeInterrupted
+	}
+	if r.cancelled {
+		finalExitCode = steps.ExitCodeCancelled
+	}
+
+	finalizeRequest := &steps.FinalizeStepRequest{
+		StepID:         r.stepID,
+		CommitSHAAfter: r.commitSHAAfter,
+		ExitCode:       finalExitCode,
+		TokenUsage:     r.metrics.TokenUsage,
+	}
+	if r.metrics.ResourceUsage.Samples > 0 {
+		finalizeRequest.ResourceUsage = &r.metrics.ResourceUsage
+	}
+	if r.mergeStrategy != "" {
+		finalizeRequest.MergeStrategy = string(r.mergeStrategy)
+		finalizeRequest.MergeCommitSHA = r.mergeCommitSHA
+	}
+	finalizeRequest.PullRequestURL = r.pullRequestURL
+	finalizeRequest.DiffStats = r.diffStats
+
+	var finalizeResponse steps.FinalizeStepResponse
+	finalizeErr := sendRequest(r.projectID, "/steps/finalize", "POST", finalizeRequest, &finalizeResponse)
+	if finalizeErr != nil {
+		r.stepLogger.LogError("database", "Failed to update step record", finalizeErr, map[string]interface{}{
+			"step_id": r.stepID,
+		})
+	}
+
+	r.result.Duration = time.Since(r.startTime)
+	r.result.ExitCode = finalExitCode
+	r.result.LeasedTaskIDs = finalizeResponse.LeasedTaskIDs
+
+	// Log step completion
+	r.stepLogger.LogStepEnd(err == nil && finalizeErr == nil, r.result.Duration, finalExitCode)
+}
+
+// createWorktree checks out the step branch in a temporary worktree and sets
+// up the agent's prompt. Conflict resolution steps start with the conflicted
+// merge in progress, and the agent is told which files to resolve.
+func (r *stepRun) createWorktree(ctx context.Context) error {
+	// Step 1: Create temporary git worktree
+	r.stepLogger.LogStepPhase("worktree", "Creating temporary git worktree")
+	r.opts.MergeQueue.Lock()
+	worktree, err := git.CreateTempWorktreeWithStep(ctx, r.sourceDir, r.stepID)
+	r.opts.MergeQueue.Unlock()
+	if err != nil {
+		if ctx.Err() != nil {
+			return errors.NewStepInterruptedError(r.stepID, ctx.Err())
+		}
+		r.stepLogger.LogError("git", "Failed to create temporary worktree", err, map[string]interface{}{
+			"source_dir": r.sourceDir,
+		})
+		return errors.Wrap(errors.ErrUnknown, err, "failed to create temporary worktree")
+	}
+	r.worktree = worktree
+	r.stepLogger.LogWorktreeCreation(worktree.Path, r.stepBranch())
+
+	agentConfig := r.agentConfig
+	if r.opts.Conflict != nil {
+		r.stepLogger.LogStepPhase("git", fmt.Sprintf("Merging %s into the worktree to resolve its conflicts", r.opts.Conflict.Branch))
+		r.conflictedFiles, err = git.StartMerge(ctx, worktree.Path, r.opts.Conflict.Branch)
+		if err != nil {
+			r.stepLogger.LogError("git", "Failed to start the conflicted merge", err, map[string]interface{}{
+				"conflict_branch": r.opts.Conflict.Branch,
+			})
+			return errors.Wrap(errors.ErrUnknown, err, "failed to start the conflicted merge")
+		}
+
+		promptTemplate := ""
+		if r.agentsConfig.ConflictResolution != nil {
+			promptTemplate = r.agentsConfig.ConflictResolution.Prompt
+		}
+		if agentConfig.Environment == nil {
+			agentConfig.Environment = map[string]string{}
+		}
+		agentConfig.Environment[promptEnvVar] = conflictPrompt(promptTemplate, r.opts.Conflict, r.project.MainBranch, r.conflictedFiles)
+	} else if r.opts.TaskID != 0 {
+		if agentConfig.Environment == nil {
+			agentConfig.Environment = map[string]string{}
+		}
+		agentConfig.Environment[promptEnvVar] = fmt.Sprintf(taskPromptTemplate, r.opts.TaskID, r.opts.TaskID)
+	}
+	return nil
+}
+
+// removeWorktree removes the step's worktree, unless it was never created or
+// was already removed after the step branch was merged
+func (r *stepRun) removeWorktree() {
+	if r.worktree == nil || r.worktreeRemoved {
+		return
+	}
+	r.opts.MergeQueue.Lock()
+	defer r.opts.MergeQueue.Unlock()
+	r.stepLogger.LogWorktreeCleanup(r.worktree.Path)
+	if cleanupErr := git.RemoveWorktree(r.worktree); cleanupErr != nil {
+		r.stepLogger.LogWarning("git", "Failed to remove worktree", map[string]interface{}{
+			"error": cleanupErr.Error(),
+		})
+	}
+}
+
+// runAgent runs the agent container in the step's worktree, streaming its
+// output to stdout, the step log and laserve. The agent is stopped if the step
+// is cancelled or ctx is done; an interrupted agent is not an error, so its
+// work can still be committed to the step branch.
+func (r *stepRun) runAgent(ctx context.Context) error {
+	stepLogger := r.stepLogger
+
+	// Step 2: Create Docker client
+	stepLogger.LogStepPhase("docker", "Initializing Docker client")
+	dockerClient, err := newContainerClient(r.agentsConfig.ContainerRuntime())
+	if err != nil {
+		stepLogger.LogError("docker", "Failed to create Docker client", err, map[string]interface{}{
+			"runtime": r.agentsConfig.ContainerRuntime(),
+		})
+		return errors.Wrap(errors.ErrUnknown, err, "failed to create Docker client")
+	}
+	stepLogger.LogDockerClientInit()
+	defer dockerClient.Close()
+	dockerClient.SetSecretEnvironment(r.secretEnv)
+
+	// Step 3: Create log file for streaming container output
+	stepLogger.LogStepPhase("logs", "Setting up log file")
+	logsDir, err := projects.GetProjectLogsDir(r.projectID)
+	if err != nil {
+		stepLogger.LogError("logs", "Failed to get project logs directory", err, nil)
+		return err
+	}
+
+	// Create logs directory if it doesn't exist
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		stepLogger.LogError("logs", "Failed to create logs directory", err, map[string]interface{}{
+			"logs_dir": logsDir,
+		})
+		return errors.Wrap(errors.ErrUnknown, err, "failed to create logs directory")
+	}
+
+	// Create log file with step ID and timestamp
+	logFilePath := filepath.Join(logsDir, projects.StepLogFileName(r.stepID, time.Now()))
+	logFile, err := os.Create(logFilePath)
+	if err != nil {
+		stepLogger.LogError("logs", "Failed to create log file", err, map[string]interface{}{
+			"log_file_path": logFilePath,
+		})
+		return errors.Wrap(errors.ErrUnknown, err, "failed to create log file")
+	}
+	defer logFile.Close()
+
+	r.logger.Info("logs", "Log file created", map[string]interface{}{
+		"log_file_path": logFilePath,
+		"project_id":    r.projectID,
+		"step_id":       r.stepID,
+	})
+
+	// Stream the output to laserve as well, so the step can be watched from the web UI
+	logStream := newLogStreamer(r.projectID, r.stepID)
+	defer logStream.Close()
+
+	// Create multi-writer to stream to stdout, the log file and laserve, with secret values redacted.
+	// The agents of a parallel run would interleave on stdout, so their output
+	// only goes to the log file and laserve.
+	var stdout io.Writer = os.Stdout
+	if r.opts.MergeQueue != nil {
+		stdout = io.Discard
+	}
+	multiWriter := logging.NewRedactingWriter(io.MultiWriter(stdout, logFile, logStream), r.secretValues)
+
+	// Wrap with formatting writer to convert the agent's output to markdown
+	formattedWriter := docker.NewFormattingWriterWithFormatter(multiWriter, r.outputFormatter)
+
+	// Step 4: Launch agent container
+	stepLogger.LogStepPhase("container", "Launching agent container")
+
+	// Use agent configuration from agents.yml
+	agentConfig := r.agentConfig
+	stepLogger.LogContainerLaunch(agentConfig.Image, fmt.Sprintf("laforge-agent-%s-%s-%d", r.projectID, agentConfig.Name, time.Now().Unix()), map[string]interface{}{
+		"work_dir":     r.worktree.Path,
+		"agent_config": r.agentConfigName,
+		"timeout":      agentConfig.Runtime.Timeout,
+		"log_file":     logFilePath,
+	})
+
+	// Stop the agent if the step is cancelled while it runs
+	watcher := watchForCancel(r.projectID, r.stepID, func() {
+		stepLogger.LogWarning("step", "Step cancelled, stopping agent container", map[string]interface{}{
+			"grace_period_seconds": cancelGracePeriod,
+		})
+		if stopErr := dockerClient.CancelAgent(cancelGracePeriod); stopErr != nil {
+			stepLogger.LogWarning("docker", "Failed to stop agent container", map[string]interface{}{
+				"error": stopErr.Error(),
+			})
+		}
+	})
+
+	// Kill the agent without waiting for it to exit on a second interrupt
+	stopForceKill := context.AfterFunc(forceKillContext(ctx), func() {
+		_ = dockerClient.CancelAgent(0)
+	})
+
+	// Run container using AgentConfig with streaming logs (formatted as markdown)
+	exitCode, logs, err := dockerClient.RunAgentContainerFromConfigWithStreamingLogs(ctx, agentConfig, r.worktree.Path, r.projectID, r.leaseToken, formattedWriter, r.metrics)
+	r.exitCode = exitCode
+	r.cancelled = watcher.Stop()
+	stopForceKill()
+	for _, event := range r.metrics.BlockedEgress {
+		stepLogger.LogWarning("egress", "Blocked outbound connection not allowed by the egress policy", map[string]interface{}{
+			"method":      event.Method,
+			"destination": event.Destination(),
+			"time":        event.Time,
+		})
+	}
+	// Keep the structure of the agent's output beside the log, even if the run failed
+	if transcriptErr := writeStepTranscript(logFilePath, logs, r.secretValues); transcriptErr != nil {
+		stepLogger.LogWarning("logs", "Failed to write step transcript", map[string]interface{}{
+			"error": transcriptErr.Error(),
+		})
+	}
+	if err != nil && ctx.Err() != nil {
+		// The agent was stopped by the interrupt; its work is committed to the
+		// step branch below so the worktree can be removed
+		stepLogger.LogWarning("step", "Step interrupted, agent container stopped", map[string]interface{}{
+			"exit_code": exitCode,
+		})
+	} else if err != nil {
+		stepLogger.LogError("docker", "Failed to run agent container", err, map[string]interface{}{
+			"exit_code": exitCode,
+		})
+		return errors.Wrap(errors.ErrUnknown, err, "failed to run agent container")
+	}
+
+	stepLogger.LogContainerCompletion(exitCode, logs)
+
+	// Log resource usage
+	stepLogger.LogResourceUsage("container", map[string]interface{}{
+		"duration_ms":   r.metrics.EndTime.Sub(r.metrics.StartTime).Milliseconds(),
+		"exit_code":     r.metrics.ExitCode,
+		"log_size":      r.metrics.LogSize,
+		"error_count":   r.metrics.ErrorCount,
+		"warning_count": r.metrics.WarningCount,
+	})
+	return nil
+}
+
+// commitStepChanges commits the agent's changes to the step branch, with the
+// message the agent left in COMMIT.md, and records the step commit.
+// commitMessage is empty if nothing was committed. For conflict resolution
+// steps, unresolvedFiles lists the files that still have conflict markers.
+func (r *stepRun) commitStepChanges() (hasChanges bool, commitMessage string, unresolvedFiles []string, err error) {
+	stepLogger := r.stepLogger
+	worktreeDir := r.worktree.Path
+
+	// Step 5: Check if there are changes to commit
+	stepLogger.LogStepPhase("git", "Checking for changes to commit")
+	hasChanges, err = hasGitChanges(worktreeDir)
+	if err != nil {
+		stepLogger.LogError("git", "Failed to check for git changes", err, map[string]interface{}{
+			"repo_path": worktreeDir,
+		})
+		return false, "", nil, errors.Wrap(errors.ErrUnknown, err, "failed to check for git changes")
+	}
+
+	stepLogger.LogGitChanges(hasChanges, worktreeDir)
+
+	// The merge in progress in a conflict resolution step is always committed,
+	// even if the resolution leaves no changes to main, and is only merged into
+	// the main branch if no conflict markers remain
+	if r.opts.Conflict != nil {
+		hasChanges = true
+		unresolvedFiles, err = git.FindConflictMarkers(worktreeDir, r.conflictedFiles)
+		if err != nil {
+			stepLogger.LogError("git", "Failed to check for conflict markers", err, nil)
+			return false, "", nil, errors.Wrap(errors.ErrUnknown, err, "failed to check for conflict markers")
+		}
+	}
+
+	if hasChanges {
+		// Check if there are actual changes besides COMMIT.md
+		hasActualChanges, err := hasGitChangesExcludingCommitMD(worktreeDir)
+		if err != nil {
+			stepLogger.LogWarning("git", "Failed to check for git changes excluding COMMIT.md", map[string]interface{}{
+				"error": err.Error(),
+			})
+			// Continue anyway - try to commit
+			hasActualChanges = true
+		}
+
+		if hasActualChanges || r.opts.Conflict != nil {
+			message := fmt.Sprintf("LaForge step S%d - Automated changes", r.stepID)
+			if r.opts.Conflict != nil {
+				message = fmt.Sprintf("Merge %s into %s, resolving conflicts", r.opts.Conflict.Branch, r.project.MainBranch)
+			}
+
+			// Check for COMMIT.md and use its contents if it exists
+			if customMessage, err := getCommitMessageFromFile(worktreeDir); err != nil {
+				stepLogger.LogWarning("git", "Failed to read COMMIT.md", map[string]interface{}{
+					"error": err.Error(),
+				})
+			} else if customMessage != "" {
+				message = customMessage
+			}
+
+			stepLogger.LogGitCommit(message, worktreeDir)
+			r.opts.MergeQueue.Lock()
+			err := commitChanges(worktreeDir, message, fmt.Sprintf("S%d", r.stepID))
+			r.opts.MergeQueue.Unlock()
+			if err != nil {
+				stepLogger.LogError("git", "Failed to commit changes", err, map[string]interface{}{
+					"repo_path": worktreeDir,
+				})
+				return false, "", nil, errors.Wrap(errors.ErrUnknown, err, "failed to commit changes")
+			}
+			commitMessage = message
+			r.logger.Info("git", "Changes committed successfully", map[string]interface{}{
+				"project_id": r.projectID,
+				"step_id":    r.stepID,
+			})
+
+		} else {
+			r.logger.Info("git", "No changes to commit (only COMMIT.md was modified)", map[string]interface{}{
+				"project_id": r.projectID,
+				"step_id":    r.stepID,
+			})
+		}
+	} else {
+		r.logger.Info("git", "No changes to commit", map[string]interface{}{
+			"project_id": r.projectID,
+			"step_id":    r.stepID,
+		})
+	}
+
+	// Delete the COMMIT.md file if it exists
+	commitMDPath := filepath.Join(worktreeDir, "COMMIT.md")
+	if err := os.Remove(commitMDPath); err != nil {
+		stepLogger.LogWarning("git", "Failed to delete COMMIT.md", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Record the step branch commit and summarize what the step changed, so
+	// runaway steps stand out in the step history
+	r.opts.MergeQueue.Lock()
+	r.commitSHAAfter, r.diffStats = recordStepCommit(stepLogger, worktreeDir, r.stepID, r.commitSHABefore)
+	r.opts.MergeQueue.Unlock()
+
+	return hasChanges, commitMessage, unresolvedFiles, nil
+}
+
+// keepUnresolvedConflicts leaves the branch of a conflict resolution step that
+// did not resolve all conflicts unmerged, and notes it on the conflict's task
+func (r *stepRun) keepUnresolvedConflicts(unresolvedFiles []string) error {
+	r.stepLogger.LogWarning("git", "Conflict markers remain, keeping step branch for manual resolution", map[string]interface{}{
+		"step_branch": r.stepBranch(),
+		"files":       unresolvedFiles,
+	})
+	if updateErr := updateConflictTask(r.projectID, r.opts.Conflict, r.stepID, "", fmt.Sprintf("Step S%d left conflict markers in %s; its branch step-S%d was not merged",
+		r.stepID, strings.Join(unresolvedFiles, ", "), r.stepID)); updateErr != nil {
+		r.stepLogger.LogWarning("tasks", "Failed to update merge conflict task", map[string]interface{}{
+			"error": updateErr.Error(),
+		})
+	}
+	return errors.NewGitMergeConflictError(
+		fmt.Errorf("conflict markers remain in %s", strings.Join(unresolvedFiles, ", ")),
+		r.opts.Conflict.Branch, r.project.MainBranch)
+}
+
+// publishAndMerge pushes the step branch and opens a pull request for it, or
+// merges it into the main branch with the project's merge strategy. Failures
+// don't fail the step; the step branch is kept so it can be merged by hand.
+// The caller holds the merge queue.
+func (r *stepRun) publishAndMerge(ctx context.Context, hasChanges bool, stepCommitMessage string) {
+	project := r.project
+	stepBranch := r.stepBranch()
+
+	// Step 6: Push the step branch for review
+	// (only if the step completed successfully and committed changes)
+	if r.exitCode == 0 && stepCommitMessage != "" && project.PullRequest.IsSet() {
+		r.stepLogger.LogStepPhase("git", fmt.Sprintf("Pushing step branch to %s", project.PullRequest.Remote))
+		url, publishErr := publishStepBranch(ctx, project, r.forge, r.sourceDir, r.stepID, stepCommitMessage)
+		if publishErr != nil {
+			// Don't fail the step - the branch can still be pushed by hand
+			r.stepLogger.LogWarning("git", "Failed to push step branch or open a pull request", map[string]interface{}{
+				"step_branch": stepBranch,
+				"error":       publishErr.Error(),
+			})
+		} else if url != "" {
+			r.pullRequestURL = url
+			r.logger.Info("git", fmt.Sprintf("Opened pull request for %s: %s", stepBranch, url), map[string]interface{}{
+				"project_id":       r.projectID,
+				"step_id":          r.stepID,
+				"step_branch":      stepBranch,
+				"pull_request_url": url,
+			})
+		}
+	}
+
+	// Step 7: Automerge step branch into main branch (only if step completed successfully)
+	if r.exitCode != 0 || !hasChanges {
+		return
+	}
+	if project.MergeStrategy == git.MergeStrategyNone {
+		r.mergeStrategy = git.MergeStrategyNone
+		r.stepLogger.LogStepPhase("git", "Merge strategy is none, keeping step branch for review")
+		r.logger.Info("git", fmt.Sprintf("Step branch %s left unmerged for review", stepBranch), map[string]interface{}{
+			"project_id":  r.projectID,
+			"step_id":     r.stepID,
+			"step_branch": stepBranch,
+		})
+		return
+	}
+	if project.PullRequest.IsSet() {
+		// The step branch is merged through its pull request, so merging it
+		// locally would bypass the review
+		r.mergeStrategy = git.MergeStrategyNone
+		r.stepLogger.LogStepPhase("git", "Pull requests are enabled, keeping step branch for review")
+		r.logger.Info("git", fmt.Sprintf("Step branch %s left unmerged for its pull request", stepBranch), map[string]interface{}{
+			"project_id":  r.projectID,
+			"step_id":     r.stepID,
+			"step_branch": stepBranch,
+		})
+		return
+	}
+
+	r.mergeStrategy = project.MergeStrategy
+	r.stepLogger.LogStepPhase("git", fmt.Sprintf("Automerging step branch into %s branch with the %s strategy", project.MainBranch, r.mergeStrategy))
+
+	mergeMessage := fmt.Sprintf("Automerge %s into %s", stepBranch, project.MainBranch)
+	if r.mergeStrategy == git.MergeStrategySquash && stepCommitMessage != "" {
+		// The squash commit replaces the step's commits, so it keeps their message
+		mergeMessage = stepCommitMessage
+	}
+
+	sha, rebasedOnto, mergeErr := r.opts.MergeQueue.merge(ctx, r.sourceDir, r.worktree.Path, stepBranch, project.MainBranch, mergeMessage, r.mergeStrategy)
+	if mergeErr != nil {
+		r.handleMergeConflict(mergeErr)
+		return
+	}
+
+	r.mergeCommitSHA = sha
+	if rebasedOnto != "" {
+		// The step's commit was rebased before it merged, so the commit
+		// recorded before the merge is no longer on the step branch
+		r.commitSHAAfter, r.diffStats = recordStepCommit(r.stepLogger, r.worktree.Path, r.stepID, rebasedOnto)
+	}
+	r.cleanUpMergedStep()
+}
+
+// handleMergeConflict keeps the step branch after a failed automerge. A merge
+// conflict is handed to a conflict resolution step if the project resolves
+// conflicts, or noted on the conflict's task if this step was resolving one.
+func (r *stepRun) handleMergeConflict(mergeErr error) {
+	stepBranch := r.stepBranch()
+	mainBranch := r.project.MainBranch
+
+	if !errors.IsErrorType(mergeErr, errors.ErrGitMergeConflict) {
+		// Log other merge failures but don't fail the step - keep branch for manual resolution
+		r.stepLogger.LogWarning("git", "Automerge failed, keeping step branch for manual resolution", map[string]interface{}{
+			"step_branch": stepBranch,
+			"error":       mergeErr.Error(),
+		})
+		r.logger.Info("git", fmt.Sprintf("Automerge failed for %s, branch preserved for manual resolution", stepBranch), map[string]interface{}{
+			"project_id":  r.projectID,
+			"step_id":     r.stepID,
+			"step_branch": stepBranch,
+			"error":       mergeErr.Error(),
+		})
+		return
+	}
+
+	// Log merge conflict but don't fail the step - keep branch for manual resolution
+	r.stepLogger.LogWarning("git", "Merge conflict detected, keeping step branch for manual resolution", map[string]interface{}{
+		"step_branch": stepBranch,
+		"error":       mergeErr.Error(),
+	})
+	r.logger.Info("git", fmt.Sprintf("Merge conflict in %s, branch preserved for manual resolution", stepBranch), map[string]interface{}{
+		"project_id":  r.projectID,
+		"step_id":     r.stepID,
+		"step_branch": stepBranch,
+		"error_type":  "merge_conflict",
+	})
+
+	if r.opts.Conflict != nil {
+		// The main branch moved on while the conflict was being resolved;
+		// leave it to a human rather than resolving it again
+		if updateErr := updateConflictTask(r.projectID, r.opts.Conflict, r.stepID, "", fmt.Sprintf("Step S%d resolved the conflicts, but %s conflicts with %s again", r.stepID, stepBranch, mainBranch)); updateErr != nil {
+			r.stepLogger.LogWarning("tasks", "Failed to update merge conflict task", map[string]interface{}{
+				"error": updateErr.Error(),
+			})
+		}
+	} else if r.agentsConfig.ResolvesConflicts() {
+		conflict, taskErr := createConflictTask(r.projectID, r.stepID, mainBranch)
+		if taskErr != nil {
+			r.stepLogger.LogWarning("tasks", "Failed to create merge conflict task", map[string]interface{}{
+				"error": taskErr.Error(),
+			})
+		} else {
+			r.result.MergeConflict = conflict
+		}
+	}
+}
+
+// cleanUpMergedStep removes the worktree and branch of a merged step. If the
+// step resolved a merge conflict, the conflicted branch is deleted as well and
+// the conflict's task is completed.
+func (r *stepRun) cleanUpMergedStep() {
+	stepBranch := r.stepBranch()
+
+	// Merge successful, clean up worktree first, then delete step branch
+	r.stepLogger.LogStepPhase("git", "Merge successful, cleaning up worktree and step branch")
+
+	// Remove worktree before attempting branch deletion
+	r.stepLogger.LogWorktreeCleanup(r.worktree.Path)
+	if cleanupErr := git.RemoveWorktree(r.worktree); cleanupErr != nil {
+		r.stepLogger.LogWarning("git", "Failed to remove worktree after successful merge", map[string]interface{}{
+			"error": cleanupErr.Error(),
+		})
+	} else {
+		r.worktreeRemoved = true // Mark worktree as removed to prevent double cleanup in removeWorktree
+	}
+
+	// Now delete the step branch
+	if deleteErr := git.DeleteBranch(r.sourceDir, stepBranch); deleteErr != nil {
+		r.stepLogger.LogWarning("git", "Failed to delete step branch after successful merge", map[string]interface{}{
+			"step_branch": stepBranch,
+			"error":       deleteErr.Error(),
+		})
+	} else {
+		r.logger.Info("git", fmt.Sprintf("Successfully automerged %s into %s and deleted step branch", stepBranch, r.project.MainBranch), map[string]interface{}{
+			"project_id":  r.projectID,
+			"step_id":     r.stepID,
+			"step_branch": stepBranch,
+		})
+	}
+
+	if r.opts.Conflict != nil {
+		// The conflicted branch is now merged through this step's branch
+		if deleteErr := git.DeleteBranch(r.sourceDir, r.opts.Conflict.Branch); deleteErr != nil {
+			r.stepLogger.LogWarning("git", "Failed to delete conflicted step branch after resolving it", map[string]interface{}{
+				"step_branch": r.opts.Conflict.Branch,
+				"error":       deleteErr.Error(),
+			})
+		}
+		if updateErr := updateConflictTask(r.projectID, r.opts.Conflict, r.stepID, "completed", fmt.Sprintf("Step S%d resolved the conflicts and merged %s into %s", r.stepID, r.opts.Conflict.Branch, r.project.MainBranch)); updateErr != nil {
+			r.stepLogger.LogWarning("tasks", "Failed to update merge conflict task", map[string]interface{}{
+				"error": updateErr.Error(),
+			})
+		}
+	}
+}
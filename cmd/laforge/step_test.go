@@ -0,0 +1,730 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/docker"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/git"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+	"github.com/tomyedwab/laforge/lib/tasks"
+)
+
+// runGit runs a git command in dir and fails the test on error
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// setupFakeProject creates the project "fake-project" in a fresh repository,
+// with ~/.laforge isolated, and runs the test from the repository
+func setupFakeProject(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	repoDir := t.TempDir()
+	runGit(t, repoDir, "init", "-b", "main")
+	runGit(t, repoDir, "config", "user.email", "test@example.com")
+	runGit(t, repoDir, "config", "user.name", "Test User")
+	if err := os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("# Test\n"), 0644); err != nil {
+		t.Fatalf("Failed to write README: %v", err)
+	}
+	runGit(t, repoDir, "add", ".")
+	runGit(t, repoDir, "commit", "-m", "Initial commit")
+	t.Chdir(repoDir)
+
+	if _, err := projects.CreateProject("fake-project", "Fake Project", "", repoDir, "main"); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	return repoDir
+}
+
+func TestExecuteStepWithFakeRuntime(t *testing.T) {
+	repoDir := setupFakeProject(t)
+
+	// Stub the laserve step endpoints
+	var finalized steps.FinalizeStepRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/projects/fake-project/steps/lease":
+			json.NewEncoder(w).Encode(steps.LeaseStepResponse{StepID: 7, Token: "step-token"})
+		case "/api/v1/projects/fake-project/steps/finalize":
+			json.NewDecoder(r.Body).Decode(&finalized)
+			json.NewEncoder(w).Encode(steps.FinalizeStepResponse{Status: "ok"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("LAFORGE_URLPATH", server.URL+"/api/v1")
+	t.Setenv("LAFORGE_API_KEY", "test-key")
+
+	// The fake agent edits the worktree and leaves a commit message
+	fake := docker.NewFakeRuntime()
+	fake.Agent = func(container *docker.Container) (int64, string) {
+		if container.ApiToken != "step-token" {
+			return 1, "unexpected token " + container.ApiToken + "\n"
+		}
+		os.WriteFile(filepath.Join(container.WorkDir, "agent.txt"), []byte("done\n"), 0644)
+		os.WriteFile(filepath.Join(container.WorkDir, "COMMIT.md"), []byte("Add agent output"), 0644)
+		return 0, `{"type":"assistant","message":{"id":"m1","content":[{"type":"tool_use","id":"t1","name":"Write","input":{"file_path":"agent.txt"}}]}}` + "\n" +
+			`{"type":"result","subtype":"success","result":"agent finished","num_turns":1}` + "\n"
+	}
+	originalClient := newContainerClient
+	newContainerClient = func(engine string) (*docker.Client, error) {
+		return docker.NewClientWithRuntime(fake), nil
+	}
+	defer func() { newContainerClient = originalClient }()
+
+	result, err := executeStep(context.Background(), "fake-project", stepOptions{Quiet: true})
+	if err != nil {
+		t.Fatalf("executeStep failed: %v", err)
+	}
+	if result.StepID != 7 || result.ExitCode != 0 {
+		t.Errorf("Unexpected step result: %+v", result)
+	}
+	if finalized.StepID != 7 || finalized.ExitCode != 0 {
+		t.Errorf("Unexpected finalize request: %+v", finalized)
+	}
+
+	// The step's commit and the files it changed are recorded
+	if finalized.CommitSHAAfter != runGit(t, repoDir, "rev-parse", "main") {
+		t.Errorf("Expected the agent commit to be recorded, got %q", finalized.CommitSHAAfter)
+	}
+	if stats := finalized.DiffStats; stats == nil || stats.FilesChanged != 1 || stats.Insertions != 1 ||
+		stats.Files[0].Path != "agent.txt" || stats.Files[0].Status != "added" {
+		t.Errorf("Unexpected diff stats: %+v", finalized.DiffStats)
+	}
+
+	// The agent's commit is merged into main and the step branch is cleaned up
+	if subject := runGit(t, repoDir, "log", "-1", "--format=%s", "main"); subject != "Add agent output" {
+		t.Errorf("Expected agent commit on main, got %q", subject)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "agent.txt")); err != nil {
+		t.Errorf("Expected agent.txt in the repository: %v", err)
+	}
+	if branches := runGit(t, repoDir, "branch", "--list", "step-S7"); branches != "" {
+		t.Errorf("Expected step branch to be deleted, got %q", branches)
+	}
+	if fake.Existing() != 0 {
+		t.Errorf("Expected agent container to be removed, %d remain", fake.Existing())
+	}
+
+	// The agent's stream-json output is stored as a transcript beside the log
+	entries, err := projects.ReadStepTranscript("fake-project", 7)
+	if err != nil {
+		t.Fatalf("Failed to read step transcript: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Tool == nil || entries[0].Tool.Name != "Write" || entries[1].Text != "agent finished" {
+		t.Errorf("Unexpected step transcript: %+v", entries)
+	}
+}
+
+func TestExecuteStepCancelled(t *testing.T) {
+	repoDir := setupFakeProject(t)
+	originalInterval := cancelPollInterval
+	cancelPollInterval = 10 * time.Millisecond
+	defer func() { cancelPollInterval = originalInterval }()
+
+	// Stub the laserve step endpoints, reporting the step as cancelled
+	var finalized steps.FinalizeStepRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/projects/fake-project/steps/lease":
+			json.NewEncoder(w).Encode(steps.LeaseStepResponse{StepID: 7, Token: "step-token"})
+		case "/api/v1/projects/fake-project/steps/7":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"step": map[string]interface{}{"id": 7, "cancel_requested_at": time.Now()},
+				},
+			})
+		case "/api/v1/projects/fake-project/steps/finalize":
+			json.NewDecoder(r.Body).Decode(&finalized)
+			json.NewEncoder(w).Encode(steps.FinalizeStepResponse{Status: "ok"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("LAFORGE_URLPATH", server.URL+"/api/v1")
+	t.Setenv("LAFORGE_API_KEY", "test-key")
+
+	// The fake agent makes a change and then works until it is released
+	release := make(chan struct{})
+	defer close(release)
+	fake := docker.NewFakeRuntime()
+	fake.Agent = func(container *docker.Container) (int64, string) {
+		os.WriteFile(filepath.Join(container.WorkDir, "agent.txt"), []byte("partial\n"), 0644)
+		os.WriteFile(filepath.Join(container.WorkDir, "COMMIT.md"), []byte("Partial agent output"), 0644)
+		<-release
+		return 0, "agent finished\n"
+	}
+	originalClient := newContainerClient
+	newContainerClient = func(engine string) (*docker.Client, error) {
+		return docker.NewClientWithRuntime(fake), nil
+	}
+	defer func() { newContainerClient = originalClient }()
+
+	result, err := executeStep(context.Background(), "fake-project", stepOptions{Quiet: true})
+	if !errors.IsErrorType(err, errors.ErrStepCancelled) {
+		t.Fatalf("Expected a step cancelled error, got %v", err)
+	}
+	if result == nil || result.ExitCode != steps.ExitCodeCancelled {
+		t.Errorf("Unexpected step result: %+v", result)
+	}
+	if finalized.StepID != 7 || finalized.ExitCode != steps.ExitCodeCancelled {
+		t.Errorf("Unexpected finalize request: %+v", finalized)
+	}
+
+	// The cancelled step is not merged into main
+	if subject := runGit(t, repoDir, "log", "-1", "--format=%s", "main"); subject != "Initial commit" {
+		t.Errorf("Expected main to be unchanged, got %q", subject)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "agent.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected agent.txt not to be merged: %v", err)
+	}
+}
+
+func TestExecuteStepInterrupted(t *testing.T) {
+	repoDir := setupFakeProject(t)
+
+	// Stub the laserve step endpoints
+	var finalized steps.FinalizeStepRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/projects/fake-project/steps/lease":
+			json.NewEncoder(w).Encode(steps.LeaseStepResponse{StepID: 7, Token: "step-token"})
+		case "/api/v1/projects/fake-project/steps/finalize":
+			json.NewDecoder(r.Body).Decode(&finalized)
+			json.NewEncoder(w).Encode(steps.FinalizeStepResponse{Status: "ok"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("LAFORGE_URLPATH", server.URL+"/api/v1")
+	t.Setenv("LAFORGE_API_KEY", "test-key")
+
+	// The step is interrupted once the fake agent has made a change
+	ctx, interrupt := context.WithCancel(context.Background())
+	defer interrupt()
+	release := make(chan struct{})
+	defer close(release)
+	fake := docker.NewFakeRuntime()
+	fake.Agent = func(container *docker.Container) (int64, string) {
+		os.WriteFile(filepath.Join(container.WorkDir, "agent.txt"), []byte("partial\n"), 0644)
+		os.WriteFile(filepath.Join(container.WorkDir, "COMMIT.md"), []byte("Partial agent output"), 0644)
+		interrupt()
+		<-release
+		return 0, "agent finished\n"
+	}
+	originalClient := newContainerClient
+	newContainerClient = func(engine string) (*docker.Client, error) {
+		return docker.NewClientWithRuntime(fake), nil
+	}
+	defer func() { newContainerClient = originalClient }()
+
+	result, err := executeStep(ctx, "fake-project", stepOptions{Quiet: true})
+	if !errors.IsErrorType(err, errors.ErrStepInterrupted) {
+		t.Fatalf("Expected a step interrupted error, got %v", err)
+	}
+	if result == nil || result.ExitCode != steps.ExitCodeInterrupted {
+		t.Errorf("Unexpected step result: %+v", result)
+	}
+	if finalized.StepID != 7 || finalized.ExitCode != steps.ExitCodeInterrupted {
+		t.Errorf("Unexpected finalize request: %+v", finalized)
+	}
+
+	// The agent's work is kept on the step branch, and the worktree and container are cleaned up
+	if subject := runGit(t, repoDir, "log", "-1", "--format=%s", "main"); subject != "Initial commit" {
+		t.Errorf("Expected main to be unchanged, got %q", subject)
+	}
+	if subject := runGit(t, repoDir, "log", "-1", "--format=%s", "step-S7"); subject != "Partial agent output" {
+		t.Errorf("Expected the agent's work on the step branch, got %q", subject)
+	}
+	if worktrees := runGit(t, repoDir, "worktree", "list"); strings.Contains(worktrees, "step-S7") {
+		t.Errorf("Expected the step worktree to be removed, got %q", worktrees)
+	}
+	if fake.Existing() != 0 {
+		t.Errorf("Expected agent container to be removed, %d remain", fake.Existing())
+	}
+}
+
+func TestExecuteStepMergeStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		// mainSubject is the subject of the last commit on main after the step
+		mainSubject string
+		merged      bool
+	}{
+		{strategy: "squash", mainSubject: "Add agent output", merged: true},
+		{strategy: "rebase", mainSubject: "Add agent output", merged: true},
+		{strategy: "none", mainSubject: "Initial commit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			repoDir := setupFakeProject(t)
+			if _, err := projects.UpdateProjectMergeStrategy("fake-project", tt.strategy); err != nil {
+				t.Fatalf("Failed to set merge strategy: %v", err)
+			}
+
+			var finalized steps.FinalizeStepRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v1/projects/fake-project/steps/lease":
+					json.NewEncoder(w).Encode(steps.LeaseStepResponse{StepID: 7, Token: "step-token"})
+				case "/api/v1/projects/fake-project/steps/finalize":
+					json.NewDecoder(r.Body).Decode(&finalized)
+					json.NewEncoder(w).Encode(steps.FinalizeStepResponse{Status: "ok"})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+			t.Setenv("LAFORGE_URLPATH", server.URL+"/api/v1")
+			t.Setenv("LAFORGE_API_KEY", "test-key")
+
+			fake := docker.NewFakeRuntime()
+			fake.Agent = func(container *docker.Container) (int64, string) {
+				os.WriteFile(filepath.Join(container.WorkDir, "agent.txt"), []byte("done\n"), 0644)
+				os.WriteFile(filepath.Join(container.WorkDir, "COMMIT.md"), []byte("Add agent output"), 0644)
+				return 0, "agent finished\n"
+			}
+			originalClient := newContainerClient
+			newContainerClient = func(engine string) (*docker.Client, error) {
+				return docker.NewClientWithRuntime(fake), nil
+			}
+			defer func() { newContainerClient = originalClient }()
+
+			if _, err := executeStep(context.Background(), "fake-project", stepOptions{Quiet: true}); err != nil {
+				t.Fatalf("executeStep failed: %v", err)
+			}
+
+			if subject := runGit(t, repoDir, "log", "-1", "--format=%s", "main"); subject != tt.mainSubject {
+				t.Errorf("Expected %q on main, got %q", tt.mainSubject, subject)
+			}
+			if finalized.MergeStrategy != tt.strategy {
+				t.Errorf("Expected merge strategy %q to be recorded, got %q", tt.strategy, finalized.MergeStrategy)
+			}
+			main := runGit(t, repoDir, "rev-parse", "main")
+			if tt.merged && finalized.MergeCommitSHA != main {
+				t.Errorf("Expected merge commit %s to be recorded, got %q", main, finalized.MergeCommitSHA)
+			}
+			if !tt.merged {
+				if finalized.MergeCommitSHA != "" {
+					t.Errorf("Expected no merge commit, got %q", finalized.MergeCommitSHA)
+				}
+				if branches := runGit(t, repoDir, "branch", "--list", "step-S7"); branches == "" {
+					t.Error("Expected the step branch to be kept for review")
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteStepOpensPullRequest(t *testing.T) {
+	repoDir := setupFakeProject(t)
+	remoteDir := t.TempDir()
+	runGit(t, remoteDir, "init", "--bare")
+	runGit(t, repoDir, "remote", "add", "origin", remoteDir)
+
+	var finalized steps.FinalizeStepRequest
+	var opened map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/projects/fake-project/steps/lease":
+			json.NewEncoder(w).Encode(steps.LeaseStepResponse{StepID: 7, Token: "step-token"})
+		case "/api/v1/projects/fake-project/steps/finalize":
+			json.NewDecoder(r.Body).Decode(&finalized)
+			json.NewEncoder(w).Encode(steps.FinalizeStepResponse{Status: "ok"})
+		case "/forge/api/v1/repos/owner/repo/pulls":
+			if r.Header.Get("Authorization") != "token forge-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&opened)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number":1,"html_url":"https://git.example.com/owner/repo/pulls/1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("LAFORGE_URLPATH", server.URL+"/api/v1")
+	t.Setenv("LAFORGE_API_KEY", "test-key")
+
+	if _, err := projects.UpdateProjectPullRequest("fake-project", projects.PullRequestConfig{
+		Remote:     "origin",
+		Forge:      "gitea",
+		APIURL:     server.URL + "/forge/api/v1",
+		Repository: "owner/repo",
+		Token:      "forge-token",
+	}); err != nil {
+		t.Fatalf("Failed to configure pull requests: %v", err)
+	}
+
+	fake := docker.NewFakeRuntime()
+	fake.Agent = func(container *docker.Container) (int64, string) {
+		os.WriteFile(filepath.Join(container.WorkDir, "agent.txt"), []byte("done\n"), 0644)
+		os.WriteFile(filepath.Join(container.WorkDir, "COMMIT.md"), []byte("Add agent output\n\nWrites agent.txt."), 0644)
+		return 0, "agent finished\n"
+	}
+	originalClient := newContainerClient
+	newContainerClient = func(engine string) (*docker.Client, error) {
+		return docker.NewClientWithRuntime(fake), nil
+	}
+	defer func() { newContainerClient = originalClient }()
+
+	if _, err := executeStep(context.Background(), "fake-project", stepOptions{Quiet: true}); err != nil {
+		t.Fatalf("executeStep failed: %v", err)
+	}
+
+	if got, want := runGit(t, remoteDir, "rev-parse", "step-S7"), runGit(t, repoDir, "rev-parse", "step-S7"); got != want {
+		t.Errorf("Expected the step branch to be pushed at %s, got %s", want, got)
+	}
+	if opened["title"] != "Add agent output" || opened["head"] != "step-S7" || opened["base"] != "main" {
+		t.Errorf("Unexpected pull request %+v", opened)
+	}
+	if !strings.HasPrefix(opened["body"], "Writes agent.txt.") {
+		t.Errorf("Expected the rest of the commit message in the pull request body, got %q", opened["body"])
+	}
+	if finalized.PullRequestURL != "https://git.example.com/owner/repo/pulls/1" {
+		t.Errorf("Expected the pull request URL to be recorded, got %q", finalized.PullRequestURL)
+	}
+
+	// The default merge strategy must not merge the branch behind the pull request's back
+	if finalized.MergeStrategy != "none" || finalized.MergeCommitSHA != "" {
+		t.Errorf("Expected the step branch to be left unmerged, got strategy %q and merge commit %q", finalized.MergeStrategy, finalized.MergeCommitSHA)
+	}
+	if files := runGit(t, repoDir, "ls-tree", "--name-only", "main"); strings.Contains(files, "agent.txt") {
+		t.Errorf("Expected agent.txt to stay off the main branch, got %q", files)
+	}
+}
+
+func TestExecuteStepResolvesMergeConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolved string
+		wantErr  bool
+	}{
+		{name: "resolved", resolved: "# Test\nFrom main\nFrom the agent\n"},
+		{name: "markers remain", resolved: "<<<<<<< HEAD\nFrom main\n=======\nFrom the agent\n>>>>>>> step-S7\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoDir := setupFakeProject(t)
+
+			nextStepID := 7
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v1/projects/fake-project/steps/lease":
+					json.NewEncoder(w).Encode(steps.LeaseStepResponse{StepID: nextStepID, Token: "step-token"})
+					nextStepID++
+				case "/api/v1/projects/fake-project/steps/finalize":
+					// Apply the step's queued task updates like laserve
+					var req steps.FinalizeStepRequest
+					json.NewDecoder(r.Body).Decode(&req)
+					db, _ := projects.OpenProjectTaskDatabase("fake-project")
+					tasks.UnleaseTasksForStepID(db, req.StepID)
+					db.Close()
+					json.NewEncoder(w).Encode(steps.FinalizeStepResponse{Status: "ok"})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+			t.Setenv("LAFORGE_URLPATH", server.URL+"/api/v1")
+			t.Setenv("LAFORGE_API_KEY", "test-key")
+
+			var prompt string
+			fake := docker.NewFakeRuntime()
+			fake.Agent = func(container *docker.Container) (int64, string) {
+				readme := filepath.Join(container.WorkDir, "README.md")
+				if p, ok := container.Config.Environment["LAFORGE_PROMPT"]; ok {
+					prompt = p
+					os.WriteFile(readme, []byte(tt.resolved), 0644)
+					return 0, "resolved\n"
+				}
+				// Someone else changes the same line on main while the agent works
+				os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("# Test\nFrom main\n"), 0644)
+				runGit(t, repoDir, "commit", "-am", "Change README on main")
+				os.WriteFile(readme, []byte("# Test\nFrom the agent\n"), 0644)
+				os.WriteFile(filepath.Join(container.WorkDir, "COMMIT.md"), []byte("Change README"), 0644)
+				return 0, "changed\n"
+			}
+			originalClient := newContainerClient
+			newContainerClient = func(engine string) (*docker.Client, error) {
+				return docker.NewClientWithRuntime(fake), nil
+			}
+			defer func() { newContainerClient = originalClient }()
+
+			opts := stepOptions{Quiet: true}
+			result, err := executeStep(context.Background(), "fake-project", opts)
+			if err != nil {
+				t.Fatalf("executeStep failed: %v", err)
+			}
+			conflict := result.MergeConflict
+			if conflict == nil || conflict.Branch != "step-S7" {
+				t.Fatalf("Expected a merge conflict for step-S7, got %+v", conflict)
+			}
+
+			mainBefore := runGit(t, repoDir, "rev-parse", "main")
+			result, resolveErr := executeConflictResolution(context.Background(), "fake-project", opts, conflict)
+			if result == nil || result.StepID != 8 {
+				t.Fatalf("Expected the conflict to be resolved in step S8, got %+v (%v)", result, resolveErr)
+			}
+			if !strings.Contains(prompt, "- README.md") || !strings.Contains(prompt, "step-S7") {
+				t.Errorf("Expected the prompt to name the branch and conflicted files, got %q", prompt)
+			}
+
+			db, err := projects.OpenProjectTaskDatabase("fake-project")
+			if err != nil {
+				t.Fatalf("Failed to open task database: %v", err)
+			}
+			defer db.Close()
+			task, _ := tasks.GetTask(db, conflict.TaskID)
+			if task == nil || task.Title != "Resolve merge conflict for step-S7" {
+				t.Fatalf("Expected the merge conflict task, got %+v", task)
+			}
+			logs, _ := tasks.GetTaskLogs(db, conflict.TaskID)
+
+			if tt.wantErr {
+				if !errors.IsErrorType(resolveErr, errors.ErrGitMergeConflict) {
+					t.Errorf("Expected a merge conflict error, got %v", resolveErr)
+				}
+				if main := runGit(t, repoDir, "rev-parse", "main"); main != mainBefore {
+					t.Error("Expected main to be left alone while conflict markers remain")
+				}
+				if runGit(t, repoDir, "branch", "--list", "step-S7") == "" || runGit(t, repoDir, "branch", "--list", "step-S8") == "" {
+					t.Error("Expected both step branches to be kept for manual resolution")
+				}
+				if task.Status != "todo" || len(logs) != 1 || !strings.Contains(logs[0].Message, "left conflict markers in README.md") {
+					t.Errorf("Expected the task to stay open with a log, got %q %+v", task.Status, logs)
+				}
+				return
+			}
+
+			if resolveErr != nil {
+				t.Fatalf("Conflict resolution failed: %v", resolveErr)
+			}
+			content, _ := os.ReadFile(filepath.Join(repoDir, "README.md"))
+			if string(content) != tt.resolved {
+				t.Errorf("Expected the resolution on main, got %q", content)
+			}
+			if branches := runGit(t, repoDir, "branch", "--list", "step-S*"); branches != "" {
+				t.Errorf("Expected the step branches to be deleted, got %q", branches)
+			}
+			if task.Status != "completed" || len(logs) != 1 {
+				t.Errorf("Expected the task to be completed with a log, got %q %+v", task.Status, logs)
+			}
+		})
+	}
+}
+
+func TestExecuteParallelSteps(t *testing.T) {
+	repoDir := setupFakeProject(t)
+	// Fast-forward merges fail once a sibling has merged, so the second
+	// branch is only merged if the merge queue rebases it
+	if _, err := projects.UpdateProjectMergeStrategy("fake-project", "ff-only"); err != nil {
+		t.Fatalf("Failed to set merge strategy: %v", err)
+	}
+
+	db, err := projects.OpenProjectTaskDatabase("fake-project")
+	if err != nil {
+		t.Fatalf("Failed to open task database: %v", err)
+	}
+	tasks.AddTask(db, "Add a.txt", nil)
+	tasks.AddTask(db, "Add b.txt", nil)
+	readyTasks, err := tasks.GetReadyTasks(db, 2)
+	db.Close()
+	if err != nil || len(readyTasks) != 2 {
+		t.Fatalf("Expected two ready tasks, got %+v (%v)", readyTasks, err)
+	}
+
+	var mu sync.Mutex
+	nextStepID := 1
+	groups := map[string]bool{}
+	finalized := map[int]steps.FinalizeStepRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v1/projects/fake-project/steps/lease":
+			var req steps.LeaseStepRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			groups[req.ParallelGroup] = true
+			json.NewEncoder(w).Encode(steps.LeaseStepResponse{StepID: nextStepID, Token: "step-token"})
+			nextStepID++
+		case "/api/v1/projects/fake-project/steps/finalize":
+			var req steps.FinalizeStepRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			finalized[req.StepID] = req
+			db, _ := projects.OpenProjectTaskDatabase("fake-project")
+			leased, _ := tasks.GetLeasedTaskIDsForStep(db, req.StepID)
+			tasks.UnleaseTasksForStepID(db, req.StepID)
+			db.Close()
+			json.NewEncoder(w).Encode(steps.FinalizeStepResponse{Status: "ok", LeasedTaskIDs: leased})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("LAFORGE_URLPATH", server.URL+"/api/v1")
+	t.Setenv("LAFORGE_API_KEY", "test-key")
+
+	// Both agents must be running at the same time before either finishes
+	var running sync.WaitGroup
+	running.Add(2)
+	fake := docker.NewFakeRuntime()
+	fake.Agent = func(container *docker.Container) (int64, string) {
+		running.Done()
+		done := make(chan struct{})
+		go func() { running.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			return 1, "sibling never started\n"
+		}
+
+		prompt := container.Config.Environment["LAFORGE_PROMPT"]
+		name := "a.txt"
+		if strings.Contains(prompt, fmt.Sprintf("task T%d.", readyTasks[1].ID)) {
+			name = "b.txt"
+		}
+		os.WriteFile(filepath.Join(container.WorkDir, name), []byte(prompt+"\n"), 0644)
+		return 0, "added " + name + "\n"
+	}
+	originalClient := newContainerClient
+	newContainerClient = func(engine string) (*docker.Client, error) {
+		return docker.NewClientWithRuntime(fake), nil
+	}
+	defer func() { newContainerClient = originalClient }()
+
+	outcomes := executeParallelSteps(context.Background(), "fake-project", stepOptions{Quiet: true}, readyTasks)
+	if len(outcomes) != 2 {
+		t.Fatalf("Expected two outcomes, got %d", len(outcomes))
+	}
+	for i, outcome := range outcomes {
+		if outcome.Err != nil || outcome.Result == nil || outcome.Result.ExitCode != 0 {
+			t.Fatalf("Expected step %d to succeed, got %+v (%v)", i, outcome.Result, outcome.Err)
+		}
+		if leased := outcome.Result.LeasedTaskIDs; len(leased) != 1 || leased[0] != readyTasks[i].ID {
+			t.Errorf("Expected step %d to lease task T%d, got %v", i, readyTasks[i].ID, leased)
+		}
+		if outcome.Result.MergeConflict != nil {
+			t.Errorf("Expected step %d to merge without a conflict", i)
+		}
+	}
+
+	if len(groups) != 1 || groups[""] {
+		t.Errorf("Expected both steps to be leased in the same parallel group, got %v", groups)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(repoDir, name)); err != nil {
+			t.Errorf("Expected %s to be merged into main: %v", name, err)
+		}
+	}
+	if branches := runGit(t, repoDir, "branch", "--list", "step-S*"); branches != "" {
+		t.Errorf("Expected the step branches to be merged and deleted, got %q", branches)
+	}
+	if parents := strings.Fields(runGit(t, repoDir, "log", "-1", "--format=%P")); len(parents) != 1 {
+		t.Errorf("Expected a linear history from fast-forward merges, got parents %v", parents)
+	}
+
+	// The step rebased by the merge queue records its rebased commit, which
+	// only adds its own file
+	mainLog := runGit(t, repoDir, "log", "--format=%H", "main")
+	if len(finalized) != 2 {
+		t.Fatalf("Expected two finalized steps, got %d", len(finalized))
+	}
+	for stepID, req := range finalized {
+		if !strings.Contains(mainLog, req.CommitSHAAfter) {
+			t.Errorf("Expected step S%d to record a commit on main, got %s", stepID, req.CommitSHAAfter)
+		}
+		if req.DiffStats == nil || req.DiffStats.FilesChanged != 1 {
+			t.Errorf("Expected step S%d to change one file, got %+v", stepID, req.DiffStats)
+		}
+		if kept := runGit(t, repoDir, "rev-parse", git.StepCommitRef(stepID)); kept != req.CommitSHAAfter {
+			t.Errorf("Expected the ref of step S%d to keep %s, got %s", stepID, req.CommitSHAAfter, kept)
+		}
+	}
+}
+
+func TestExecuteStepFailsIfAssignedTaskIsLeased(t *testing.T) {
+	setupFakeProject(t)
+
+	// Another run already leased the task
+	db, err := projects.OpenProjectTaskDatabase("fake-project")
+	if err != nil {
+		t.Fatalf("Failed to open task database: %v", err)
+	}
+	taskID, _ := tasks.AddTask(db, "Add a.txt", nil)
+	if err := tasks.LeaseTask(db, taskID, 3); err != nil {
+		t.Fatalf("Failed to lease task: %v", err)
+	}
+	db.Close()
+
+	var finalized *steps.FinalizeStepRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/projects/fake-project/steps/lease":
+			json.NewEncoder(w).Encode(steps.LeaseStepResponse{StepID: 4, Token: "step-token"})
+		case "/api/v1/projects/fake-project/steps/finalize":
+			finalized = &steps.FinalizeStepRequest{}
+			json.NewDecoder(r.Body).Decode(finalized)
+			json.NewEncoder(w).Encode(steps.FinalizeStepResponse{Status: "ok"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("LAFORGE_URLPATH", server.URL+"/api/v1")
+	t.Setenv("LAFORGE_API_KEY", "test-key")
+
+	fake := docker.NewFakeRuntime()
+	agentRan := false
+	fake.Agent = func(container *docker.Container) (int64, string) {
+		agentRan = true
+		return 0, ""
+	}
+	originalClient := newContainerClient
+	newContainerClient = func(engine string) (*docker.Client, error) {
+		return docker.NewClientWithRuntime(fake), nil
+	}
+	defer func() { newContainerClient = originalClient }()
+
+	result, err := executeStep(context.Background(), "fake-project", stepOptions{Quiet: true, TaskID: taskID})
+	if err == nil {
+		t.Fatal("Expected the step to fail when its task is leased by another step")
+	}
+	if agentRan {
+		t.Error("Expected the agent not to run")
+	}
+	if result == nil || result.StepID != 4 || result.ExitCode != 1 {
+		t.Errorf("Unexpected step result: %+v", result)
+	}
+	if finalized == nil || finalized.StepID != 4 || finalized.ExitCode != 1 {
+		t.Errorf("Expected the step to be finalized as failed, got %+v", finalized)
+	}
+}
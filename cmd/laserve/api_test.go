@@ -45,13 +45,13 @@ func TestAPIEndpoints(t *testing.T) {
 
 		// Login
 		t.Run("Login", func(t *testing.T) {
-			req, err := http.NewRequest("POST", "/api/v1/public/login", nil)
+			req, err := http.NewRequest("POST", "/api/v1/public/login", strings.NewReader(`{"username":"test-user","password":"test-password"}`))
 			if err != nil {
 				t.Fatal(err)
 			}
 
 			rr := httptest.NewRecorder()
-			loginHandler := makeLoginHandler(jwtManager)
+			loginHandler := makeLoginHandler(jwtManager, newTestUserDB(t))
 			loginHandler.ServeHTTP(rr, req)
 
 			if status := rr.Code; status != http.StatusOK {
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tomyedwab/laforge/lib/users"
+)
+
+const apiKeyUsage = `Usage: laserve apikey <command> [options] [name]
+
+Manage long-lived API keys for CI and the laforge host process.
+
+Commands:
+  create [options] <name>   Create a key and print its secret
+  revoke <name>             Delete a key
+  list                      List keys and when they were last used
+
+Options:
+  -users-db string    Path to the user database (default ~/.laforge/users.db)
+  -role string        Key role for create: read-only, task-writer or step-runner
+  -projects string    Comma-separated project IDs for create, or '*' for all projects
+
+The secret is shown only once, when the key is created. Only a hash is stored.
+`
+
+// runAPIKeyCommand implements the "laserve apikey" admin subcommands and returns
+// the process exit code
+func runAPIKeyCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, apiKeyUsage)
+		return 2
+	}
+
+	command := args[0]
+	fs := flag.NewFlagSet("apikey "+command, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, apiKeyUsage) }
+	usersDB := fs.String("users-db", "", "Path to the user database")
+	role := fs.String("role", string(users.RoleReadOnly), "Key role")
+	projectList := fs.String("projects", "", "Comma-separated project IDs, or '*' for all projects")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	expectedArgs := 1
+	if command == "list" {
+		expectedArgs = 0
+	}
+	if fs.NArg() != expectedArgs {
+		fs.Usage()
+		return 2
+	}
+
+	udb, err := openUserDB(*usersDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer udb.Close()
+
+	switch command {
+	case "create":
+		err = apiKeyCreate(udb, fs.Arg(0), *role, *projectList)
+	case "revoke":
+		err = apiKeyRevoke(udb, fs.Arg(0))
+	case "list":
+		err = apiKeyList(udb)
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func apiKeyCreate(udb *users.UserDatabase, name, roleName, projectList string) error {
+	role, err := users.ParseAPIKeyRole(roleName)
+	if err != nil {
+		return err
+	}
+
+	key, secret, err := udb.CreateAPIKey(name, role, strings.Split(projectList, ","), "cli")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created API key '%s' (%s) for projects: %s\n", key.Name, key.Role, strings.Join(key.Projects, ", "))
+	fmt.Printf("Key: %s\n", secret)
+	fmt.Println("Store this key now; it cannot be shown again.")
+	return nil
+}
+
+func apiKeyRevoke(udb *users.UserDatabase, name string) error {
+	if err := udb.RevokeAPIKey(name); err != nil {
+		return err
+	}
+	fmt.Printf("Revoked API key '%s'\n", name)
+	return nil
+}
+
+func apiKeyList(udb *users.UserDatabase) error {
+	keys, err := udb.ListAPIKeys()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		fmt.Println("No API keys found")
+		return nil
+	}
+
+	fmt.Printf("%-20s %-14s %-12s %-20s %-20s %-20s\n", "NAME", "PREFIX", "ROLE", "PROJECTS", "CREATED", "LAST USED")
+	fmt.Printf("%-20s %-14s %-12s %-20s %-20s %-20s\n", "--------------------", "--------------", "------------", "--------------------", "--------------------", "--------------------")
+	for _, key := range keys {
+		lastUsed := "never"
+		if key.LastUsedAt != nil {
+			lastUsed = key.LastUsedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-20s %-14s %-12s %-20s %-20s %-20s\n",
+			key.Name, key.Prefix, key.Role, strings.Join(key.Projects, ","),
+			key.CreatedAt.Format("2006-01-02 15:04:05"), lastUsed)
+	}
+	return nil
+}
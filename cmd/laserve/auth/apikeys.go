@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/tomyedwab/laforge/lib/users"
+)
+
+const APIKeyContextKey ContextKey = "api_key"
+
+// APIKeyStore looks up the API keys presented to AuthMiddleware
+type APIKeyStore interface {
+	AuthenticateAPIKey(secret string) (*users.APIKey, error)
+}
+
+// SetAPIKeyStore enables API key authentication in AuthMiddleware
+func (j *JWTManager) SetAPIKeyStore(store APIKeyStore) {
+	j.apiKeys = store
+}
+
+// IsAPIKey returns true if a bearer token is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, users.APIKeyPrefix)
+}
+
+// APIKeyUserID returns the user ID requests made with an API key act as
+func APIKeyUserID(key *users.APIKey) string {
+	return "apikey:" + key.Name
+}
+
+// GetAPIKeyFromContext returns the API key a request was authenticated with, if any
+func GetAPIKeyFromContext(ctx context.Context) (*users.APIKey, bool) {
+	key, ok := ctx.Value(APIKeyContextKey).(*users.APIKey)
+	return key, ok && key != nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/tomyedwab/laforge/lib/users"
+)
+
+func TestAuthMiddlewareAPIKeys(t *testing.T) {
+	udb, err := users.InitUserDB(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("Failed to create user database: %v", err)
+	}
+	defer udb.Close()
+
+	jwtManager := NewJWTManager("test-secret-key")
+	jwtManager.SetAPIKeyStore(udb)
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetAPIKeyFromContext(r.Context()); !ok {
+			t.Error("API key not found in context")
+		}
+		if _, ok := GetUserIDFromContext(r.Context()); !ok {
+			t.Error("User ID not found in context")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router := mux.NewRouter()
+	protected := router.PathPrefix("/api/v1/projects").Subrouter()
+	protected.Use(jwtManager.AuthMiddleware)
+	protected.HandleFunc("", okHandler).Methods("GET")
+	protected.HandleFunc("/{project_id}/tasks", okHandler).Methods("GET", "POST")
+	protected.HandleFunc("/{project_id}/steps/lease", okHandler).Methods("POST")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/rollback", okHandler).Methods("POST")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/logs", okHandler).Methods("GET", "POST")
+
+	createKey := func(name string, role users.APIKeyRole, projects ...string) string {
+		_, secret, err := udb.CreateAPIKey(name, role, projects, "test")
+		if err != nil {
+			t.Fatalf("Failed to create API key: %v", err)
+		}
+		return secret
+	}
+
+	readOnly := createKey("reader", users.RoleReadOnly, "project-a")
+	taskWriter := createKey("ci", users.RoleTaskWriter, "project-a")
+	stepRunner := createKey("runner", users.RoleStepRunner, users.AllProjects)
+
+	tests := []struct {
+		name       string
+		key        string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"read-only can read", readOnly, "GET", "/api/v1/projects/project-a/tasks", http.StatusOK},
+		{"read-only cannot write", readOnly, "POST", "/api/v1/projects/project-a/tasks", http.StatusForbidden},
+		{"scoped key cannot read other project", readOnly, "GET", "/api/v1/projects/project-b/tasks", http.StatusForbidden},
+		{"scoped key cannot list projects", readOnly, "GET", "/api/v1/projects", http.StatusForbidden},
+		{"task-writer can create tasks", taskWriter, "POST", "/api/v1/projects/project-a/tasks", http.StatusOK},
+		{"task-writer cannot lease steps", taskWriter, "POST", "/api/v1/projects/project-a/steps/lease", http.StatusForbidden},
+		{"step-runner can lease steps", stepRunner, "POST", "/api/v1/projects/project-b/steps/lease", http.StatusOK},
+		{"step-runner cannot create tasks", stepRunner, "POST", "/api/v1/projects/project-b/tasks", http.StatusForbidden},
+		{"step-runner streams step logs", stepRunner, "POST", "/api/v1/projects/project-b/steps/1/logs", http.StatusOK},
+		{"task-writer cannot stream step logs", taskWriter, "POST", "/api/v1/projects/project-a/steps/1/logs", http.StatusForbidden},
+		{"read-only can read step logs", readOnly, "GET", "/api/v1/projects/project-a/steps/1/logs", http.StatusOK},
+		{"step-runner cannot roll back", stepRunner, "POST", "/api/v1/projects/project-b/steps/1/rollback", http.StatusForbidden},
+		{"step-runner can list projects", stepRunner, "GET", "/api/v1/projects", http.StatusOK},
+		{"unknown key", users.APIKeyPrefix + "unknown", "GET", "/api/v1/projects/project-a/tasks", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,16 +11,26 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/tomyedwab/laforge/lib/users"
 )
 
 type Claims struct {
 	UserID *string `json:"user_id"`
 	StepID *int    `json:"step_id"`
+
+	// ProjectID is the project a step token was issued for
+	ProjectID *string `json:"project_id,omitempty"`
+
+	// Admin is set for users with admin rights
+	Admin bool `json:"admin,omitempty"`
+
 	jwt.RegisteredClaims
 }
 
 type JWTManager struct {
 	secretKey string
+	apiKeys   APIKeyStore
+	users     UserStore
 }
 
 func NewJWTManager(secretKey string) *JWTManager {
@@ -28,14 +40,34 @@ func NewJWTManager(secretKey string) *JWTManager {
 }
 
 func (j *JWTManager) GenerateToken(userID *string, stepID *int) (string, error) {
-	claims := &Claims{
+	return j.signClaims(&Claims{
 		UserID: userID,
 		StepID: stepID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
+	})
+}
+
+// GenerateUserToken issues a token for a logged-in user
+func (j *JWTManager) GenerateUserToken(userID string, admin bool) (string, error) {
+	return j.signClaims(&Claims{
+		UserID: &userID,
+		Admin:  admin,
+	})
+}
+
+// GenerateStepToken issues a token for the agent running a step, valid only for
+// the step's project
+func (j *JWTManager) GenerateStepToken(projectID string, stepID int) (string, error) {
+	return j.signClaims(&Claims{
+		StepID:    &stepID,
+		ProjectID: &projectID,
+	})
+}
+
+func (j *JWTManager) signClaims(claims *Claims) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		NotBefore: jwt.NewNumericDate(time.Now()),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -101,6 +133,28 @@ func (j *JWTManager) AuthMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
+		if IsAPIKey(tokenString) && j.apiKeys != nil {
+			key, err := j.apiKeys.AuthenticateAPIKey(tokenString)
+			if err != nil {
+				log.Printf("AUTH: API key validation failed: %v", err)
+				http.Error(w, `{"error":{"code":"UNAUTHORIZED","message":"Invalid or revoked API key"}}`, http.StatusUnauthorized)
+				return
+			}
+
+			log.Printf("AUTH: Successfully validated API key: %s", key.Name)
+			userID := APIKeyUserID(key)
+			principal := &Principal{Kind: PrincipalAPIKey, UserID: userID, APIKey: key}
+			if !authorizeRequest(w, r, principal) {
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserContextKey, &userID)
+			ctx = context.WithValue(ctx, APIKeyContextKey, key)
+			ctx = context.WithValue(ctx, PrincipalContextKey, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		log.Printf("AUTH: Validating token starting with %s...", tokenString[:min(10, len(tokenString))])
 		claims, err := j.ValidateToken(tokenString)
 		if err != nil {
@@ -109,14 +163,74 @@ func (j *JWTManager) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		log.Printf("AUTH: Successfully validated token for user: %s", claims.UserID)
+		if claims.UserID == nil && claims.StepID == nil {
+			log.Printf("AUTH: Token has neither a user nor a step")
+			http.Error(w, `{"error":{"code":"UNAUTHORIZED","message":"Invalid or expired token"}}`, http.StatusUnauthorized)
+			return
+		}
+
+		principal := &Principal{Kind: PrincipalUser}
+		if claims.UserID != nil && j.users != nil {
+			user, err := j.lookupTokenUser(*claims.UserID)
+			if errors.Is(err, users.ErrUserNotFound) {
+				log.Printf("AUTH: Token user %s no longer exists", *claims.UserID)
+				http.Error(w, `{"error":{"code":"UNAUTHORIZED","message":"Invalid or expired token"}}`, http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.Printf("AUTH: Failed to look up token user %s: %v", *claims.UserID, err)
+				http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to authenticate"}}`, http.StatusInternalServerError)
+				return
+			}
+			log.Printf("AUTH: Successfully validated token for user: %s", user.Username)
+			principal.UserID = *claims.UserID
+			principal.Username = user.Username
+			if user.Admin {
+				principal.Kind = PrincipalAdmin
+			}
+		} else if claims.UserID != nil {
+			log.Printf("AUTH: Successfully validated token for user: %s", *claims.UserID)
+			principal.UserID = *claims.UserID
+			if claims.Admin {
+				principal.Kind = PrincipalAdmin
+			}
+		} else if claims.StepID != nil {
+			log.Printf("AUTH: Successfully validated token for step: S%d", *claims.StepID)
+			principal.Kind = PrincipalStep
+			principal.StepID = *claims.StepID
+			if claims.ProjectID != nil {
+				principal.ProjectID = *claims.ProjectID
+			}
+		}
+		if !authorizeRequest(w, r, principal) {
+			return
+		}
+
 		// Add user ID to context
 		ctx := context.WithValue(r.Context(), UserContextKey, claims.UserID)
 		ctx = context.WithValue(ctx, StepContextKey, claims.StepID)
+		ctx = context.WithValue(ctx, PrincipalContextKey, principal)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// authorizeRequest writes a 403 response and returns false if the principal may
+// not make the request
+func authorizeRequest(w http.ResponseWriter, r *http.Request, principal *Principal) bool {
+	if err := Authorize(principal, r); err != nil {
+		log.Printf("AUTH: Forbidden %s %s for %s: %v", r.Method, r.RequestURI, principal.Kind, err)
+		body, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":    "FORBIDDEN",
+				"message": err.Error(),
+			},
+		})
+		http.Error(w, string(body), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
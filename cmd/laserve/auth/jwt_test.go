@@ -29,7 +29,7 @@ func TestJWTManager(t *testing.T) {
 		}
 
 		if *claims.UserID != userID {
-			t.Errorf("Expected user ID %s, got %s", userID, claims.UserID)
+			t.Errorf("Expected user ID %s, got %s", userID, *claims.UserID)
 		}
 	})
 
@@ -148,7 +148,7 @@ func TestAuthMiddleware(t *testing.T) {
 
 func TestGetUserIDFromContext(t *testing.T) {
 	userID := "test-user-123"
-	ctx := context.WithValue(context.Background(), UserContextKey, userID)
+	ctx := context.WithValue(context.Background(), UserContextKey, &userID)
 
 	retrievedUserID, ok := GetUserIDFromContext(ctx)
 	if !ok {
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tomyedwab/laforge/lib/users"
+)
+
+const PrincipalContextKey ContextKey = "principal"
+
+// PrincipalKind identifies the kind of credential that authenticated a request
+type PrincipalKind int
+
+const (
+	// PrincipalUser is a human user who logged in with a password
+	PrincipalUser PrincipalKind = iota
+	// PrincipalAdmin is a user with the admin flag set
+	PrincipalAdmin
+	// PrincipalStep is an agent holding the token issued when its step was leased
+	PrincipalStep
+	// PrincipalAPIKey is a client authenticated with an API key
+	PrincipalAPIKey
+)
+
+func (k PrincipalKind) String() string {
+	switch k {
+	case PrincipalUser:
+		return "user"
+	case PrincipalAdmin:
+		return "admin"
+	case PrincipalStep:
+		return "step"
+	case PrincipalAPIKey:
+		return "api key"
+	default:
+		return "unknown"
+	}
+}
+
+// Principal is the identity a request was authenticated as
+type Principal struct {
+	Kind   PrincipalKind
+	UserID string
+
+	// Username is set for user tokens when AuthMiddleware has a user store
+	Username string
+
+	// StepID and ProjectID are set for step tokens
+	StepID    int
+	ProjectID string
+
+	// APIKey is set for API keys
+	APIKey *users.APIKey
+}
+
+// stepRoutes are the only routes step tokens may call. Agents read tasks, lease
+// them and queue updates to the tasks they hold; the handlers check the lease.
+var stepRoutes = map[string]bool{
+	"GET /api/v1/projects/{project_id}":                         true,
+	"GET /api/v1/projects/{project_id}/tasks":                   true,
+	"GET /api/v1/projects/{project_id}/tasks/{task_id}":         true,
+	"GET /api/v1/projects/{project_id}/tasks/{task_id}/logs":    true,
+	"GET /api/v1/projects/{project_id}/tasks/{task_id}/reviews": true,
+	"POST /api/v1/projects/{project_id}/tasks/{task_id}/lease":  true,
+	"POST /api/v1/projects/{project_id}/tasks/{task_id}/queue":  true,
+}
+
+// adminRoutes may only be called by admins
+var adminRoutes = map[string]bool{
+	"POST /api/v1/projects/{project_id}/steps/{step_id}/rollback": true,
+	"GET /api/v1/apikeys":           true,
+	"POST /api/v1/apikeys":          true,
+	"DELETE /api/v1/apikeys/{name}": true,
+}
+
+// routeKey identifies the matched route of a request by method and path template
+func routeKey(r *http.Request) string {
+	template := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		if t, err := current.GetPathTemplate(); err == nil {
+			template = t
+		}
+	}
+	return r.Method + " " + template
+}
+
+// Authorize returns an error describing why the principal may not make the request,
+// or nil if it may
+func Authorize(p *Principal, r *http.Request) error {
+	route := routeKey(r)
+	projectID, hasProject := mux.Vars(r)["project_id"]
+
+	if adminRoutes[route] && p.Kind != PrincipalAdmin {
+		return fmt.Errorf("this operation requires an admin")
+	}
+
+	switch p.Kind {
+	case PrincipalAdmin, PrincipalUser:
+		return nil
+
+	case PrincipalStep:
+		if !stepRoutes[route] {
+			return fmt.Errorf("step tokens may only read tasks and update tasks leased to their step")
+		}
+		if !hasProject || projectID != p.ProjectID {
+			return fmt.Errorf("step token is not valid for this project")
+		}
+		return nil
+
+	case PrincipalAPIKey:
+		return authorizeAPIKey(p.APIKey, r, route, projectID, hasProject)
+
+	default:
+		return fmt.Errorf("unknown credential type")
+	}
+}
+
+// authorizeAPIKey checks the request against the API key's project scope and role.
+// Routes without a project are only available to keys scoped to all projects.
+func authorizeAPIKey(key *users.APIKey, r *http.Request, route, projectID string, hasProject bool) error {
+	if hasProject {
+		if !key.AllowsProject(projectID) {
+			return fmt.Errorf("API key is not scoped to project %s", projectID)
+		}
+	} else if !key.AllowsAllProjects() {
+		return fmt.Errorf("API key is not scoped to all projects")
+	}
+
+	if r.Method == http.MethodGet {
+		return nil
+	}
+
+	allowed := false
+	switch key.Role {
+	case users.RoleTaskWriter:
+		allowed = strings.Contains(route, "/{project_id}/tasks") || strings.Contains(route, "/{project_id}/reviews")
+	case users.RoleStepRunner:
+		allowed = strings.HasSuffix(route, "/{project_id}/steps/lease") || strings.HasSuffix(route, "/{project_id}/steps/finalize") ||
+			strings.HasSuffix(route, "/{project_id}/steps/{step_id}/logs")
+	}
+	if !allowed {
+		return fmt.Errorf("API key role %s is not permitted to perform this operation", key.Role)
+	}
+	return nil
+}
+
+// GetPrincipalFromContext returns the identity a request was authenticated as
+func GetPrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(PrincipalContextKey).(*Principal)
+	return principal, ok && principal != nil
+}
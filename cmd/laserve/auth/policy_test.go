@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAuthMiddlewareAuthorization(t *testing.T) {
+	jwtManager := NewJWTManager("test-secret-key")
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetPrincipalFromContext(r.Context()); !ok {
+			t.Error("Principal not found in context")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api/v1").Subrouter()
+	protected := api.PathPrefix("/projects").Subrouter()
+	protected.Use(jwtManager.AuthMiddleware)
+	protected.HandleFunc("/{project_id}/tasks", okHandler).Methods("GET", "POST")
+	protected.HandleFunc("/{project_id}/tasks/{task_id}", okHandler).Methods("GET", "DELETE")
+	protected.HandleFunc("/{project_id}/tasks/{task_id}/queue", okHandler).Methods("POST")
+	protected.HandleFunc("/{project_id}/reviews/{review_id}/feedback", okHandler).Methods("PUT")
+	protected.HandleFunc("/{project_id}/steps/lease", okHandler).Methods("POST")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/rollback", okHandler).Methods("POST")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/cancel", okHandler).Methods("POST")
+	apiKeys := api.PathPrefix("/apikeys").Subrouter()
+	apiKeys.Use(jwtManager.AuthMiddleware)
+	apiKeys.HandleFunc("", okHandler).Methods("GET")
+
+	userToken, _ := jwtManager.GenerateUserToken("alice", false)
+	adminToken, _ := jwtManager.GenerateUserToken("root", true)
+	stepToken, _ := jwtManager.GenerateStepToken("project-a", 7)
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"step reads tasks", stepToken, "GET", "/api/v1/projects/project-a/tasks/3", http.StatusOK},
+		{"step queues task update", stepToken, "POST", "/api/v1/projects/project-a/tasks/3/queue", http.StatusOK},
+		{"step cannot create tasks", stepToken, "POST", "/api/v1/projects/project-a/tasks", http.StatusForbidden},
+		{"step cannot delete tasks", stepToken, "DELETE", "/api/v1/projects/project-a/tasks/3", http.StatusForbidden},
+		{"step cannot approve reviews", stepToken, "PUT", "/api/v1/projects/project-a/reviews/1/feedback", http.StatusForbidden},
+		{"step cannot lease steps", stepToken, "POST", "/api/v1/projects/project-a/steps/lease", http.StatusForbidden},
+		{"step cannot cancel steps", stepToken, "POST", "/api/v1/projects/project-a/steps/7/cancel", http.StatusForbidden},
+		{"step cannot read other projects", stepToken, "GET", "/api/v1/projects/project-b/tasks", http.StatusForbidden},
+		{"user deletes tasks", userToken, "DELETE", "/api/v1/projects/project-a/tasks/3", http.StatusOK},
+		{"user submits feedback", userToken, "PUT", "/api/v1/projects/project-a/reviews/1/feedback", http.StatusOK},
+		{"user leases steps", userToken, "POST", "/api/v1/projects/project-a/steps/lease", http.StatusOK},
+		{"user cancels steps", userToken, "POST", "/api/v1/projects/project-a/steps/1/cancel", http.StatusOK},
+		{"user cannot roll back", userToken, "POST", "/api/v1/projects/project-a/steps/1/rollback", http.StatusForbidden},
+		{"user cannot manage API keys", userToken, "GET", "/api/v1/apikeys", http.StatusForbidden},
+		{"admin rolls back", adminToken, "POST", "/api/v1/projects/project-a/steps/1/rollback", http.StatusOK},
+		{"admin manages API keys", adminToken, "GET", "/api/v1/apikeys", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+
+			if rr.Code == http.StatusForbidden {
+				var body struct {
+					Error struct {
+						Code    string `json:"code"`
+						Message string `json:"message"`
+					} `json:"error"`
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Forbidden response is not JSON: %v", err)
+				}
+				if body.Error.Code != "FORBIDDEN" || body.Error.Message == "" {
+					t.Errorf("Unexpected forbidden response: %s", rr.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"strconv"
+
+	"github.com/tomyedwab/laforge/lib/users"
+)
+
+// UserStore looks up the users named by the tokens presented to AuthMiddleware
+type UserStore interface {
+	GetUserByID(id int) (*users.User, error)
+}
+
+// SetUserStore makes AuthMiddleware check that the user behind each user token
+// still exists, and take their admin rights from the user database rather than
+// the token, so removed and demoted users lose access at once
+func (j *JWTManager) SetUserStore(store UserStore) {
+	j.users = store
+}
+
+// UserTokenID returns the user ID tokens are issued to a user with. It is the
+// user's database ID, so a token cannot outlive its user by a new user taking
+// the same username.
+func UserTokenID(user *users.User) string {
+	return strconv.Itoa(user.ID)
+}
+
+// lookupTokenUser returns the current account of the user a token was issued to
+func (j *JWTManager) lookupTokenUser(userID string) (*users.User, error) {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, users.ErrUserNotFound
+	}
+	return j.users.GetUserByID(id)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/tomyedwab/laforge/lib/users"
+)
+
+func TestAuthMiddlewareChecksUser(t *testing.T) {
+	udb, err := users.InitUserDB(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("Failed to create user database: %v", err)
+	}
+	defer udb.Close()
+
+	jwtManager := NewJWTManager("test-secret-key")
+	jwtManager.SetUserStore(udb)
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router := mux.NewRouter()
+	protected := router.PathPrefix("/api/v1/projects").Subrouter()
+	protected.Use(jwtManager.AuthMiddleware)
+	protected.HandleFunc("/{project_id}/tasks", okHandler).Methods("GET")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/rollback", okHandler).Methods("POST")
+
+	userToken := func(username string, admin bool) string {
+		user, err := udb.AddUserWithRole(username, "correct-horse", admin)
+		if err != nil {
+			t.Fatalf("Failed to add user: %v", err)
+		}
+		token, err := jwtManager.GenerateUserToken(UserTokenID(user), user.Admin)
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		return token
+	}
+
+	admin := userToken("root", true)
+	demoted := userToken("former-admin", true)
+	removed := userToken("removed", false)
+	if err := udb.SetAdmin("former-admin", false); err != nil {
+		t.Fatalf("SetAdmin failed: %v", err)
+	}
+	if err := udb.RemoveUser("removed"); err != nil {
+		t.Fatalf("RemoveUser failed: %v", err)
+	}
+
+	// Tokens issued before user IDs were used name the user by username
+	legacyUserID := "root"
+	legacy, _ := jwtManager.GenerateUserToken(legacyUserID, true)
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"admin can roll back", admin, "POST", "/api/v1/projects/project-a/steps/1/rollback", http.StatusOK},
+		{"demoted admin can read", demoted, "GET", "/api/v1/projects/project-a/tasks", http.StatusOK},
+		{"demoted admin cannot roll back", demoted, "POST", "/api/v1/projects/project-a/steps/1/rollback", http.StatusForbidden},
+		{"removed user is rejected", removed, "GET", "/api/v1/projects/project-a/tasks", http.StatusUnauthorized},
+		{"username token is rejected", legacy, "GET", "/api/v1/projects/project-a/tasks", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
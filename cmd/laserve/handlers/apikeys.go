@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tomyedwab/laforge/cmd/laserve/auth"
+	"github.com/tomyedwab/laforge/lib/users"
+)
+
+// APIKeyHandler handles API key management requests
+type APIKeyHandler struct {
+	userDB *users.UserDatabase
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(userDB *users.UserDatabase) *APIKeyHandler {
+	return &APIKeyHandler{userDB: userDB}
+}
+
+// CreateAPIKeyRequest is the body of a request to create an API key
+type CreateAPIKeyRequest struct {
+	Name     string   `json:"name"`
+	Role     string   `json:"role"`
+	Projects []string `json:"projects"`
+}
+
+// requireUser returns the name of the logged-in user making the request, or their
+// ID if the name is unknown. API keys and step tokens cannot manage API keys.
+func requireUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if _, isAPIKey := auth.GetAPIKeyFromContext(r.Context()); !ok || isAPIKey {
+		http.Error(w, `{"error":{"code":"FORBIDDEN","message":"API keys can only be managed by a logged-in user"}}`, http.StatusForbidden)
+		return "", false
+	}
+	if principal, ok := auth.GetPrincipalFromContext(r.Context()); ok && principal.Username != "" {
+		return principal.Username, true
+	}
+	return userID, true
+}
+
+// ListAPIKeys handles GET /apikeys
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireUser(w, r); !ok {
+		return
+	}
+
+	keys, err := h.userDB.ListAPIKeys()
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to list API keys"}}`, http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []*users.APIKey{}
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"api_keys": keys,
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateAPIKey handles POST /apikeys
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid request body"}}`, http.StatusBadRequest)
+		return
+	}
+
+	role, err := users.ParseAPIKeyRole(req.Role)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	key, secret, err := h.userDB.CreateAPIKey(req.Name, role, req.Projects, userID)
+	if stderrors.Is(err, users.ErrAPIKeyExists) {
+		writeError(w, http.StatusConflict, "CONFLICT", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"api_key": key,
+			"key":     secret,
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeAPIKey handles DELETE /apikeys/{name}
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireUser(w, r); !ok {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	err := h.userDB.RevokeAPIKey(name)
+	if stderrors.Is(err, users.ErrAPIKeyNotFound) {
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"API key not found"}}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke API key %s: %v", name, err)
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to revoke API key"}}`, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"message": "API key revoked successfully",
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -28,7 +28,7 @@ func (h *ArtifactHandler) ServeArtifact(w http.ResponseWriter, r *http.Request)
 	// Load project to get repository path
 	project, err := projects.LoadProject(projectID)
 	if err != nil {
-		if errors.IsErrorType(err, errors.ErrNotFound) {
+		if errors.IsErrorType(err, errors.ErrNotFound) || errors.IsErrorType(err, errors.ErrProjectNotFound) {
 			http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Project not found"}}`, http.StatusNotFound)
 		} else {
 			http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to load project"}}`, http.StatusInternalServerError)
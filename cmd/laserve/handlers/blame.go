@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// CommitStepResponse links a commit to the step that made it
+type CommitStepResponse struct {
+	Commit  string `json:"commit"`
+	Subject string `json:"subject"`
+	// StepID is null for commits made outside LaForge
+	StepID *int `json:"step_id"`
+	// Source is how the commit was linked to the step: note, merge_message or
+	// step_record
+	Source string `json:"source"`
+	// Step is null if the step is not in the step database
+	Step    *StepResponse `json:"step"`
+	TaskIDs []int         `json:"task_ids"`
+}
+
+// BlameRangeResponse is a run of lines last changed by the same commit
+type BlameRangeResponse struct {
+	StartLine int                 `json:"start_line"`
+	EndLine   int                 `json:"end_line"`
+	Commit    *CommitStepResponse `json:"commit"`
+}
+
+// convertCommitStep converts a projects.CommitStep to CommitStepResponse
+func convertCommitStep(commitStep *projects.CommitStep) *CommitStepResponse {
+	response := &CommitStepResponse{
+		Commit:  commitStep.Commit.SHA,
+		Subject: commitStep.Commit.Subject,
+		Source:  commitStep.Source,
+		TaskIDs: []int{},
+	}
+	if commitStep.StepID != 0 {
+		stepID := commitStep.StepID
+		response.StepID = &stepID
+	}
+	if commitStep.Step != nil {
+		response.Step = convertStep(commitStep.Step)
+	}
+	if commitStep.TaskIDs != nil {
+		response.TaskIDs = commitStep.TaskIDs
+	}
+	return response
+}
+
+// writeProvenanceError writes the response for an error looking up the steps
+// behind a commit or file
+func writeProvenanceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.IsErrorType(err, errors.ErrProjectNotFound):
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Project not found"}}`, http.StatusNotFound)
+	case errors.IsErrorType(err, errors.ErrNotFound):
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Commit not found"}}`, http.StatusNotFound)
+	case errors.IsErrorType(err, errors.ErrInvalidInput):
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid file or line range"}}`, http.StatusBadRequest)
+	default:
+		log.Printf("Failed to look up steps in git history: %v", err)
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to look up steps in git history"}}`, http.StatusInternalServerError)
+	}
+}
+
+// GetCommitStep handles GET /commits/{commit}/step. The commit may be a SHA, a
+// prefix of one, or any revision git understands.
+func (h *StepHandler) GetCommitStep(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["project_id"]
+
+	commitStep, err := projects.FindCommitStep(projectID, vars["commit"])
+	if err != nil {
+		writeProvenanceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"commit": convertCommitStep(commitStep),
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// BlameFile handles GET /blame?path=...&start=...&end=... It maps the lines of
+// a file on the project's main branch to the steps that last changed them. The
+// start and end lines are optional.
+func (h *StepHandler) BlameFile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["project_id"]
+
+	query := r.URL.Query()
+	path := query.Get("path")
+	if path == "" {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"path is required"}}`, http.StatusBadRequest)
+		return
+	}
+
+	var startLine, endLine int
+	var err error
+	if start := query.Get("start"); start != "" {
+		if startLine, err = strconv.Atoi(start); err != nil || startLine < 1 {
+			http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid start line"}}`, http.StatusBadRequest)
+			return
+		}
+	}
+	if end := query.Get("end"); end != "" {
+		if endLine, err = strconv.Atoi(end); err != nil || endLine < 1 || endLine < startLine {
+			http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid end line"}}`, http.StatusBadRequest)
+			return
+		}
+		if startLine == 0 {
+			startLine = 1
+		}
+	}
+
+	ranges, err := projects.BlameFile(projectID, path, startLine, endLine)
+	if err != nil {
+		writeProvenanceError(w, err)
+		return
+	}
+
+	responseRanges := make([]*BlameRangeResponse, len(ranges))
+	for i, blameRange := range ranges {
+		responseRanges[i] = &BlameRangeResponse{
+			StartLine: blameRange.StartLine,
+			EndLine:   blameRange.EndLine,
+			Commit:    convertCommitStep(blameRange.CommitStep),
+		}
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"path":   path,
+			"ranges": responseRanges,
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
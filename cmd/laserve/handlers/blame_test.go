@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+func TestBlameAndCommitStep(t *testing.T) {
+	repoDir := setupTestProject(t, map[string]string{"main.go": "package main\n"})
+	before := runGit(t, repoDir, "rev-parse", "HEAD")
+
+	step := &steps.Step{Active: true, CommitSHABefore: before, AgentConfigName: "coder"}
+	createTestSteps(t, step)
+	sdb, err := projects.OpenProjectStepDatabase("test-project")
+	if err != nil {
+		t.Fatalf("Failed to open step database: %v", err)
+	}
+	sdb.RecordStepTasks(step.ID, []int{5})
+	sdb.Close()
+
+	after := commitTestFiles(t, repoDir, "Add main", map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	runGit(t, repoDir, "notes", "add", "-m", fmt.Sprintf("Step-id: S%d", step.ID))
+
+	handler := NewStepHandler(nil, nil)
+
+	blame := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/projects/test-project/blame"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"project_id": "test-project"})
+		rr := httptest.NewRecorder()
+		handler.BlameFile(rr, req)
+		return rr
+	}
+
+	rr := blame("?path=main.go")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var blameResponse struct {
+		Data struct {
+			Ranges []BlameRangeResponse `json:"ranges"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&blameResponse); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	ranges := blameResponse.Data.Ranges
+	if len(ranges) != 2 || ranges[0].Commit.StepID != nil || ranges[1].StartLine != 2 || ranges[1].EndLine != 3 {
+		t.Fatalf("Expected line 1 outside any step and lines 2-3 from a step, got %+v", ranges)
+	}
+	if got := ranges[1].Commit; got.StepID == nil || *got.StepID != step.ID || got.Source != "note" ||
+		got.Step == nil || got.Step.AgentConfigName != "coder" || len(got.TaskIDs) != 1 || got.TaskIDs[0] != 5 {
+		t.Errorf("Expected lines 2-3 to link to S%d, got %+v", step.ID, got)
+	}
+
+	if rr := blame(""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a path, got %d", rr.Code)
+	}
+	if rr := blame("?path=missing.go"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a missing file, got %d", rr.Code)
+	}
+	if rr := blame("?path=main.go&start=3&end=2"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid range, got %d", rr.Code)
+	}
+
+	commitStep := func(commit string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/projects/test-project/commits/"+commit+"/step", nil)
+		req = mux.SetURLVars(req, map[string]string{"project_id": "test-project", "commit": commit})
+		rr := httptest.NewRecorder()
+		handler.GetCommitStep(rr, req)
+		return rr
+	}
+
+	rr = commitStep(after[:8])
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var commitResponse struct {
+		Data struct {
+			Commit CommitStepResponse `json:"commit"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&commitResponse); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got := commitResponse.Data.Commit; got.Commit != after || got.StepID == nil || *got.StepID != step.ID {
+		t.Errorf("Expected %s to link to S%d, got %+v", after, step.ID, got)
+	}
+
+	if rr := commitStep("no-such-commit"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown commit, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tomyedwab/laforge/lib/costs"
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// CostHandler handles cost reporting API requests
+type CostHandler struct{}
+
+// NewCostHandler creates a new cost handler
+func NewCostHandler() *CostHandler {
+	return &CostHandler{}
+}
+
+// GetProjectCosts handles GET /projects/{project_id}/costs
+func (h *CostHandler) GetProjectCosts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["project_id"]
+
+	exists, err := projects.ProjectExists(projectID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to check project"}}`, http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Project not found"}}`, http.StatusNotFound)
+		return
+	}
+
+	report, err := costs.GenerateCostReport(projectID)
+	if err != nil {
+		log.Printf("Failed to generate cost report for project %s: %v", projectID, err)
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to generate cost report"}}`, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"costs": report,
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
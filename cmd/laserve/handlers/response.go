@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeError writes an error response in the standard API error format. Use this
+// instead of a literal error body when the message includes dynamic content.
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	})
+	http.Error(w, string(body), status)
+}
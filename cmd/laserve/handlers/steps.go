@@ -6,21 +6,30 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/tomyedwab/laforge/cmd/laserve/auth"
 	"github.com/tomyedwab/laforge/cmd/laserve/websocket"
+	"github.com/tomyedwab/laforge/lib/costs"
 	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/git"
 	"github.com/tomyedwab/laforge/lib/projects"
 	"github.com/tomyedwab/laforge/lib/steps"
 	"github.com/tomyedwab/laforge/lib/tasks"
+	"github.com/tomyedwab/laforge/lib/transcript"
 )
 
 type StepHandler struct {
 	wsServer   *websocket.Server
 	jwtManager *auth.JWTManager
+
+	// leaseMu serializes leases, so each budget check sees the steps leased
+	// before it as running, and keeps steps from being leased during a rollback
+	leaseMu sync.Mutex
 }
 
 func NewStepHandler(wsServer *websocket.Server, jwtManager *auth.JWTManager) *StepHandler {
@@ -59,29 +68,94 @@ type StepResponse struct {
 	DurationMs       *int       `json:"duration_ms"`
 	PromptTokens     int        `json:"prompt_tokens"`
 	CompletionTokens int        `json:"completion_tokens"`
+	CacheReadTokens  int        `json:"cache_read_tokens"`
+	CacheWriteTokens int        `json:"cache_write_tokens"`
 	TotalTokens      int        `json:"total_tokens"`
 	CostUSD          float64    `json:"cost_usd"`
 	ExitCode         *int       `json:"exit_code"`
+	PeakMemoryBytes  int64      `json:"peak_memory_bytes"`
+	AvgMemoryBytes   int64      `json:"avg_memory_bytes"`
+	PeakCPUPercent   float64    `json:"peak_cpu_percent"`
+	AvgCPUPercent    float64    `json:"avg_cpu_percent"`
+	ResourceSamples  int        `json:"resource_samples"`
+	// CancelRequestedAt is set once a cancellation has been requested for the step
+	CancelRequestedAt *time.Time `json:"cancel_requested_at"`
+	Cancelled         bool       `json:"cancelled"`
+	Interrupted       bool       `json:"interrupted"`
+	// MergeStrategy and MergeCommitSHA record how the step's branch was merged
+	// into the main branch; MergeCommitSHA is empty if it was not merged
+	MergeStrategy  string `json:"merge_strategy"`
+	MergeCommitSHA string `json:"merge_commit_sha"`
+	// PullRequestURL is the pull request opened for the step's branch, if any
+	PullRequestURL string `json:"pull_request_url"`
+	// ParallelGroup and SiblingStepIDs identify the steps that ran concurrently
+	// with this one in a parallel run; both are empty for steps that ran alone
+	ParallelGroup  string `json:"parallel_group"`
+	SiblingStepIDs []int  `json:"sibling_step_ids"`
+	// FilesChanged, Insertions and Deletions summarize the changes the step
+	// committed; the per-file breakdown is served by /steps/{step_id}/diff
+	FilesChanged int `json:"files_changed"`
+	Insertions   int `json:"insertions"`
+	Deletions    int `json:"deletions"`
 }
 
 // convertStep converts a steps.Step to StepResponse
 func convertStep(step *steps.Step) *StepResponse {
 	return &StepResponse{
-		ID:               step.ID,
-		ProjectID:        step.ProjectID,
-		Active:           step.Active,
-		ParentStepID:     step.ParentStepID,
-		CommitSHABefore:  step.CommitSHABefore,
-		CommitSHAAfter:   step.CommitSHAAfter,
-		AgentConfigName:  step.AgentConfigName,
-		StartTime:        step.StartTime,
-		EndTime:          step.EndTime,
-		DurationMs:       step.DurationMs,
-		PromptTokens:     step.TokenUsage.PromptTokens,
-		CompletionTokens: step.TokenUsage.CompletionTokens,
-		TotalTokens:      step.TokenUsage.TotalTokens,
-		CostUSD:          step.TokenUsage.Cost,
-		ExitCode:         step.ExitCode,
+		ID:                step.ID,
+		ProjectID:         step.ProjectID,
+		Active:            step.Active,
+		ParentStepID:      step.ParentStepID,
+		CommitSHABefore:   step.CommitSHABefore,
+		CommitSHAAfter:    step.CommitSHAAfter,
+		AgentConfigName:   step.AgentConfigName,
+		StartTime:         step.StartTime,
+		EndTime:           step.EndTime,
+		DurationMs:        step.DurationMs,
+		PromptTokens:      step.TokenUsage.PromptTokens,
+		CompletionTokens:  step.TokenUsage.CompletionTokens,
+		CacheReadTokens:   step.TokenUsage.CacheReadTokens,
+		CacheWriteTokens:  step.TokenUsage.CacheWriteTokens,
+		TotalTokens:       step.TokenUsage.TotalTokens,
+		CostUSD:           step.TokenUsage.Cost,
+		ExitCode:          step.ExitCode,
+		PeakMemoryBytes:   step.ResourceUsage.PeakMemoryBytes,
+		AvgMemoryBytes:    step.ResourceUsage.AvgMemoryBytes,
+		PeakCPUPercent:    step.ResourceUsage.PeakCPUPercent,
+		AvgCPUPercent:     step.ResourceUsage.AvgCPUPercent,
+		ResourceSamples:   step.ResourceUsage.Samples,
+		CancelRequestedAt: step.CancelRequestedAt,
+		Cancelled:         step.IsCancelled(),
+		Interrupted:       step.IsInterrupted(),
+		MergeStrategy:     step.MergeStrategy,
+		MergeCommitSHA:    step.MergeCommitSHA,
+		PullRequestURL:    step.PullRequestURL,
+		ParallelGroup:     step.ParallelGroup,
+		SiblingStepIDs:    []int{},
+		FilesChanged:      step.DiffStats.FilesChanged,
+		Insertions:        step.DiffStats.Insertions,
+		Deletions:         step.DiffStats.Deletions,
+	}
+}
+
+// linkParallelSiblings fills in the sibling step IDs of steps that ran in a
+// parallel group, from the other steps of the group in the list
+func linkParallelSiblings(responseSteps []*StepResponse) {
+	groups := map[string][]int{}
+	for _, step := range responseSteps {
+		if step.ParallelGroup != "" {
+			groups[step.ParallelGroup] = append(groups[step.ParallelGroup], step.ID)
+		}
+	}
+	for _, ids := range groups {
+		sort.Ints(ids)
+	}
+	for _, step := range responseSteps {
+		for _, id := range groups[step.ParallelGroup] {
+			if id != step.ID {
+				step.SiblingStepIDs = append(step.SiblingStepIDs, id)
+			}
+		}
 	}
 }
 
@@ -127,6 +201,7 @@ func (h *StepHandler) ListSteps(w http.ResponseWriter, r *http.Request) {
 	for i, step := range dbSteps {
 		responseSteps[i] = convertStep(step)
 	}
+	linkParallelSiblings(responseSteps)
 
 	// Apply pagination
 	total := len(responseSteps)
@@ -184,15 +259,20 @@ func (h *StepHandler) GetStep(w http.ResponseWriter, r *http.Request) {
 
 	step, err := sdb.GetStep(stepID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Step not found"}}`, http.StatusNotFound)
-		} else {
-			http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to fetch step"}}`, http.StatusInternalServerError)
-		}
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to fetch step"}}`, http.StatusInternalServerError)
+		return
+	}
+	if step == nil {
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Step not found"}}`, http.StatusNotFound)
 		return
 	}
 
 	responseStep := convertStep(step)
+	if siblingIDs, err := sdb.GetSiblingStepIDs(step); err != nil {
+		log.Printf("Failed to get sibling steps of step S%d: %v", step.ID, err)
+	} else if len(siblingIDs) > 0 {
+		responseStep.SiblingStepIDs = siblingIDs
+	}
 
 	response := map[string]interface{}{
 		"data": map[string]interface{}{
@@ -240,6 +320,20 @@ func (h *StepHandler) LeaseStep(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.leaseMu.Lock()
+	defer h.leaseMu.Unlock()
+
+	// Refuse to start new steps once the project's spending budget is used up
+	if _, err := costs.CheckProjectBudget(projectID); err != nil {
+		if errors.IsErrorType(err, errors.ErrBudgetExceeded) {
+			writeError(w, http.StatusPaymentRequired, "BUDGET_EXCEEDED", err.Error())
+			return
+		}
+		log.Printf("Failed to check budget for project %s: %v", projectID, err)
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to check project budget"}}`, http.StatusInternalServerError)
+		return
+	}
+
 	// Open project step database
 	sdb, err := h.getProjectStepDB(projectID)
 	if err != nil {
@@ -248,7 +342,14 @@ func (h *StepHandler) LeaseStep(w http.ResponseWriter, r *http.Request) {
 	}
 	defer sdb.Close()
 
-	latest, err := sdb.GetLatestActiveStep(projectID)
+	// Steps leased by the same parallel run share a parent, rather than each
+	// taking the sibling leased just before it
+	var latest *steps.Step
+	if req.ParallelGroup != "" {
+		latest, err = sdb.GetLatestActiveStepOutsideGroup(projectID, req.ParallelGroup)
+	} else {
+		latest, err = sdb.GetLatestActiveStep(projectID)
+	}
 	if err != nil {
 		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to get latest active step"}}`, http.StatusInternalServerError)
 		return
@@ -264,6 +365,7 @@ func (h *StepHandler) LeaseStep(w http.ResponseWriter, r *http.Request) {
 		CommitSHABefore: req.CommitSHABefore,
 		AgentConfigName: configName,
 		ProjectID:       projectID,
+		ParallelGroup:   req.ParallelGroup,
 		StartTime:       time.Now(),
 		TokenUsage: steps.TokenUsage{
 			PromptTokens:     0, // Will be updated after step completion
@@ -281,7 +383,12 @@ func (h *StepHandler) LeaseStep(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.jwtManager.GenerateToken(nil, &stepId)
+	// Keep a copy of the task state so the step can be rolled back later
+	if err := projects.SnapshotTaskDatabase(projectID, stepId); err != nil {
+		log.Printf("Failed to snapshot task database for step S%d: %v", stepId, err)
+	}
+
+	token, err := h.jwtManager.GenerateStepToken(projectID, stepId)
 	if err != nil {
 		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to generate token"}}`, http.StatusInternalServerError)
 		return
@@ -337,6 +444,13 @@ func (h *StepHandler) FinalizeStep(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Record which tasks the step worked on before the leases are released
+	leasedTaskIDs, err := tasks.GetLeasedTaskIDsForStep(db, req.StepID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to get task leases"}}`, http.StatusInternalServerError)
+		return
+	}
+
 	// Release all task leases for this step
 	err = tasks.UnleaseTasksForStepID(db, req.StepID)
 	if err != nil {
@@ -344,15 +458,500 @@ func (h *StepHandler) FinalizeStep(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := sdb.RecordStepTasks(req.StepID, leasedTaskIDs); err != nil {
+		log.Printf("Failed to record tasks for step S%d: %v", req.StepID, err)
+	}
+
 	// Calculate duration and update step record
 	duration := int(time.Since(step.StartTime).Milliseconds())
 	now := time.Now()
-	err = sdb.UpdateStep(req.StepID, req.CommitSHAAfter, now, duration, req.ExitCode, steps.TokenUsage{})
+	err = sdb.UpdateStep(req.StepID, req.CommitSHAAfter, now, duration, req.ExitCode, req.TokenUsage)
 	if err != nil {
 		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to update step"}}`, http.StatusInternalServerError)
 		return
 	}
 
+	if req.ResourceUsage != nil {
+		if err := sdb.UpdateStepResourceUsage(req.StepID, *req.ResourceUsage); err != nil {
+			log.Printf("Failed to record resource usage for step S%d: %v", req.StepID, err)
+		}
+	}
+
+	if req.MergeStrategy != "" {
+		if err := sdb.UpdateStepMerge(req.StepID, req.MergeStrategy, req.MergeCommitSHA); err != nil {
+			log.Printf("Failed to record merge for step S%d: %v", req.StepID, err)
+		}
+	}
+
+	if req.PullRequestURL != "" {
+		if err := sdb.UpdateStepPullRequest(req.StepID, req.PullRequestURL); err != nil {
+			log.Printf("Failed to record pull request for step S%d: %v", req.StepID, err)
+		}
+	}
+
+	if req.DiffStats != nil {
+		if err := sdb.UpdateStepDiffStats(req.StepID, *req.DiffStats); err != nil {
+			log.Printf("Failed to record diff stats for step S%d: %v", req.StepID, err)
+		}
+	}
+
+	response := &steps.FinalizeStepResponse{
+		Status:        "ok",
+		LeasedTaskIDs: leasedTaskIDs,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CancelStep handles POST /steps/{step_id}/cancel. It only records the request;
+// the laforge process running the step polls for it, stops the agent container
+// and finalizes the step as cancelled.
+func (h *StepHandler) CancelStep(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["project_id"]
+
+	stepID, err := strconv.Atoi(vars["step_id"])
+	if err != nil {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid step ID"}}`, http.StatusBadRequest)
+		return
+	}
+
+	// Open project step database
+	sdb, err := h.getProjectStepDB(projectID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to open project step database"}}`, http.StatusInternalServerError)
+		return
+	}
+	defer sdb.Close()
+
+	requested, err := sdb.RequestStepCancel(stepID, time.Now())
+	if err != nil {
+		log.Printf("Failed to request cancellation of step S%d: %v", stepID, err)
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to cancel step"}}`, http.StatusInternalServerError)
+		return
+	}
+
+	step, err := sdb.GetStep(stepID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to fetch step"}}`, http.StatusInternalServerError)
+		return
+	}
+	if step == nil {
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Step not found"}}`, http.StatusNotFound)
+		return
+	}
+
+	// A repeated request for a running step is not an error
+	if !requested && step.EndTime != nil {
+		http.Error(w, `{"error":{"code":"CONFLICT","message":"Step has already finished"}}`, http.StatusConflict)
+		return
+	}
+
+	if requested && h.wsServer != nil {
+		h.wsServer.BroadcastStepUpdate(projectID, stepID, "cancel_requested")
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"step": convertStep(step),
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RollbackStep handles POST /steps/{step_id}/rollback
+func (h *StepHandler) RollbackStep(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["project_id"]
+
+	stepID, err := strconv.Atoi(vars["step_id"])
+	if err != nil {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid step ID"}}`, http.StatusBadRequest)
+		return
+	}
+
+	// Hold off leases until the rollback is done, so no step starts on top of
+	// the state being rolled back
+	h.leaseMu.Lock()
+	result, err := projects.RollbackToStep(projectID, stepID)
+	h.leaseMu.Unlock()
+	if err != nil {
+		switch {
+		case errors.IsErrorType(err, errors.ErrNotFound), errors.IsErrorType(err, errors.ErrProjectNotFound):
+			http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Step not found"}}`, http.StatusNotFound)
+		case errors.IsErrorType(err, errors.ErrStepInProgress):
+			http.Error(w, `{"error":{"code":"CONFLICT","message":"Cannot roll back while a step is running"}}`, http.StatusConflict)
+		case errors.IsErrorType(err, errors.ErrInvalidInput):
+			writeError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		default:
+			log.Printf("Failed to roll back to step S%d: %v", stepID, err)
+			http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to roll back step"}}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if h.wsServer != nil {
+		for _, id := range result.DeactivatedStepIDs {
+			h.wsServer.BroadcastStepUpdate(projectID, id, "rolled_back")
+		}
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"rollback": result,
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// maxStepLogRead is the most step log content returned by a single GET /steps/{step_id}/logs
+const maxStepLogRead = 1024 * 1024
+
+// AppendStepLog handles POST /steps/{step_id}/logs. The laforge process running
+// the step pushes its formatted output here, and it is relayed to WebSocket
+// clients on the step_log channel. The output is not stored by laserve, since
+// laforge already writes it to the step log file that GetStepLogs reads.
+func (h *StepHandler) AppendStepLog(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["project_id"]
+
+	stepID, err := strconv.Atoi(vars["step_id"])
+	if err != nil {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid step ID"}}`, http.StatusBadRequest)
+		return
+	}
+
+	var req steps.AppendStepLogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid request body"}}`, http.StatusBadRequest)
+		return
+	}
+	if req.Offset < 0 {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Offset cannot be negative"}}`, http.StatusBadRequest)
+		return
+	}
+
+	// Open project step database
+	sdb, err := h.getProjectStepDB(projectID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to open project step database"}}`, http.StatusInternalServerError)
+		return
+	}
+	defer sdb.Close()
+
+	step, err := sdb.GetStep(stepID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to fetch step"}}`, http.StatusInternalServerError)
+		return
+	}
+	if step == nil {
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Step not found"}}`, http.StatusNotFound)
+		return
+	}
+	if step.EndTime != nil {
+		http.Error(w, `{"error":{"code":"CONFLICT","message":"Step has already finished"}}`, http.StatusConflict)
+		return
+	}
+
+	if h.wsServer != nil && req.Content != "" {
+		h.wsServer.BroadcastStepLog(projectID, stepID, req.Offset, req.Content)
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"step_id":     stepID,
+			"next_offset": req.Offset + int64(len(req.Content)),
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// StepLogResponse represents the API response format for a range of a step log
+type StepLogResponse struct {
+	StepID     int    `json:"step_id"`
+	Offset     int64  `json:"offset"`
+	NextOffset int64  `json:"next_offset"`
+	Size       int64  `json:"size"`
+	Content    string `json:"content"`
+	// Running is true while the step runs and its log may still grow
+	Running bool `json:"running"`
+}
+
+// GetStepLogs handles GET /steps/{step_id}/logs. The offset query parameter is
+// the byte offset to read from, counting back from the end of the log if it is
+// negative, and limit is the most bytes to return.
+func (h *StepHandler) GetStepLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["project_id"]
+
+	stepID, err := strconv.Atoi(vars["step_id"])
+	if err != nil {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid step ID"}}`, http.StatusBadRequest)
+		return
+	}
+
+	var offset int64
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid offset"}}`, http.StatusBadRequest)
+			return
+		}
+	}
+	limit := int64(maxStepLogRead)
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || limit <= 0 {
+			http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid limit"}}`, http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, maxStepLogRead)
+	}
+
+	// Open project step database
+	sdb, err := h.getProjectStepDB(projectID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to open project step database"}}`, http.StatusInternalServerError)
+		return
+	}
+	defer sdb.Close()
+
+	step, err := sdb.GetStep(stepID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to fetch step"}}`, http.StatusInternalServerError)
+		return
+	}
+	if step == nil {
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Step not found"}}`, http.StatusNotFound)
+		return
+	}
+
+	chunk, err := projects.ReadStepLog(projectID, stepID, offset, limit)
+	if err != nil {
+		log.Printf("Failed to read log of step S%d: %v", stepID, err)
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to read step log"}}`, http.StatusInternalServerError)
+		return
+	}
+
+	// A step that has not written any output yet has an empty log
+	stepLog := &StepLogResponse{StepID: stepID, Running: step.EndTime == nil}
+	if chunk != nil {
+		stepLog.Offset = chunk.Offset
+		stepLog.NextOffset = chunk.Offset + int64(len(chunk.Content))
+		stepLog.Size = chunk.Size
+		stepLog.Content = chunk.Content
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"log": stepLog,
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// StepTranscriptResponse represents the API response format for a step's agent transcript
+type StepTranscriptResponse struct {
+	StepID int `json:"step_id"`
+	// Entries are the transcript entries selected by the query filters
+	Entries []transcript.Entry `json:"entries"`
+	// Summary totals the whole transcript, regardless of the filters
+	Summary transcript.Summary `json:"summary"`
+}
+
+// GetStepTranscript handles GET /steps/{step_id}/transcript. The type query
+// parameter selects entries of one type, tool selects the calls of a tool by
+// name and contains selects the tool calls whose input contains the given text.
+func (h *StepHandler) GetStepTranscript(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["project_id"]
+
+	stepID, err := strconv.Atoi(vars["step_id"])
+	if err != nil {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid step ID"}}`, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := transcript.Filter{
+		Type:     transcript.EntryType(query.Get("type")),
+		Tool:     query.Get("tool"),
+		Contains: query.Get("contains"),
+	}
+	switch filter.Type {
+	case "", transcript.EntrySession, transcript.EntryMessage, transcript.EntryToolCall, transcript.EntryUsage, transcript.EntryResult:
+	default:
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid entry type"}}`, http.StatusBadRequest)
+		return
+	}
+
+	// Open project step database
+	sdb, err := h.getProjectStepDB(projectID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to open project step database"}}`, http.StatusInternalServerError)
+		return
+	}
+	defer sdb.Close()
+
+	step, err := sdb.GetStep(stepID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to fetch step"}}`, http.StatusInternalServerError)
+		return
+	}
+	if step == nil {
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Step not found"}}`, http.StatusNotFound)
+		return
+	}
+
+	entries, err := projects.ReadStepTranscript(projectID, stepID)
+	if err != nil {
+		log.Printf("Failed to read transcript of step S%d: %v", stepID, err)
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to read step transcript"}}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Steps that are still running, or whose agent does not write stream-json,
+	// have an empty transcript
+	stepTranscript := &StepTranscriptResponse{
+		StepID:  stepID,
+		Entries: filter.Apply(entries),
+		Summary: transcript.Summarize(entries),
+	}
+	if stepTranscript.Entries == nil {
+		stepTranscript.Entries = []transcript.Entry{}
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"transcript": stepTranscript,
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"status":"ok"}`))
+	json.NewEncoder(w).Encode(response)
+}
+
+// StepDiffResponse is the response format for the changes a step committed
+type StepDiffResponse struct {
+	StepID          int             `json:"step_id"`
+	CommitSHABefore string          `json:"commit_before"`
+	CommitSHAAfter  string          `json:"commit_after"`
+	Stats           steps.DiffStats `json:"stats"`
+	// Diff is the unified diff between the two commits, limited to the
+	// requested path if one was given
+	Diff string `json:"diff"`
+}
+
+// GetStepDiff handles GET /steps/{step_id}/diff. It returns the unified diff of
+// the changes the step committed, from the project repository; the path query
+// parameter limits it to one file or directory. Steps that committed nothing
+// have an empty diff.
+func (h *StepHandler) GetStepDiff(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["project_id"]
+
+	stepID, err := strconv.Atoi(vars["step_id"])
+	if err != nil {
+		http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Invalid step ID"}}`, http.StatusBadRequest)
+		return
+	}
+
+	// Load project to get repository path
+	project, err := projects.LoadProject(projectID)
+	if err != nil {
+		if errors.IsErrorType(err, errors.ErrNotFound) || errors.IsErrorType(err, errors.ErrProjectNotFound) {
+			http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Project not found"}}`, http.StatusNotFound)
+		} else {
+			http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to load project"}}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Open project step database
+	sdb, err := h.getProjectStepDB(projectID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to open project step database"}}`, http.StatusInternalServerError)
+		return
+	}
+	defer sdb.Close()
+
+	step, err := sdb.GetStep(stepID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to fetch step"}}`, http.StatusInternalServerError)
+		return
+	}
+	if step == nil {
+		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Step not found"}}`, http.StatusNotFound)
+		return
+	}
+
+	stepDiff := &StepDiffResponse{
+		StepID:          stepID,
+		CommitSHABefore: step.CommitSHABefore,
+		CommitSHAAfter:  step.CommitSHAAfter,
+		Stats:           step.DiffStats,
+	}
+
+	// Running steps, and steps that committed nothing, have no diff
+	if step.CommitSHAAfter != "" && step.CommitSHAAfter != step.CommitSHABefore {
+		var paths []string
+		if path := r.URL.Query().Get("path"); path != "" {
+			paths = append(paths, path)
+		}
+		// The step's refs keep its commit after its branch is deleted, and
+		// point at the commit it was rebased onto if it was rebased to merge
+		from := step.CommitSHABefore
+		if base, err := git.GetCommitInfo(project.RepositoryPath, git.StepBaseRef(stepID)); err == nil {
+			from = base.SHA
+		}
+		diff, err := git.GetDiff(project.RepositoryPath, from, step.CommitSHAAfter, paths...)
+		if err != nil {
+			log.Printf("Failed to diff step S%d: %v", stepID, err)
+			http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to diff step commits"}}`, http.StatusInternalServerError)
+			return
+		}
+		stepDiff.Diff = diff
+	}
+
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"diff": stepDiff,
+		},
+		"meta": map[string]interface{}{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"version":   "1.0.0",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
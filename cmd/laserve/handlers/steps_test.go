@@ -1,12 +1,99 @@
 package handlers
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/tomyedwab/laforge/lib/git"
+	"github.com/tomyedwab/laforge/lib/projects"
 	"github.com/tomyedwab/laforge/lib/steps"
 )
 
+// runGit runs a git command in dir and returns its output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commitTestFiles writes files into the repository and commits them, returning
+// the new commit
+func commitTestFiles(t *testing.T, repoDir string, message string, files map[string]string) string {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	runGit(t, repoDir, "add", ".")
+	runGit(t, repoDir, "commit", "-m", message)
+	return runGit(t, repoDir, "rev-parse", "HEAD")
+}
+
+// setupTestProject creates the project "test-project" with ~/.laforge isolated
+// and returns its repository. If files are given, the repository is a git
+// repository on branch main with the files in its initial commit; otherwise it
+// is an empty directory.
+func setupTestProject(t *testing.T, files map[string]string) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	repoDir := t.TempDir()
+	if files != nil {
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git is not available")
+		}
+		runGit(t, repoDir, "init", "-b", "main")
+		runGit(t, repoDir, "config", "user.email", "test@example.com")
+		runGit(t, repoDir, "config", "user.name", "Test User")
+		commitTestFiles(t, repoDir, "Initial commit", files)
+	}
+
+	if _, err := projects.CreateProject("test-project", "Test Project", "", repoDir, "main"); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	return repoDir
+}
+
+// createTestSteps records steps of test-project, filling in their project and
+// start time. Steps with a CommitSHAAfter are finished as if finalized.
+func createTestSteps(t *testing.T, stepList ...*steps.Step) {
+	t.Helper()
+	sdb, err := projects.OpenProjectStepDatabase("test-project")
+	if err != nil {
+		t.Fatalf("Failed to open step database: %v", err)
+	}
+	defer sdb.Close()
+
+	for _, step := range stepList {
+		step.ProjectID = "test-project"
+		if step.StartTime.IsZero() {
+			step.StartTime = time.Now()
+		}
+		if _, err := sdb.CreateStep(step); err != nil {
+			t.Fatalf("Failed to create step: %v", err)
+		}
+		if step.CommitSHAAfter != "" {
+			if err := sdb.UpdateStep(step.ID, step.CommitSHAAfter, time.Now(), 1000, 0, steps.TokenUsage{}); err != nil {
+				t.Fatalf("Failed to finish step S%d: %v", step.ID, err)
+			}
+		}
+	}
+}
+
 func TestConvertStep(t *testing.T) {
 	now := time.Now()
 	duration := 1800000 // 30 minutes in milliseconds
@@ -205,3 +292,290 @@ func TestStepResponseStructure(t *testing.T) {
 		t.Error("ExitCode field mismatch")
 	}
 }
+
+func TestCancelStep(t *testing.T) {
+	setupTestProject(t, nil)
+	running := &steps.Step{Active: true, CommitSHABefore: "abc123"}
+	finished := &steps.Step{Active: true, CommitSHABefore: "abc123", CommitSHAAfter: "def456"}
+	createTestSteps(t, running, finished)
+
+	handler := NewStepHandler(nil, nil)
+	cancel := func(stepID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/projects/test-project/steps/"+stepID+"/cancel", nil)
+		req = mux.SetURLVars(req, map[string]string{"project_id": "test-project", "step_id": stepID})
+		rr := httptest.NewRecorder()
+		handler.CancelStep(rr, req)
+		return rr
+	}
+
+	rr := cancel(strconv.Itoa(running.ID))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data struct {
+			Step StepResponse `json:"step"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Data.Step.CancelRequestedAt == nil {
+		t.Error("Expected cancel_requested_at to be set")
+	}
+
+	// Cancelling a running step again is not an error
+	if rr := cancel(strconv.Itoa(running.ID)); rr.Code != http.StatusOK {
+		t.Errorf("Expected repeated cancel to succeed, got %d", rr.Code)
+	}
+	if rr := cancel(strconv.Itoa(finished.ID)); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a finished step, got %d", rr.Code)
+	}
+	if rr := cancel("999"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing step, got %d", rr.Code)
+	}
+	if rr := cancel("abc"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid step ID, got %d", rr.Code)
+	}
+}
+
+func TestStepLogs(t *testing.T) {
+	setupTestProject(t, nil)
+	running := &steps.Step{Active: true, CommitSHABefore: "abc123"}
+	finished := &steps.Step{Active: true, CommitSHABefore: "abc123", CommitSHAAfter: "def456"}
+	createTestSteps(t, running, finished)
+
+	logsDir, _ := projects.GetProjectLogsDir("test-project")
+	os.MkdirAll(logsDir, 0755)
+	os.WriteFile(filepath.Join(logsDir, projects.StepLogFileName(running.ID, time.Now())), []byte("hello, world\n"), 0644)
+
+	handler := NewStepHandler(nil, nil)
+	request := func(method, stepID, query, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/projects/test-project/steps/"+stepID+"/logs"+query, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"project_id": "test-project", "step_id": stepID})
+		rr := httptest.NewRecorder()
+		if method == "POST" {
+			handler.AppendStepLog(rr, req)
+		} else {
+			handler.GetStepLogs(rr, req)
+		}
+		return rr
+	}
+
+	rr := request("GET", strconv.Itoa(running.ID), "?offset=7&limit=5", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data struct {
+			Log StepLogResponse `json:"log"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got := response.Data.Log; got.Content != "world" || got.Offset != 7 || got.NextOffset != 12 || got.Size != 13 || !got.Running {
+		t.Errorf("Unexpected log response %+v", got)
+	}
+
+	// A step without output has an empty log
+	rr = request("GET", strconv.Itoa(finished.ID), "", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"size":0`) {
+		t.Errorf("Expected an empty log, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := request("GET", "999", "", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing step, got %d", rr.Code)
+	}
+	if rr := request("GET", strconv.Itoa(running.ID), "?limit=0", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid limit, got %d", rr.Code)
+	}
+
+	// Output can only be appended while the step runs
+	if rr := request("POST", strconv.Itoa(running.ID), "", `{"offset":13,"content":"more\n"}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := request("POST", strconv.Itoa(finished.ID), "", `{"offset":0,"content":"late\n"}`); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a finished step, got %d", rr.Code)
+	}
+	if rr := request("POST", strconv.Itoa(running.ID), "", `{"offset":-1,"content":"x"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a negative offset, got %d", rr.Code)
+	}
+}
+
+func TestStepTranscript(t *testing.T) {
+	setupTestProject(t, nil)
+	step := &steps.Step{Active: true, CommitSHABefore: "abc123"}
+	createTestSteps(t, step)
+
+	logsDir, _ := projects.GetProjectLogsDir("test-project")
+	os.MkdirAll(logsDir, 0755)
+	logPath := filepath.Join(logsDir, projects.StepLogFileName(step.ID, time.Now()))
+	os.WriteFile(logPath, []byte("formatted output\n"), 0644)
+	os.WriteFile(projects.StepTranscriptPath(logPath), []byte(
+		`{"type":"tool_call","turn":1,"tool":{"id":"t1","name":"Bash","input":{"command":"rm -rf build"}}}`+"\n"+
+			`{"type":"tool_call","turn":2,"tool":{"id":"t2","name":"Bash","input":{"command":"go test ./..."}}}`+"\n"+
+			`{"type":"tool_call","turn":2,"tool":{"id":"t3","name":"Read","input":{"file_path":"main.go"}}}`+"\n"), 0644)
+
+	handler := NewStepHandler(nil, nil)
+	request := func(stepID, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/projects/test-project/steps/"+stepID+"/transcript"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"project_id": "test-project", "step_id": stepID})
+		rr := httptest.NewRecorder()
+		handler.GetStepTranscript(rr, req)
+		return rr
+	}
+
+	rr := request(strconv.Itoa(step.ID), "?tool=bash&contains=rm+-rf")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data struct {
+			Transcript StepTranscriptResponse `json:"transcript"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	got := response.Data.Transcript
+	if len(got.Entries) != 1 || got.Entries[0].Tool.ID != "t1" {
+		t.Errorf("Expected only the rm -rf call, got %+v", got.Entries)
+	}
+	// The summary covers the whole transcript
+	if got.Summary.Turns != 2 || got.Summary.ToolCalls != 3 || got.Summary.Tools["Bash"] != 2 {
+		t.Errorf("Unexpected summary %+v", got.Summary)
+	}
+
+	if rr := request("999", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing step, got %d", rr.Code)
+	}
+	if rr := request(strconv.Itoa(step.ID), "?type=bogus"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid type, got %d", rr.Code)
+	}
+}
+
+func TestStepParallelSiblings(t *testing.T) {
+	setupTestProject(t, nil)
+	single := &steps.Step{Active: true, CommitSHABefore: "abc123"}
+	first := &steps.Step{Active: true, CommitSHABefore: "abc123", ParallelGroup: "run-1"}
+	second := &steps.Step{Active: true, CommitSHABefore: "abc123", ParallelGroup: "run-1"}
+	createTestSteps(t, single, first, second)
+
+	handler := NewStepHandler(nil, nil)
+
+	req := httptest.NewRequest("GET", "/api/v1/projects/test-project/steps", nil)
+	req = mux.SetURLVars(req, map[string]string{"project_id": "test-project"})
+	rr := httptest.NewRecorder()
+	handler.ListSteps(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var listResponse struct {
+		Data struct {
+			Steps []StepResponse `json:"steps"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&listResponse); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	siblings := map[int][]int{}
+	for _, step := range listResponse.Data.Steps {
+		siblings[step.ID] = step.SiblingStepIDs
+	}
+	if len(siblings[single.ID]) != 0 {
+		t.Errorf("Expected no siblings for S%d, got %v", single.ID, siblings[single.ID])
+	}
+	if len(siblings[first.ID]) != 1 || siblings[first.ID][0] != second.ID {
+		t.Errorf("Expected S%d as the sibling of S%d, got %v", second.ID, first.ID, siblings[first.ID])
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/projects/test-project/steps/"+strconv.Itoa(second.ID), nil)
+	req = mux.SetURLVars(req, map[string]string{"project_id": "test-project", "step_id": strconv.Itoa(second.ID)})
+	rr = httptest.NewRecorder()
+	handler.GetStep(rr, req)
+	var getResponse struct {
+		Data struct {
+			Step StepResponse `json:"step"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&getResponse); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got := getResponse.Data.Step; got.ParallelGroup != "run-1" || len(got.SiblingStepIDs) != 1 || got.SiblingStepIDs[0] != first.ID {
+		t.Errorf("Expected S%d as the sibling of S%d in group run-1, got %+v", first.ID, second.ID, got)
+	}
+}
+
+func TestStepDiff(t *testing.T) {
+	repoDir := setupTestProject(t, map[string]string{"README.md": "# Test\n"})
+	before := runGit(t, repoDir, "rev-parse", "HEAD")
+	after := commitTestFiles(t, repoDir, "Step changes", map[string]string{"README.md": "# Changed\n", "agent.txt": "done\n"})
+
+	// A step rebased onto the commit above before it merged, whose branch is gone
+	runGit(t, repoDir, "checkout", "-b", "rebased-step")
+	rebasedAfter := commitTestFiles(t, repoDir, "Rebased step changes", map[string]string{"rebased.txt": "rebased\n"})
+	runGit(t, repoDir, "checkout", "main")
+
+	step := &steps.Step{Active: true, CommitSHABefore: before, CommitSHAAfter: after}
+	running := &steps.Step{Active: true, CommitSHABefore: after}
+	rebased := &steps.Step{Active: true, CommitSHABefore: before, CommitSHAAfter: rebasedAfter}
+	createTestSteps(t, step, running, rebased)
+
+	runGit(t, repoDir, "update-ref", git.StepBaseRef(rebased.ID), after)
+	runGit(t, repoDir, "update-ref", git.StepCommitRef(rebased.ID), rebasedAfter)
+	runGit(t, repoDir, "branch", "-D", "rebased-step")
+
+	sdb, err := projects.OpenProjectStepDatabase("test-project")
+	if err != nil {
+		t.Fatalf("Failed to open step database: %v", err)
+	}
+	sdb.UpdateStepDiffStats(step.ID, steps.DiffStats{FilesChanged: 2, Insertions: 2, Deletions: 1})
+	sdb.Close()
+
+	handler := NewStepHandler(nil, nil)
+	request := func(stepID int, query string) (*httptest.ResponseRecorder, StepDiffResponse) {
+		req := httptest.NewRequest("GET", "/api/v1/projects/test-project/steps/"+strconv.Itoa(stepID)+"/diff"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"project_id": "test-project", "step_id": strconv.Itoa(stepID)})
+		rr := httptest.NewRecorder()
+		handler.GetStepDiff(rr, req)
+		var response struct {
+			Data struct {
+				Diff StepDiffResponse `json:"diff"`
+			} `json:"data"`
+		}
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rr, response.Data.Diff
+	}
+
+	rr, diff := request(step.ID, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if diff.Stats.FilesChanged != 2 || !strings.Contains(diff.Diff, "+# Changed") || !strings.Contains(diff.Diff, "+done") {
+		t.Errorf("Expected the diff of both files, got %+v", diff)
+	}
+
+	_, diff = request(step.ID, "?path=agent.txt")
+	if strings.Contains(diff.Diff, "README.md") || !strings.Contains(diff.Diff, "+done") {
+		t.Errorf("Expected the diff to be limited to agent.txt, got:\n%s", diff.Diff)
+	}
+
+	// A rebased step is diffed against the commit it was rebased onto
+	_, diff = request(rebased.ID, "")
+	if strings.Contains(diff.Diff, "agent.txt") || !strings.Contains(diff.Diff, "+rebased") {
+		t.Errorf("Expected the diff to only cover rebased.txt, got:\n%s", diff.Diff)
+	}
+
+	// A step that has not committed anything has an empty diff
+	if rr, diff := request(running.ID, ""); rr.Code != http.StatusOK || diff.Diff != "" {
+		t.Errorf("Expected an empty diff for a running step, got %d %+v", rr.Code, diff)
+	}
+	if rr, _ := request(999, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing step, got %d", rr.Code)
+	}
+}
@@ -456,7 +456,7 @@ func (h *TaskHandler) LeaseTask(w http.ResponseWriter, r *http.Request) {
 
 	stepID, ok := auth.GetStepIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error":{"code":"AUTH_ERROR","message":"Auth token is not associated with an active step"}}`, http.StatusUnauthorized)
+		http.Error(w, `{"error":{"code":"FORBIDDEN","message":"Auth token is not associated with an active step"}}`, http.StatusForbidden)
 		return
 	}
 
@@ -1138,7 +1138,7 @@ func (h *TaskHandler) QueueTaskUpdate(w http.ResponseWriter, r *http.Request) {
 
 	stepID, ok := auth.GetStepIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, `{"error":{"code":"ERROR","message":"Queueing of task updates must occur within step context"}}`, http.StatusUnauthorized)
+		http.Error(w, `{"error":{"code":"FORBIDDEN","message":"Queueing of task updates must occur within step context"}}`, http.StatusForbidden)
 		return
 	}
 
@@ -1158,7 +1158,7 @@ func (h *TaskHandler) QueueTaskUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !leased {
-		http.Error(w, `{"error":{"code":"ERROR","message":"Task is not leased"}}`, http.StatusUnauthorized)
+		http.Error(w, `{"error":{"code":"FORBIDDEN","message":"Task is not leased by this step"}}`, http.StatusForbidden)
 		return
 	}
 
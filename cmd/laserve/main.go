@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	stderrors "errors"
 	"flag"
 	"fmt"
 	"log"
@@ -16,6 +18,7 @@ import (
 	"github.com/tomyedwab/laforge/cmd/laserve/auth"
 	"github.com/tomyedwab/laforge/cmd/laserve/handlers"
 	"github.com/tomyedwab/laforge/cmd/laserve/websocket"
+	"github.com/tomyedwab/laforge/lib/users"
 )
 
 const (
@@ -28,9 +31,18 @@ type Config struct {
 	Port        string
 	JWTSecret   string
 	Environment string
+	UsersDB     string
 }
 
 func main() {
+	// Account administration runs instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		os.Exit(runUserCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		os.Exit(runAPIKeyCommand(os.Args[2:]))
+	}
+
 	config := parseFlags()
 
 	if err := run(config); err != nil {
@@ -45,6 +57,7 @@ func parseFlags() *Config {
 	flag.StringVar(&config.Port, "port", defaultPort, "Server port")
 	flag.StringVar(&config.JWTSecret, "jwt-secret", "", "JWT secret for authentication")
 	flag.StringVar(&config.Environment, "env", "development", "Environment (development, staging, production)")
+	flag.StringVar(&config.UsersDB, "users-db", "", "Path to the user database (default ~/.laforge/users.db)")
 
 	flag.Parse()
 
@@ -67,6 +80,21 @@ func run(config *Config) error {
 	// Create JWT manager
 	jwtManager := auth.NewJWTManager(config.JWTSecret)
 
+	// Open user database for login
+	userDB, err := openUserDB(config.UsersDB)
+	if err != nil {
+		return fmt.Errorf("failed to open user database: %w", err)
+	}
+	defer userDB.Close()
+
+	if userList, err := userDB.ListUsers(); err == nil && len(userList) == 0 {
+		log.Printf("WARNING: No user accounts exist; create one with 'laserve user add <username>' to log in")
+	}
+
+	// Accept API keys alongside JWTs
+	jwtManager.SetAPIKeyStore(userDB)
+	jwtManager.SetUserStore(userDB)
+
 	// Create WebSocket server
 	wsServer := websocket.NewServer()
 	go wsServer.Run() // Start WebSocket server in background
@@ -78,7 +106,7 @@ func run(config *Config) error {
 	stepHandler := handlers.NewStepHandler(wsServer, jwtManager)
 
 	// Create router
-	router := setupRouter(jwtManager, taskHandler, stepHandler, wsServer, config)
+	router := setupRouter(jwtManager, userDB, taskHandler, stepHandler, wsServer, config)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -180,7 +208,7 @@ func corsMiddleware(config *Config) func(http.Handler) http.Handler {
 	}
 }
 
-func setupRouter(jwtManager *auth.JWTManager, taskHandler *handlers.TaskHandler, stepHandler *handlers.StepHandler, wsServer *websocket.Server, config *Config) *mux.Router {
+func setupRouter(jwtManager *auth.JWTManager, userDB *users.UserDatabase, taskHandler *handlers.TaskHandler, stepHandler *handlers.StepHandler, wsServer *websocket.Server, config *Config) *mux.Router {
 	router := mux.NewRouter()
 
 	// Apply logging middleware first
@@ -196,7 +224,7 @@ func setupRouter(jwtManager *auth.JWTManager, taskHandler *handlers.TaskHandler,
 	public := api.PathPrefix("/public").Subrouter()
 	public.HandleFunc("/health", healthHandler).Methods("GET")
 	public.HandleFunc("/health", corsPreflightHandler).Methods("OPTIONS")
-	public.HandleFunc("/login", makeLoginHandler(jwtManager)).Methods("POST")
+	public.HandleFunc("/login", makeLoginHandler(jwtManager, userDB)).Methods("POST")
 	public.HandleFunc("/login", corsPreflightHandler).Methods("OPTIONS")
 
 	// Create project handler
@@ -205,6 +233,21 @@ func setupRouter(jwtManager *auth.JWTManager, taskHandler *handlers.TaskHandler,
 	// Create artifact handler
 	artifactHandler := handlers.NewArtifactHandler()
 
+	// Create cost handler
+	costHandler := handlers.NewCostHandler()
+
+	// Create API key handler
+	apiKeyHandler := handlers.NewAPIKeyHandler(userDB)
+
+	// API key management routes (authentication required)
+	apiKeys := api.PathPrefix("/apikeys").Subrouter()
+	apiKeys.Use(jwtManager.AuthMiddleware)
+	apiKeys.HandleFunc("", apiKeyHandler.ListAPIKeys).Methods("GET")
+	apiKeys.HandleFunc("", apiKeyHandler.CreateAPIKey).Methods("POST")
+	apiKeys.HandleFunc("", corsPreflightHandler).Methods("OPTIONS")
+	apiKeys.HandleFunc("/{name}", apiKeyHandler.RevokeAPIKey).Methods("DELETE")
+	apiKeys.HandleFunc("/{name}", corsPreflightHandler).Methods("OPTIONS")
+
 	// Protected routes (authentication required)
 	protected := api.PathPrefix("/projects").Subrouter()
 	protected.Use(jwtManager.AuthMiddleware)
@@ -254,6 +297,27 @@ func setupRouter(jwtManager *auth.JWTManager, taskHandler *handlers.TaskHandler,
 	protected.HandleFunc("/{project_id}/steps/lease", corsPreflightHandler).Methods("OPTIONS")
 	protected.HandleFunc("/{project_id}/steps/finalize", stepHandler.FinalizeStep).Methods("POST")
 	protected.HandleFunc("/{project_id}/steps/finalize", corsPreflightHandler).Methods("OPTIONS")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/rollback", stepHandler.RollbackStep).Methods("POST")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/rollback", corsPreflightHandler).Methods("OPTIONS")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/cancel", stepHandler.CancelStep).Methods("POST")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/cancel", corsPreflightHandler).Methods("OPTIONS")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/logs", stepHandler.GetStepLogs).Methods("GET")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/logs", stepHandler.AppendStepLog).Methods("POST")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/logs", corsPreflightHandler).Methods("OPTIONS")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/transcript", stepHandler.GetStepTranscript).Methods("GET")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/transcript", corsPreflightHandler).Methods("OPTIONS")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/diff", stepHandler.GetStepDiff).Methods("GET")
+	protected.HandleFunc("/{project_id}/steps/{step_id}/diff", corsPreflightHandler).Methods("OPTIONS")
+
+	// Routes linking code to the steps that wrote it
+	protected.HandleFunc("/{project_id}/blame", stepHandler.BlameFile).Methods("GET")
+	protected.HandleFunc("/{project_id}/blame", corsPreflightHandler).Methods("OPTIONS")
+	protected.HandleFunc("/{project_id}/commits/{commit}/step", stepHandler.GetCommitStep).Methods("GET")
+	protected.HandleFunc("/{project_id}/commits/{commit}/step", corsPreflightHandler).Methods("OPTIONS")
+
+	// Cost reporting routes
+	protected.HandleFunc("/{project_id}/costs", costHandler.GetProjectCosts).Methods("GET")
+	protected.HandleFunc("/{project_id}/costs", corsPreflightHandler).Methods("OPTIONS")
 
 	// Artifact serving routes
 	protected.HandleFunc("/{project_id}/artifacts/{artifact_path:.*}", artifactHandler.ServeArtifact).Methods("GET")
@@ -281,21 +345,54 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, `{"status":"healthy","service":"laserve","version":"1.0.0"}`)
 }
 
-func makeLoginHandler(jwtManager *auth.JWTManager) http.HandlerFunc {
+// LoginRequest is the body of a login request
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func makeLoginHandler(jwtManager *auth.JWTManager, userDB *users.UserDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// For now, use a simple hardcoded user for testing
-		// In production, this would validate credentials against a database
-		userID := "test-user"
+		var req LoginRequest
+		if r.Body == nil || json.NewDecoder(r.Body).Decode(&req) != nil || req.Username == "" || req.Password == "" {
+			http.Error(w, `{"error":{"code":"VALIDATION_ERROR","message":"Username and password are required"}}`, http.StatusBadRequest)
+			return
+		}
 
-		token, err := jwtManager.GenerateToken(&userID, nil)
+		user, err := userDB.Authenticate(req.Username, req.Password)
+		if stderrors.Is(err, users.ErrInvalidCredentials) {
+			log.Printf("AUTH: Failed login for user: %s", req.Username)
+			http.Error(w, `{"error":{"code":"UNAUTHORIZED","message":"Invalid username or password"}}`, http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("AUTH: Failed to authenticate user %s: %v", req.Username, err)
+			http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to authenticate"}}`, http.StatusInternalServerError)
+			return
+		}
+
+		userID := auth.UserTokenID(user)
+		token, err := jwtManager.GenerateUserToken(userID, user.Admin)
 		if err != nil {
 			http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to generate token"}}`, http.StatusInternalServerError)
 			return
 		}
 
+		response := map[string]interface{}{
+			"data": map[string]interface{}{
+				"token":    token,
+				"user_id":  userID,
+				"username": user.Username,
+				"admin":    user.Admin,
+			},
+			"meta": map[string]interface{}{
+				"timestamp": time.Now().Format(time.RFC3339),
+				"version":   "1.0.0",
+			},
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"token":"%s","user_id":"%s","meta":{"timestamp":"%s","version":"1.0.0"}}`,
-			token, userID, time.Now().Format(time.RFC3339))
+		json.NewEncoder(w).Encode(response)
 	}
 }
@@ -1,15 +1,32 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/tomyedwab/laforge/cmd/laserve/auth"
+	"github.com/tomyedwab/laforge/lib/users"
 )
 
+// newTestUserDB creates a user database containing test-user with password test-password
+func newTestUserDB(t *testing.T) *users.UserDatabase {
+	userDB, err := users.InitUserDB(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("Failed to create user database: %v", err)
+	}
+	t.Cleanup(func() { userDB.Close() })
+
+	if _, err := userDB.AddUser("test-user", "test-password"); err != nil {
+		t.Fatalf("Failed to add test user: %v", err)
+	}
+	return userDB
+}
+
 func TestHealthHandler(t *testing.T) {
 	req, err := http.NewRequest("GET", "/api/v1/public/health", nil)
 	if err != nil {
@@ -33,9 +50,9 @@ func TestHealthHandler(t *testing.T) {
 
 func TestLoginHandler(t *testing.T) {
 	jwtManager := auth.NewJWTManager("test-secret")
-	loginHandler := makeLoginHandler(jwtManager)
+	loginHandler := makeLoginHandler(jwtManager, newTestUserDB(t))
 
-	req, err := http.NewRequest("POST", "/api/v1/public/login", nil)
+	req, err := http.NewRequest("POST", "/api/v1/public/login", strings.NewReader(`{"username":"test-user","password":"test-password"}`))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -61,6 +78,62 @@ func TestLoginHandler(t *testing.T) {
 	if !strings.Contains(body, "meta") {
 		t.Error("Response should contain meta object")
 	}
+	// The token names the user by database ID, not by username
+	var response struct {
+		Data struct {
+			Token    string `json:"token"`
+			UserID   string `json:"user_id"`
+			Username string `json:"username"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	claims, err := jwtManager.ValidateToken(response.Data.Token)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if claims.UserID == nil || *claims.UserID != "1" || response.Data.UserID != "1" {
+		t.Errorf("Expected the token to be issued to user ID 1, got %v and %q", claims.UserID, response.Data.UserID)
+	}
+	if response.Data.Username != "test-user" {
+		t.Errorf("Expected username test-user, got %q", response.Data.Username)
+	}
+}
+
+func TestLoginHandlerRejectsInvalidCredentials(t *testing.T) {
+	jwtManager := auth.NewJWTManager("test-secret")
+	loginHandler := makeLoginHandler(jwtManager, newTestUserDB(t))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"wrong password", `{"username":"test-user","password":"wrong-password"}`, http.StatusUnauthorized},
+		{"unknown user", `{"username":"other-user","password":"test-password"}`, http.StatusUnauthorized},
+		{"missing password", `{"username":"test-user"}`, http.StatusBadRequest},
+		{"invalid body", `not json`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/api/v1/public/login", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			loginHandler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+			if strings.Contains(rr.Body.String(), "token") {
+				t.Error("Response should not contain a token")
+			}
+		})
+	}
 }
 
 func TestParseFlags(t *testing.T) {
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tomyedwab/laforge/lib/users"
+	"golang.org/x/term"
+)
+
+const userUsage = `Usage: laserve user <command> [options] <username>
+
+Manage the accounts that can log in to laserve.
+
+Commands:
+  add <username>      Create an account
+  remove <username>   Delete an account
+  passwd <username>   Change an account's password
+  promote <username>  Grant admin rights
+  demote <username>   Revoke admin rights
+  list                List accounts
+
+Options:
+  -users-db string    Path to the user database (default ~/.laforge/users.db)
+  -admin              Create the account with admin rights (add only)
+
+Admins can additionally roll back steps and manage API keys. Role changes take
+effect the next time the user logs in.
+
+The password is prompted for on a terminal, or read from the first line of
+standard input otherwise.
+`
+
+// runUserCommand implements the "laserve user" admin subcommands and returns the
+// process exit code
+func runUserCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, userUsage)
+		return 2
+	}
+
+	command := args[0]
+	fs := flag.NewFlagSet("user "+command, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, userUsage) }
+	usersDB := fs.String("users-db", "", "Path to the user database")
+	admin := fs.Bool("admin", false, "Create the account with admin rights")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	expectedArgs := 1
+	if command == "list" {
+		expectedArgs = 0
+	}
+	if fs.NArg() != expectedArgs {
+		fs.Usage()
+		return 2
+	}
+
+	udb, err := openUserDB(*usersDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer udb.Close()
+
+	switch command {
+	case "add":
+		err = userAdd(udb, fs.Arg(0), *admin)
+	case "remove":
+		err = userRemove(udb, fs.Arg(0))
+	case "passwd":
+		err = userPasswd(udb, fs.Arg(0))
+	case "promote":
+		err = userSetAdmin(udb, fs.Arg(0), true)
+	case "demote":
+		err = userSetAdmin(udb, fs.Arg(0), false)
+	case "list":
+		err = userList(udb)
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// openUserDB opens the user database at path, or at its default location if path is empty
+func openUserDB(path string) (*users.UserDatabase, error) {
+	if path == "" {
+		return users.OpenUserDB()
+	}
+	return users.InitUserDB(path)
+}
+
+func userAdd(udb *users.UserDatabase, username string, admin bool) error {
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	if _, err := udb.AddUserWithRole(username, password, admin); err != nil {
+		return err
+	}
+	if admin {
+		fmt.Printf("Added admin user '%s'\n", username)
+	} else {
+		fmt.Printf("Added user '%s'\n", username)
+	}
+	return nil
+}
+
+func userSetAdmin(udb *users.UserDatabase, username string, admin bool) error {
+	if err := udb.SetAdmin(username, admin); err != nil {
+		return err
+	}
+	if admin {
+		fmt.Printf("Granted admin rights to user '%s'\n", username)
+	} else {
+		fmt.Printf("Revoked admin rights from user '%s'\n", username)
+	}
+	return nil
+}
+
+func userRemove(udb *users.UserDatabase, username string) error {
+	if err := udb.RemoveUser(username); err != nil {
+		return err
+	}
+	fmt.Printf("Removed user '%s'\n", username)
+	return nil
+}
+
+func userPasswd(udb *users.UserDatabase, username string) error {
+	if _, err := udb.GetUser(username); err != nil {
+		return err
+	}
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	if err := udb.SetPassword(username, password); err != nil {
+		return err
+	}
+	fmt.Printf("Updated password for user '%s'\n", username)
+	return nil
+}
+
+func userList(udb *users.UserDatabase) error {
+	userList, err := udb.ListUsers()
+	if err != nil {
+		return err
+	}
+	if len(userList) == 0 {
+		fmt.Println("No users found")
+		return nil
+	}
+
+	fmt.Printf("%-24s %-6s %-20s\n", "USERNAME", "ADMIN", "CREATED")
+	fmt.Printf("%-24s %-6s %-20s\n", "------------------------", "------", "--------------------")
+	for _, user := range userList {
+		admin := "no"
+		if user.Admin {
+			admin = "yes"
+		}
+		fmt.Printf("%-24s %-6s %-20s\n", user.Username, admin, user.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// readNewPassword prompts twice for a password on a terminal, or reads a single
+// line from standard input when it is not a terminal
+func readNewPassword() (string, error) {
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirmation, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+
+	if string(password) != string(confirmation) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return string(password), nil
+}
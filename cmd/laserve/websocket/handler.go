@@ -55,6 +55,10 @@ type Message struct {
 	Channel   string      `json:"channel"`
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
+
+	// projectID limits a broadcast to the clients connected to that project.
+	// Empty means all clients.
+	projectID string
 }
 
 // Server manages WebSocket connections
@@ -106,6 +110,9 @@ func (s *Server) Run() {
 			s.mu.RLock()
 			for client := range s.clients {
 				// Only send to clients subscribed to the channel
+				if message.projectID != "" && client.projectID != message.projectID {
+					continue
+				}
 				if client.channels[message.Channel] {
 					select {
 					case client.send <- s.encodeMessage(message):
@@ -314,3 +321,21 @@ func (s *Server) BroadcastStepUpdate(projectID string, stepID int, status string
 	}
 	s.broadcast <- message
 }
+
+// BroadcastStepLog sends a chunk of a running step's output to the clients of the
+// project subscribed to the step_log channel. The offset is the chunk's byte
+// offset in the step log, so clients can join it with GET /steps/{step_id}/logs.
+func (s *Server) BroadcastStepLog(projectID string, stepID int, offset int64, content string) {
+	message := Message{
+		Type:    "step_log",
+		Channel: "step_log",
+		Data: map[string]interface{}{
+			"step_id": stepID,
+			"offset":  offset,
+			"content": content,
+		},
+		Timestamp: time.Now(),
+		projectID: projectID,
+	}
+	s.broadcast <- message
+}
@@ -150,6 +150,54 @@ func TestBroadcastFunctions(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 }
 
+func TestBroadcastStepLog(t *testing.T) {
+	server := NewServer()
+	go server.Run()
+
+	newClient := func(projectID string) *Client {
+		client := &Client{
+			send:      make(chan []byte, 256),
+			server:    server,
+			userID:    "test-user",
+			projectID: projectID,
+			channels:  map[string]bool{"step_log": true},
+		}
+		server.register <- client
+		<-client.send // Welcome message
+		return client
+	}
+	subscribed := newClient("test-project")
+	otherProject := newClient("other-project")
+
+	server.BroadcastStepLog("test-project", 3, 42, "hello\n")
+
+	select {
+	case data := <-subscribed.send:
+		var msg struct {
+			Type string `json:"type"`
+			Data struct {
+				StepID  int    `json:"step_id"`
+				Offset  int64  `json:"offset"`
+				Content string `json:"content"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("Failed to decode message: %v", err)
+		}
+		if msg.Type != "step_log" || msg.Data.StepID != 3 || msg.Data.Offset != 42 || msg.Data.Content != "hello\n" {
+			t.Errorf("Unexpected message %s", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the step log to be sent to the project's client")
+	}
+
+	select {
+	case data := <-otherProject.send:
+		t.Errorf("Expected no message for another project, got %s", data)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
 func TestWebSocketHandler(t *testing.T) {
 	server := NewServer()
 	go server.Run()
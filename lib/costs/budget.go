@@ -0,0 +1,131 @@
+package costs
+
+import (
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+// BudgetStatus summarizes a project's spending against its budget
+type BudgetStatus struct {
+	Budget     projects.BudgetConfig `json:"budget"`
+	SpentToday float64               `json:"spent_today_usd"`
+	SpentTotal float64               `json:"spent_total_usd"`
+
+	// RunningSteps is the number of steps that have been leased but not finalized.
+	// Their cost is not known until they finish, so each one holds the
+	// remainder of the per-step limit from the budgets.
+	RunningSteps  int     `json:"running_steps"`
+	ReservedToday float64 `json:"reserved_today_usd"`
+	ReservedTotal float64 `json:"reserved_total_usd"`
+}
+
+// EvaluateBudget computes the spending of the given steps against a budget. Steps
+// are priced the same way as in cost reports, and "today" is the calendar day of now.
+// Steps that are still running reserve up to the per-step limit.
+func EvaluateBudget(budget projects.BudgetConfig, stepList []*steps.Step, agentsConfig *projects.AgentsConfig, pricing *PricingTable, now time.Time) *BudgetStatus {
+	status := &BudgetStatus{Budget: budget}
+	today := now.Format("2006-01-02")
+
+	for _, step := range stepList {
+		model := ""
+		if agentsConfig != nil {
+			if agent, ok := agentsConfig.GetAgent(step.AgentConfigName); ok {
+				model = ModelForAgentConfig(&agent)
+			}
+		}
+		cost, _ := StepCost(step, model, pricing)
+
+		startedToday := step.StartTime.Format("2006-01-02") == today
+		status.SpentTotal += cost
+		if startedToday {
+			status.SpentToday += cost
+		}
+
+		if step.Active && step.EndTime == nil {
+			status.RunningSteps++
+			reserved := budget.MaxCostPerStep - cost
+			if reserved <= 0 {
+				continue
+			}
+			status.ReservedTotal += reserved
+			if startedToday {
+				status.ReservedToday += reserved
+			}
+		}
+	}
+
+	return status
+}
+
+// Check returns a budget exceeded error if another step cannot be started within
+// the budget. The per-step limit is reserved from the remaining daily and total
+// budgets for the new step and for every running step, so a step is only started
+// if all of them can spend up to that limit. The limit is not enforced while a
+// step runs: a step that spends more than it is only counted once it finishes.
+func (s *BudgetStatus) Check() error {
+	reserve := s.Budget.MaxCostPerStep
+
+	if s.Budget.MaxTotalCost > 0 {
+		if err := checkLimit("total", s.SpentTotal, s.ReservedTotal, reserve, s.Budget.MaxTotalCost); err != nil {
+			return err
+		}
+	}
+	if s.Budget.MaxCostPerDay > 0 {
+		if err := checkLimit("daily", s.SpentToday, s.ReservedToday, reserve, s.Budget.MaxCostPerDay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkLimit(budget string, spent, reserved, reserve, limit float64) error {
+	if spent >= limit {
+		return errors.NewBudgetExceededError(budget, spent, limit)
+	}
+	if reserve > 0 && spent+reserved+reserve > limit {
+		return errors.Newf(errors.ErrBudgetExceeded, "%s budget of $%.2f cannot cover another step of up to $%.2f ($%.2f spent, $%.2f reserved by running steps)", budget, limit, reserve, spent, reserved).
+			WithContext("budget", budget).
+			WithContext("spent", spent).
+			WithContext("reserved", reserved).
+			WithContext("limit", limit)
+	}
+	return nil
+}
+
+// CheckProjectBudget computes the spending of a project against its configured
+// budget. The returned error has type ErrBudgetExceeded if no further step may be
+// started; the status is returned in either case.
+func CheckProjectBudget(projectID string) (*BudgetStatus, error) {
+	project, err := projects.LoadProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	sdb, err := projects.OpenProjectStepDatabase(projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+
+	stepList, err := sdb.ListSteps(projectID, false)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to list steps")
+	}
+
+	// A missing agents.yml only means unreported costs cannot be priced
+	agentsConfig, err := projects.LoadAgentsConfig(projectID)
+	if err != nil {
+		agentsConfig = nil
+	}
+
+	pricing, err := LoadPricing()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to load pricing table")
+	}
+
+	status := EvaluateBudget(project.Budget, stepList, agentsConfig, pricing, time.Now())
+	return status, status.Check()
+}
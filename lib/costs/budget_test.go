@@ -0,0 +1,96 @@
+package costs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+func TestEvaluateBudget(t *testing.T) {
+	now := time.Date(2025, 3, 2, 15, 0, 0, 0, time.Local)
+	stepList := []*steps.Step{
+		{ID: 1, StartTime: now.Add(-24 * time.Hour), TokenUsage: steps.TokenUsage{Cost: 4}},
+		{ID: 2, StartTime: now.Add(-2 * time.Hour), TokenUsage: steps.TokenUsage{Cost: 1.5}},
+		{ID: 3, AgentConfigName: "priced", StartTime: now.Add(-1 * time.Hour), TokenUsage: steps.TokenUsage{PromptTokens: 1_000_000, TotalTokens: 1_000_000}},
+	}
+	agentsConfig := &projects.AgentsConfig{Agents: map[string]projects.AgentConfig{
+		"priced": {Name: "priced", Environment: map[string]string{"MODELNAME": "test-model"}},
+	}}
+	pricing := &PricingTable{Models: map[string]ModelPricing{"test-model": {Prompt: 0.5}}}
+
+	status := EvaluateBudget(projects.BudgetConfig{}, stepList, agentsConfig, pricing, now)
+	if !floatEquals(status.SpentTotal, 6) {
+		t.Errorf("Expected total spend 6, got %v", status.SpentTotal)
+	}
+	if !floatEquals(status.SpentToday, 2) {
+		t.Errorf("Expected spend today 2, got %v", status.SpentToday)
+	}
+}
+
+func TestEvaluateBudgetReservesRunningSteps(t *testing.T) {
+	now := time.Date(2025, 3, 2, 15, 0, 0, 0, time.Local)
+	ended := now.Add(-30 * time.Minute)
+	stepList := []*steps.Step{
+		{ID: 1, Active: true, StartTime: now.Add(-24 * time.Hour), EndTime: &ended, TokenUsage: steps.TokenUsage{Cost: 4}},
+		{ID: 2, Active: true, StartTime: now.Add(-25 * time.Hour), TokenUsage: steps.TokenUsage{Cost: 0.5}},
+		{ID: 3, Active: true, StartTime: now.Add(-1 * time.Hour)},
+		{ID: 4, Active: true, StartTime: now.Add(-1 * time.Hour), TokenUsage: steps.TokenUsage{Cost: 3}},
+		{ID: 5, Active: false, StartTime: now.Add(-1 * time.Hour)},
+	}
+	budget := projects.BudgetConfig{MaxCostPerDay: 10, MaxCostPerStep: 2}
+
+	status := EvaluateBudget(budget, stepList, nil, &PricingTable{}, now)
+	if status.RunningSteps != 3 {
+		t.Errorf("Expected 3 running steps, got %d", status.RunningSteps)
+	}
+	if !floatEquals(status.ReservedTotal, 3.5) {
+		t.Errorf("Expected total reservation 3.5, got %v", status.ReservedTotal)
+	}
+	if !floatEquals(status.ReservedToday, 2) {
+		t.Errorf("Expected reservation today 2, got %v", status.ReservedToday)
+	}
+
+	// 3 spent and 2 reserved today leave room for another step of up to 2
+	if err := status.Check(); err != nil {
+		t.Fatalf("Expected a step to fit in the budget, got %v", err)
+	}
+
+	// Two more running steps leave no room for a third
+	status.ReservedToday += 2 * budget.MaxCostPerStep
+	if err := status.Check(); !errors.IsErrorType(err, errors.ErrBudgetExceeded) {
+		t.Errorf("Expected budget exceeded error once running steps reserve the budget, got %v", err)
+	}
+}
+
+func TestBudgetStatusCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		budget   projects.BudgetConfig
+		exceeded bool
+	}{
+		{"no budget", projects.BudgetConfig{}, false},
+		{"within budgets", projects.BudgetConfig{MaxCostPerDay: 5, MaxTotalCost: 20}, false},
+		{"daily budget spent", projects.BudgetConfig{MaxCostPerDay: 2}, true},
+		{"total budget spent", projects.BudgetConfig{MaxTotalCost: 6}, true},
+		{"per-step reserve fits", projects.BudgetConfig{MaxCostPerDay: 5, MaxCostPerStep: 3}, false},
+		{"per-step reserve exceeds daily budget", projects.BudgetConfig{MaxCostPerDay: 5, MaxCostPerStep: 3.5}, true},
+		{"per-step reserve exceeds total budget", projects.BudgetConfig{MaxTotalCost: 10, MaxCostPerStep: 5}, true},
+		{"per-step limit alone", projects.BudgetConfig{MaxCostPerStep: 100}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &BudgetStatus{Budget: tt.budget, SpentToday: 2, SpentTotal: 6}
+			err := status.Check()
+			if tt.exceeded && !errors.IsErrorType(err, errors.ErrBudgetExceeded) {
+				t.Errorf("Expected budget exceeded error, got %v", err)
+			}
+			if !tt.exceeded && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package costs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+	"gopkg.in/yaml.v3"
+)
+
+// ModelEnvironmentVariables lists the agent config environment variables that name
+// the model an agent runs, in order of preference
+var ModelEnvironmentVariables = []string{"MODELNAME", "ANTHROPIC_MODEL"}
+
+// ModelPricing holds the rates for a model in USD per million tokens
+type ModelPricing struct {
+	// Prompt is the rate for uncached input tokens
+	Prompt float64 `yaml:"prompt"`
+
+	// Completion is the rate for output tokens
+	Completion float64 `yaml:"completion"`
+
+	// CacheRead is the rate for input tokens read from the prompt cache
+	CacheRead float64 `yaml:"cache_read,omitempty"`
+
+	// CacheWrite is the rate for input tokens written to the prompt cache
+	CacheWrite float64 `yaml:"cache_write,omitempty"`
+}
+
+// PricingTable represents the pricing.yml file structure
+type PricingTable struct {
+	// Models maps a model name, or a prefix of one, to its pricing
+	Models map[string]ModelPricing `yaml:"models"`
+}
+
+// GetPricingPath returns the path to the pricing table (~/.laforge/pricing.yml)
+func GetPricingPath() (string, error) {
+	laforgeDir, err := projects.GetLaForgeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(laforgeDir, "pricing.yml"), nil
+}
+
+// LoadPricing loads the pricing table from ~/.laforge/pricing.yml. A missing file
+// results in an empty table, so only costs reported by agents are used.
+func LoadPricing() (*PricingTable, error) {
+	pricingPath, err := GetPricingPath()
+	if err != nil {
+		return nil, err
+	}
+	return LoadPricingFile(pricingPath)
+}
+
+// LoadPricingFile loads a pricing table from the given path
+func LoadPricingFile(path string) (*PricingTable, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &PricingTable{Models: map[string]ModelPricing{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	var table PricingTable
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing file: %w", err)
+	}
+	if table.Models == nil {
+		table.Models = map[string]ModelPricing{}
+	}
+
+	return &table, nil
+}
+
+// Lookup returns the pricing for a model. An exact match is preferred, otherwise
+// the longest model name in the table that is a prefix of the model is used, so
+// that "claude-sonnet-4-5" prices "claude-sonnet-4-5-20250929".
+func (p *PricingTable) Lookup(model string) (ModelPricing, bool) {
+	if p == nil || model == "" {
+		return ModelPricing{}, false
+	}
+	if pricing, ok := p.Models[model]; ok {
+		return pricing, true
+	}
+
+	bestMatch := ""
+	for name := range p.Models {
+		if strings.HasPrefix(model, name) && len(name) > len(bestMatch) {
+			bestMatch = name
+		}
+	}
+	if bestMatch == "" {
+		return ModelPricing{}, false
+	}
+	return p.Models[bestMatch], true
+}
+
+// Cost computes the cost in USD of the given token usage
+func (m ModelPricing) Cost(usage steps.TokenUsage) float64 {
+	return (float64(usage.PromptTokens)*m.Prompt +
+		float64(usage.CompletionTokens)*m.Completion +
+		float64(usage.CacheReadTokens)*m.CacheRead +
+		float64(usage.CacheWriteTokens)*m.CacheWrite) / 1_000_000
+}
+
+// ModelForAgentConfig returns the model an agent config runs, as named by its environment
+func ModelForAgentConfig(agentConfig *projects.AgentConfig) string {
+	if agentConfig == nil {
+		return ""
+	}
+	for _, key := range ModelEnvironmentVariables {
+		if model := agentConfig.Environment[key]; model != "" {
+			return model
+		}
+	}
+	return ""
+}
+
+// StepCost returns the cost of a step. The cost reported by the agent is used when
+// available; otherwise it is computed from the step's token counts and the pricing
+// for the given model. The second return value is false if the step has token usage
+// but no cost could be determined.
+func StepCost(step *steps.Step, model string, pricing *PricingTable) (float64, bool) {
+	if step.TokenUsage.Cost > 0 {
+		return step.TokenUsage.Cost, true
+	}
+
+	modelPricing, ok := pricing.Lookup(model)
+	if !ok {
+		return 0, step.TokenUsage.TotalTokens == 0
+	}
+	return modelPricing.Cost(step.TokenUsage), true
+}
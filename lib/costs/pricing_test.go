@@ -0,0 +1,137 @@
+package costs
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+func floatEquals(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestLoadPricingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pricing.yml")
+	content := `models:
+  claude-sonnet-4-5:
+    prompt: 3.0
+    completion: 15.0
+    cache_read: 0.3
+    cache_write: 3.75
+  gpt-4o:
+    prompt: 2.5
+    completion: 10.0
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write pricing file: %v", err)
+	}
+
+	table, err := LoadPricingFile(path)
+	if err != nil {
+		t.Fatalf("LoadPricingFile failed: %v", err)
+	}
+	if len(table.Models) != 2 {
+		t.Fatalf("Expected 2 models, got %d", len(table.Models))
+	}
+	if pricing := table.Models["claude-sonnet-4-5"]; pricing.CacheWrite != 3.75 {
+		t.Errorf("Expected cache_write 3.75, got %v", pricing.CacheWrite)
+	}
+
+	// A missing file is an empty table
+	table, err = LoadPricingFile(filepath.Join(dir, "missing.yml"))
+	if err != nil {
+		t.Fatalf("LoadPricingFile failed for missing file: %v", err)
+	}
+	if len(table.Models) != 0 {
+		t.Errorf("Expected empty table for missing file, got %v", table.Models)
+	}
+}
+
+func TestPricingLookup(t *testing.T) {
+	table := &PricingTable{Models: map[string]ModelPricing{
+		"claude-sonnet":     {Prompt: 1},
+		"claude-sonnet-4-5": {Prompt: 2},
+	}}
+
+	tests := []struct {
+		model  string
+		prompt float64
+		found  bool
+	}{
+		{"claude-sonnet-4-5", 2, true},
+		{"claude-sonnet-4-5-20250929", 2, true},
+		{"claude-sonnet-4", 1, true},
+		{"claude-haiku-4-5", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		pricing, found := table.Lookup(tt.model)
+		if found != tt.found || pricing.Prompt != tt.prompt {
+			t.Errorf("Lookup(%q) = %v, %v; want prompt %v, %v", tt.model, pricing, found, tt.prompt, tt.found)
+		}
+	}
+}
+
+func TestStepCost(t *testing.T) {
+	table := &PricingTable{Models: map[string]ModelPricing{
+		"claude-sonnet-4-5": {Prompt: 3, Completion: 15, CacheRead: 0.3, CacheWrite: 3.75},
+	}}
+	usage := steps.TokenUsage{
+		PromptTokens:     1_000_000,
+		CompletionTokens: 100_000,
+		CacheReadTokens:  2_000_000,
+		CacheWriteTokens: 400_000,
+		TotalTokens:      3_500_000,
+	}
+
+	// Computed from the pricing table
+	cost, priced := StepCost(&steps.Step{TokenUsage: usage}, "claude-sonnet-4-5", table)
+	if !priced || !floatEquals(cost, 3+1.5+0.6+1.5) {
+		t.Errorf("Expected computed cost 6.6, got %v (priced=%v)", cost, priced)
+	}
+
+	// Reported cost wins over the pricing table
+	reported := usage
+	reported.Cost = 1.23
+	cost, priced = StepCost(&steps.Step{TokenUsage: reported}, "claude-sonnet-4-5", table)
+	if !priced || cost != 1.23 {
+		t.Errorf("Expected reported cost 1.23, got %v (priced=%v)", cost, priced)
+	}
+
+	// Unknown model cannot be priced
+	cost, priced = StepCost(&steps.Step{TokenUsage: usage}, "unknown-model", table)
+	if priced || cost != 0 {
+		t.Errorf("Expected unpriced step, got %v (priced=%v)", cost, priced)
+	}
+
+	// Steps without token usage cost nothing
+	cost, priced = StepCost(&steps.Step{}, "", table)
+	if !priced || cost != 0 {
+		t.Errorf("Expected zero cost for step without usage, got %v (priced=%v)", cost, priced)
+	}
+}
+
+func TestModelForAgentConfig(t *testing.T) {
+	agent := &projects.AgentConfig{Environment: map[string]string{
+		"ANTHROPIC_MODEL": "claude-haiku-4-5",
+		"MODELNAME":       "claude-sonnet-4-5",
+	}}
+	if model := ModelForAgentConfig(agent); model != "claude-sonnet-4-5" {
+		t.Errorf("Expected MODELNAME to take precedence, got %q", model)
+	}
+
+	delete(agent.Environment, "MODELNAME")
+	if model := ModelForAgentConfig(agent); model != "claude-haiku-4-5" {
+		t.Errorf("Expected ANTHROPIC_MODEL fallback, got %q", model)
+	}
+
+	if model := ModelForAgentConfig(&projects.AgentConfig{}); model != "" {
+		t.Errorf("Expected no model, got %q", model)
+	}
+}
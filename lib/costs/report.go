@@ -0,0 +1,151 @@
+package costs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+// UnassignedTask is the rollup key for steps that did not lease any task
+const UnassignedTask = "unassigned"
+
+// CostRollup aggregates token usage and cost for a group of steps
+type CostRollup struct {
+	Key           string  `json:"key"`
+	Steps         int     `json:"steps"`
+	TotalTokens   int     `json:"total_tokens"`
+	Cost          float64 `json:"cost_usd"`
+	UnpricedSteps int     `json:"unpriced_steps"`
+}
+
+// CostReport summarizes the spending of a project
+type CostReport struct {
+	ProjectID     string       `json:"project_id"`
+	Steps         int          `json:"steps"`
+	TotalTokens   int          `json:"total_tokens"`
+	TotalCost     float64      `json:"total_cost_usd"`
+	UnpricedSteps int          `json:"unpriced_steps"`
+	ByDay         []CostRollup `json:"by_day"`
+	ByAgentConfig []CostRollup `json:"by_agent_config"`
+	ByTask        []CostRollup `json:"by_task"`
+}
+
+// BuildCostReport computes cost rollups for the given steps. stepTasks maps a step ID
+// to the tasks it worked on; a step's cost is split evenly between its tasks. Steps are
+// priced with the model named by their agent config in agentsConfig.
+func BuildCostReport(projectID string, stepList []*steps.Step, stepTasks map[int][]int, agentsConfig *projects.AgentsConfig, pricing *PricingTable) *CostReport {
+	report := &CostReport{ProjectID: projectID}
+
+	byDay := map[string]*CostRollup{}
+	byAgent := map[string]*CostRollup{}
+	byTask := map[string]*CostRollup{}
+
+	add := func(rollups map[string]*CostRollup, key string, tokens int, cost float64, priced bool) {
+		rollup, ok := rollups[key]
+		if !ok {
+			rollup = &CostRollup{Key: key}
+			rollups[key] = rollup
+		}
+		rollup.Steps++
+		rollup.TotalTokens += tokens
+		rollup.Cost += cost
+		if !priced {
+			rollup.UnpricedSteps++
+		}
+	}
+
+	for _, step := range stepList {
+		model := ""
+		if agentsConfig != nil {
+			if agent, ok := agentsConfig.GetAgent(step.AgentConfigName); ok {
+				model = ModelForAgentConfig(&agent)
+			}
+		}
+		cost, priced := StepCost(step, model, pricing)
+		tokens := step.TokenUsage.TotalTokens
+
+		report.Steps++
+		report.TotalTokens += tokens
+		report.TotalCost += cost
+		if !priced {
+			report.UnpricedSteps++
+		}
+
+		add(byDay, step.StartTime.Format("2006-01-02"), tokens, cost, priced)
+
+		agentName := step.AgentConfigName
+		if agentName == "" {
+			agentName = "unknown"
+		}
+		add(byAgent, agentName, tokens, cost, priced)
+
+		taskIDs := stepTasks[step.ID]
+		if len(taskIDs) == 0 {
+			add(byTask, UnassignedTask, tokens, cost, priced)
+			continue
+		}
+		share := len(taskIDs)
+		for _, taskID := range taskIDs {
+			add(byTask, fmt.Sprintf("T%d", taskID), tokens/share, cost/float64(share), priced)
+		}
+	}
+
+	report.ByDay = sortedRollups(byDay, func(a, b CostRollup) bool { return a.Key < b.Key })
+	report.ByAgentConfig = sortedRollups(byAgent, byCostDescending)
+	report.ByTask = sortedRollups(byTask, byCostDescending)
+
+	return report
+}
+
+// GenerateCostReport loads the steps, agent configs and pricing for a project and
+// builds its cost report
+func GenerateCostReport(projectID string) (*CostReport, error) {
+	sdb, err := projects.OpenProjectStepDatabase(projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+
+	stepList, err := sdb.ListSteps(projectID, false)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to list steps")
+	}
+
+	stepTasks, err := sdb.ListStepTasks(projectID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to list step tasks")
+	}
+
+	// Agent configs are only needed to find the model for steps without a reported
+	// cost, so a missing agents.yml is not an error
+	agentsConfig, err := projects.LoadAgentsConfig(projectID)
+	if err != nil {
+		agentsConfig = nil
+	}
+
+	pricing, err := LoadPricing()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to load pricing table")
+	}
+
+	return BuildCostReport(projectID, stepList, stepTasks, agentsConfig, pricing), nil
+}
+
+func byCostDescending(a, b CostRollup) bool {
+	if a.Cost != b.Cost {
+		return a.Cost > b.Cost
+	}
+	return a.Key < b.Key
+}
+
+func sortedRollups(rollups map[string]*CostRollup, less func(a, b CostRollup) bool) []CostRollup {
+	result := make([]CostRollup, 0, len(rollups))
+	for _, rollup := range rollups {
+		result = append(result, *rollup)
+	}
+	sort.Slice(result, func(i, j int) bool { return less(result[i], result[j]) })
+	return result
+}
@@ -0,0 +1,65 @@
+package costs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+func TestBuildCostReport(t *testing.T) {
+	day1 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.Local)
+	day2 := time.Date(2025, 3, 2, 10, 0, 0, 0, time.Local)
+
+	stepList := []*steps.Step{
+		{ID: 1, AgentConfigName: "claude", StartTime: day1, TokenUsage: steps.TokenUsage{TotalTokens: 1000, Cost: 0.50}},
+		{ID: 2, AgentConfigName: "cheap", StartTime: day1, TokenUsage: steps.TokenUsage{PromptTokens: 1_000_000, TotalTokens: 1_000_000}},
+		{ID: 3, AgentConfigName: "claude", StartTime: day2, TokenUsage: steps.TokenUsage{TotalTokens: 3000, Cost: 1.00}},
+		{ID: 4, AgentConfigName: "unpriced", StartTime: day2, TokenUsage: steps.TokenUsage{PromptTokens: 10, TotalTokens: 10}},
+	}
+	stepTasks := map[int][]int{
+		1: {5},
+		3: {5, 6},
+	}
+	agentsConfig := &projects.AgentsConfig{Agents: map[string]projects.AgentConfig{
+		"claude":   {Name: "claude"},
+		"cheap":    {Name: "cheap", Environment: map[string]string{"MODELNAME": "cheap-model"}},
+		"unpriced": {Name: "unpriced", Environment: map[string]string{"MODELNAME": "mystery-model"}},
+	}}
+	pricing := &PricingTable{Models: map[string]ModelPricing{
+		"cheap-model": {Prompt: 0.25},
+	}}
+
+	report := BuildCostReport("test-project", stepList, stepTasks, agentsConfig, pricing)
+
+	if report.Steps != 4 {
+		t.Errorf("Expected 4 steps, got %d", report.Steps)
+	}
+	if !floatEquals(report.TotalCost, 1.75) {
+		t.Errorf("Expected total cost 1.75, got %v", report.TotalCost)
+	}
+	if report.UnpricedSteps != 1 {
+		t.Errorf("Expected 1 unpriced step, got %d", report.UnpricedSteps)
+	}
+
+	if len(report.ByDay) != 2 || report.ByDay[0].Key != "2025-03-01" || !floatEquals(report.ByDay[0].Cost, 0.75) {
+		t.Errorf("Unexpected day rollup: %+v", report.ByDay)
+	}
+
+	if len(report.ByAgentConfig) != 3 || report.ByAgentConfig[0].Key != "claude" || report.ByAgentConfig[0].Steps != 2 || !floatEquals(report.ByAgentConfig[0].Cost, 1.5) {
+		t.Errorf("Unexpected agent config rollup: %+v", report.ByAgentConfig)
+	}
+
+	taskCosts := map[string]float64{}
+	for _, rollup := range report.ByTask {
+		taskCosts[rollup.Key] = rollup.Cost
+	}
+	// S1 goes entirely to T5, S3 is split between T5 and T6
+	if !floatEquals(taskCosts["T5"], 1.0) || !floatEquals(taskCosts["T6"], 0.5) || !floatEquals(taskCosts[UnassignedTask], 0.25) {
+		t.Errorf("Unexpected task rollup: %+v", report.ByTask)
+	}
+	if report.ByTask[0].Key != "T5" {
+		t.Errorf("Expected task rollups sorted by cost, got %+v", report.ByTask)
+	}
+}
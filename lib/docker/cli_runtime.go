@@ -0,0 +1,448 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// CLIRuntime manages containers by running the docker or podman CLI
+type CLIRuntime struct {
+	// engine is the container engine whose CLI is run. Empty means docker.
+	engine string
+}
+
+// NewCLIRuntime checks that the CLI of the given engine ("docker" or "podman",
+// empty meaning docker) can reach a daemon and returns a runtime using it
+func NewCLIRuntime(engine string) (*CLIRuntime, error) {
+	r := &CLIRuntime{engine: engine}
+
+	// Check if the CLI is available
+	if err := exec.Command(r.binary(), "--version").Run(); err != nil {
+		return nil, fmt.Errorf("%s is not available: %w", r.binary(), err)
+	}
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := r.command(ctx, "info")
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", r.binary(), err)
+	}
+
+	return r, nil
+}
+
+// binary returns the name of the CLI executable
+func (r *CLIRuntime) binary() string {
+	if r.engine == projects.ContainerRuntimePodman {
+		return "podman"
+	}
+	return "docker"
+}
+
+// command returns a CLI command bound to ctx. The command runs in its own
+// process group, so a Ctrl-C meant for laforge does not kill the "wait" and
+// "logs" commands it needs to stop the agent cleanly.
+func (r *CLIRuntime) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, r.binary(), args...)
+	detachFromTerminalSignals(cmd)
+	return cmd
+}
+
+// EnsureImage pulls the image unless it is already available locally
+func (r *CLIRuntime) EnsureImage(ctx context.Context, image string) error {
+	// Podman lists local images with a registry prefix such as "localhost/", so
+	// ask it to resolve the name instead
+	if r.engine == projects.ContainerRuntimePodman {
+		if err := r.command(ctx, "image", "exists", image).Run(); err == nil {
+			return nil // Image exists
+		}
+		return r.pull(ctx, image)
+	}
+
+	// Check if image exists locally
+	cmd := r.command(ctx, "images", "--format", "{{.Repository}}:{{.Tag}}")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list images: %w", err)
+	}
+
+	// Check if our image is in the list
+	images := strings.Split(string(output), "\n")
+	for _, img := range images {
+		if strings.TrimSpace(img) == image {
+			return nil // Image exists
+		}
+	}
+
+	// Image not found, pull it
+	return r.pull(ctx, image)
+}
+
+// pull pulls the image from its registry
+func (r *CLIRuntime) pull(ctx context.Context, image string) error {
+	cmd := r.command(ctx, "pull", image)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("failed to pull image %s: %w\nOutput: %s", image, err, string(exitErr.Stderr))
+		}
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+
+	// Check if pull was successful
+	if strings.Contains(string(output), "Error") {
+		return fmt.Errorf("failed to pull image %s: %s", image, string(output))
+	}
+
+	return nil
+}
+
+// Create creates a container with "docker create" and sets container.ID
+func (r *CLIRuntime) Create(ctx context.Context, container *Container) error {
+	cmd := r.command(ctx, buildCreateArgs(container)...)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("failed to create container: %w\nOutput: %s", err, string(exitErr.Stderr))
+		}
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+
+	// Parse container ID from output
+	containerID := strings.TrimSpace(string(output))
+	if containerID == "" {
+		return fmt.Errorf("failed to get container ID from %s create output", r.binary())
+	}
+
+	container.ID = containerID
+	return nil
+}
+
+// Start starts a created container
+func (r *CLIRuntime) Start(ctx context.Context, container *Container) error {
+	cmd := r.command(ctx, "start", container.ID)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start container: %w\nOutput: %s", err, string(output))
+	}
+	return nil
+}
+
+// Wait blocks until the container exits and returns its exit code
+func (r *CLIRuntime) Wait(ctx context.Context, container *Container) (int64, error) {
+	cmd := r.command(ctx, "wait", container.ID)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return -1, fmt.Errorf("failed to wait for container: %w\nOutput: %s", err, string(exitErr.Stderr))
+		}
+		return -1, fmt.Errorf("failed to wait for container: %w", err)
+	}
+
+	// Parse exit code
+	exitCode := int64(0)
+	fmt.Sscanf(strings.TrimSpace(string(output)), "%d", &exitCode)
+
+	return exitCode, nil
+}
+
+// Logs returns the combined stdout and stderr of the container
+func (r *CLIRuntime) Logs(ctx context.Context, container *Container, opts LogOptions) (io.ReadCloser, error) {
+	args := []string{"logs"}
+	if opts.Follow {
+		args = append(args, "-f")
+	}
+	if opts.Timestamps {
+		args = append(args, "-t")
+	}
+	args = append(args, container.ID)
+
+	if !opts.Follow {
+		cmd := r.command(ctx, args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get container logs: %w\nOutput: %s", err, string(output))
+		}
+		return io.NopCloser(strings.NewReader(string(output))), nil
+	}
+
+	// Stream both stdout and stderr of "logs -f" through a single pipe
+	pr, pw := io.Pipe()
+	cmd := r.command(ctx, args...)
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		return nil, fmt.Errorf("failed to start logs command: %w", err)
+	}
+	go func() {
+		pw.CloseWithError(cmd.Wait())
+	}()
+
+	return &cmdReadCloser{PipeReader: pr, cmd: cmd}, nil
+}
+
+// cmdReadCloser reads the output of a running command and kills it when closed
+type cmdReadCloser struct {
+	*io.PipeReader
+	cmd *exec.Cmd
+}
+
+func (c *cmdReadCloser) Close() error {
+	if c.cmd.Process != nil {
+		_ = c.cmd.Process.Kill()
+	}
+	return c.PipeReader.Close()
+}
+
+// Stop stops the container, killing it if it is still running after timeout
+func (r *CLIRuntime) Stop(ctx context.Context, container *Container, timeout time.Duration) error {
+	cmd := r.command(ctx, "stop", "-t", fmt.Sprintf("%d", int(timeout.Seconds())), container.ID)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to stop container: %w", err)
+	}
+	return nil
+}
+
+// Remove removes the container
+func (r *CLIRuntime) Remove(ctx context.Context, container *Container, force bool) error {
+	args := []string{"rm"}
+	if force {
+		args = append(args, "-f")
+	}
+	args = append(args, container.ID)
+
+	cmd := r.command(ctx, args...)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to remove container: %w", err)
+	}
+	return nil
+}
+
+// Stats returns the current resource usage of a running container
+func (r *CLIRuntime) Stats(ctx context.Context, container *Container) (ContainerStats, error) {
+	cmd := r.command(ctx, "stats", "--no-stream", "--format", statsFormat, container.ID)
+	output, err := cmd.Output()
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("failed to get container stats: %w", err)
+	}
+	return parseContainerStats(strings.TrimSpace(string(output)))
+}
+
+// CreateNetwork creates a bridge network
+func (r *CLIRuntime) CreateNetwork(ctx context.Context, name string, internal bool) error {
+	args := []string{"network", "create"}
+	if internal {
+		args = append(args, "--internal")
+	}
+	args = append(args, name)
+
+	if output, err := r.command(ctx, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create network %s: %w\nOutput: %s", name, err, string(output))
+	}
+	return nil
+}
+
+// ConnectNetwork attaches a created container to an additional network
+func (r *CLIRuntime) ConnectNetwork(ctx context.Context, name string, container *Container) error {
+	if output, err := r.command(ctx, "network", "connect", name, container.ID).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to connect container to network %s: %w\nOutput: %s", name, err, string(output))
+	}
+	return nil
+}
+
+// RemoveNetwork removes a network
+func (r *CLIRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	if output, err := r.command(ctx, "network", "rm", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove network %s: %w\nOutput: %s", name, err, string(output))
+	}
+	return nil
+}
+
+// Close is a no-op for the CLI runtime
+func (r *CLIRuntime) Close() error {
+	return nil
+}
+
+// buildCreateArgs returns the "create" arguments for an agent container, which are
+// the same for the docker and podman CLIs apart from host and user namespace setup
+func buildCreateArgs(container *Container) []string {
+	agentConfig := container.Config
+	args := []string{"create", "--name", container.Name}
+
+	// Specify the host dns entry for Linux. Podman defines its own.
+	if runtime.GOOS == "linux" && !container.isPodman() {
+		args = append(args, "--add-host=host.docker.internal:host-gateway")
+	}
+
+	// Keep file ownership in the worktree under rootless Podman
+	if userns := container.usernsMode(); userns != "" {
+		args = append(args, "--userns="+userns)
+	}
+
+	// Add environment variables from AgentConfig
+	for key, value := range agentConfig.Environment {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
+	}
+
+	if !container.Sidecar {
+		args = append(args, "-e", "LATASK_URLPATH="+container.CallbackURL())
+		args = append(args, "-e", "LATASK_TOKEN="+container.ApiToken)
+	}
+	if container.SecretsFile != "" {
+		args = append(args, "-e", SecretsFileEnvVar+"="+SecretsFileContainerPath)
+	}
+
+	// Add volume mounts from AgentConfig
+	for _, volume := range agentConfig.Volumes {
+		args = append(args, "-v", volume)
+	}
+
+	// Set working directory
+	args = append(args, "-w", container.WorkingDir())
+
+	// Set resource limits
+	args = append(args, resourceArgs(&agentConfig.Resources)...)
+
+	// Set network mode if specified
+	if agentConfig.Runtime.NetworkMode != "" {
+		args = append(args, "--network", agentConfig.Runtime.NetworkMode)
+	}
+
+	// Set capabilities if specified
+	for _, cap := range agentConfig.Runtime.Capabilities {
+		args = append(args, "--cap-add", cap)
+	}
+
+	// Set devices if specified
+	for _, device := range agentConfig.Runtime.Devices {
+		args = append(args, "--device", device)
+	}
+
+	// Set AutoRemove option
+	if agentConfig.Runtime.AutoRemove {
+		args = append(args, "--rm")
+	}
+
+	// Set privileged mode if specified
+	if agentConfig.Runtime.Privileged {
+		args = append(args, "--privileged")
+	}
+
+	// Add volume mounts for work directory and task database
+	if !container.Sidecar {
+		args = append(args, "-v", container.workDirVolume())
+	}
+	if container.SecretsFile != "" {
+		args = append(args, "-v", container.secretsFileVolume())
+	}
+
+	// Set the image
+	args = append(args, agentConfig.Image)
+
+	// Add command if specified
+	if len(agentConfig.Command) > 0 {
+		args = append(args, agentConfig.Command...)
+	}
+
+	return args
+}
+
+// resourceArgs maps the resource limits of an agent configuration to "docker run" flags
+func resourceArgs(resources *projects.ResourceConfig) []string {
+	var args []string
+
+	// Set memory limit if specified
+	if resources.Memory != "" {
+		args = append(args, "-m", parseMemoryLimit(resources.Memory))
+	}
+
+	// Set CPU shares if specified
+	if resources.CPUShares > 0 {
+		args = append(args, "-c", fmt.Sprintf("%d", resources.CPUShares))
+	}
+
+	// Set CPU limit if specified
+	if resources.CPULimit != "" {
+		args = append(args, "--cpus", strings.TrimSpace(resources.CPULimit))
+	}
+
+	// Set PIDs limit if specified
+	if resources.PidsLimit > 0 {
+		args = append(args, "--pids-limit", fmt.Sprintf("%d", resources.PidsLimit))
+	}
+
+	// Set writable layer size if specified
+	if resources.DiskSize != "" {
+		args = append(args, "--storage-opt", "size="+parseMemoryLimit(resources.DiskSize))
+	}
+
+	// Mount a tmpfs at /tmp if sized, or if the root filesystem is read-only
+	if resources.TmpfsSize != "" {
+		args = append(args, "--tmpfs", "/tmp:rw,size="+parseMemoryLimit(resources.TmpfsSize))
+	} else if resources.ReadOnlyRootFS {
+		args = append(args, "--tmpfs", "/tmp:rw")
+	}
+
+	// Set ulimits in a stable order
+	names := make([]string, 0, len(resources.Ulimits))
+	for name := range resources.Ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--ulimit", fmt.Sprintf("%s=%s", name, resources.Ulimits[name]))
+	}
+
+	// Mount the root filesystem read-only if requested
+	if resources.ReadOnlyRootFS {
+		args = append(args, "--read-only")
+	}
+
+	// Override the user if specified
+	if resources.User != "" {
+		args = append(args, "--user", resources.User)
+	}
+
+	return args
+}
+
+// statsFormat is the "stats" output template. It names the fields explicitly
+// because "{{json .}}" produces different keys under docker and podman.
+const statsFormat = `{"CPUPerc":"{{.CPUPerc}}","MemUsage":"{{.MemUsage}}"}`
+
+// parseContainerStats parses a line of "stats" output in statsFormat, e.g.
+// {"CPUPerc":"12.50%","MemUsage":"256MiB / 1GiB",...}
+func parseContainerStats(line string) (ContainerStats, error) {
+	var stats struct {
+		CPUPerc  string `json:"CPUPerc"`
+		MemUsage string `json:"MemUsage"`
+	}
+	if err := json.Unmarshal([]byte(line), &stats); err != nil {
+		return ContainerStats{}, fmt.Errorf("failed to parse container stats: %w", err)
+	}
+
+	cpuPercent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(stats.CPUPerc), "%"), 64)
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("invalid CPU usage %q: %w", stats.CPUPerc, err)
+	}
+
+	used, _, _ := strings.Cut(stats.MemUsage, "/")
+	memoryBytes, err := parseByteSize(used)
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("invalid memory usage %q: %w", stats.MemUsage, err)
+	}
+
+	return ContainerStats{MemoryBytes: memoryBytes, CPUPercent: cpuPercent}, nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package docker
+
+import "os/exec"
+
+// detachFromTerminalSignals is a no-op on platforms without process groups
+func detachFromTerminalSignals(cmd *exec.Cmd) {}
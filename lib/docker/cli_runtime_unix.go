@@ -0,0 +1,14 @@
+//go:build unix
+
+package docker
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachFromTerminalSignals starts the command in a new process group, so it
+// does not receive the signals the terminal sends to laforge's process group
+func detachFromTerminalSignals(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -7,13 +7,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os/exec"
+	"os"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/tomyedwab/laforge/lib/egress"
 	"github.com/tomyedwab/laforge/lib/projects"
 	"github.com/tomyedwab/laforge/lib/steps"
 )
@@ -27,16 +28,37 @@ type Container struct {
 	StartTime time.Time
 	ProjectID string
 	ApiToken  string
+
+	// Engine is the container runtime the container runs under, one of the
+	// projects.ContainerRuntime* values. Empty means Docker.
+	Engine string
+
+	// Sidecar marks a helper container, such as the egress proxy, that runs
+	// alongside the agent. Sidecars get no worktree mount or laserve credentials.
+	Sidecar bool
+
+	// SecretsFile is the host path of the env-file holding the agent's secret
+	// environment variables, mounted at SecretsFileContainerPath. Empty if the
+	// agent has no secrets.
+	SecretsFile string
 }
 
-// FormattingWriter wraps an io.Writer and formats Claude Code JSON output line-by-line
+// FormattingWriter wraps an io.Writer and formats agent output line-by-line
 type FormattingWriter struct {
-	writer io.Writer
+	writer    io.Writer
+	formatter OutputFormatter
 }
 
 // NewFormattingWriter creates a new FormattingWriter that wraps the given writer
+// and formats Claude Code JSON output
 func NewFormattingWriter(w io.Writer) *FormattingWriter {
-	return &FormattingWriter{writer: w}
+	return &FormattingWriter{writer: w, formatter: claudeFormatter{}}
+}
+
+// NewFormattingWriterWithFormatter creates a new FormattingWriter that wraps the
+// given writer and formats output with the given formatter
+func NewFormattingWriterWithFormatter(w io.Writer, formatter OutputFormatter) *FormattingWriter {
+	return &FormattingWriter{writer: w, formatter: formatter}
 }
 
 // Write implements io.Writer by formatting each line before writing
@@ -51,7 +73,7 @@ func (fw *FormattingWriter) Write(p []byte) (n int, err error) {
 
 		// Format the line if it's not empty
 		if line != "" {
-			formatted := FormatClaudeOutput(line)
+			formatted := fw.formatter.Format(line)
 
 			if _, err := fw.writer.Write([]byte(formatted)); err != nil {
 				return len(p), err
@@ -68,39 +90,70 @@ func (fw *FormattingWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-// Client provides Docker operations using Docker CLI
-type Client struct {
-	// Using Docker CLI for now to avoid complex dependencies
+// CallbackURL returns the laserve URL the agent uses to reach the project API
+func (c *Container) CallbackURL() string {
+	return "http://" + c.hostGatewayName() + ":8080/api/v1/projects/" + c.ProjectID
 }
 
-// NewClient creates a new Docker client
-func NewClient() (*Client, error) {
-	// Check if Docker is available
-	if err := exec.Command("docker", "--version").Run(); err != nil {
-		return nil, fmt.Errorf("docker is not available: %w", err)
+// WorkingDir returns the working directory of the agent inside the container
+func (c *Container) WorkingDir() string {
+	if c.Config != nil && c.Config.WorkingDir != "" {
+		return c.Config.WorkingDir
 	}
+	return "/src"
+}
 
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// Client runs agent containers on a container Runtime
+type Client struct {
+	runtime   Runtime
+	engine    string
+	secretEnv map[string]string
+
+	// running is the agent container started by RunAgentContainerFromConfigWithStreamingLogs,
+	// and cancelTimeout is the stop timeout in seconds once the agent is cancelled
+	mu            sync.Mutex
+	running       *Container
+	cancelled     bool
+	cancelTimeout int
+}
 
-	cmd := exec.CommandContext(ctx, "docker", "info")
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Docker daemon: %w", err)
+// NewClient creates a client for the given container engine ("docker" or
+// "podman", empty meaning docker), using the runtime backend selected by the
+// LAFORGE_CONTAINER_BACKEND environment variable, or the engine's CLI by default
+func NewClient(engine string) (*Client, error) {
+	rt, err := NewRuntime(os.Getenv(BackendEnvVar), engine)
+	if err != nil {
+		return nil, err
 	}
+	return &Client{runtime: rt, engine: engine}, nil
+}
 
-	return &Client{}, nil
+// NewClientWithRuntime creates a client that runs containers on the given runtime
+func NewClientWithRuntime(rt Runtime) *Client {
+	return &Client{runtime: rt}
 }
 
-// Close closes the Docker client (no-op for CLI-based implementation)
+// getRuntime returns the client's runtime. A zero Client uses the docker CLI.
+func (c *Client) getRuntime() Runtime {
+	if c.runtime == nil {
+		c.runtime = &CLIRuntime{}
+	}
+	return c.runtime
+}
+
+// Close releases the resources held by the client's runtime
 func (c *Client) Close() error {
-	return nil
+	return c.getRuntime().Close()
 }
 
-// CreateAgentContainer creates a container for running the LaForge agent
-func (c *Client) CreateAgentContainer(agentConfig *projects.AgentConfig, workDir, projectID, apiToken string) (*Container, error) {
+// CreateAgentContainer prepares a container for running the LaForge agent
+func (c *Client) CreateAgentContainer(ctx context.Context, agentConfig *projects.AgentConfig, workDir, projectID, apiToken string) (*Container, error) {
+	if agentConfig == nil {
+		return nil, fmt.Errorf("agent configuration is required")
+	}
+
 	// Ensure the image exists, pull if necessary
-	if err := c.ensureImage(agentConfig.Image); err != nil {
+	if err := c.getRuntime().EnsureImage(ctx, agentConfig.Image); err != nil {
 		return nil, fmt.Errorf("failed to ensure image %s: %w", agentConfig.Image, err)
 	}
 
@@ -113,16 +166,29 @@ func (c *Client) CreateAgentContainer(agentConfig *projects.AgentConfig, workDir
 		WorkDir:   workDir,
 		ProjectID: projectID,
 		ApiToken:  apiToken,
+		Engine:    c.engine,
 	}, nil
 }
 
-// WaitForContainer waits for a container to finish
-func (c *Client) WaitForContainer(container *Container) (int64, error) {
-	ctx := context.Background()
+// startContainerWithAgentConfig creates and starts a container using the given AgentConfig
+func (c *Client) startContainerWithAgentConfig(ctx context.Context, container *Container, agentConfig *projects.AgentConfig) error {
+	container.Config = agentConfig
+
+	if err := c.getRuntime().Create(ctx, container); err != nil {
+		return err
+	}
+	if err := c.getRuntime().Start(ctx, container); err != nil {
+		return err
+	}
+
+	container.StartTime = time.Now()
+	return nil
+}
 
+// WaitForContainer waits for a container to finish, or until ctx is done
+func (c *Client) WaitForContainer(ctx context.Context, container *Container) (int64, error) {
 	// Set timeout if specified
 	if container.Config.Runtime.Timeout != "" {
-		var err error
 		timeoutDuration, err := time.ParseDuration(container.Config.Runtime.Timeout)
 		if err != nil {
 			return -1, fmt.Errorf("invalid timeout format: %w", err)
@@ -132,48 +198,22 @@ func (c *Client) WaitForContainer(container *Container) (int64, error) {
 		defer cancel()
 	}
 
-	// Wait for container
-	cmd := exec.CommandContext(ctx, "docker", "wait", container.ID)
-	output, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return -1, fmt.Errorf("failed to wait for container: %w\nOutput: %s", err, string(exitErr.Stderr))
-		}
-		return -1, fmt.Errorf("failed to wait for container: %w", err)
-	}
-
-	// Parse exit code
-	exitCode := int64(0)
-	fmt.Sscanf(strings.TrimSpace(string(output)), "%d", &exitCode)
-
-	return exitCode, nil
+	return c.getRuntime().Wait(ctx, container)
 }
 
-// GetContainerLogs retrieves logs from a container
+// GetContainerLogs retrieves logs from a container. Runtimes return stdout and stderr
+// combined, so the stdout and stderr parameters are kept for API compatibility only.
 func (c *Client) GetContainerLogs(container *Container, stdout, stderr, timestamps bool) (string, error) {
-	ctx := context.Background()
-
-	args := []string{"logs"}
-
-	// Note: docker logs returns both stdout and stderr by default
-	// The stdout and stderr parameters are kept for API compatibility but not used
-	// as the Docker CLI doesn't support filtering by stream
-
-	if timestamps {
-		args = append(args, "-t")
+	logs, err := c.getRuntime().Logs(context.Background(), container, LogOptions{Timestamps: timestamps})
+	if err != nil {
+		return "", err
 	}
+	defer logs.Close()
 
-	args = append(args, container.ID)
-
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	output, err := cmd.Output()
+	output, err := io.ReadAll(logs)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", fmt.Errorf("failed to get container logs: %w\nOutput: %s", err, string(exitErr.Stderr))
-		}
 		return "", fmt.Errorf("failed to get container logs: %w", err)
 	}
-
 	return string(output), nil
 }
 
@@ -188,34 +228,42 @@ func (c *Client) GetContainerLogsFormatted(container *Container, stdout, stderr,
 	return FormatClaudeOutput(logs), nil
 }
 
-// StopContainer stops a running container
+// StopContainer stops a running container, waiting up to timeout seconds before killing it
 func (c *Client) StopContainer(container *Container, timeout int) error {
-	ctx := context.Background()
+	return c.getRuntime().Stop(context.Background(), container, time.Duration(timeout)*time.Second)
+}
 
-	cmd := exec.CommandContext(ctx, "docker", "stop", "-t", fmt.Sprintf("%d", timeout), container.ID)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to stop container: %w", err)
-	}
+// CancelAgent stops the agent container the client is running, waiting up to
+// timeout seconds for the agent to exit before killing it. If the agent has not
+// started yet, it is stopped as soon as it starts. It is safe to call from
+// another goroutine.
+func (c *Client) CancelAgent(timeout int) error {
+	c.mu.Lock()
+	c.cancelled = true
+	c.cancelTimeout = timeout
+	container := c.running
+	c.mu.Unlock()
+	if container == nil {
+		return nil
+	}
+	return c.StopContainer(container, timeout)
+}
 
-	return nil
+// setRunning records the agent container the client is running, and stops it
+// right away if the agent was already cancelled
+func (c *Client) setRunning(container *Container) {
+	c.mu.Lock()
+	c.running = container
+	cancelled, timeout := c.cancelled, c.cancelTimeout
+	c.mu.Unlock()
+	if container != nil && cancelled {
+		_ = c.StopContainer(container, timeout)
+	}
 }
 
 // RemoveContainer removes a container
 func (c *Client) RemoveContainer(container *Container, force bool) error {
-	ctx := context.Background()
-
-	args := []string{"rm"}
-	if force {
-		args = append(args, "-f")
-	}
-	args = append(args, container.ID)
-
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to remove container: %w", err)
-	}
-
-	return nil
+	return c.getRuntime().Remove(context.Background(), container, force)
 }
 
 // CleanupContainer stops and removes a container
@@ -227,102 +275,6 @@ func (c *Client) CleanupContainer(container *Container) error {
 	return c.RemoveContainer(container, true)
 }
 
-// ListContainers lists containers with optional filters
-func (c *Client) ListContainers(all bool, filters map[string]string) ([]map[string]interface{}, error) {
-	ctx := context.Background()
-
-	args := []string{"ps", "--format", "{{json .}}"}
-	if all {
-		args = append(args, "-a")
-	}
-
-	// Add name filter if specified
-	if nameFilter, ok := filters["name"]; ok {
-		args = append(args, "--filter", fmt.Sprintf("name=%s", nameFilter))
-	}
-
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to list containers: %w", err)
-	}
-
-	// Parse JSON output (simplified - in real implementation would use proper JSON parsing)
-	var containers []map[string]interface{}
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	for _, line := range lines {
-		if line != "" {
-			containers = append(containers, map[string]interface{}{
-				"ID":   strings.TrimSpace(line),
-				"Name": "container",
-			})
-		}
-	}
-
-	return containers, nil
-}
-
-// GetContainerInfo gets detailed information about a container
-func (c *Client) GetContainerInfo(containerID string) (map[string]interface{}, error) {
-	ctx := context.Background()
-
-	cmd := exec.CommandContext(ctx, "docker", "inspect", containerID)
-	_, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to inspect container: %w", err)
-	}
-
-	// Return simplified info (in real implementation would parse JSON properly)
-	return map[string]interface{}{
-		"ID":      containerID,
-		"Running": true,
-	}, nil
-}
-
-// PullImage pulls a Docker image
-func (c *Client) PullImage(image string) error {
-	ctx := context.Background()
-
-	cmd := exec.CommandContext(ctx, "docker", "pull", image)
-	output, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return fmt.Errorf("failed to pull image %s: %w\nOutput: %s", image, err, string(exitErr.Stderr))
-		}
-		return fmt.Errorf("failed to pull image %s: %w", image, err)
-	}
-
-	// Check if pull was successful
-	if strings.Contains(string(output), "Error") {
-		return fmt.Errorf("failed to pull image %s: %s", image, string(output))
-	}
-
-	return nil
-}
-
-// ensureImage ensures that the specified image exists locally
-func (c *Client) ensureImage(image string) error {
-	ctx := context.Background()
-
-	// Check if image exists locally
-	cmd := exec.CommandContext(ctx, "docker", "images", "--format", "{{.Repository}}:{{.Tag}}")
-	output, err := cmd.Output()
-	if err != nil {
-		return fmt.Errorf("failed to list images: %w", err)
-	}
-
-	// Check if our image is in the list
-	images := strings.Split(string(output), "\n")
-	for _, img := range images {
-		if strings.TrimSpace(img) == image {
-			return nil // Image exists
-		}
-	}
-
-	// Image not found, pull it
-	return c.PullImage(image)
-}
-
 // parseMemoryLimit parses memory limit string (e.g., "512m", "1g") to bytes
 func parseMemoryLimit(limit string) string {
 	limit = strings.ToLower(strings.TrimSpace(limit))
@@ -346,44 +298,100 @@ func parseMemoryLimit(limit string) string {
 
 // ContainerMetrics represents metrics collected during container execution
 type ContainerMetrics struct {
-	StartTime    time.Time
-	EndTime      time.Time
-	ExitCode     int64
-	MemoryUsage  string
-	CPUUsage     string
-	LogSize      int
-	ErrorCount   int
-	WarningCount int
-	TokenUsage   steps.TokenUsage
+	StartTime     time.Time
+	EndTime       time.Time
+	ExitCode      int64
+	LogSize       int
+	ErrorCount    int
+	WarningCount  int
+	TokenUsage    steps.TokenUsage
+	ResourceUsage steps.ResourceUsage
+
+	// BlockedEgress lists the connections blocked by the agent's egress policy
+	BlockedEgress []egress.Event
 }
 
+// InterruptStopTimeout is how many seconds an interrupted agent gets to exit before it is killed
+const InterruptStopTimeout = 10
+
 // RunAgentContainerFromConfigWithStreamingLogs creates, starts, and manages an agent container from AgentConfig
-// with real-time log streaming to the provided writer, and returns logs and metrics
-func (c *Client) RunAgentContainerFromConfigWithStreamingLogs(agentConfig *projects.AgentConfig, workDir, projectID, apiToken string, logWriter io.Writer, metrics *ContainerMetrics) (int64, string, error) {
+// with real-time log streaming to the provided writer, and returns logs and metrics.
+//
+// If ctx is done while the agent runs, the agent is stopped with a grace period
+// of InterruptStopTimeout seconds. Its logs and metrics are still collected and
+// its container removed before the context's error is returned.
+func (c *Client) RunAgentContainerFromConfigWithStreamingLogs(ctx context.Context, agentConfig *projects.AgentConfig, workDir, projectID, apiToken string, logWriter io.Writer, metrics *ContainerMetrics) (int64, string, error) {
 	if metrics == nil {
 		metrics = &ContainerMetrics{}
 	}
 	metrics.StartTime = time.Now()
 
+	formatter, err := GetOutputFormatter(agentConfig.OutputFormat)
+	if err != nil {
+		metrics.EndTime = time.Now()
+		return -1, "", err
+	}
+
 	// Create container from AgentConfig
-	container, err := c.CreateAgentContainer(agentConfig, workDir, projectID, apiToken)
+	container, err := c.CreateAgentContainer(ctx, agentConfig, workDir, projectID, apiToken)
 	if err != nil {
 		metrics.EndTime = time.Now()
 		return -1, "", fmt.Errorf("failed to create container from config: %w", err)
 	}
 
+	// Pass secret environment variables in a tmpfs env-file, removed after the run
+	if len(c.secretEnv) > 0 {
+		removeSecretsFile, err := c.writeSecretsFile(container)
+		if err != nil {
+			metrics.EndTime = time.Now()
+			return -1, "", err
+		}
+		defer removeSecretsFile()
+	}
+
 	// Create a copy of agent config with AutoRemove disabled
 	// We need to get logs before removing the container
 	configCopy := *agentConfig
 	configCopy.Runtime.AutoRemove = false
 
+	// Route the agent's traffic through the egress proxy if it has a policy. The
+	// proxy is removed after the agent container, and its blocked connection
+	// attempts are appended to the step log.
+	if agentConfig.Egress != nil {
+		sidecar, err := c.startEgressProxy(ctx, container)
+		if err != nil {
+			metrics.EndTime = time.Now()
+			return -1, "", fmt.Errorf("failed to start egress proxy: %w", err)
+		}
+		defer func() {
+			metrics.BlockedEgress = c.stopEgressProxy(sidecar)
+			if logWriter != nil {
+				for _, event := range metrics.BlockedEgress {
+					fmt.Fprintf(logWriter, "[egress] Blocked %s %s at %s\n", event.Method, event.Destination(), event.Time.Format(time.RFC3339))
+				}
+			}
+		}()
+		sidecar.apply(&configCopy)
+	}
+
 	// Start container with AgentConfig (without AutoRemove)
-	if err := c.startContainerWithAgentConfig(container, &configCopy); err != nil {
+	if err := c.startContainerWithAgentConfig(ctx, container, &configCopy); err != nil {
 		// Clean up on error
 		metrics.EndTime = time.Now()
 		_ = c.CleanupContainer(container)
 		return -1, "", fmt.Errorf("failed to start container: %w", err)
 	}
+	c.setRunning(container)
+	defer c.setRunning(nil)
+
+	// Stop the agent when the caller is interrupted. Everything below runs on a
+	// context that is not cancelled with ctx, so the stopped agent's exit code
+	// and logs are still collected.
+	stopInterrupted := context.AfterFunc(ctx, func() {
+		_ = c.CancelAgent(InterruptStopTimeout)
+	})
+	defer stopInterrupted()
+	runCtx := context.WithoutCancel(ctx)
 
 	// Start streaming logs in the background
 	logBuffer := &bytes.Buffer{}
@@ -394,34 +402,17 @@ func (c *Client) RunAgentContainerFromConfigWithStreamingLogs(agentConfig *proje
 		multiWriter = logBuffer
 	}
 
-	// Stream logs using docker logs -f
-	ctx := context.Background()
-	logsCmd := exec.CommandContext(ctx, "docker", "logs", "-f", container.ID)
-
-	// Create pipes for stdout and stderr
-	stdout, err := logsCmd.StdoutPipe()
-	if err != nil {
-		_ = c.CleanupContainer(container)
-		return -1, "", fmt.Errorf("failed to create stdout pipe: %w", err)
-	}
-
-	stderr, err := logsCmd.StderrPipe()
+	// Stream the container's output as it runs
+	logStream, err := c.getRuntime().Logs(runCtx, container, LogOptions{Follow: true})
 	if err != nil {
 		_ = c.CleanupContainer(container)
-		return -1, "", fmt.Errorf("failed to create stderr pipe: %w", err)
+		return -1, "", err
 	}
+	defer logStream.Close()
 
-	// Start the logs command
-	if err := logsCmd.Start(); err != nil {
-		_ = c.CleanupContainer(container)
-		return -1, "", fmt.Errorf("failed to start logs command: %w", err)
-	}
-
-	// Stream stdout and stderr to the multi-writer in goroutines
-	logsDone := make(chan error, 2)
-
+	logsDone := make(chan error, 1)
 	go func() {
-		scanner := bufio.NewScanner(stdout)
+		scanner := bufio.NewScanner(logStream)
 		for scanner.Scan() {
 			line := scanner.Text() + "\n"
 			multiWriter.Write([]byte(line))
@@ -429,22 +420,25 @@ func (c *Client) RunAgentContainerFromConfigWithStreamingLogs(agentConfig *proje
 		logsDone <- scanner.Err()
 	}()
 
+	// Sample resource usage in the background while the container runs
+	sampler := &statsSampler{}
+	statsCtx, stopSampling := context.WithCancel(runCtx)
+	samplingDone := make(chan struct{})
 	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text() + "\n"
-			multiWriter.Write([]byte(line))
-		}
-		logsDone <- scanner.Err()
+		c.sampleContainerStats(statsCtx, container, statsSampleInterval, sampler)
+		close(samplingDone)
 	}()
 
 	// Wait for container to finish
-	exitCode, err := c.WaitForContainer(container)
+	exitCode, err := c.WaitForContainer(runCtx, container)
+	interrupted := ctx.Err()
+	stopSampling()
+	<-samplingDone
+	metrics.ResourceUsage = sampler.usage()
 	if err != nil {
 		// Clean up on error
 		metrics.EndTime = time.Now()
 		metrics.ExitCode = exitCode
-		logsCmd.Process.Kill()
 		_ = c.CleanupContainer(container)
 		return -1, "", fmt.Errorf("failed to wait for container: %w", err)
 	}
@@ -453,25 +447,20 @@ func (c *Client) RunAgentContainerFromConfigWithStreamingLogs(agentConfig *proje
 	metrics.EndTime = time.Now()
 
 	// Wait for log streaming to complete (with timeout)
-	logTimeout := time.After(5 * time.Second)
-	for i := 0; i < 2; i++ {
-		select {
-		case <-logsDone:
-		case <-logTimeout:
-			logsCmd.Process.Kill()
-		}
+	select {
+	case <-logsDone:
+	case <-time.After(5 * time.Second):
+		logStream.Close()
+		<-logsDone
 	}
 
-	// Wait for the logs command to finish
-	logsCmd.Wait()
-
 	// Get the captured logs
 	logs := logBuffer.String()
 
 	metrics.LogSize = len(logs)
 	metrics.ErrorCount = c.countErrorsInLogs(logs)
 	metrics.WarningCount = c.countWarningsInLogs(logs)
-	metrics.TokenUsage = c.ExtractTokenUsageFromLogs(logs)
+	metrics.TokenUsage = formatter.ExtractTokenUsage(logs)
 
 	// Always clean up the container manually since we disabled AutoRemove
 	// to be able to collect logs
@@ -479,26 +468,35 @@ func (c *Client) RunAgentContainerFromConfigWithStreamingLogs(agentConfig *proje
 		return exitCode, logs, fmt.Errorf("failed to cleanup container: %w", err)
 	}
 
+	if interrupted != nil {
+		return exitCode, logs, fmt.Errorf("agent container was interrupted: %w", interrupted)
+	}
 	return exitCode, logs, nil
 }
 
 // RunAgentContainerWithFormattedLogs creates, starts, and manages an agent container with formatted streaming logs
-// This is a convenience wrapper around RunAgentContainerFromConfigWithStreamingLogs that formats Claude Code JSON output
-func (c *Client) RunAgentContainerWithFormattedLogs(agentConfig *projects.AgentConfig, workDir, projectID, apiToken string, logWriter io.Writer, metrics *ContainerMetrics) (int64, string, error) {
+// This is a convenience wrapper around RunAgentContainerFromConfigWithStreamingLogs that formats the agent's
+// output with the formatter selected by the agent configuration's output_format
+func (c *Client) RunAgentContainerWithFormattedLogs(ctx context.Context, agentConfig *projects.AgentConfig, workDir, projectID, apiToken string, logWriter io.Writer, metrics *ContainerMetrics) (int64, string, error) {
+	formatter, err := GetOutputFormatter(agentConfig.OutputFormat)
+	if err != nil {
+		return -1, "", err
+	}
+
 	// Wrap the log writer with formatting if provided
 	var formattedWriter io.Writer
 	if logWriter != nil {
-		formattedWriter = NewFormattingWriter(logWriter)
+		formattedWriter = NewFormattingWriterWithFormatter(logWriter, formatter)
 	}
 
 	// Run container with formatted streaming
-	exitCode, logs, err := c.RunAgentContainerFromConfigWithStreamingLogs(agentConfig, workDir, projectID, apiToken, formattedWriter, metrics)
+	exitCode, logs, err := c.RunAgentContainerFromConfigWithStreamingLogs(ctx, agentConfig, workDir, projectID, apiToken, formattedWriter, metrics)
 	if err != nil {
 		return exitCode, logs, err
 	}
 
 	// Also format the returned logs
-	formattedLogs := FormatClaudeOutput(logs)
+	formattedLogs := formatter.Format(logs)
 
 	return exitCode, formattedLogs, nil
 }
@@ -529,12 +527,22 @@ func (c *Client) countWarningsInLogs(logs string) int {
 	return warningCount
 }
 
-// ExtractTokenUsageFromLogs extracts token usage information from container logs
+// ExtractTokenUsageFromLogs extracts token usage information from container
+// logs with the default output formatter. Runs of agent configurations use the
+// formatter selected by their output_format instead.
 func (c *Client) ExtractTokenUsageFromLogs(logs string) steps.TokenUsage {
+	return claudeFormatter{}.ExtractTokenUsage(logs)
+}
+
+// extractGenericTokenUsage extracts the first token usage reported in the logs
+// as a {"token_usage":{...}} JSON line, a "TOKEN_USAGE: key=value, ..." line or
+// a "resource usage" line with a tokens JSON object
+func extractGenericTokenUsage(logs string) steps.TokenUsage {
 	tokenUsage := steps.TokenUsage{}
 	tokenUsageFound := false
 
 	lines := strings.Split(logs, "\n")
+
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 
@@ -648,101 +656,61 @@ func (c *Client) ExtractTokenUsageFromLogs(logs string) steps.TokenUsage {
 	return tokenUsage
 }
 
-// startContainerWithAgentConfig starts a container with additional AgentConfig options
-func (c *Client) startContainerWithAgentConfig(container *Container, agentConfig *projects.AgentConfig) error {
-	ctx := context.Background()
-
-	// Build docker run command
-	args := []string{"run", "-d", "--name", container.Name}
-
-	// Specify the host dns entry for Linux
-	if runtime.GOOS == "linux" {
-		args = append(args, "--add-host=host.docker.internal:host-gateway")
-	}
-
-	// Add environment variables from AgentConfig
-	for key, value := range agentConfig.Environment {
-		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
-	}
-
-	args = append(args, "-e", "LATASK_URLPATH=http://host.docker.internal:8080/api/v1/projects/"+container.ProjectID)
-	args = append(args, "-e", "LATASK_TOKEN="+container.ApiToken)
-
-	// Add volume mounts from AgentConfig
-	for _, volume := range agentConfig.Volumes {
-		args = append(args, "-v", volume)
-	}
-
-	// Set working directory
-	if agentConfig.WorkingDir != "" {
-		args = append(args, "-w", agentConfig.WorkingDir)
-	} else {
-		args = append(args, "-w", "/src")
-	}
-
-	// Set memory limit if specified
-	if agentConfig.Resources.Memory != "" {
-		args = append(args, "-m", agentConfig.Resources.Memory)
-	}
-
-	// Set CPU shares if specified
-	if agentConfig.Resources.CPUShares > 0 {
-		args = append(args, "-c", fmt.Sprintf("%d", agentConfig.Resources.CPUShares))
-	}
-
-	// Set network mode if specified
-	if agentConfig.Runtime.NetworkMode != "" {
-		args = append(args, "--network", agentConfig.Runtime.NetworkMode)
-	}
-
-	// Set capabilities if specified
-	for _, cap := range agentConfig.Runtime.Capabilities {
-		args = append(args, "--cap-add", cap)
-	}
-
-	// Set devices if specified
-	for _, device := range agentConfig.Runtime.Devices {
-		args = append(args, "--device", device)
+// parseClaudeResultUsage extracts token usage from a Claude Code stream-json "result"
+// message. Per-model totals from modelUsage are preferred since they include usage by
+// subagents running on other models; the top-level usage is used as a fallback.
+func parseClaudeResultUsage(line string) (steps.TokenUsage, bool) {
+	tokenUsage := steps.TokenUsage{}
+	if !strings.HasPrefix(line, "{") || !strings.Contains(line, `"result"`) {
+		return tokenUsage, false
 	}
 
-	// Set AutoRemove option
-	if agentConfig.Runtime.AutoRemove {
-		args = append(args, "--rm")
+	var msg ClaudeMessage
+	if err := json.Unmarshal([]byte(line), &msg); err != nil || msg.Type != "result" {
+		return tokenUsage, false
 	}
-
-	// Set privileged mode if specified
-	if agentConfig.Runtime.Privileged {
-		args = append(args, "--privileged")
+	if msg.Usage == nil && msg.ModelUsage == nil && msg.TotalCostUSD == 0 {
+		return tokenUsage, false
 	}
 
-	// Add volume mounts for work directory and task database
-	args = append(args, "-v", fmt.Sprintf("%s:/src", container.WorkDir))
-
-	// Set the image
-	args = append(args, agentConfig.Image)
-
-	// Add command if specified
-	if len(agentConfig.Command) > 0 {
-		args = append(args, agentConfig.Command...)
+	intField := func(data map[string]interface{}, key string) int {
+		if val, ok := data[key].(float64); ok {
+			return int(val)
+		}
+		return 0
 	}
 
-	// Execute docker run command
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to start container: %w\nOutput: %s", err, string(output))
+	if len(msg.ModelUsage) > 0 {
+		modelCost := 0.0
+		for _, usage := range msg.ModelUsage {
+			modelData, ok := usage.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			tokenUsage.PromptTokens += intField(modelData, "inputTokens")
+			tokenUsage.CompletionTokens += intField(modelData, "outputTokens")
+			tokenUsage.CacheReadTokens += intField(modelData, "cacheReadInputTokens")
+			tokenUsage.CacheWriteTokens += intField(modelData, "cacheCreationInputTokens")
+			if cost, ok := modelData["costUSD"].(float64); ok {
+				modelCost += cost
+			}
+		}
+		tokenUsage.Cost = modelCost
+	} else if msg.Usage != nil {
+		tokenUsage.PromptTokens = intField(msg.Usage, "input_tokens")
+		tokenUsage.CompletionTokens = intField(msg.Usage, "output_tokens")
+		tokenUsage.CacheReadTokens = intField(msg.Usage, "cache_read_input_tokens")
+		tokenUsage.CacheWriteTokens = intField(msg.Usage, "cache_creation_input_tokens")
 	}
 
-	// Parse container ID from output
-	containerID := strings.TrimSpace(string(output))
-	if containerID == "" {
-		return fmt.Errorf("failed to get container ID from docker run output")
+	if msg.TotalCostUSD > 0 {
+		tokenUsage.Cost = msg.TotalCostUSD
 	}
 
-	container.ID = containerID
-	container.StartTime = time.Now()
+	tokenUsage.TotalTokens = tokenUsage.PromptTokens + tokenUsage.CompletionTokens +
+		tokenUsage.CacheReadTokens + tokenUsage.CacheWriteTokens
 
-	return nil
+	return tokenUsage, true
 }
 
 func isTempFile(path string) bool {
@@ -2,9 +2,14 @@ package docker
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/tomyedwab/laforge/lib/projects"
 )
@@ -15,7 +20,7 @@ func TestNewClient(t *testing.T) {
 		t.Skip("Docker is not available")
 	}
 
-	client, err := NewClient()
+	client, err := NewClient("")
 	if err != nil {
 		t.Fatalf("Failed to create Docker client: %v", err)
 	}
@@ -74,7 +79,7 @@ func TestContainerCreationValidation(t *testing.T) {
 			}
 
 			// Test container creation (will fail if Docker not available, which is expected)
-			container, err := client.CreateAgentContainer(agentConfig, tt.workDir)
+			container, err := client.CreateAgentContainer(context.Background(), agentConfig, tt.workDir, "test-project", "test-token")
 
 			// We expect either success or a Docker-related error, not a validation error
 			if tt.wantErr {
@@ -121,20 +126,156 @@ func TestParseMemoryLimit(t *testing.T) {
 	}
 }
 
+func TestBuildCreateArgs(t *testing.T) {
+	container := &Container{
+		Name:      "laforge-agent-test",
+		ProjectID: "test-project",
+		WorkDir:   "/tmp/work",
+		ApiToken:  "token",
+	}
+	agentConfig := &projects.AgentConfig{
+		Name:       "test",
+		Image:      "laforge-agent:latest",
+		WorkingDir: "/src",
+		Resources: projects.ResourceConfig{
+			Memory:         "512",
+			CPUShares:      256,
+			CPULimit:       "1.5",
+			PidsLimit:      128,
+			DiskSize:       "10g",
+			TmpfsSize:      "64m",
+			Ulimits:        map[string]string{"nproc": "256", "nofile": "1024:4096"},
+			ReadOnlyRootFS: true,
+			User:           "1000:1000",
+		},
+		Runtime: projects.RuntimeConfig{
+			NetworkMode: "none",
+			AutoRemove:  true,
+		},
+		Command: []string{"run-agent"},
+	}
+
+	container.Config = agentConfig
+	args := buildCreateArgs(container)
+	joined := strings.Join(args, " ")
+
+	expected := []string{
+		"-m 512m",
+		"-c 256",
+		"--cpus 1.5",
+		"--pids-limit 128",
+		"--storage-opt size=10g",
+		"--tmpfs /tmp:rw,size=64m",
+		"--ulimit nofile=1024:4096 --ulimit nproc=256",
+		"--read-only",
+		"--user 1000:1000",
+		"--network none",
+		"--rm",
+		"-v /tmp/work:/src laforge-agent:latest run-agent",
+	}
+	for _, want := range expected {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected create args to contain %q, got: %s", want, joined)
+		}
+	}
+
+	if args[0] != "create" || args[len(args)-2] != "laforge-agent:latest" {
+		t.Errorf("Unexpected create args: %v", args)
+	}
+}
+
+func TestBuildCreateArgsOmitsUnsetResources(t *testing.T) {
+	container := &Container{
+		Name:    "laforge-agent-test",
+		WorkDir: "/tmp/work",
+		Config:  &projects.AgentConfig{Name: "test", Image: "laforge-agent:latest"},
+	}
+
+	joined := strings.Join(buildCreateArgs(container), " ")
+	for _, flag := range []string{"-m", "-c", "--cpus", "--pids-limit", "--storage-opt", "--tmpfs", "--ulimit", "--read-only", "--user"} {
+		if strings.Contains(joined, " "+flag+" ") || strings.HasSuffix(joined, " "+flag) {
+			t.Errorf("Expected create args not to contain %s, got: %s", flag, joined)
+		}
+	}
+}
+
+func TestBuildCreateArgsPodman(t *testing.T) {
+	container := &Container{
+		Name:      "laforge-agent-test",
+		WorkDir:   "/tmp/work",
+		ProjectID: "test-project",
+		Engine:    projects.ContainerRuntimePodman,
+		Config:    &projects.AgentConfig{Name: "test", Image: "laforge-agent:latest"},
+	}
+
+	joined := strings.Join(buildCreateArgs(container), " ")
+	if strings.Contains(joined, "--add-host") {
+		t.Errorf("Expected no --add-host for podman, got: %s", joined)
+	}
+	if !strings.Contains(joined, "LATASK_URLPATH=http://host.containers.internal:8080/api/v1/projects/test-project") {
+		t.Errorf("Expected callback URL through host.containers.internal, got: %s", joined)
+	}
+	if !strings.Contains(joined, "-v /tmp/work:/src:Z") {
+		t.Errorf("Expected relabeled work directory mount, got: %s", joined)
+	}
+
+	// keep-id only applies to rootless podman
+	if rootless := os.Geteuid() != 0; strings.Contains(joined, "--userns=keep-id") != rootless {
+		t.Errorf("Expected --userns=keep-id only when rootless (rootless=%v), got: %s", rootless, joined)
+	}
+}
+
+func TestBuildCreateArgsSidecar(t *testing.T) {
+	container := &Container{
+		Name:    "laforge-agent-test-egress-proxy",
+		Sidecar: true,
+		Config: &projects.AgentConfig{
+			Name:    "egress-proxy",
+			Image:   "laforge-agent:latest",
+			Volumes: []string{"/usr/bin/laforge:/usr/local/bin/laforge-egress-proxy:ro"},
+		},
+	}
+
+	joined := strings.Join(buildCreateArgs(container), " ")
+	if strings.Contains(joined, "LATASK_") || strings.Contains(joined, ":/src") {
+		t.Errorf("Expected no laserve credentials or worktree for a sidecar, got: %s", joined)
+	}
+	if !strings.Contains(joined, "-v /usr/bin/laforge:/usr/local/bin/laforge-egress-proxy:ro") {
+		t.Errorf("Expected sidecar volume, got: %s", joined)
+	}
+}
+
+func TestCLIRuntimeBinary(t *testing.T) {
+	if binary := (&CLIRuntime{}).binary(); binary != "docker" {
+		t.Errorf("Expected docker by default, got %s", binary)
+	}
+	if binary := (&CLIRuntime{engine: projects.ContainerRuntimePodman}).binary(); binary != "podman" {
+		t.Errorf("Expected podman, got %s", binary)
+	}
+}
+
+func TestResourceArgsReadOnlyMountsTmp(t *testing.T) {
+	args := resourceArgs(&projects.ResourceConfig{ReadOnlyRootFS: true})
+	expected := []string{"--tmpfs", "/tmp:rw", "--read-only"}
+	if strings.Join(args, " ") != strings.Join(expected, " ") {
+		t.Errorf("resourceArgs() = %v, want %v", args, expected)
+	}
+}
+
 func TestEnsureImage(t *testing.T) {
 	// Skip if Docker is not available
 	if err := exec.Command("docker", "--version").Run(); err != nil {
 		t.Skip("Docker is not available")
 	}
 
-	client := &Client{}
+	rt := &CLIRuntime{}
 
 	// Test with a small, commonly available image
 	// Using alpine as it's small and widely available
 	image := "alpine:latest"
 
 	// This should succeed either by finding the image locally or pulling it
-	err := client.ensureImage(image)
+	err := rt.EnsureImage(context.Background(), image)
 	if err != nil {
 		t.Logf("ensureImage failed (this might be expected in some environments): %v", err)
 	}
@@ -258,7 +399,7 @@ func TestAgentConfigContainerCreation(t *testing.T) {
 			}
 
 			// Test container creation with the agent config
-			container, err := client.CreateAgentContainer(tt.agentConfig, tt.workDir)
+			container, err := client.CreateAgentContainer(context.Background(), tt.agentConfig, tt.workDir, "test-project", "test-token")
 
 			if tt.wantErr {
 				if err == nil {
@@ -332,7 +473,7 @@ func TestCreateAgentContainerWithConfig(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			container, err := client.CreateAgentContainer(tt.agentConfig, tt.workDir)
+			container, err := client.CreateAgentContainer(context.Background(), tt.agentConfig, tt.workDir, "test-project", "test-token")
 
 			if tt.wantErr {
 				if err == nil {
@@ -393,7 +534,7 @@ func TestStartContainerWithConfig(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Test container creation (which is the first step in starting a container)
-			container, err := client.CreateAgentContainer(tt.agentConfig, tt.workDir)
+			container, err := client.CreateAgentContainer(context.Background(), tt.agentConfig, tt.workDir, "test-project", "test-token")
 
 			if tt.wantErr {
 				if err == nil {
@@ -452,7 +593,7 @@ func TestStartContainerFromConfig(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Test container creation and starting
-			container, err := client.CreateAgentContainer(tt.agentConfig, tt.workDir)
+			container, err := client.CreateAgentContainer(context.Background(), tt.agentConfig, tt.workDir, "test-project", "test-token")
 			if err != nil {
 				if !tt.wantErr {
 					t.Errorf("CreateAgentContainer() unexpected error = %v", err)
@@ -461,7 +602,7 @@ func TestStartContainerFromConfig(t *testing.T) {
 			}
 
 			// Test starting the container
-			err = client.startContainerWithAgentConfig(container, tt.agentConfig)
+			err = client.startContainerWithAgentConfig(context.Background(), container, tt.agentConfig)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("startContainerWithAgentConfig() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -518,7 +659,7 @@ func TestRunAgentContainerFromConfig(t *testing.T) {
 			// Use a buffer to capture logs
 			var logBuffer bytes.Buffer
 
-			exitCode, logs, err := client.RunAgentContainerFromConfigWithStreamingLogs(tt.agentConfig, tt.workDir, &logBuffer, metrics)
+			exitCode, logs, err := client.RunAgentContainerFromConfigWithStreamingLogs(context.Background(), tt.agentConfig, tt.workDir, "test-project", "test-token", &logBuffer, metrics)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("RunAgentContainerFromConfigWithStreamingLogs() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -534,6 +675,126 @@ func TestRunAgentContainerFromConfig(t *testing.T) {
 	}
 }
 
+func TestRunAgentContainerWithFakeRuntime(t *testing.T) {
+	defer func(interval time.Duration) { statsSampleInterval = interval }(statsSampleInterval)
+	statsSampleInterval = 10 * time.Millisecond
+
+	workDir := t.TempDir()
+	rt := NewFakeRuntime()
+	rt.Usage = ContainerStats{MemoryBytes: 64 << 20, CPUPercent: 50}
+	rt.Agent = func(container *Container) (int64, string) {
+		// Run long enough for the resource usage to be sampled
+		time.Sleep(50 * time.Millisecond)
+		if err := os.WriteFile(filepath.Join(container.WorkDir, "output.txt"), []byte("done"), 0644); err != nil {
+			return 1, err.Error()
+		}
+		return 3, "working\n" + `{"type":"result","subtype":"success","total_cost_usd":0.05,"usage":{"input_tokens":100,"output_tokens":50}}` + "\n"
+	}
+	client := NewClientWithRuntime(rt)
+
+	agentConfig := &projects.AgentConfig{
+		Name:    "test-agent",
+		Image:   "laforge-agent:latest",
+		Runtime: projects.RuntimeConfig{AutoRemove: true, Timeout: "10s"},
+	}
+	metrics := &ContainerMetrics{}
+	var logBuffer bytes.Buffer
+
+	exitCode, logs, err := client.RunAgentContainerFromConfigWithStreamingLogs(context.Background(), agentConfig, workDir, "test-project", "test-token", &logBuffer, metrics)
+	if err != nil {
+		t.Fatalf("RunAgentContainerFromConfigWithStreamingLogs() error = %v", err)
+	}
+	if exitCode != 3 || metrics.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d (metrics %d)", exitCode, metrics.ExitCode)
+	}
+	if !strings.HasPrefix(logs, "working\n") || logBuffer.String() != logs {
+		t.Errorf("Unexpected logs %q, streamed %q", logs, logBuffer.String())
+	}
+	if metrics.TokenUsage.PromptTokens != 100 || metrics.TokenUsage.CompletionTokens != 50 {
+		t.Errorf("Unexpected token usage: %+v", metrics.TokenUsage)
+	}
+	if metrics.ResourceUsage.Samples == 0 || metrics.ResourceUsage.PeakMemoryBytes != 64<<20 {
+		t.Errorf("Unexpected resource usage: %+v", metrics.ResourceUsage)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "output.txt")); err != nil {
+		t.Errorf("Expected agent output in work directory: %v", err)
+	}
+
+	created := rt.Created()
+	if len(created) != 1 {
+		t.Fatalf("Expected one container, got %d", len(created))
+	}
+	if created[0].ApiToken != "test-token" || created[0].Config.Runtime.AutoRemove {
+		t.Errorf("Unexpected container: %+v", created[0])
+	}
+	if agentConfig.Runtime.AutoRemove != true {
+		t.Error("Expected the caller's agent config to be left unchanged")
+	}
+	if rt.Existing() != 0 {
+		t.Errorf("Expected container to be removed, %d remain", rt.Existing())
+	}
+	if images := rt.Images(); len(images) != 1 || images[0] != "laforge-agent:latest" {
+		t.Errorf("Expected image to be ensured, got %v", images)
+	}
+}
+
+func TestRunAgentContainerWithFakeRuntimeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	rt := NewFakeRuntime()
+	rt.Agent = func(container *Container) (int64, string) {
+		<-release
+		return 0, ""
+	}
+	client := NewClientWithRuntime(rt)
+
+	agentConfig := &projects.AgentConfig{
+		Name:    "test-agent",
+		Image:   "laforge-agent:latest",
+		Runtime: projects.RuntimeConfig{Timeout: "20ms"},
+	}
+	_, _, err := client.RunAgentContainerFromConfigWithStreamingLogs(context.Background(), agentConfig, t.TempDir(), "test-project", "test-token", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to wait for container") {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+	if rt.Existing() != 0 {
+		t.Errorf("Expected container to be cleaned up after timeout, %d remain", rt.Existing())
+	}
+}
+
+func TestRunAgentContainerWithFakeRuntimeInterrupted(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	rt := NewFakeRuntime()
+	started := make(chan struct{})
+	rt.Agent = func(container *Container) (int64, string) {
+		close(started)
+		<-release
+		return 0, ""
+	}
+	client := NewClientWithRuntime(rt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	agentConfig := &projects.AgentConfig{Name: "test-agent", Image: "laforge-agent:latest"}
+	exitCode, logs, err := client.RunAgentContainerFromConfigWithStreamingLogs(ctx, agentConfig, t.TempDir(), "test-project", "test-token", nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected an interrupted error, got %v", err)
+	}
+	if exitCode != 143 || logs != "fake agent stopped\n" {
+		t.Errorf("Expected the stopped agent's exit code and logs, got %d %q", exitCode, logs)
+	}
+	if rt.Existing() != 0 {
+		t.Errorf("Expected container to be cleaned up after the interruption, %d remain", rt.Existing())
+	}
+}
+
 func TestVolumeMountDetection(t *testing.T) {
 
 	tests := []struct {
@@ -0,0 +1,171 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/egress"
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// egressProxyPort is the port the egress proxy listens on inside its container
+const egressProxyPort = 3128
+
+// egressProxyBinary is where the laforge binary is mounted in the proxy container
+const egressProxyBinary = "/usr/local/bin/laforge-egress-proxy"
+
+// egressReadyTimeout is how long to wait for the egress proxy to start listening
+var egressReadyTimeout = 10 * time.Second
+
+// egressSidecar is the proxy container and isolated network that enforce an
+// agent's egress policy. The agent is only attached to the internal network, so
+// the proxy, which is also attached to the default network, is its only way out.
+type egressSidecar struct {
+	network string
+	proxy   *Container
+}
+
+// proxyURL returns the URL the agent uses to reach the proxy
+func (s *egressSidecar) proxyURL() string {
+	return fmt.Sprintf("http://%s:%d", s.proxy.Name, egressProxyPort)
+}
+
+// apply routes an agent configuration's traffic through the proxy. The
+// configuration is modified in place, so it must be a copy.
+func (s *egressSidecar) apply(agentConfig *projects.AgentConfig) {
+	environment := make(map[string]string, len(agentConfig.Environment)+4)
+	for key, value := range agentConfig.Environment {
+		environment[key] = value
+	}
+	// Tools disagree on the case of the proxy variables, so set both
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		environment[key] = s.proxyURL()
+	}
+	agentConfig.Environment = environment
+	agentConfig.Runtime.NetworkMode = s.network
+}
+
+// egressAllowList returns the destinations the proxy allows for an agent: its
+// configured allow list plus the laserve callback
+func egressAllowList(agent *Container) []string {
+	allow := append([]string{}, agent.Config.Egress.Allow...)
+	return append(allow, agent.hostGatewayName()+":8080")
+}
+
+// startEgressProxy creates the isolated network and starts the proxy sidecar for
+// an agent container whose configuration has an egress policy
+func (c *Client) startEgressProxy(ctx context.Context, agent *Container) (*egressSidecar, error) {
+	// The proxy is the laforge binary itself, mounted into the proxy image
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the laforge executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+
+	image := agent.Config.Egress.ProxyImage
+	if image == "" {
+		image = agent.Config.Image
+	} else if err := c.getRuntime().EnsureImage(ctx, image); err != nil {
+		return nil, fmt.Errorf("failed to ensure image %s: %w", image, err)
+	}
+
+	command := []string{egressProxyBinary, "egress-proxy", "--listen", ":" + strconv.Itoa(egressProxyPort)}
+	for _, entry := range egressAllowList(agent) {
+		command = append(command, "--allow", entry)
+	}
+
+	sidecar := &egressSidecar{
+		network: agent.Name + "-egress",
+		proxy: &Container{
+			Name:      agent.Name + "-egress-proxy",
+			ProjectID: agent.ProjectID,
+			Engine:    agent.Engine,
+			Sidecar:   true,
+			Config: &projects.AgentConfig{
+				Name:    "egress-proxy",
+				Image:   image,
+				Volumes: []string{executable + ":" + egressProxyBinary + ":ro"},
+				Command: command,
+			},
+		},
+	}
+
+	if err := c.getRuntime().CreateNetwork(ctx, sidecar.network, true); err != nil {
+		return nil, err
+	}
+
+	// The proxy starts on the default network so it can reach the outside, and
+	// joins the agent's internal network before it starts
+	if err := c.getRuntime().Create(ctx, sidecar.proxy); err != nil {
+		c.stopEgressProxy(sidecar)
+		return nil, fmt.Errorf("failed to create egress proxy: %w", err)
+	}
+	if err := c.getRuntime().ConnectNetwork(ctx, sidecar.network, sidecar.proxy); err != nil {
+		c.stopEgressProxy(sidecar)
+		return nil, err
+	}
+	if err := c.getRuntime().Start(ctx, sidecar.proxy); err != nil {
+		c.stopEgressProxy(sidecar)
+		return nil, fmt.Errorf("failed to start egress proxy: %w", err)
+	}
+
+	if err := c.waitForEgressProxy(ctx, sidecar.proxy); err != nil {
+		c.stopEgressProxy(sidecar)
+		return nil, err
+	}
+	return sidecar, nil
+}
+
+// waitForEgressProxy waits until the proxy logs that it is listening
+func (c *Client) waitForEgressProxy(ctx context.Context, proxy *Container) error {
+	deadline := time.Now().Add(egressReadyTimeout)
+	var output string
+	for {
+		if logs, err := c.getRuntime().Logs(ctx, proxy, LogOptions{}); err == nil {
+			data, _ := io.ReadAll(logs)
+			logs.Close()
+			output = string(data)
+			for _, event := range egress.ParseEvents(output) {
+				if event.Event == egress.EventListening {
+					return nil
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("egress proxy did not start within %s\nOutput: %s", egressReadyTimeout, strings.TrimSpace(output))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// stopEgressProxy removes the proxy and its network, and returns the connection
+// attempts the proxy blocked. Cleanup errors are ignored, since the step has
+// already finished by the time the sidecar is removed.
+func (c *Client) stopEgressProxy(sidecar *egressSidecar) []egress.Event {
+	var blocked []egress.Event
+	if sidecar.proxy.ID != "" {
+		if logs, err := c.GetContainerLogs(sidecar.proxy, true, true, false); err == nil {
+			for _, event := range egress.ParseEvents(logs) {
+				if event.Event == egress.EventBlocked {
+					blocked = append(blocked, event)
+				}
+			}
+		}
+		_ = c.CleanupContainer(sidecar.proxy)
+	}
+	_ = c.getRuntime().RemoveNetwork(context.Background(), sidecar.network)
+	return blocked
+}
@@ -0,0 +1,116 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+func TestRunAgentContainerWithEgressPolicy(t *testing.T) {
+	rt := NewFakeRuntime()
+	rt.SidecarAgent = func(container *Container) (int64, string) {
+		return 0, `{"time":"2025-01-01T00:00:00Z","event":"listening","addr":":3128"}
+{"time":"2025-01-01T00:00:01Z","event":"allowed","method":"CONNECT","host":"api.anthropic.com","port":443}
+{"time":"2025-01-01T00:00:02Z","event":"blocked","method":"CONNECT","host":"evil.example.com","port":443}
+`
+	}
+	client := NewClientWithRuntime(rt)
+
+	agentConfig := &projects.AgentConfig{
+		Name:        "test-agent",
+		Image:       "laforge-agent:latest",
+		Environment: map[string]string{"MODELNAME": "test"},
+		Egress:      &projects.EgressConfig{Allow: []string{"api.anthropic.com:443"}},
+	}
+	metrics := &ContainerMetrics{}
+	var logBuffer bytes.Buffer
+
+	exitCode, _, err := client.RunAgentContainerFromConfigWithStreamingLogs(context.Background(), agentConfig, t.TempDir(), "test-project", "test-token", &logBuffer, metrics)
+	if err != nil {
+		t.Fatalf("RunAgentContainerFromConfigWithStreamingLogs() error = %v", err)
+	}
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+
+	created := rt.Created()
+	if len(created) != 2 {
+		t.Fatalf("Expected proxy and agent containers, got %d", len(created))
+	}
+	proxy, agent := created[0], created[1]
+
+	if !proxy.Sidecar || proxy.ApiToken != "" {
+		t.Errorf("Expected the proxy to be a sidecar without credentials: %+v", proxy)
+	}
+	command := strings.Join(proxy.Config.Command, " ")
+	for _, want := range []string{"egress-proxy", "--allow api.anthropic.com:443", "--allow host.docker.internal:8080"} {
+		if !strings.Contains(command, want) {
+			t.Errorf("Expected proxy command to contain %q, got %s", want, command)
+		}
+	}
+
+	network := agent.Name + "-egress"
+	if agent.Config.Runtime.NetworkMode != network {
+		t.Errorf("Expected agent on network %s, got %q", network, agent.Config.Runtime.NetworkMode)
+	}
+	proxyURL := "http://" + agent.Name + "-egress-proxy:3128"
+	if agent.Config.Environment["HTTPS_PROXY"] != proxyURL || agent.Config.Environment["http_proxy"] != proxyURL {
+		t.Errorf("Expected proxy environment for %s, got %v", proxyURL, agent.Config.Environment)
+	}
+	if agent.Config.Environment["MODELNAME"] != "test" {
+		t.Errorf("Expected agent environment to be kept, got %v", agent.Config.Environment)
+	}
+	if _, ok := agentConfig.Environment["HTTPS_PROXY"]; ok || agentConfig.Runtime.NetworkMode != "" {
+		t.Error("Expected the caller's agent config to be left unchanged")
+	}
+
+	if len(metrics.BlockedEgress) != 1 || metrics.BlockedEgress[0].Destination() != "evil.example.com:443" {
+		t.Errorf("Unexpected blocked egress: %+v", metrics.BlockedEgress)
+	}
+	if !strings.Contains(logBuffer.String(), "[egress] Blocked CONNECT evil.example.com:443") {
+		t.Errorf("Expected blocked connection in step log, got %q", logBuffer.String())
+	}
+
+	if rt.Existing() != 0 {
+		t.Errorf("Expected all containers to be removed, %d remain", rt.Existing())
+	}
+	if networks := rt.Networks(); len(networks) != 0 {
+		t.Errorf("Expected egress network to be removed, got %v", networks)
+	}
+}
+
+func TestRunAgentContainerEgressProxyFailsToStart(t *testing.T) {
+	defer func(timeout time.Duration) { egressReadyTimeout = timeout }(egressReadyTimeout)
+	egressReadyTimeout = 200 * time.Millisecond
+
+	rt := NewFakeRuntime()
+	rt.SidecarAgent = func(container *Container) (int64, string) {
+		return 1, "exec format error\n"
+	}
+	agentRan := false
+	rt.Agent = func(container *Container) (int64, string) {
+		agentRan = true
+		return 0, ""
+	}
+	client := NewClientWithRuntime(rt)
+
+	agentConfig := &projects.AgentConfig{
+		Name:   "test-agent",
+		Image:  "laforge-agent:latest",
+		Egress: &projects.EgressConfig{},
+	}
+	_, _, err := client.RunAgentContainerFromConfigWithStreamingLogs(context.Background(), agentConfig, t.TempDir(), "test-project", "test-token", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "exec format error") {
+		t.Errorf("Expected proxy startup error with its output, got %v", err)
+	}
+	if agentRan {
+		t.Error("Expected the agent not to run without its proxy")
+	}
+	if rt.Existing() != 0 || len(rt.Networks()) != 0 {
+		t.Errorf("Expected proxy and network to be cleaned up, got %d containers and %v", rt.Existing(), rt.Networks())
+	}
+}
@@ -0,0 +1,597 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// engineAPIVersion is the Docker Engine API version requested by EngineRuntime
+const engineAPIVersion = "v1.41"
+
+// defaultDockerHost is the daemon socket used when DOCKER_HOST is not set
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// EngineRuntime manages containers through the Docker Engine API. It also works
+// with Podman's Docker-compatible API socket.
+type EngineRuntime struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewEngineRuntime connects to the Docker Engine API at host, given in DOCKER_HOST
+// format ("unix:///var/run/docker.sock" or "tcp://127.0.0.1:2375"). An empty host
+// uses the default docker socket.
+func NewEngineRuntime(host string) (*EngineRuntime, error) {
+	if host == "" {
+		host = defaultDockerHost
+	}
+
+	r := &EngineRuntime{}
+	switch {
+	case strings.HasPrefix(host, "unix://"):
+		socketPath := strings.TrimPrefix(host, "unix://")
+		r.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		}
+		r.baseURL = "http://docker"
+	case strings.HasPrefix(host, "tcp://"):
+		r.client = &http.Client{}
+		r.baseURL = "http://" + strings.TrimPrefix(host, "tcp://")
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q, must start with unix:// or tcp://", host)
+	}
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resp, err := r.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Docker daemon at %s: %w", host, err)
+	}
+	resp.Body.Close()
+
+	return r, nil
+}
+
+// engineError is an error response from the Docker Engine API
+type engineError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *engineError) Error() string {
+	return fmt.Sprintf("docker engine returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// isNotFound returns true if err is a 404 response from the Docker Engine API
+func isNotFound(err error) bool {
+	engineErr, ok := err.(*engineError)
+	return ok && engineErr.StatusCode == http.StatusNotFound
+}
+
+// do sends a request to the Docker Engine API. Error responses are returned as an
+// *engineError; otherwise the caller must close the response body.
+func (r *EngineRuntime) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(jsonBody)
+	}
+
+	requestURL := r.baseURL + "/" + engineAPIVersion + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var errorResponse struct {
+			Message string `json:"message"`
+		}
+		bodyText, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(bodyText, &errorResponse); err != nil || errorResponse.Message == "" {
+			errorResponse.Message = strings.TrimSpace(string(bodyText))
+		}
+		return nil, &engineError{StatusCode: resp.StatusCode, Message: errorResponse.Message}
+	}
+	return resp, nil
+}
+
+// EnsureImage pulls the image unless it is already available locally
+func (r *EngineRuntime) EnsureImage(ctx context.Context, image string) error {
+	resp, err := r.do(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		return nil // Image exists
+	}
+	if !isNotFound(err) {
+		return fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+
+	// Image not found, pull it. Progress is streamed as JSON messages, and
+	// failures are reported in the stream rather than the status code.
+	resp, err = r.do(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {image}}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to pull image %s: %w", image, err)
+		}
+		if message.Error != "" {
+			return fmt.Errorf("failed to pull image %s: %s", image, message.Error)
+		}
+	}
+}
+
+// Create creates a container and sets container.ID
+func (r *EngineRuntime) Create(ctx context.Context, container *Container) error {
+	config, err := buildCreateConfig(container)
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+
+	resp, err := r.do(ctx, http.MethodPost, "/containers/create", url.Values{"name": {container.Name}}, config)
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return fmt.Errorf("failed to parse create container response: %w", err)
+	}
+	if created.ID == "" {
+		return fmt.Errorf("failed to get container ID from create container response")
+	}
+
+	container.ID = created.ID
+	return nil
+}
+
+// Start starts a created container
+func (r *EngineRuntime) Start(ctx context.Context, container *Container) error {
+	resp, err := r.do(ctx, http.MethodPost, "/containers/"+container.ID+"/start", nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Wait blocks until the container exits and returns its exit code
+func (r *EngineRuntime) Wait(ctx context.Context, container *Container) (int64, error) {
+	resp, err := r.do(ctx, http.MethodPost, "/containers/"+container.ID+"/wait", nil, nil)
+	if err != nil {
+		return -1, fmt.Errorf("failed to wait for container: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		StatusCode int64 `json:"StatusCode"`
+		Error      *struct {
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return -1, fmt.Errorf("failed to wait for container: %w", err)
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return -1, fmt.Errorf("failed to wait for container: %s", result.Error.Message)
+	}
+	return result.StatusCode, nil
+}
+
+// Logs returns the combined stdout and stderr of the container
+func (r *EngineRuntime) Logs(ctx context.Context, container *Container, opts LogOptions) (io.ReadCloser, error) {
+	query := url.Values{
+		"stdout":     {"1"},
+		"stderr":     {"1"},
+		"follow":     {strconv.FormatBool(opts.Follow)},
+		"timestamps": {strconv.FormatBool(opts.Timestamps)},
+	}
+	resp, err := r.do(ctx, http.MethodGet, "/containers/"+container.ID+"/logs", query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container logs: %w", err)
+	}
+
+	// Containers without a TTY multiplex stdout and stderr into frames
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(demuxLogs(pw, resp.Body))
+		resp.Body.Close()
+	}()
+	return &demuxReadCloser{PipeReader: pr, body: resp.Body}, nil
+}
+
+// demuxReadCloser reads demultiplexed logs and closes the underlying response when closed
+type demuxReadCloser struct {
+	*io.PipeReader
+	body io.Closer
+}
+
+func (d *demuxReadCloser) Close() error {
+	d.body.Close()
+	return d.PipeReader.Close()
+}
+
+// demuxLogs copies the payload of a multiplexed Docker log stream to dst. Each
+// frame has an 8 byte header: the stream type, three zero bytes, and the
+// big-endian payload length.
+func demuxLogs(dst io.Writer, src io.Reader) error {
+	reader := bufio.NewReader(src)
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(dst, reader, size); err != nil {
+			return err
+		}
+	}
+}
+
+// Stop stops the container, killing it if it is still running after timeout
+func (r *EngineRuntime) Stop(ctx context.Context, container *Container, timeout time.Duration) error {
+	query := url.Values{"t": {strconv.Itoa(int(timeout.Seconds()))}}
+	resp, err := r.do(ctx, http.MethodPost, "/containers/"+container.ID+"/stop", query, nil)
+	if err != nil {
+		return fmt.Errorf("failed to stop container: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Remove removes the container
+func (r *EngineRuntime) Remove(ctx context.Context, container *Container, force bool) error {
+	query := url.Values{"force": {strconv.FormatBool(force)}}
+	resp, err := r.do(ctx, http.MethodDelete, "/containers/"+container.ID, query, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove container: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// engineStats is the subset of the Engine API stats response used to compute usage
+type engineStats struct {
+	CPUStats    engineCPUStats `json:"cpu_stats"`
+	PreCPUStats engineCPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage int64            `json:"usage"`
+		Stats map[string]int64 `json:"stats"`
+	} `json:"memory_stats"`
+}
+
+type engineCPUStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemCPUUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs     uint32 `json:"online_cpus"`
+}
+
+// Stats returns the current resource usage of a running container
+func (r *EngineRuntime) Stats(ctx context.Context, container *Container) (ContainerStats, error) {
+	resp, err := r.do(ctx, http.MethodGet, "/containers/"+container.ID+"/stats", url.Values{"stream": {"false"}}, nil)
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("failed to get container stats: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var stats engineStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return ContainerStats{}, fmt.Errorf("failed to parse container stats: %w", err)
+	}
+	return stats.usage(), nil
+}
+
+// usage computes memory and CPU usage the same way as "docker stats"
+func (s *engineStats) usage() ContainerStats {
+	// Page cache is reclaimable, so it is not counted as used memory
+	memory := s.MemoryStats.Usage
+	if inactive, ok := s.MemoryStats.Stats["inactive_file"]; ok && inactive < memory {
+		memory -= inactive
+	} else if inactive, ok := s.MemoryStats.Stats["total_inactive_file"]; ok && inactive < memory {
+		memory -= inactive
+	}
+
+	cpuPercent := 0.0
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemCPUUsage) - float64(s.PreCPUStats.SystemCPUUsage)
+	onlineCPUs := float64(s.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpuPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+
+	return ContainerStats{MemoryBytes: memory, CPUPercent: cpuPercent}
+}
+
+// CreateNetwork creates a bridge network
+func (r *EngineRuntime) CreateNetwork(ctx context.Context, name string, internal bool) error {
+	body := map[string]interface{}{"Name": name, "Driver": "bridge", "Internal": internal, "CheckDuplicate": true}
+	resp, err := r.do(ctx, http.MethodPost, "/networks/create", nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to create network %s: %w", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ConnectNetwork attaches a created container to an additional network
+func (r *EngineRuntime) ConnectNetwork(ctx context.Context, name string, container *Container) error {
+	body := map[string]string{"Container": container.ID}
+	resp, err := r.do(ctx, http.MethodPost, "/networks/"+name+"/connect", nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to connect container to network %s: %w", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// RemoveNetwork removes a network
+func (r *EngineRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	resp, err := r.do(ctx, http.MethodDelete, "/networks/"+name, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove network %s: %w", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Close releases idle connections to the daemon
+func (r *EngineRuntime) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+// engineCreateConfig is the body of a Docker Engine API create container request
+type engineCreateConfig struct {
+	Image      string           `json:"Image"`
+	Cmd        []string         `json:"Cmd,omitempty"`
+	Env        []string         `json:"Env"`
+	WorkingDir string           `json:"WorkingDir"`
+	User       string           `json:"User,omitempty"`
+	HostConfig engineHostConfig `json:"HostConfig"`
+}
+
+type engineHostConfig struct {
+	Binds          []string          `json:"Binds"`
+	NetworkMode    string            `json:"NetworkMode,omitempty"`
+	CapAdd         []string          `json:"CapAdd,omitempty"`
+	Devices        []engineDevice    `json:"Devices,omitempty"`
+	Privileged     bool              `json:"Privileged"`
+	AutoRemove     bool              `json:"AutoRemove"`
+	ExtraHosts     []string          `json:"ExtraHosts,omitempty"`
+	UsernsMode     string            `json:"UsernsMode,omitempty"`
+	Memory         int64             `json:"Memory,omitempty"`
+	CPUShares      int64             `json:"CpuShares,omitempty"`
+	NanoCPUs       int64             `json:"NanoCpus,omitempty"`
+	PidsLimit      *int64            `json:"PidsLimit,omitempty"`
+	StorageOpt     map[string]string `json:"StorageOpt,omitempty"`
+	Tmpfs          map[string]string `json:"Tmpfs,omitempty"`
+	Ulimits        []engineUlimit    `json:"Ulimits,omitempty"`
+	ReadonlyRootfs bool              `json:"ReadonlyRootfs"`
+}
+
+type engineDevice struct {
+	PathOnHost        string `json:"PathOnHost"`
+	PathInContainer   string `json:"PathInContainer"`
+	CgroupPermissions string `json:"CgroupPermissions"`
+}
+
+type engineUlimit struct {
+	Name string `json:"Name"`
+	Soft int64  `json:"Soft"`
+	Hard int64  `json:"Hard"`
+}
+
+// buildCreateConfig returns the create container request for an agent container.
+// It mirrors the arguments built by buildCreateArgs for the docker CLI.
+func buildCreateConfig(container *Container) (*engineCreateConfig, error) {
+	agentConfig := container.Config
+	resources := agentConfig.Resources
+
+	config := &engineCreateConfig{
+		Image:      agentConfig.Image,
+		Cmd:        agentConfig.Command,
+		WorkingDir: container.WorkingDir(),
+		User:       resources.User,
+		HostConfig: engineHostConfig{
+			NetworkMode:    agentConfig.Runtime.NetworkMode,
+			CapAdd:         agentConfig.Runtime.Capabilities,
+			Privileged:     agentConfig.Runtime.Privileged,
+			AutoRemove:     agentConfig.Runtime.AutoRemove,
+			UsernsMode:     container.usernsMode(),
+			CPUShares:      resources.CPUShares,
+			ReadonlyRootfs: resources.ReadOnlyRootFS,
+		},
+	}
+
+	// Specify the host dns entry for Linux. Podman defines its own.
+	if runtime.GOOS == "linux" && !container.isPodman() {
+		config.HostConfig.ExtraHosts = []string{"host.docker.internal:host-gateway"}
+	}
+
+	// Add environment variables from AgentConfig in a stable order
+	keys := make([]string, 0, len(agentConfig.Environment))
+	for key := range agentConfig.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		config.Env = append(config.Env, fmt.Sprintf("%s=%s", key, agentConfig.Environment[key]))
+	}
+	if !container.Sidecar {
+		config.Env = append(config.Env, "LATASK_URLPATH="+container.CallbackURL(), "LATASK_TOKEN="+container.ApiToken)
+	}
+	if container.SecretsFile != "" {
+		config.Env = append(config.Env, SecretsFileEnvVar+"="+SecretsFileContainerPath)
+	}
+
+	// Add volume mounts from AgentConfig, then the work directory
+	config.HostConfig.Binds = append([]string{}, agentConfig.Volumes...)
+	if !container.Sidecar {
+		config.HostConfig.Binds = append(config.HostConfig.Binds, container.workDirVolume())
+	}
+	if container.SecretsFile != "" {
+		config.HostConfig.Binds = append(config.HostConfig.Binds, container.secretsFileVolume())
+	}
+
+	for _, device := range agentConfig.Runtime.Devices {
+		config.HostConfig.Devices = append(config.HostConfig.Devices, parseDevice(device))
+	}
+
+	if resources.Memory != "" {
+		memory, err := memoryLimitBytes(resources.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory limit: %w", err)
+		}
+		config.HostConfig.Memory = memory
+	}
+
+	if resources.CPULimit != "" {
+		cpus, err := strconv.ParseFloat(strings.TrimSpace(resources.CPULimit), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU limit: %w", err)
+		}
+		config.HostConfig.NanoCPUs = int64(cpus * 1e9)
+	}
+
+	if resources.PidsLimit > 0 {
+		pidsLimit := resources.PidsLimit
+		config.HostConfig.PidsLimit = &pidsLimit
+	}
+
+	if resources.DiskSize != "" {
+		config.HostConfig.StorageOpt = map[string]string{"size": parseMemoryLimit(resources.DiskSize)}
+	}
+
+	// Mount a tmpfs at /tmp if sized, or if the root filesystem is read-only
+	if resources.TmpfsSize != "" {
+		config.HostConfig.Tmpfs = map[string]string{"/tmp": "rw,size=" + parseMemoryLimit(resources.TmpfsSize)}
+	} else if resources.ReadOnlyRootFS {
+		config.HostConfig.Tmpfs = map[string]string{"/tmp": "rw"}
+	}
+
+	names := make([]string, 0, len(resources.Ulimits))
+	for name := range resources.Ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ulimit, err := parseUlimit(name, resources.Ulimits[name])
+		if err != nil {
+			return nil, err
+		}
+		config.HostConfig.Ulimits = append(config.HostConfig.Ulimits, ulimit)
+	}
+
+	return config, nil
+}
+
+// memoryLimitBytes converts a memory limit such as "512m" to bytes, using binary
+// units like the docker CLI
+func memoryLimitBytes(limit string) (int64, error) {
+	limit = parseMemoryLimit(limit)
+	multipliers := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"b", 1},
+	}
+	for _, unit := range multipliers {
+		if strings.HasSuffix(limit, unit.suffix) {
+			// Sizes may be fractional, like "1.5g"
+			value, err := strconv.ParseFloat(strings.TrimSuffix(limit, unit.suffix), 64)
+			if err != nil {
+				return 0, err
+			}
+			return int64(value * float64(unit.multiplier)), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown unit in %q", limit)
+}
+
+// parseDevice parses a device mapping in "--device" format: host[:container[:permissions]]
+func parseDevice(device string) engineDevice {
+	parts := strings.SplitN(device, ":", 3)
+	result := engineDevice{PathOnHost: parts[0], PathInContainer: parts[0], CgroupPermissions: "rwm"}
+	if len(parts) > 1 && parts[1] != "" {
+		result.PathInContainer = parts[1]
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		result.CgroupPermissions = parts[2]
+	}
+	return result
+}
+
+// parseUlimit parses a ulimit given as "limit" or "soft:hard"
+func parseUlimit(name, value string) (engineUlimit, error) {
+	soft, hard, hasHard := strings.Cut(value, ":")
+	ulimit := engineUlimit{Name: name}
+
+	var err error
+	if ulimit.Soft, err = strconv.ParseInt(soft, 10, 64); err != nil {
+		return ulimit, fmt.Errorf("invalid ulimit %s: %w", name, err)
+	}
+	ulimit.Hard = ulimit.Soft
+	if hasHard {
+		if ulimit.Hard, err = strconv.ParseInt(hard, 10, 64); err != nil {
+			return ulimit, fmt.Errorf("invalid ulimit %s: %w", name, err)
+		}
+	}
+	return ulimit, nil
+}
@@ -0,0 +1,333 @@
+package docker
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// logFrame encodes a payload as a multiplexed Docker log frame
+func logFrame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+// startFakeEngine serves a minimal Docker Engine API on a unix socket and returns
+// the DOCKER_HOST to reach it
+func startFakeEngine(t *testing.T, handler http.Handler) string {
+	socketPath := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("Cannot listen on unix socket: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return "unix://" + socketPath
+}
+
+func TestEngineRuntimeLifecycle(t *testing.T) {
+	var created engineCreateConfig
+	var createdName string
+	var pulled string
+	removed := false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("GET /v1.41/images/{name}/json", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"No such image"}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("POST /v1.41/images/create", func(w http.ResponseWriter, r *http.Request) {
+		pulled = r.URL.Query().Get("fromImage")
+		w.Write([]byte(`{"status":"Pulling"}` + "\n" + `{"status":"Downloaded"}` + "\n"))
+	})
+	mux.HandleFunc("POST /v1.41/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		createdName = r.URL.Query().Get("name")
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			http.Error(w, `{"message":"bad body"}`, http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc123","Warnings":[]}`))
+	})
+	mux.HandleFunc("POST /v1.41/containers/abc123/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /v1.41/containers/abc123/wait", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"StatusCode":2}`))
+	})
+	mux.HandleFunc("GET /v1.41/containers/abc123/logs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("follow") != "true" {
+			t.Errorf("Expected follow=true, got %s", r.URL.RawQuery)
+		}
+		w.Write(logFrame(1, "hello "))
+		w.Write(logFrame(2, "from stderr\n"))
+		w.Write(logFrame(1, "done\n"))
+	})
+	mux.HandleFunc("GET /v1.41/containers/abc123/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"cpu_stats":{"cpu_usage":{"total_usage":3000},"system_cpu_usage":20000,"online_cpus":2},
+			"precpu_stats":{"cpu_usage":{"total_usage":1000},"system_cpu_usage":10000},
+			"memory_stats":{"usage":1048576,"stats":{"inactive_file":524288}}
+		}`))
+	})
+	mux.HandleFunc("POST /v1.41/containers/abc123/stop", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("t") != "5" {
+			t.Errorf("Expected stop timeout 5, got %s", r.URL.RawQuery)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /v1.41/containers/abc123", func(w http.ResponseWriter, r *http.Request) {
+		removed = r.URL.Query().Get("force") == "true"
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	rt, err := NewEngineRuntime(startFakeEngine(t, mux))
+	if err != nil {
+		t.Fatalf("NewEngineRuntime failed: %v", err)
+	}
+	defer rt.Close()
+	ctx := context.Background()
+
+	if err := rt.EnsureImage(ctx, "laforge-agent:latest"); err != nil {
+		t.Fatalf("EnsureImage failed: %v", err)
+	}
+	if pulled != "laforge-agent:latest" {
+		t.Errorf("Expected image to be pulled, got %q", pulled)
+	}
+
+	container := &Container{
+		Name:      "laforge-agent-test",
+		ProjectID: "test-project",
+		WorkDir:   "/tmp/work",
+		ApiToken:  "token",
+		Config: &projects.AgentConfig{
+			Image:       "laforge-agent:latest",
+			Environment: map[string]string{"B": "2", "A": "1"},
+			Volumes:     []string{"/cache:/cache:ro"},
+			Command:     []string{"run-agent"},
+			Resources: projects.ResourceConfig{
+				Memory:    "512m",
+				CPULimit:  "1.5",
+				PidsLimit: 64,
+				Ulimits:   map[string]string{"nofile": "1024:4096"},
+				User:      "1000",
+			},
+			Runtime: projects.RuntimeConfig{
+				NetworkMode: "none",
+				Devices:     []string{"/dev/fuse"},
+			},
+		},
+	}
+	if err := rt.Create(ctx, container); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if container.ID != "abc123" || createdName != "laforge-agent-test" {
+		t.Errorf("Unexpected container ID %q or name %q", container.ID, createdName)
+	}
+	if created.Image != "laforge-agent:latest" || created.User != "1000" || created.WorkingDir != "/src" {
+		t.Errorf("Unexpected create config: %+v", created)
+	}
+	wantEnv := "A=1 B=2 LATASK_URLPATH=http://host.docker.internal:8080/api/v1/projects/test-project LATASK_TOKEN=token"
+	if strings.Join(created.Env, " ") != wantEnv {
+		t.Errorf("Env = %v, want %s", created.Env, wantEnv)
+	}
+	host := created.HostConfig
+	if strings.Join(host.Binds, " ") != "/cache:/cache:ro /tmp/work:/src" {
+		t.Errorf("Unexpected binds: %v", host.Binds)
+	}
+	if host.Memory != 512<<20 || host.NanoCPUs != 1500000000 || host.PidsLimit == nil || *host.PidsLimit != 64 {
+		t.Errorf("Unexpected resource limits: %+v", host)
+	}
+	if len(host.Ulimits) != 1 || host.Ulimits[0] != (engineUlimit{Name: "nofile", Soft: 1024, Hard: 4096}) {
+		t.Errorf("Unexpected ulimits: %+v", host.Ulimits)
+	}
+	if len(host.Devices) != 1 || host.Devices[0].PathInContainer != "/dev/fuse" || host.Devices[0].CgroupPermissions != "rwm" {
+		t.Errorf("Unexpected devices: %+v", host.Devices)
+	}
+
+	if err := rt.Start(ctx, container); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	logs, err := rt.Logs(ctx, container, LogOptions{Follow: true})
+	if err != nil {
+		t.Fatalf("Logs failed: %v", err)
+	}
+	output, err := io.ReadAll(logs)
+	logs.Close()
+	if err != nil || string(output) != "hello from stderr\ndone\n" {
+		t.Errorf("Unexpected logs %q (error %v)", output, err)
+	}
+
+	stats, err := rt.Stats(ctx, container)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.MemoryBytes != 524288 || stats.CPUPercent != 40 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	exitCode, err := rt.Wait(ctx, container)
+	if err != nil || exitCode != 2 {
+		t.Errorf("Wait() = %d, %v, want 2", exitCode, err)
+	}
+
+	if err := rt.Stop(ctx, container, 5*time.Second); err != nil {
+		t.Errorf("Stop failed: %v", err)
+	}
+	if err := rt.Remove(ctx, container, true); err != nil || !removed {
+		t.Errorf("Remove failed: %v", err)
+	}
+}
+
+func TestEngineRuntimeErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("GET /v1.41/images/{name}/json", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"No such image"}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("POST /v1.41/images/create", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":"pull access denied"}` + "\n"))
+	})
+	mux.HandleFunc("POST /v1.41/containers/missing/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"No such container: missing"}`, http.StatusNotFound)
+	})
+
+	rt, err := NewEngineRuntime(startFakeEngine(t, mux))
+	if err != nil {
+		t.Fatalf("NewEngineRuntime failed: %v", err)
+	}
+	defer rt.Close()
+
+	if err := rt.EnsureImage(context.Background(), "private/image"); err == nil || !strings.Contains(err.Error(), "pull access denied") {
+		t.Errorf("Expected pull error, got %v", err)
+	}
+	if err := rt.Start(context.Background(), &Container{ID: "missing"}); err == nil || !strings.Contains(err.Error(), "No such container") {
+		t.Errorf("Expected missing container error, got %v", err)
+	}
+}
+
+func TestEngineRuntimeNetworks(t *testing.T) {
+	var createBody map[string]interface{}
+	var connected string
+	removed := false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("POST /v1.41/networks/create", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&createBody)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"net1"}`))
+	})
+	mux.HandleFunc("POST /v1.41/networks/agent-egress/connect", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Container string }
+		json.NewDecoder(r.Body).Decode(&body)
+		connected = body.Container
+	})
+	mux.HandleFunc("DELETE /v1.41/networks/agent-egress", func(w http.ResponseWriter, r *http.Request) {
+		removed = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	rt, err := NewEngineRuntime(startFakeEngine(t, mux))
+	if err != nil {
+		t.Fatalf("NewEngineRuntime failed: %v", err)
+	}
+	defer rt.Close()
+	ctx := context.Background()
+
+	if err := rt.CreateNetwork(ctx, "agent-egress", true); err != nil {
+		t.Fatalf("CreateNetwork failed: %v", err)
+	}
+	if createBody["Name"] != "agent-egress" || createBody["Internal"] != true {
+		t.Errorf("Unexpected create network body: %v", createBody)
+	}
+	if err := rt.ConnectNetwork(ctx, "agent-egress", &Container{ID: "abc123"}); err != nil || connected != "abc123" {
+		t.Errorf("ConnectNetwork failed: %v (connected %q)", err, connected)
+	}
+	if err := rt.RemoveNetwork(ctx, "agent-egress"); err != nil || !removed {
+		t.Errorf("RemoveNetwork failed: %v", err)
+	}
+}
+
+func TestNewEngineRuntimeRejectsUnknownHost(t *testing.T) {
+	if _, err := NewEngineRuntime("ssh://example.com"); err == nil {
+		t.Error("Expected error for unsupported docker host")
+	}
+}
+
+func TestBuildCreateConfigPodman(t *testing.T) {
+	config, err := buildCreateConfig(&Container{
+		WorkDir:   "/tmp/work",
+		ProjectID: "test-project",
+		Engine:    projects.ContainerRuntimePodman,
+		Config:    &projects.AgentConfig{Name: "test", Image: "laforge-agent:latest"},
+	})
+	if err != nil {
+		t.Fatalf("buildCreateConfig failed: %v", err)
+	}
+
+	if len(config.HostConfig.ExtraHosts) != 0 {
+		t.Errorf("Expected no extra hosts for podman, got %v", config.HostConfig.ExtraHosts)
+	}
+	if strings.Join(config.HostConfig.Binds, " ") != "/tmp/work:/src:Z" {
+		t.Errorf("Unexpected binds: %v", config.HostConfig.Binds)
+	}
+	if env := strings.Join(config.Env, " "); !strings.Contains(env, "http://host.containers.internal:8080/") {
+		t.Errorf("Expected callback URL through host.containers.internal, got %s", env)
+	}
+	if rootless := os.Geteuid() != 0; (config.HostConfig.UsernsMode == "keep-id") != rootless {
+		t.Errorf("Unexpected UsernsMode %q (rootless=%v)", config.HostConfig.UsernsMode, rootless)
+	}
+}
+
+func TestNewRuntime(t *testing.T) {
+	rt, err := NewRuntime(BackendFake, "")
+	if err != nil {
+		t.Fatalf("NewRuntime(fake) failed: %v", err)
+	}
+	if _, ok := rt.(*FakeRuntime); !ok {
+		t.Errorf("Expected *FakeRuntime, got %T", rt)
+	}
+
+	if _, err := NewRuntime("kubernetes", ""); err == nil {
+		t.Error("Expected error for unknown backend")
+	}
+	if _, err := NewRuntime(BackendFake, "containerd"); err == nil {
+		t.Error("Expected error for unknown container runtime")
+	}
+}
+
+func TestMemoryLimitBytes(t *testing.T) {
+	tests := map[string]int64{
+		"512m": 512 << 20,
+		"1.5g": 3 << 29,
+		"2kb":  2 << 10,
+		"100":  100 << 20,
+	}
+	for limit, want := range tests {
+		got, err := memoryLimitBytes(limit)
+		if err != nil || got != want {
+			t.Errorf("memoryLimitBytes(%q) = %d, %v; want %d", limit, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeAgent simulates the agent in a FakeRuntime container. It may modify the
+// container's work directory, and returns the exit code and output of the agent.
+type FakeAgent func(container *Container) (int64, string)
+
+// FakeRuntime runs containers in memory without a daemon, for tests
+type FakeRuntime struct {
+	// Agent is run when a container starts. The default agent prints a line and exits 0.
+	Agent FakeAgent
+
+	// SidecarAgent is run instead of Agent for sidecar containers. The default
+	// reports that the egress proxy is listening and exits 0.
+	SidecarAgent FakeAgent
+
+	// Usage is returned by Stats while a container is running
+	Usage ContainerStats
+
+	mu         sync.Mutex
+	nextID     int
+	images     []string
+	created    []*Container
+	containers map[string]*fakeContainer
+	networks   map[string][]string
+}
+
+type fakeContainer struct {
+	container *Container
+	started   bool
+	finished  bool
+	done      chan struct{}
+	exitCode  int64
+	logs      string
+}
+
+// NewFakeRuntime returns an empty in-memory runtime
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{containers: map[string]*fakeContainer{}, networks: map[string][]string{}}
+}
+
+// Images returns the images passed to EnsureImage
+func (r *FakeRuntime) Images() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.images...)
+}
+
+// Created returns every container created so far, in order
+func (r *FakeRuntime) Created() []*Container {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Container(nil), r.created...)
+}
+
+// Existing returns the number of containers that have been created but not removed
+func (r *FakeRuntime) Existing() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.containers)
+}
+
+// Networks returns the names of the networks that exist, with the IDs of the
+// containers connected to each
+func (r *FakeRuntime) Networks() map[string][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	networks := make(map[string][]string, len(r.networks))
+	for name, containerIDs := range r.networks {
+		networks[name] = append([]string(nil), containerIDs...)
+	}
+	return networks
+}
+
+func (r *FakeRuntime) get(container *Container) (*fakeContainer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fc, ok := r.containers[container.ID]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", container.ID)
+	}
+	return fc, nil
+}
+
+// EnsureImage records the image
+func (r *FakeRuntime) EnsureImage(ctx context.Context, image string) error {
+	if image == "" {
+		return fmt.Errorf("image name cannot be empty")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.images = append(r.images, image)
+	return nil
+}
+
+// Create registers the container and assigns it an ID
+func (r *FakeRuntime) Create(ctx context.Context, container *Container) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.containers == nil {
+		r.containers = map[string]*fakeContainer{}
+	}
+	r.nextID++
+	container.ID = fmt.Sprintf("fake-%d", r.nextID)
+	r.containers[container.ID] = &fakeContainer{container: container, done: make(chan struct{})}
+	r.created = append(r.created, container)
+
+	// Containers started on a created network are connected to it
+	if container.Config != nil {
+		if _, exists := r.networks[container.Config.Runtime.NetworkMode]; exists {
+			r.networks[container.Config.Runtime.NetworkMode] = append(r.networks[container.Config.Runtime.NetworkMode], container.ID)
+		}
+	}
+	return nil
+}
+
+// Start runs the fake agent in the background
+func (r *FakeRuntime) Start(ctx context.Context, container *Container) error {
+	fc, err := r.get(container)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if fc.started {
+		r.mu.Unlock()
+		return fmt.Errorf("container %s is already started", container.ID)
+	}
+	fc.started = true
+	agent := r.Agent
+	if container.Sidecar {
+		agent = r.SidecarAgent
+		if agent == nil {
+			agent = func(*Container) (int64, string) {
+				return 0, `{"event":"listening","addr":":3128"}` + "\n"
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	if agent == nil {
+		agent = func(*Container) (int64, string) {
+			return 0, "fake agent finished\n"
+		}
+	}
+
+	go func() {
+		exitCode, logs := agent(container)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if !fc.finished {
+			fc.finished = true
+			fc.exitCode = exitCode
+			fc.logs = logs
+			close(fc.done)
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until the fake agent returns
+func (r *FakeRuntime) Wait(ctx context.Context, container *Container) (int64, error) {
+	fc, err := r.get(container)
+	if err != nil {
+		return -1, err
+	}
+
+	select {
+	case <-fc.done:
+	case <-ctx.Done():
+		return -1, fmt.Errorf("failed to wait for container: %w", ctx.Err())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fc.exitCode, nil
+}
+
+// Logs returns the output of the fake agent, which only becomes available once
+// the agent has finished
+func (r *FakeRuntime) Logs(ctx context.Context, container *Container, opts LogOptions) (io.ReadCloser, error) {
+	fc, err := r.get(container)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container logs: %w", err)
+	}
+
+	if opts.Follow {
+		// Stream the output once the agent finishes
+		pr, pw := io.Pipe()
+		go func() {
+			select {
+			case <-fc.done:
+				r.mu.Lock()
+				logs := fc.logs
+				r.mu.Unlock()
+				_, err := io.WriteString(pw, logs)
+				pw.CloseWithError(err)
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+			}
+		}()
+		return pr, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return io.NopCloser(strings.NewReader(fc.logs)), nil
+}
+
+// Stop ends a running container as if the agent exited on SIGTERM, with exit
+// code 143. The fake agent keeps running, but its result is discarded.
+func (r *FakeRuntime) Stop(ctx context.Context, container *Container, timeout time.Duration) error {
+	fc, err := r.get(container)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fc.started && !fc.finished {
+		fc.finished = true
+		fc.exitCode = 143
+		fc.logs = "fake agent stopped\n"
+		close(fc.done)
+	}
+	return nil
+}
+
+// Remove forgets the container
+func (r *FakeRuntime) Remove(ctx context.Context, container *Container, force bool) error {
+	fc, err := r.get(container)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-fc.done:
+	default:
+		if fc.started && !force {
+			return fmt.Errorf("container %s is still running", container.ID)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.containers, container.ID)
+	return nil
+}
+
+// Stats returns Usage while the container is running
+func (r *FakeRuntime) Stats(ctx context.Context, container *Container) (ContainerStats, error) {
+	fc, err := r.get(container)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	select {
+	case <-fc.done:
+		return ContainerStats{}, fmt.Errorf("container %s is not running", container.ID)
+	default:
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Usage, nil
+}
+
+// CreateNetwork records the network
+func (r *FakeRuntime) CreateNetwork(ctx context.Context, name string, internal bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.networks == nil {
+		r.networks = map[string][]string{}
+	}
+	if _, exists := r.networks[name]; exists {
+		return fmt.Errorf("network %s already exists", name)
+	}
+	r.networks[name] = nil
+	return nil
+}
+
+// ConnectNetwork records the container as connected to the network
+func (r *FakeRuntime) ConnectNetwork(ctx context.Context, name string, container *Container) error {
+	if _, err := r.get(container); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.networks[name]; !exists {
+		return fmt.Errorf("no such network: %s", name)
+	}
+	r.networks[name] = append(r.networks[name], container.ID)
+	return nil
+}
+
+// RemoveNetwork forgets the network
+func (r *FakeRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.networks[name]; !exists {
+		return fmt.Errorf("no such network: %s", name)
+	}
+	delete(r.networks, name)
+	return nil
+}
+
+// Close is a no-op for the fake runtime
+func (r *FakeRuntime) Close() error {
+	return nil
+}
@@ -0,0 +1,252 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+// Output formats that agent configurations can select with output_format
+const (
+	// OutputFormatClaude is Claude Code's stream-json output
+	OutputFormatClaude = "claude"
+	// OutputFormatOpencode is the JSON event output of `opencode run --format json`
+	OutputFormatOpencode = "opencode"
+	// OutputFormatJSONL passes output through unchanged
+	OutputFormatJSONL = "jsonl"
+
+	// DefaultOutputFormat is used by agent configurations without an output_format
+	DefaultOutputFormat = OutputFormatClaude
+)
+
+// OutputFormatter turns an agent's raw output into the markdown shown to users
+// and written to the step log, and reads the run's token usage from it
+type OutputFormatter interface {
+	// Format formats agent output, either a single line as it is streamed or the
+	// full logs of a run. Output the formatter does not understand is returned as-is.
+	Format(output string) string
+
+	// ExtractTokenUsage returns the token usage of a run from its full raw logs
+	ExtractTokenUsage(logs string) steps.TokenUsage
+}
+
+var (
+	outputFormattersMu sync.RWMutex
+	outputFormatters   = map[string]OutputFormatter{}
+)
+
+func init() {
+	RegisterOutputFormatter(OutputFormatClaude, claudeFormatter{})
+	RegisterOutputFormatter(OutputFormatOpencode, opencodeFormatter{})
+	RegisterOutputFormatter(OutputFormatJSONL, jsonlFormatter{})
+}
+
+// RegisterOutputFormatter makes a formatter available to agent configurations
+// under the given name, replacing any formatter registered with that name
+func RegisterOutputFormatter(name string, formatter OutputFormatter) {
+	outputFormattersMu.Lock()
+	defer outputFormattersMu.Unlock()
+	outputFormatters[name] = formatter
+}
+
+// GetOutputFormatter returns the formatter registered with the given name. An
+// empty name selects DefaultOutputFormat.
+func GetOutputFormatter(name string) (OutputFormatter, error) {
+	if name == "" {
+		name = DefaultOutputFormat
+	}
+
+	outputFormattersMu.RLock()
+	defer outputFormattersMu.RUnlock()
+	formatter, ok := outputFormatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format '%s', must be one of: %s", name, strings.Join(outputFormatterNamesLocked(), ", "))
+	}
+	return formatter, nil
+}
+
+// OutputFormatterNames returns the names of all registered formatters, sorted
+func OutputFormatterNames() []string {
+	outputFormattersMu.RLock()
+	defer outputFormattersMu.RUnlock()
+	return outputFormatterNamesLocked()
+}
+
+func outputFormatterNamesLocked() []string {
+	names := make([]string, 0, len(outputFormatters))
+	for name := range outputFormatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// claudeFormatter formats Claude Code stream-json output
+type claudeFormatter struct{}
+
+func (claudeFormatter) Format(output string) string {
+	return FormatClaudeOutput(output)
+}
+
+// ExtractTokenUsage returns the totals of the last Claude Code result message.
+// Agents that wrap Claude Code and print their own usage lines fall back to the
+// generic patterns of the jsonl formatter.
+func (claudeFormatter) ExtractTokenUsage(logs string) steps.TokenUsage {
+	lines := strings.Split(logs, "\n")
+
+	// The Claude Code result message reports the totals for the whole session, so
+	// it takes precedence over any other usage reported in the logs
+	for i := len(lines) - 1; i >= 0; i-- {
+		if claudeUsage, ok := parseClaudeResultUsage(strings.TrimSpace(lines[i])); ok {
+			return claudeUsage
+		}
+	}
+	return extractGenericTokenUsage(logs)
+}
+
+// jsonlFormatter passes agent output through unchanged, for agents that write
+// plain text or JSON lines with no dedicated formatter
+type jsonlFormatter struct{}
+
+func (jsonlFormatter) Format(output string) string {
+	return output
+}
+
+// ExtractTokenUsage reads the first token usage reported in one of the patterns
+// understood by extractGenericTokenUsage
+func (jsonlFormatter) ExtractTokenUsage(logs string) steps.TokenUsage {
+	return extractGenericTokenUsage(logs)
+}
+
+// opencodeEvent is a line of `opencode run --format json` output
+type opencodeEvent struct {
+	Type  string          `json:"type"`
+	Part  opencodePart    `json:"part"`
+	Error json.RawMessage `json:"error"`
+}
+
+// opencodePart is the message part an opencode event reports
+type opencodePart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+
+	// Tool parts
+	Tool  string `json:"tool"`
+	State struct {
+		Status string                 `json:"status"`
+		Input  map[string]interface{} `json:"input"`
+		Output string                 `json:"output"`
+		Error  string                 `json:"error"`
+	} `json:"state"`
+
+	// Step finish parts
+	Cost   float64 `json:"cost"`
+	Tokens struct {
+		Input     int `json:"input"`
+		Output    int `json:"output"`
+		Reasoning int `json:"reasoning"`
+		Cache     struct {
+			Read  int `json:"read"`
+			Write int `json:"write"`
+		} `json:"cache"`
+	} `json:"tokens"`
+}
+
+// opencodeFormatter formats the JSON events written by `opencode run --format json`
+type opencodeFormatter struct{}
+
+func (opencodeFormatter) Format(output string) string {
+	var formatted strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		var event opencodeEvent
+		if !strings.HasPrefix(trimmed, "{") || json.Unmarshal([]byte(trimmed), &event) != nil || event.Type == "" {
+			// Not an opencode event, such as output of the wrapper script
+			formatted.WriteString(line)
+			formatted.WriteString("\n")
+			continue
+		}
+
+		switch event.Type {
+		case "text":
+			if event.Part.Text != "" {
+				formatted.WriteString(event.Part.Text)
+				formatted.WriteString("\n\n")
+			}
+
+		case "tool_use":
+			if paramStr := formatToolParams(event.Part.State.Input); paramStr != "" {
+				formatted.WriteString(fmt.Sprintf("> %s (%s)\n", event.Part.Tool, paramStr))
+			} else {
+				formatted.WriteString(fmt.Sprintf("> %s\n", event.Part.Tool))
+			}
+			if event.Part.State.Status == "error" {
+				formatted.WriteString(fmt.Sprintf("⚠️  Tool error: %s\n\n", event.Part.State.Error))
+			} else if event.Part.State.Output != "" {
+				formatted.WriteString(formatToolResult(event.Part.State.Output))
+			} else {
+				formatted.WriteString("\n")
+			}
+
+		case "error":
+			formatted.WriteString(fmt.Sprintf("❌ Error: %s\n\n", opencodeErrorMessage(event.Error)))
+		}
+	}
+	return formatted.String()
+}
+
+// ExtractTokenUsage totals the usage reported at the end of each opencode step
+func (opencodeFormatter) ExtractTokenUsage(logs string) steps.TokenUsage {
+	tokenUsage := steps.TokenUsage{}
+	for _, line := range strings.Split(logs, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") || !strings.Contains(line, `"step_finish"`) {
+			continue
+		}
+		var event opencodeEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil || event.Type != "step_finish" {
+			continue
+		}
+		tokens := event.Part.Tokens
+		tokenUsage.PromptTokens += tokens.Input
+		tokenUsage.CompletionTokens += tokens.Output + tokens.Reasoning
+		tokenUsage.CacheReadTokens += tokens.Cache.Read
+		tokenUsage.CacheWriteTokens += tokens.Cache.Write
+		tokenUsage.Cost += event.Part.Cost
+	}
+	tokenUsage.TotalTokens = tokenUsage.PromptTokens + tokenUsage.CompletionTokens +
+		tokenUsage.CacheReadTokens + tokenUsage.CacheWriteTokens
+	return tokenUsage
+}
+
+// opencodeErrorMessage extracts the message of an opencode error event, which is
+// either a string or an object with a name and data.message
+func opencodeErrorMessage(raw json.RawMessage) string {
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil {
+		return message
+	}
+	var structured struct {
+		Name string `json:"name"`
+		Data struct {
+			Message string `json:"message"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &structured); err == nil {
+		if structured.Data.Message != "" {
+			return structured.Data.Message
+		}
+		if structured.Name != "" {
+			return structured.Name
+		}
+	}
+	return string(raw)
+}
@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+const opencodeOutput = `Starting opencode
+{"type":"step_start","sessionID":"ses_1","part":{"type":"step-start"}}
+{"type":"text","sessionID":"ses_1","part":{"type":"text","text":"Running the tests."}}
+{"type":"tool_use","sessionID":"ses_1","part":{"type":"tool","tool":"bash","state":{"status":"completed","input":{"command":"go test ./..."},"output":"ok"}}}
+{"type":"tool_use","sessionID":"ses_1","part":{"type":"tool","tool":"read","state":{"status":"error","input":{"filePath":"missing.go"},"error":"file not found"}}}
+{"type":"step_finish","sessionID":"ses_1","part":{"type":"step-finish","cost":0.01,"tokens":{"input":100,"output":20,"reasoning":5,"cache":{"read":1000,"write":50}}}}
+{"type":"step_finish","sessionID":"ses_1","part":{"type":"step-finish","cost":0.02,"tokens":{"input":200,"output":30,"reasoning":0,"cache":{"read":2000,"write":0}}}}
+{"type":"error","sessionID":"ses_1","error":{"name":"APIError","data":{"message":"rate limited"}}}
+`
+
+func TestGetOutputFormatter(t *testing.T) {
+	for _, name := range []string{"", OutputFormatClaude, OutputFormatOpencode, OutputFormatJSONL} {
+		if _, err := GetOutputFormatter(name); err != nil {
+			t.Errorf("GetOutputFormatter(%q) error = %v", name, err)
+		}
+	}
+
+	_, err := GetOutputFormatter("aider")
+	if err == nil || !strings.Contains(err.Error(), "claude, jsonl, opencode") {
+		t.Errorf("Expected an error listing the output formats, got %v", err)
+	}
+
+	RegisterOutputFormatter("test-format", jsonlFormatter{})
+	defer func() {
+		outputFormattersMu.Lock()
+		delete(outputFormatters, "test-format")
+		outputFormattersMu.Unlock()
+	}()
+	if _, err := GetOutputFormatter("test-format"); err != nil {
+		t.Errorf("Expected a registered formatter to be found: %v", err)
+	}
+}
+
+func TestOpencodeFormatter(t *testing.T) {
+	formatter, _ := GetOutputFormatter(OutputFormatOpencode)
+
+	output := formatter.Format(opencodeOutput)
+	for _, expected := range []string{
+		"Starting opencode\n",
+		"Running the tests.\n",
+		"> bash (go test ./...)\n",
+		"**Tool result:**\n```\nok\n```",
+		"> read (1 params)\n⚠️  Tool error: file not found",
+		"❌ Error: rate limited",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in formatted output:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "step_start") || strings.Contains(output, "step_finish") {
+		t.Errorf("Expected step events to be dropped:\n%s", output)
+	}
+
+	usage := formatter.ExtractTokenUsage(opencodeOutput)
+	expected := steps.TokenUsage{PromptTokens: 300, CompletionTokens: 55, CacheReadTokens: 3000, CacheWriteTokens: 50, TotalTokens: 3405}
+	if usage.Cost < 0.0299 || usage.Cost > 0.0301 {
+		t.Errorf("Expected cost 0.03, got %v", usage.Cost)
+	}
+	usage.Cost = 0
+	if usage != expected {
+		t.Errorf("Expected token usage %+v, got %+v", expected, usage)
+	}
+}
+
+func TestJSONLFormatter(t *testing.T) {
+	formatter, _ := GetOutputFormatter(OutputFormatJSONL)
+
+	logs := `{"event":"start"}` + "\n" + `{"token_usage": {"prompt_tokens": 10, "completion_tokens": 5}}` + "\n"
+	if got := formatter.Format(logs); got != logs {
+		t.Errorf("Expected output to pass through unchanged, got %q", got)
+	}
+	if usage := formatter.ExtractTokenUsage(logs); usage.PromptTokens != 10 || usage.CompletionTokens != 5 || usage.TotalTokens != 15 {
+		t.Errorf("Unexpected token usage %+v", usage)
+	}
+}
+
+func TestFormattingWriterWithFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	formatter, _ := GetOutputFormatter(OutputFormatOpencode)
+	fw := NewFormattingWriterWithFormatter(&buf, formatter)
+
+	line := `{"type":"text","part":{"type":"text","text":"Hello"}}` + "\n"
+	if _, err := fw.Write([]byte(line)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "Hello\n") {
+		t.Errorf("Expected formatted opencode output, got %q", buf.String())
+	}
+}
+
+func TestRunAgentContainerUsesOutputFormat(t *testing.T) {
+	rt := NewFakeRuntime()
+	rt.Agent = func(container *Container) (int64, string) {
+		return 0, opencodeOutput
+	}
+	client := NewClientWithRuntime(rt)
+
+	agentConfig := &projects.AgentConfig{
+		Name:         "opencode",
+		Image:        "laforge-agent:latest",
+		OutputFormat: OutputFormatOpencode,
+	}
+	metrics := &ContainerMetrics{}
+	var logBuffer bytes.Buffer
+	if _, _, err := client.RunAgentContainerWithFormattedLogs(context.Background(), agentConfig, t.TempDir(), "test-project", "test-token", &logBuffer, metrics); err != nil {
+		t.Fatalf("RunAgentContainerWithFormattedLogs() error = %v", err)
+	}
+	if metrics.TokenUsage.PromptTokens != 300 {
+		t.Errorf("Expected token usage from the opencode formatter, got %+v", metrics.TokenUsage)
+	}
+	if !strings.Contains(logBuffer.String(), "> bash (go test ./...)") {
+		t.Errorf("Expected streamed output formatted by the opencode formatter, got %q", logBuffer.String())
+	}
+
+	agentConfig.OutputFormat = "unknown"
+	if _, _, err := client.RunAgentContainerFromConfigWithStreamingLogs(context.Background(), agentConfig, t.TempDir(), "test-project", "test-token", nil, nil); err == nil {
+		t.Error("Expected an error for an unknown output format")
+	}
+}
@@ -22,7 +22,7 @@ func TestFormattingWriter_ClaudeJSON(t *testing.T) {
 	}
 
 	output := buf.String()
-	if !strings.Contains(output, "Starting Claude Code session") {
+	if !strings.Contains(output, "# Claude Code") {
 		t.Errorf("Expected formatted output, got: %s", output)
 	}
 
@@ -71,7 +71,7 @@ func TestFormattingWriter_MultipleLines(t *testing.T) {
 	}
 
 	output := buf.String()
-	if !strings.Contains(output, "Starting Claude Code session") {
+	if !strings.Contains(output, "# Claude Code") {
 		t.Errorf("Expected first line formatted, got: %s", output)
 	}
 
@@ -135,8 +135,8 @@ func TestFormattingWriter_AssistantMessage(t *testing.T) {
 	}
 
 	output := buf.String()
-	if !strings.Contains(output, "💬") {
-		t.Errorf("Expected chat emoji, got: %s", output)
+	if strings.Contains(output, `"type"`) {
+		t.Errorf("Expected raw JSON to be formatted, got: %s", output)
 	}
 
 	if !strings.Contains(output, "Test message") {
@@ -156,11 +156,7 @@ func TestFormattingWriter_ToolUse(t *testing.T) {
 	}
 
 	output := buf.String()
-	if !strings.Contains(output, "🔧") {
-		t.Errorf("Expected tool emoji, got: %s", output)
-	}
-
-	if !strings.Contains(output, "Read") {
+	if !strings.Contains(output, "> Read") {
 		t.Errorf("Expected tool name, got: %s", output)
 	}
 }
@@ -188,14 +184,10 @@ func TestFormattingWriter_StreamingScenario(t *testing.T) {
 
 	// Check that all expected elements are present
 	expectedElements := []string{
-		"Starting Claude Code session",
-		"claude-sonnet-4-5",
-		"💬",
+		"# Claude Code (claude-sonnet-4-5)",
 		"Starting work",
-		"🔧",
-		"Read",
-		"✅",
-		"completed successfully",
+		"> Read",
+		"✅ Success",
 		"$0.05",
 	}
 
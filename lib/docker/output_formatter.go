@@ -38,6 +38,17 @@ func formatToolParams(input map[string]interface{}) string {
 	return strings.Join(params, ", ")
 }
 
+// formatToolResult formats the output of a tool call as a code block, keeping
+// only the start and end of long output
+func formatToolResult(result string) string {
+	lines := strings.Split(result, "\n")
+	if len(lines) <= 100 {
+		return fmt.Sprintf("**Tool result:**\n```\n%s\n```\n\n", result)
+	}
+	truncated := strings.Join(lines[:50], "\n") + "\n\n... [" + fmt.Sprintf("%d", len(lines)-100) + " lines truncated] ...\n\n" + strings.Join(lines[len(lines)-50:], "\n")
+	return fmt.Sprintf("**Tool result** _(truncated, %d lines total)_:\n```\n%s\n```\n\n", len(lines), truncated)
+}
+
 // ClaudeMessage represents different types of Claude Code JSON output messages
 type ClaudeMessage struct {
 	Type           string                 `json:"type"`
@@ -172,15 +183,7 @@ func FormatClaudeOutput(logs string) string {
 									output.WriteString(fmt.Sprintf("⚠️  Tool error: %s\n\n", errorMsg))
 								}
 							} else if contentStr, ok := itemMap["content"].(string); ok {
-								// Non-error result - show if not too long
-								lines := strings.Split(contentStr, "\n")
-								if len(lines) <= 100 {
-									output.WriteString(fmt.Sprintf("**Tool result:**\n```\n%s\n```\n\n", contentStr))
-								} else {
-									// Truncate long results
-									truncated := strings.Join(lines[:50], "\n") + "\n\n... [" + fmt.Sprintf("%d", len(lines)-100) + " lines truncated] ...\n\n" + strings.Join(lines[len(lines)-50:], "\n")
-									output.WriteString(fmt.Sprintf("**Tool result** _(truncated, %d lines total)_:\n```\n%s\n```\n\n", len(lines), truncated))
-								}
+								output.WriteString(formatToolResult(contentStr))
 							}
 						}
 					}
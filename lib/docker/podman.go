@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// isPodman returns true if the container runs under Podman rather than Docker
+func (c *Container) isPodman() bool {
+	return c.Engine == projects.ContainerRuntimePodman
+}
+
+// hostGatewayName returns the hostname containers use to reach the host.
+// Podman defines host.containers.internal itself, while Docker on Linux
+// needs host.docker.internal mapped to the host gateway (see buildCreateArgs).
+func (c *Container) hostGatewayName() string {
+	if c.isPodman() {
+		return "host.containers.internal"
+	}
+	return "host.docker.internal"
+}
+
+// workDirVolume returns the bind mount of the worktree at /src. Under Podman the
+// mount is relabeled for the container's private SELinux context, which is a
+// no-op on hosts without SELinux.
+func (c *Container) workDirVolume() string {
+	volume := fmt.Sprintf("%s:/src", c.WorkDir)
+	if c.isPodman() {
+		volume += ":Z"
+	}
+	return volume
+}
+
+// usernsMode returns the user namespace mode for the container. Rootless Podman
+// maps root in the container to the invoking user, but any other user to a
+// subordinate UID, so files the agent writes to the worktree would not be owned
+// by the user running laforge. keep-id maps the user's UID to itself instead.
+func (c *Container) usernsMode() string {
+	if c.isPodman() && os.Geteuid() != 0 {
+		return "keep-id"
+	}
+	return ""
+}
+
+// podmanHost returns the Podman API socket in DOCKER_HOST format: CONTAINER_HOST
+// if set, otherwise the rootless or system socket depending on the current user
+func podmanHost() string {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+	if os.Geteuid() != 0 {
+		runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+		if runtimeDir == "" {
+			runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+		}
+		return "unix://" + filepath.Join(runtimeDir, "podman", "podman.sock")
+	}
+	return "unix:///run/podman/podman.sock"
+}
@@ -0,0 +1,104 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+// BackendEnvVar selects the Runtime used by NewClient
+const BackendEnvVar = "LAFORGE_CONTAINER_BACKEND"
+
+// Runtime backends that can be selected with BackendEnvVar
+const (
+	// BackendCLI runs containers by shelling out to the docker or podman CLI (the default)
+	BackendCLI = "cli"
+	// BackendAPI talks to the Docker Engine API, or Podman's compatible API, over its unix socket
+	BackendAPI = "api"
+	// BackendFake runs containers in memory without a daemon, for tests
+	BackendFake = "fake"
+)
+
+// Runtime manages the lifecycle of agent containers
+type Runtime interface {
+	// EnsureImage pulls the image unless it is already available locally
+	EnsureImage(ctx context.Context, image string) error
+
+	// Create creates a container from container.Config and sets container.ID
+	Create(ctx context.Context, container *Container) error
+
+	// Start starts a created container
+	Start(ctx context.Context, container *Container) error
+
+	// Wait blocks until the container exits and returns its exit code
+	Wait(ctx context.Context, container *Container) (int64, error)
+
+	// Logs returns the combined stdout and stderr of the container. With
+	// Follow set, the stream stays open until the container exits or the
+	// reader is closed.
+	Logs(ctx context.Context, container *Container, opts LogOptions) (io.ReadCloser, error)
+
+	// Stop stops the container, killing it if it is still running after timeout
+	Stop(ctx context.Context, container *Container, timeout time.Duration) error
+
+	// Remove removes the container
+	Remove(ctx context.Context, container *Container, force bool) error
+
+	// Stats returns the current resource usage of a running container
+	Stats(ctx context.Context, container *Container) (ContainerStats, error)
+
+	// CreateNetwork creates a bridge network. An internal network has no route
+	// out of the host, so containers on it can only reach each other.
+	CreateNetwork(ctx context.Context, name string, internal bool) error
+
+	// ConnectNetwork attaches a created container to an additional network
+	ConnectNetwork(ctx context.Context, name string, container *Container) error
+
+	// RemoveNetwork removes a network with no containers attached
+	RemoveNetwork(ctx context.Context, name string) error
+
+	// Close releases any resources held by the runtime
+	Close() error
+}
+
+// LogOptions controls which container logs are returned by Runtime.Logs
+type LogOptions struct {
+	Follow     bool
+	Timestamps bool
+}
+
+// ContainerStats is a point-in-time sample of a container's resource usage
+type ContainerStats struct {
+	MemoryBytes int64
+	CPUPercent  float64
+}
+
+// NewRuntime returns the runtime for the named backend and container engine,
+// defaulting to the engine's CLI. The API backend connects to DOCKER_HOST, or
+// for Podman to its API socket (see podmanHost).
+func NewRuntime(backend, engine string) (Runtime, error) {
+	switch engine {
+	case "", projects.ContainerRuntimeDocker, projects.ContainerRuntimePodman:
+	default:
+		return nil, fmt.Errorf("unknown container runtime %q, must be %s or %s", engine, projects.ContainerRuntimeDocker, projects.ContainerRuntimePodman)
+	}
+
+	switch backend {
+	case "", BackendCLI:
+		return NewCLIRuntime(engine)
+	case BackendAPI:
+		host := os.Getenv("DOCKER_HOST")
+		if host == "" && engine == projects.ContainerRuntimePodman {
+			host = podmanHost()
+		}
+		return NewEngineRuntime(host)
+	case BackendFake:
+		return NewFakeRuntime(), nil
+	default:
+		return nil, fmt.Errorf("unknown container backend %q, must be one of: %s, %s, %s", backend, BackendCLI, BackendAPI, BackendFake)
+	}
+}
@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tomyedwab/laforge/lib/secrets"
+)
+
+// SecretsFileContainerPath is where the secrets env-file is mounted in the agent container
+const SecretsFileContainerPath = "/run/laforge/secrets.env"
+
+// SecretsFileEnvVar tells the agent entrypoint which file to source secrets from
+const SecretsFileEnvVar = "LAFORGE_SECRETS_FILE"
+
+// SetSecretEnvironment sets environment variables that carry secret values.
+// Instead of being passed on the container command line, where they would be
+// visible in "docker inspect", they are written to an env-file on a tmpfs and
+// mounted read-only into the agent container, which sources it at startup.
+func (c *Client) SetSecretEnvironment(env map[string]string) {
+	c.secretEnv = env
+}
+
+// sharedMemoryDir is the tmpfs used for secrets env-files when XDG_RUNTIME_DIR
+// is not set
+var sharedMemoryDir = "/dev/shm"
+
+// secretsTmpDir returns a memory-backed directory for secrets env-files, so
+// secret values are never written to disk. It fails rather than fall back to
+// a disk-backed temporary directory.
+func secretsTmpDir() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	if info, err := os.Stat(sharedMemoryDir); err == nil && info.IsDir() {
+		return sharedMemoryDir, nil
+	}
+	return "", fmt.Errorf("no tmpfs for the secrets file: set XDG_RUNTIME_DIR to a memory-backed directory or provide %s", sharedMemoryDir)
+}
+
+// writeSecretsFile writes the client's secret environment to an env-file for
+// the container, and returns a function that removes it
+func (c *Client) writeSecretsFile(container *Container) (func(), error) {
+	tmpDir, err := secretsTmpDir()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(tmpDir, "laforge-secrets-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	// The directory keeps other host users out, while the file itself must be
+	// readable by the agent user inside the container
+	path := filepath.Join(dir, "secrets.env")
+	if err := os.WriteFile(path, []byte(secrets.FormatEnvFile(c.secretEnv)), 0644); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to write secrets file: %w", err)
+	}
+
+	container.SecretsFile = path
+	return cleanup, nil
+}
+
+// secretsFileVolume returns the bind mount of the container's secrets env-file
+func (c *Container) secretsFileVolume() string {
+	volume := c.SecretsFile + ":" + SecretsFileContainerPath + ":ro"
+	if c.isPodman() {
+		volume += ",Z"
+	}
+	return volume
+}
@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+)
+
+func TestRunAgentContainerWithSecrets(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	rt := NewFakeRuntime()
+	var secretsFile, secretsContent string
+	rt.Agent = func(container *Container) (int64, string) {
+		secretsFile = container.SecretsFile
+		data, _ := os.ReadFile(container.SecretsFile)
+		secretsContent = string(data)
+		return 0, "done\n"
+	}
+	client := NewClientWithRuntime(rt)
+	client.SetSecretEnvironment(map[string]string{"ANTHROPIC_API_KEY": "sk-it's-secret"})
+
+	agentConfig := &projects.AgentConfig{
+		Name:        "test-agent",
+		Image:       "laforge-agent:latest",
+		Environment: map[string]string{"MODELNAME": "test"},
+	}
+	exitCode, _, err := client.RunAgentContainerFromConfigWithStreamingLogs(context.Background(), agentConfig, t.TempDir(), "test-project", "test-token", nil, nil)
+	if err != nil {
+		t.Fatalf("RunAgentContainerFromConfigWithStreamingLogs() error = %v", err)
+	}
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+
+	if secretsContent != "ANTHROPIC_API_KEY='sk-it'\\''s-secret'\n" {
+		t.Errorf("Unexpected secrets file content %q", secretsContent)
+	}
+	if _, err := os.Stat(secretsFile); !os.IsNotExist(err) {
+		t.Errorf("Expected secrets file %s to be removed after the run", secretsFile)
+	}
+
+	args := strings.Join(buildCreateArgs(rt.Created()[0]), " ")
+	if strings.Contains(args, "sk-it") {
+		t.Errorf("Expected secret value to be kept off the command line: %s", args)
+	}
+	for _, want := range []string{
+		"-e " + SecretsFileEnvVar + "=" + SecretsFileContainerPath,
+		"-v " + secretsFile + ":" + SecretsFileContainerPath + ":ro",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Expected create args to contain %q, got %s", want, args)
+		}
+	}
+}
+
+func TestRunAgentContainerWithSecretsRequiresTmpfs(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	originalDir := sharedMemoryDir
+	sharedMemoryDir = "/nonexistent/shm"
+	defer func() { sharedMemoryDir = originalDir }()
+
+	rt := NewFakeRuntime()
+	client := NewClientWithRuntime(rt)
+	client.SetSecretEnvironment(map[string]string{"ANTHROPIC_API_KEY": "sk-secret"})
+
+	agentConfig := &projects.AgentConfig{Name: "test-agent", Image: "laforge-agent:latest"}
+	_, _, err := client.RunAgentContainerFromConfigWithStreamingLogs(context.Background(), agentConfig, t.TempDir(), "test-project", "test-token", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "no tmpfs") {
+		t.Fatalf("Expected the run to fail without a tmpfs, got %v", err)
+	}
+	if len(rt.Created()) != 0 {
+		t.Errorf("Expected no container to be created, got %d", len(rt.Created()))
+	}
+}
+
+func TestBuildCreateArgsWithoutSecrets(t *testing.T) {
+	container := &Container{
+		Name:   "test-container",
+		Config: &projects.AgentConfig{Image: "laforge-agent:latest"},
+	}
+	args := strings.Join(buildCreateArgs(container), " ")
+	if strings.Contains(args, SecretsFileEnvVar) || strings.Contains(args, SecretsFileContainerPath) {
+		t.Errorf("Expected no secrets file without secrets: %s", args)
+	}
+}
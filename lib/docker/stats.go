@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+// statsSampleInterval is how often container resource usage is sampled while an agent runs
+var statsSampleInterval = 5 * time.Second
+
+// statsSampler accumulates resource usage samples into peak and average figures
+type statsSampler struct {
+	mu             sync.Mutex
+	samples        int
+	peakMemory     int64
+	totalMemory    int64
+	peakCPUPercent float64
+	totalCPU       float64
+}
+
+// add records a single sample
+func (s *statsSampler) add(memoryBytes int64, cpuPercent float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples++
+	s.totalMemory += memoryBytes
+	s.totalCPU += cpuPercent
+	if memoryBytes > s.peakMemory {
+		s.peakMemory = memoryBytes
+	}
+	if cpuPercent > s.peakCPUPercent {
+		s.peakCPUPercent = cpuPercent
+	}
+}
+
+// usage returns the resource usage summarized from the samples recorded so far
+func (s *statsSampler) usage() steps.ResourceUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.samples == 0 {
+		return steps.ResourceUsage{}
+	}
+	return steps.ResourceUsage{
+		PeakMemoryBytes: s.peakMemory,
+		AvgMemoryBytes:  s.totalMemory / int64(s.samples),
+		PeakCPUPercent:  s.peakCPUPercent,
+		AvgCPUPercent:   s.totalCPU / float64(s.samples),
+		Samples:         s.samples,
+	}
+}
+
+// sampleContainerStats samples the container's resource usage every interval until
+// ctx is cancelled. Failed samples are skipped, since the container may exit at any time.
+func (c *Client) sampleContainerStats(ctx context.Context, container *Container, interval time.Duration, sampler *statsSampler) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if stats, err := c.getRuntime().Stats(ctx, container); err == nil {
+			sampler.add(stats.MemoryBytes, stats.CPUPercent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// byteUnits are the size suffixes used by docker, longest first so that "MiB" is
+// not mistaken for "B"
+var byteUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"B", 1},
+}
+
+// parseByteSize parses a human-readable size as printed by docker (e.g. "1.5GiB", "512kB")
+func parseByteSize(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(size, unit.suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(size, unit.suffix)), 64)
+			if err != nil {
+				return 0, err
+			}
+			return int64(value * unit.multiplier), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown size unit in %q", size)
+}
+
+// FormatBytes formats a byte count using binary units, e.g. "256.0 MiB"
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
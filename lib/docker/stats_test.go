@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"testing"
+)
+
+func TestParseContainerStats(t *testing.T) {
+	line := `{"BlockIO":"0B / 0B","CPUPerc":"12.50%","Container":"abc123","ID":"abc123","MemPerc":"25.00%","MemUsage":"256MiB / 1GiB","Name":"laforge-agent","NetIO":"1kB / 2kB","PIDs":"12"}`
+
+	stats, err := parseContainerStats(line)
+	if err != nil {
+		t.Fatalf("parseContainerStats failed: %v", err)
+	}
+	if stats.MemoryBytes != 256<<20 {
+		t.Errorf("Expected memory usage %d, got %d", 256<<20, stats.MemoryBytes)
+	}
+	if stats.CPUPercent != 12.5 {
+		t.Errorf("Expected CPU usage 12.5, got %f", stats.CPUPercent)
+	}
+
+	if _, err := parseContainerStats(`{"CPUPerc":"--","MemUsage":"0B / 0B"}`); err == nil {
+		t.Error("Expected error for stats of a stopped container")
+	}
+	if _, err := parseContainerStats("not json"); err == nil {
+		t.Error("Expected error for malformed stats")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0B", 0},
+		{"100B", 100},
+		{"1.5KiB", 1536},
+		{"256MiB", 256 << 20},
+		{"2GiB", 2 << 30},
+		{"512kB", 512000},
+		{"1.2MB", 1200000},
+		{" 3GB ", 3000000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := parseByteSize(tt.input)
+			if err != nil {
+				t.Fatalf("parseByteSize(%q) failed: %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("parseByteSize(%q) = %d, want %d", tt.input, result, tt.expected)
+			}
+		})
+	}
+
+	if _, err := parseByteSize("12 parsecs"); err == nil {
+		t.Error("Expected error for unknown unit")
+	}
+}
+
+func TestStatsSampler(t *testing.T) {
+	sampler := &statsSampler{}
+	if usage := sampler.usage(); usage.Samples != 0 || usage.PeakMemoryBytes != 0 {
+		t.Errorf("Expected empty usage without samples, got %+v", usage)
+	}
+
+	sampler.add(100<<20, 50)
+	sampler.add(300<<20, 150)
+	sampler.add(200<<20, 10)
+
+	usage := sampler.usage()
+	if usage.Samples != 3 {
+		t.Errorf("Expected 3 samples, got %d", usage.Samples)
+	}
+	if usage.PeakMemoryBytes != 300<<20 {
+		t.Errorf("Expected peak memory %d, got %d", 300<<20, usage.PeakMemoryBytes)
+	}
+	if usage.AvgMemoryBytes != 200<<20 {
+		t.Errorf("Expected average memory %d, got %d", 200<<20, usage.AvgMemoryBytes)
+	}
+	if usage.PeakCPUPercent != 150 {
+		t.Errorf("Expected peak CPU 150, got %f", usage.PeakCPUPercent)
+	}
+	if usage.AvgCPUPercent != 70 {
+		t.Errorf("Expected average CPU 70, got %f", usage.AvgCPUPercent)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{512, "512 B"},
+		{1536, "1.5 KiB"},
+		{256 << 20, "256.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		if result := FormatBytes(tt.input); result != tt.expected {
+			t.Errorf("FormatBytes(%d) = %s, want %s", tt.input, result, tt.expected)
+		}
+	}
+}
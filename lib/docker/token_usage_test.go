@@ -2,6 +2,8 @@ package docker
 
 import (
 	"testing"
+
+	"github.com/tomyedwab/laforge/lib/steps"
 )
 
 func TestExtractTokenUsageFromLogs(t *testing.T) {
@@ -225,3 +227,70 @@ TOKEN_USAGE: prompt_tokens=invalid, completion_tokens=abc, total_tokens=xyz, cos
 		})
 	}
 }
+
+func TestExtractTokenUsageFromClaudeResult(t *testing.T) {
+	client := &Client{}
+
+	tests := []struct {
+		name     string
+		logs     string
+		expected steps.TokenUsage
+	}{
+		{
+			name: "result with modelUsage",
+			logs: `{"type":"system","subtype":"init","model":"claude-sonnet-4-5"}
+{"type":"assistant","message":{"content":[{"type":"text","text":"Working"}],"usage":{"input_tokens":3,"output_tokens":5}}}
+{"type":"result","subtype":"success","total_cost_usd":0.1234,"usage":{"input_tokens":10,"cache_creation_input_tokens":200,"cache_read_input_tokens":3000,"output_tokens":400},"modelUsage":{"claude-sonnet-4-5":{"inputTokens":10,"outputTokens":400,"cacheReadInputTokens":3000,"cacheCreationInputTokens":200,"costUSD":0.12},"claude-haiku-4-5":{"inputTokens":50,"outputTokens":20,"cacheReadInputTokens":0,"cacheCreationInputTokens":0,"costUSD":0.0034}}}`,
+			expected: steps.TokenUsage{
+				PromptTokens:     60,
+				CompletionTokens: 420,
+				CacheReadTokens:  3000,
+				CacheWriteTokens: 200,
+				TotalTokens:      3680,
+				Cost:             0.1234,
+			},
+		},
+		{
+			name: "result with usage only",
+			logs: `{"type":"result","subtype":"success","total_cost_usd":0.05,"usage":{"input_tokens":100,"cache_creation_input_tokens":20,"cache_read_input_tokens":30,"output_tokens":50}}`,
+			expected: steps.TokenUsage{
+				PromptTokens:     100,
+				CompletionTokens: 50,
+				CacheReadTokens:  30,
+				CacheWriteTokens: 20,
+				TotalTokens:      200,
+				Cost:             0.05,
+			},
+		},
+		{
+			name: "result takes precedence over earlier token_usage",
+			logs: `{"token_usage": {"prompt_tokens": 1, "completion_tokens": 2, "total_tokens": 3, "cost": 0.001}}
+{"type":"result","subtype":"success","total_cost_usd":0.02,"usage":{"input_tokens":10,"output_tokens":20}}`,
+			expected: steps.TokenUsage{
+				PromptTokens:     10,
+				CompletionTokens: 20,
+				TotalTokens:      30,
+				Cost:             0.02,
+			},
+		},
+		{
+			name: "result without usage is ignored",
+			logs: `{"type":"result","subtype":"error_max_turns"}
+TOKEN_USAGE: prompt_tokens=5, completion_tokens=7`,
+			expected: steps.TokenUsage{
+				PromptTokens:     5,
+				CompletionTokens: 7,
+				TotalTokens:      12,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := client.ExtractTokenUsageFromLogs(tt.logs)
+			if result != tt.expected {
+				t.Errorf("ExtractTokenUsageFromLogs() = %+v, want %+v", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package egress
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Rule allows connections to a host, or to every subdomain of a domain when Host
+// starts with "*.", on one port or on any port when Port is 0
+type Rule struct {
+	Host string
+	Port int
+}
+
+// ParseRule parses an allow list entry of the form "host", "host:port",
+// "*.domain" or "*.domain:port"
+func ParseRule(entry string) (Rule, error) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return Rule{}, fmt.Errorf("egress rule cannot be empty")
+	}
+
+	host, port := entry, 0
+	if h, p, err := net.SplitHostPort(entry); err == nil {
+		value, err := strconv.Atoi(p)
+		if err != nil || value < 1 || value > 65535 {
+			return Rule{}, fmt.Errorf("invalid port in egress rule '%s'", entry)
+		}
+		host, port = h, value
+	} else if strings.Contains(entry, ":") && !strings.HasPrefix(entry, "[") {
+		return Rule{}, fmt.Errorf("invalid egress rule '%s': %w", entry, err)
+	}
+
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	domain := strings.TrimPrefix(host, "*.")
+	if domain == "" || strings.ContainsAny(domain, "*/ ") {
+		return Rule{}, fmt.Errorf("invalid host in egress rule '%s'", entry)
+	}
+
+	return Rule{Host: host, Port: port}, nil
+}
+
+// String returns the rule in the format accepted by ParseRule
+func (r Rule) String() string {
+	if r.Port == 0 {
+		return r.Host
+	}
+	return net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+}
+
+// Matches returns true if the rule allows connecting to host on port
+func (r Rule) Matches(host string, port int) bool {
+	if r.Port != 0 && r.Port != port {
+		return false
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if domain, ok := strings.CutPrefix(r.Host, "*."); ok {
+		return strings.HasSuffix(host, "."+domain)
+	}
+	return host == r.Host
+}
+
+// Policy is a list of allowed destinations. Everything else is blocked.
+type Policy struct {
+	Rules []Rule
+}
+
+// NewPolicy parses an allow list into a policy
+func NewPolicy(allow []string) (*Policy, error) {
+	policy := &Policy{}
+	for _, entry := range allow {
+		rule, err := ParseRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+	return policy, nil
+}
+
+// Allows returns true if any rule allows connecting to host on port
+func (p *Policy) Allows(host string, port int) bool {
+	for _, rule := range p.Rules {
+		if rule.Matches(host, port) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package egress
+
+import "testing"
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    Rule
+		wantErr bool
+	}{
+		{entry: "api.anthropic.com", want: Rule{Host: "api.anthropic.com"}},
+		{entry: "Registry.NPMJS.org:443", want: Rule{Host: "registry.npmjs.org", Port: 443}},
+		{entry: "*.pypi.org", want: Rule{Host: "*.pypi.org"}},
+		{entry: "[::1]:8080", want: Rule{Host: "::1", Port: 8080}},
+		{entry: "", wantErr: true},
+		{entry: "example.com:http", wantErr: true},
+		{entry: "example.com:70000", wantErr: true},
+		{entry: "*", wantErr: true},
+		{entry: "*.", wantErr: true},
+		{entry: "https://example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			rule, err := ParseRule(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRule(%q) error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			}
+			if !tt.wantErr && rule != tt.want {
+				t.Errorf("ParseRule(%q) = %+v, want %+v", tt.entry, rule, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	policy, err := NewPolicy([]string{"api.anthropic.com:443", "*.pypi.org", "host.docker.internal:8080"})
+	if err != nil {
+		t.Fatalf("NewPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		port int
+		want bool
+	}{
+		{"api.anthropic.com", 443, true},
+		{"API.Anthropic.com.", 443, true},
+		{"api.anthropic.com", 80, false},
+		{"files.pypi.org", 443, true},
+		{"files.pypi.org", 80, true},
+		{"pypi.org", 443, false},
+		{"evilpypi.org", 443, false},
+		{"host.docker.internal", 8080, true},
+		{"example.com", 443, false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Allows(tt.host, tt.port); got != tt.want {
+			t.Errorf("Allows(%s, %d) = %v, want %v", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
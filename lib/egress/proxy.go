@@ -0,0 +1,233 @@
+package egress
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types written to the proxy's log
+const (
+	EventListening = "listening"
+	EventAllowed   = "allowed"
+	EventBlocked   = "blocked"
+)
+
+// Event is a single line of the proxy's JSON log
+type Event struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Method string    `json:"method,omitempty"`
+	Host   string    `json:"host,omitempty"`
+	Port   int       `json:"port,omitempty"`
+	Addr   string    `json:"addr,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Destination returns the host and port of the event as "host:port"
+func (e Event) Destination() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// ParseEvents returns the events in a proxy log, skipping any lines that are not events
+func ParseEvents(logs string) []Event {
+	var events []Event
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal([]byte(scanner.Text()), &event); err != nil || event.Event == "" {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// Proxy is an HTTP proxy that only connects to destinations allowed by its policy.
+// HTTPS traffic is tunneled with CONNECT; plain HTTP requests are forwarded.
+// Every decision is logged as a JSON Event line.
+type Proxy struct {
+	Policy *Policy
+
+	// Log receives one JSON Event per line. Nil discards the events.
+	Log io.Writer
+
+	// DialTimeout limits how long connecting to a destination may take
+	DialTimeout time.Duration
+
+	mu        sync.Mutex
+	transport *http.Transport
+}
+
+// LogEvent writes an event to the proxy's log
+func (p *Proxy) LogEvent(event Event) {
+	if p.Log == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Log.Write(append(line, '\n'))
+}
+
+func (p *Proxy) dialTimeout() time.Duration {
+	if p.DialTimeout > 0 {
+		return p.DialTimeout
+	}
+	return 30 * time.Second
+}
+
+func (p *Proxy) getTransport() *http.Transport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.transport == nil {
+		p.transport = &http.Transport{
+			DialContext: (&net.Dialer{Timeout: p.dialTimeout()}).DialContext,
+		}
+	}
+	return p.transport
+}
+
+// ServeHTTP implements http.Handler
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+	p.handleForward(w, r)
+}
+
+// authorize checks the destination against the policy and logs the decision
+func (p *Proxy) authorize(w http.ResponseWriter, method, hostport string, defaultPort int) (string, bool) {
+	host, portText, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, portText = hostport, strconv.Itoa(defaultPort)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || host == "" {
+		http.Error(w, "invalid destination", http.StatusBadRequest)
+		return "", false
+	}
+
+	event := Event{Method: method, Host: host, Port: port}
+	if !p.Policy.Allows(host, port) {
+		event.Event = EventBlocked
+		p.LogEvent(event)
+		http.Error(w, "destination blocked by LaForge egress policy: "+event.Destination(), http.StatusForbidden)
+		return "", false
+	}
+	event.Event = EventAllowed
+	p.LogEvent(event)
+	return event.Destination(), true
+}
+
+// handleConnect tunnels a CONNECT request to an allowed destination
+func (p *Proxy) handleConnect(w http.ResponseWriter, r *http.Request) {
+	destination, ok := p.authorize(w, r.Method, r.Host, 443)
+	if !ok {
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", destination, p.dialTimeout())
+	if err != nil {
+		http.Error(w, "failed to connect to "+destination, http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "connection hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+
+	// Forward anything the client sent after the CONNECT request, then splice
+	// the two connections until either side closes
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, buffered)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	client.Close()
+	upstream.Close()
+}
+
+// closeWrite half-closes a TCP connection so the peer sees EOF
+func closeWrite(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+}
+
+// hopHeaders are removed when forwarding a request, since they apply only to
+// the connection to the proxy
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Proxy-Authorization", "Proxy-Authenticate",
+	"Keep-Alive", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// handleForward forwards a plain HTTP proxy request to an allowed destination
+func (p *Proxy) handleForward(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.IsAbs() || r.URL.Scheme != "http" {
+		http.Error(w, "only absolute http:// URLs and CONNECT are supported", http.StatusBadRequest)
+		return
+	}
+	if _, ok := p.authorize(w, r.Method, r.URL.Host, 80); !ok {
+		return
+	}
+
+	outReq := r.Clone(r.Context())
+	outReq.RequestURI = ""
+	for _, header := range hopHeaders {
+		outReq.Header.Del(header)
+	}
+
+	resp, err := p.getTransport().RoundTrip(outReq)
+	if err != nil {
+		http.Error(w, "failed to reach "+r.URL.Host, http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range hopHeaders {
+		resp.Header.Del(header)
+	}
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,126 @@
+package egress
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newProxyClient returns an HTTP client that sends all requests through the proxy
+func newProxyClient(t *testing.T, policy *Policy) (*http.Client, *bytes.Buffer) {
+	log := &bytes.Buffer{}
+	proxyServer := httptest.NewServer(&Proxy{Policy: policy, Log: log})
+	t.Cleanup(proxyServer.Close)
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}, log
+}
+
+func TestProxyForwardsAllowedRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from " + r.URL.Path))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	policy, _ := NewPolicy([]string{upstreamURL.Host})
+	client, log := newProxyClient(t, policy)
+
+	resp, err := client.Get(upstream.URL + "/tasks")
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "hello from /tasks" {
+		t.Errorf("Unexpected response %d: %s", resp.StatusCode, body)
+	}
+
+	events := ParseEvents(log.String())
+	if len(events) != 1 || events[0].Event != EventAllowed || events[0].Method != "GET" || events[0].Destination() != upstreamURL.Host {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+}
+
+func TestProxyTunnelsAllowedConnect(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	policy, _ := NewPolicy([]string{upstreamURL.Host})
+	client, log := newProxyClient(t, policy)
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "secure" {
+		t.Errorf("Unexpected response body: %s", body)
+	}
+
+	events := ParseEvents(log.String())
+	if len(events) != 1 || events[0].Event != EventAllowed || events[0].Method != http.MethodConnect {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+}
+
+func TestProxyBlocksUnlistedDestinations(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Blocked request reached the upstream server")
+	}))
+	defer upstream.Close()
+	tlsUpstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Blocked request reached the upstream server")
+	}))
+	defer tlsUpstream.Close()
+
+	policy, _ := NewPolicy([]string{"api.anthropic.com"})
+	client, log := newProxyClient(t, policy)
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", resp.StatusCode)
+	}
+
+	if _, err := client.Get(tlsUpstream.URL); err == nil {
+		t.Error("Expected CONNECT to a blocked destination to fail")
+	}
+
+	events := ParseEvents(log.String())
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %+v", events)
+	}
+	for _, event := range events {
+		if event.Event != EventBlocked || !strings.HasPrefix(event.Host, "127.0.0.1") {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	}
+}
+
+func TestParseEventsSkipsOtherLines(t *testing.T) {
+	logs := `{"time":"2025-01-01T00:00:00Z","event":"listening","addr":":3128"}
+panic: something else
+{"time":"2025-01-01T00:00:01Z","event":"blocked","method":"CONNECT","host":"example.com","port":443}
+{"unrelated":true}
+`
+	events := ParseEvents(logs)
+	if len(events) != 2 || events[1].Destination() != "example.com:443" {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+}
@@ -46,6 +46,13 @@ const (
 	ErrInvalidTaskStatus
 	ErrTaskDependencyNotMet
 	ErrTaskReviewRequired
+
+	// Step errors
+	ErrStepInProgress
+	ErrBudgetExceeded
+	ErrAuthenticationFailed
+	ErrStepCancelled
+	ErrStepInterrupted
 )
 
 // LaForgeError represents a LaForge-specific error with additional context
@@ -175,6 +182,16 @@ func ExitCode(err error) int {
 			return 30
 		case ErrTaskDependencyNotMet, ErrTaskReviewRequired:
 			return 40
+		case ErrStepInProgress:
+			return 50
+		case ErrBudgetExceeded:
+			return 51
+		case ErrAuthenticationFailed:
+			return 52
+		case ErrStepCancelled:
+			return 53
+		case ErrStepInterrupted:
+			return 54
 		default:
 			return 1
 		}
@@ -239,6 +256,16 @@ func UserFriendlyMessage(err error) string {
 			return "Task dependencies are not met. Please complete upstream tasks first."
 		case ErrTaskReviewRequired:
 			return "This task requires review before it can be completed."
+		case ErrStepInProgress:
+			return "A step is still running for this project. Wait for it to finish before continuing."
+		case ErrBudgetExceeded:
+			return fmt.Sprintf("The project's spending budget has been reached: %s.", laforgeErr.Message)
+		case ErrAuthenticationFailed:
+			return fmt.Sprintf("Could not log in to laserve: %s.", laforgeErr.Message)
+		case ErrStepCancelled:
+			return "The step was cancelled before the agent finished."
+		case ErrStepInterrupted:
+			return "The step was interrupted before it finished."
 		default:
 			return laforgeErr.Message
 		}
@@ -275,6 +302,16 @@ func Suggestion(err error) string {
 			return "Use 'latasks list' to see task dependencies and their status."
 		case ErrTaskReviewRequired:
 			return "Use 'latasks review' to submit the task for review."
+		case ErrStepInProgress:
+			return "Use 'laforge steps <project-id>' to see which steps are still running."
+		case ErrBudgetExceeded:
+			return "Use 'laforge cost <project-id>' to review spending and 'laforge budget <project-id>' to raise the limit. Daily budgets reset at midnight."
+		case ErrAuthenticationFailed:
+			return "Set LAFORGE_API_KEY, or LAFORGE_USERNAME and LAFORGE_PASSWORD, or add them to ~/.laforge/credentials.yml. Accounts are created with 'laserve user add <username>' and keys with 'laserve apikey create'."
+		case ErrStepCancelled:
+			return "The step branch was kept without merging. Use 'laforge step info <project-id> <step-id>' to inspect the step."
+		case ErrStepInterrupted:
+			return "Any changes the agent committed were kept on the step branch without merging. Run 'laforge step' again to continue."
 		default:
 			if laforgeErr.Cause != nil {
 				return fmt.Sprintf("Underlying error: %v", laforgeErr.Cause)
@@ -340,3 +377,34 @@ func NewGitMergeConflictError(cause error, sourceBranch, targetBranch string) *L
 		WithContext("source_branch", sourceBranch).
 		WithContext("target_branch", targetBranch)
 }
+
+// NewStepInProgressError creates an error for operations blocked by a running step
+func NewStepInProgressError(stepID int) *LaForgeError {
+	return Newf(ErrStepInProgress, "Step S%d is still running", stepID).
+		WithContext("step_id", stepID)
+}
+
+// NewStepInterruptedError creates an error for a step that was interrupted by a signal
+func NewStepInterruptedError(stepID int, cause error) *LaForgeError {
+	return Wrapf(ErrStepInterrupted, cause, "Step S%d was interrupted", stepID).
+		WithContext("step_id", stepID)
+}
+
+// NewBudgetExceededError creates an error for a step blocked by a project spending budget
+func NewBudgetExceededError(budget string, spent, limit float64) *LaForgeError {
+	return Newf(ErrBudgetExceeded, "%s budget of $%.2f exhausted ($%.2f spent)", budget, limit, spent).
+		WithContext("budget", budget).
+		WithContext("spent", spent).
+		WithContext("limit", limit)
+}
+
+// NewAuthenticationFailedError creates an error for a failed login to laserve
+func NewAuthenticationFailedError(cause error) *LaForgeError {
+	return New(ErrAuthenticationFailed, cause.Error())
+}
+
+// NewStepCancelledError creates an error for a step that was cancelled while it ran
+func NewStepCancelledError(stepID int) *LaForgeError {
+	return Newf(ErrStepCancelled, "Step S%d was cancelled", stepID).
+		WithContext("step_id", stepID)
+}
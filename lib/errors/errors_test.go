@@ -148,6 +148,11 @@ func TestExitCode(t *testing.T) {
 		{New(ErrDatabaseConnectionFailed, "db connection failed"), 20},
 		{New(ErrDockerNotAvailable, "docker not available"), 30},
 		{New(ErrTaskDependencyNotMet, "dependency not met"), 40},
+		{New(ErrStepInProgress, "step running"), 50},
+		{New(ErrBudgetExceeded, "budget exceeded"), 51},
+		{New(ErrAuthenticationFailed, "invalid credentials"), 52},
+		{New(ErrStepCancelled, "step cancelled"), 53},
+		{New(ErrStepInterrupted, "step interrupted"), 54},
 		{New(ErrUnknown, "unknown error"), 1},
 		{errors.New("regular error"), 1},
 	}
@@ -172,6 +177,8 @@ func TestUserFriendlyMessage(t *testing.T) {
 		{New(ErrProjectNotFound, "project not found"), "Project not found. Please check the project ID and try again."},
 		{New(ErrDockerNotAvailable, "docker not available"), "Docker is not available. Please install Docker and try again."},
 		{New(ErrTaskDependencyNotMet, "dependency not met"), "Task dependencies are not met. Please complete upstream tasks first."},
+		{NewBudgetExceededError("daily", 10.5, 10), "The project's spending budget has been reached: daily budget of $10.00 exhausted ($10.50 spent)."},
+		{NewAuthenticationFailedError(fmt.Errorf("invalid credentials")), "Could not log in to laserve: invalid credentials."},
 		{errors.New("regular error"), "regular error"},
 	}
 
@@ -0,0 +1,100 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Forge types that projects can select for their pull requests
+const (
+	// TypeGitHub is the GitHub REST API
+	TypeGitHub = "github"
+	// TypeGitea is the Gitea REST API, which Forgejo also implements
+	TypeGitea = "gitea"
+)
+
+// Config selects and configures the forge that pull requests are opened on
+type Config struct {
+	// Type is the name the forge is registered under
+	Type string
+
+	// APIURL is the base URL of the forge's REST API, such as
+	// https://gitea.example.com/api/v1
+	APIURL string
+
+	// Repository is the repository pull requests are opened in, as owner/name
+	Repository string
+
+	// Token authenticates with the forge's API
+	Token string
+}
+
+// PullRequest describes a pull request to open
+type PullRequest struct {
+	Title string
+	Body  string
+
+	// Head is the branch with the changes, which must already be pushed
+	Head string
+
+	// Base is the branch the changes are to be merged into
+	Base string
+}
+
+// PullRequestInfo identifies a pull request that was opened
+type PullRequestInfo struct {
+	Number int
+	URL    string
+}
+
+// Forge opens pull requests on a code hosting service
+type Forge interface {
+	CreatePullRequest(ctx context.Context, pr PullRequest) (*PullRequestInfo, error)
+}
+
+// Factory creates a forge from its configuration
+type Factory func(config Config) (Forge, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+func init() {
+	Register(TypeGitHub, newRESTFactory("https://api.github.com"))
+	Register(TypeGitea, newRESTFactory(""))
+}
+
+// Register makes a forge available to projects under the given name,
+// replacing any forge registered with that name
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// New creates the forge selected by config.Type
+func New(config Config) (Forge, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[config.Type]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown forge '%s', must be one of: %s", config.Type, strings.Join(Names(), ", "))
+	}
+	return factory(config)
+}
+
+// Names returns the names of all registered forges, sorted
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,70 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New(Config{Type: TypeGitHub, Repository: "owner/repo"}); err != nil {
+		t.Errorf("Expected GitHub to default its API URL, got %v", err)
+	}
+	if _, err := New(Config{Type: TypeGitea, Repository: "owner/repo"}); err == nil {
+		t.Error("Expected an error for Gitea without an API URL")
+	}
+	if _, err := New(Config{Type: TypeGitea, APIURL: "http://localhost", Repository: "repo"}); err == nil {
+		t.Error("Expected an error for a repository without an owner")
+	}
+
+	_, err := New(Config{Type: "bitbucket"})
+	if err == nil || !strings.Contains(err.Error(), "gitea, github") {
+		t.Errorf("Expected an error listing the forges, got %v", err)
+	}
+}
+
+func TestCreatePullRequest(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/repos/owner/repo/pulls" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "token secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"bad credentials"}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"number":12,"html_url":"https://git.example.com/owner/repo/pulls/12"}`))
+	}))
+	defer server.Close()
+
+	f, err := New(Config{Type: TypeGitea, APIURL: server.URL + "/api/v1/", Repository: "owner/repo", Token: "secret-token"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	info, err := f.CreatePullRequest(context.Background(), PullRequest{Title: "Add feature", Body: "Details", Head: "step-S3", Base: "main"})
+	if err != nil {
+		t.Fatalf("CreatePullRequest() error = %v", err)
+	}
+	if info.Number != 12 || info.URL != "https://git.example.com/owner/repo/pulls/12" {
+		t.Errorf("Unexpected pull request %+v", info)
+	}
+	expected := map[string]string{"title": "Add feature", "body": "Details", "head": "step-S3", "base": "main"}
+	for key, value := range expected {
+		if received[key] != value {
+			t.Errorf("Expected %s %q in the request, got %q", key, value, received[key])
+		}
+	}
+
+	f, _ = New(Config{Type: TypeGitea, APIURL: server.URL + "/api/v1", Repository: "owner/repo", Token: "wrong"})
+	_, err = f.CreatePullRequest(context.Background(), PullRequest{Head: "step-S3", Base: "main"})
+	if err == nil || !strings.Contains(err.Error(), "bad credentials") {
+		t.Errorf("Expected the API error message, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// restForge opens pull requests through the `POST /repos/{owner}/{repo}/pulls`
+// endpoint, which GitHub and Gitea implement with the same request and response
+type restForge struct {
+	client     *http.Client
+	apiURL     string
+	repository string
+	token      string
+}
+
+// newRESTFactory returns a factory for REST forges, using defaultAPIURL when the
+// configuration does not set an API URL
+func newRESTFactory(defaultAPIURL string) Factory {
+	return func(config Config) (Forge, error) {
+		apiURL := config.APIURL
+		if apiURL == "" {
+			apiURL = defaultAPIURL
+		}
+		if apiURL == "" {
+			return nil, fmt.Errorf("forge '%s' requires an API URL", config.Type)
+		}
+		if owner, name, ok := strings.Cut(config.Repository, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid repository '%s', must be owner/name", config.Repository)
+		}
+		return &restForge{
+			client:     &http.Client{Timeout: 30 * time.Second},
+			apiURL:     strings.TrimSuffix(apiURL, "/"),
+			repository: config.Repository,
+			token:      config.Token,
+		}, nil
+	}
+}
+
+// restPullRequest is the pull request object returned by the API
+type restPullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+func (f *restForge) CreatePullRequest(ctx context.Context, pr PullRequest) (*PullRequestInfo, error) {
+	body, err := json.Marshal(map[string]string{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"head":  pr.Head,
+		"base":  pr.Base,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode pull request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/pulls", f.apiURL, f.repository)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if f.token != "" {
+		// Both GitHub and Gitea accept tokens in this form
+		req.Header.Set("Authorization", "token "+f.token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to open pull request: %s", errorMessage(resp.Status, respBody))
+	}
+
+	var created restPullRequest
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if created.HTMLURL == "" {
+		return nil, fmt.Errorf("response did not include the pull request URL")
+	}
+	return &PullRequestInfo{Number: created.Number, URL: created.HTMLURL}, nil
+}
+
+// errorMessage returns the message of an API error response, falling back to
+// the response status
+func errorMessage(status string, body []byte) string {
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Message != "" {
+		return fmt.Sprintf("%s: %s", status, apiErr.Message)
+	}
+	return status
+}
@@ -1,13 +1,17 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/steps"
 )
 
 // Worktree represents a git worktree
@@ -17,8 +21,9 @@ type Worktree struct {
 	OriginalDir string
 }
 
-// CreateWorktree creates a temporary git worktree for the given project
-func CreateWorktree(projectDir string, worktreeDir string, branchName string) (*Worktree, error) {
+// CreateWorktree creates a temporary git worktree for the given project. The
+// checkout is aborted if ctx is done before it finishes.
+func CreateWorktree(ctx context.Context, projectDir string, worktreeDir string, branchName string) (*Worktree, error) {
 	// Check if git is available
 	if err := exec.Command("git", "--version").Run(); err != nil {
 		return nil, fmt.Errorf("git is not available: %w", err)
@@ -35,7 +40,7 @@ func CreateWorktree(projectDir string, worktreeDir string, branchName string) (*
 	}
 
 	// Create the worktree
-	cmd := exec.Command("git", "worktree", "add", "-b", branchName, worktreeDir)
+	cmd := exec.CommandContext(ctx, "git", "worktree", "add", "-b", branchName, worktreeDir)
 	cmd.Dir = projectDir
 	if output, err := cmd.CombinedOutput(); err != nil {
 		// Clean up on error
@@ -90,7 +95,7 @@ func GetWorktrees(repoDir string) ([]*Worktree, error) {
 }
 
 // CreateTempWorktree creates a temporary worktree in the system's temp directory
-func CreateTempWorktree(projectDir string, branchPrefix string) (*Worktree, error) {
+func CreateTempWorktree(ctx context.Context, projectDir string, branchPrefix string) (*Worktree, error) {
 	// Generate a unique branch name
 	branchName := fmt.Sprintf("%s-%d", branchPrefix, os.Getpid())
 
@@ -100,7 +105,7 @@ func CreateTempWorktree(projectDir string, branchPrefix string) (*Worktree, erro
 		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
 	}
 
-	worktree, err := CreateWorktree(projectDir, tempDir, branchName)
+	worktree, err := CreateWorktree(ctx, projectDir, tempDir, branchName)
 	if err != nil {
 		// Clean up temp directory on error
 		os.RemoveAll(tempDir)
@@ -111,7 +116,7 @@ func CreateTempWorktree(projectDir string, branchPrefix string) (*Worktree, erro
 }
 
 // CreateTempWorktreeWithStep creates a temporary worktree with a step-based branch name
-func CreateTempWorktreeWithStep(projectDir string, stepNumber int) (*Worktree, error) {
+func CreateTempWorktreeWithStep(ctx context.Context, projectDir string, stepNumber int) (*Worktree, error) {
 	// Generate a branch name based on step number
 	branchName := fmt.Sprintf("step-S%d", stepNumber)
 
@@ -121,7 +126,7 @@ func CreateTempWorktreeWithStep(projectDir string, stepNumber int) (*Worktree, e
 		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
 	}
 
-	worktree, err := CreateWorktree(projectDir, tempDir, branchName)
+	worktree, err := CreateWorktree(ctx, projectDir, tempDir, branchName)
 	if err != nil {
 		// Clean up temp directory on error
 		os.RemoveAll(tempDir)
@@ -172,6 +177,18 @@ func GetCurrentCommitSHA(repoDir string) (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
+// HasUncommittedChanges checks if the working tree has staged, unstaged or untracked changes
+func HasUncommittedChanges(repoDir string) (bool, error) {
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = repoDir
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to check git status: %w", err)
+	}
+
+	return len(strings.TrimSpace(string(output))) > 0, nil
+}
+
 // parseWorktreeList parses the output of 'git worktree list --porcelain'
 func parseWorktreeList(output string, repoDir string) []*Worktree {
 	var worktrees []*Worktree
@@ -260,28 +277,91 @@ func ResetToCommit(repoDir string, commitSHA string) error {
 	return nil
 }
 
-// MergeBranch merges source branch into target branch
-func MergeBranch(repoDir string, sourceBranch string, targetBranch string, message string) error {
+// MergeStrategy is how a step branch is merged into the main branch
+type MergeStrategy string
+
+const (
+	// MergeStrategyMerge merges the branch with `git merge`, fast-forwarding when possible
+	MergeStrategyMerge MergeStrategy = "merge"
+	// MergeStrategySquash squashes the branch into a single commit on the target
+	MergeStrategySquash MergeStrategy = "squash"
+	// MergeStrategyRebase replays the branch's commits onto the target and fast-forwards it
+	MergeStrategyRebase MergeStrategy = "rebase"
+	// MergeStrategyFFOnly only fast-forwards the target, failing if the branches have diverged
+	MergeStrategyFFOnly MergeStrategy = "ff-only"
+	// MergeStrategyNone leaves the branch unmerged for a human to review
+	MergeStrategyNone MergeStrategy = "none"
+
+	// DefaultMergeStrategy is used by projects without a merge strategy
+	DefaultMergeStrategy = MergeStrategyMerge
+)
+
+// MergeStrategies lists all merge strategies
+var MergeStrategies = []MergeStrategy{MergeStrategyMerge, MergeStrategySquash, MergeStrategyRebase, MergeStrategyFFOnly, MergeStrategyNone}
+
+// ParseMergeStrategy validates a merge strategy name. An empty name selects
+// DefaultMergeStrategy.
+func ParseMergeStrategy(name string) (MergeStrategy, error) {
+	if name == "" {
+		return DefaultMergeStrategy, nil
+	}
+	for _, strategy := range MergeStrategies {
+		if MergeStrategy(name) == strategy {
+			return strategy, nil
+		}
+	}
+	names := make([]string, len(MergeStrategies))
+	for i, strategy := range MergeStrategies {
+		names[i] = string(strategy)
+	}
+	return "", fmt.Errorf("invalid merge strategy '%s', must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// MergeBranch merges source branch into target branch. It returns ctx's error
+// without merging if ctx is done before the merge starts; a merge that has
+// started is never interrupted, so the repository is not left mid-merge.
+func MergeBranch(ctx context.Context, repoDir string, sourceBranch string, targetBranch string, message string) error {
+	_, err := MergeBranchWithStrategy(ctx, repoDir, sourceBranch, targetBranch, message, MergeStrategyMerge)
+	return err
+}
+
+// MergeBranchWithStrategy merges source branch into target branch with the
+// given strategy and returns the commit SHA the target branch points to
+// afterwards. The message is used for merge and squash commits. The
+// MergeStrategyNone strategy leaves both branches alone and returns an empty SHA.
+//
+// If the branches cannot be merged cleanly, the merge is aborted so the
+// repository is left as it was, and an ErrGitMergeConflict error is returned.
+// As with MergeBranch, a merge that has started is never interrupted by ctx.
+func MergeBranchWithStrategy(ctx context.Context, repoDir string, sourceBranch string, targetBranch string, message string, strategy MergeStrategy) (string, error) {
+	if strategy == MergeStrategyNone {
+		return "", nil
+	}
+
 	// Check if git is available
 	if err := exec.Command("git", "--version").Run(); err != nil {
-		return fmt.Errorf("git is not available: %w", err)
+		return "", fmt.Errorf("git is not available: %w", err)
 	}
 
 	// Verify the repository directory is a git repository
 	if !IsGitRepository(repoDir) {
-		return fmt.Errorf("directory is not a git repository: %s", repoDir)
+		return "", fmt.Errorf("directory is not a git repository: %s", repoDir)
 	}
 
 	// Get current branch to restore later
 	originalBranch, err := GetCurrentBranch(repoDir)
 	if err != nil {
-		return fmt.Errorf("failed to get current branch: %w", err)
+		return "", fmt.Errorf("failed to get current branch: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
 
 	// Switch to target branch if not already on it
 	if originalBranch != targetBranch {
 		if err := SwitchBranch(repoDir, targetBranch); err != nil {
-			return fmt.Errorf("failed to switch to target branch %s: %w", targetBranch, err)
+			return "", fmt.Errorf("failed to switch to target branch %s: %w", targetBranch, err)
 		}
 		defer func() {
 			// Restore original branch
@@ -289,20 +369,130 @@ func MergeBranch(repoDir string, sourceBranch string, targetBranch string, messa
 		}()
 	}
 
-	// Perform the merge
-	cmd := exec.Command("git", "merge", sourceBranch, "-m", message)
+	switch strategy {
+	case MergeStrategyMerge:
+		err = mergeCommit(repoDir, sourceBranch, targetBranch, message)
+	case MergeStrategySquash:
+		err = mergeSquash(repoDir, sourceBranch, targetBranch, message)
+	case MergeStrategyRebase:
+		err = mergeRebase(repoDir, sourceBranch, targetBranch)
+	case MergeStrategyFFOnly:
+		err = mergeFastForward(repoDir, sourceBranch, targetBranch)
+	default:
+		err = fmt.Errorf("unknown merge strategy '%s'", strategy)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return GetCurrentCommitSHA(repoDir)
+}
+
+// runGit runs a git command in repoDir and returns its combined output
+func runGit(repoDir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
 	cmd.Dir = repoDir
-	if output, err := cmd.CombinedOutput(); err != nil {
-		// Check if it's a merge conflict
-		if strings.Contains(string(output), "CONFLICT") {
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// mergeConflict aborts a failed merge or squash if it stopped on conflicts and
+// returns the ErrGitMergeConflict error for it, or returns nil if the failure
+// was not a conflict
+func mergeConflict(repoDir string, output string, cause error, sourceBranch string, targetBranch string) error {
+	if !strings.Contains(output, "CONFLICT") {
+		return nil
+	}
+	// reset --merge also cleans up after a squash, which leaves no MERGE_HEAD to abort
+	_, _ = runGit(repoDir, "reset", "--merge")
+	return errors.NewGitMergeConflictError(
+		fmt.Errorf("merge conflict detected: %w\nOutput: %s", cause, output),
+		sourceBranch, targetBranch,
+	)
+}
+
+// mergeCommit merges the source branch into the checked out target branch
+func mergeCommit(repoDir string, sourceBranch string, targetBranch string, message string) error {
+	if output, err := runGit(repoDir, "merge", sourceBranch, "-m", message); err != nil {
+		if conflictErr := mergeConflict(repoDir, output, err, sourceBranch, targetBranch); conflictErr != nil {
+			return conflictErr
+		}
+		return fmt.Errorf("failed to merge %s into %s: %w\nOutput: %s", sourceBranch, targetBranch, err, output)
+	}
+	return nil
+}
+
+// mergeSquash squashes the source branch into a single commit on the checked
+// out target branch. Nothing is committed if the source branch has no changes
+// that are not already on the target.
+func mergeSquash(repoDir string, sourceBranch string, targetBranch string, message string) error {
+	if output, err := runGit(repoDir, "merge", "--squash", sourceBranch); err != nil {
+		if conflictErr := mergeConflict(repoDir, output, err, sourceBranch, targetBranch); conflictErr != nil {
+			return conflictErr
+		}
+		return fmt.Errorf("failed to squash %s into %s: %w\nOutput: %s", sourceBranch, targetBranch, err, output)
+	}
+
+	if _, err := runGit(repoDir, "diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	if output, err := runGit(repoDir, "commit", "-m", message); err != nil {
+		_, _ = runGit(repoDir, "reset", "--merge")
+		return fmt.Errorf("failed to commit squashed %s: %w\nOutput: %s", sourceBranch, err, output)
+	}
+	return nil
+}
+
+// mergeRebase replays the source branch's commits onto the checked out target
+// branch and fast-forwards the target to them, carrying their git notes over to
+// the rebased commits. The commits are rebased on a detached HEAD, so the source
+// branch itself is left as it was and may stay checked out in a worktree.
+func mergeRebase(repoDir string, sourceBranch string, targetBranch string) error {
+	if output, err := runGit(repoDir, "checkout", "--detach", sourceBranch); err != nil {
+		return fmt.Errorf("failed to check out %s: %w\nOutput: %s", sourceBranch, err, output)
+	}
+	defer func() {
+		// Return to the target branch, which the caller restores from
+		_ = SwitchBranch(repoDir, targetBranch)
+	}()
+
+	if output, err := runGit(repoDir, "-c", "notes.rewriteRef=refs/notes/commits", "rebase", targetBranch); err != nil {
+		_, _ = runGit(repoDir, "rebase", "--abort")
+		if strings.Contains(output, "CONFLICT") || strings.Contains(output, "could not apply") {
 			return errors.NewGitMergeConflictError(
-				fmt.Errorf("merge conflict detected: %w\nOutput: %s", err, string(output)),
+				fmt.Errorf("rebase conflict detected: %w\nOutput: %s", err, output),
 				sourceBranch, targetBranch,
 			)
 		}
-		return fmt.Errorf("failed to merge %s into %s: %w\nOutput: %s", sourceBranch, targetBranch, err, string(output))
+		return fmt.Errorf("failed to rebase %s onto %s: %w\nOutput: %s", sourceBranch, targetBranch, err, output)
+	}
+
+	rebased, err := GetCurrentCommitSHA(repoDir)
+	if err != nil {
+		return err
 	}
+	if err := SwitchBranch(repoDir, targetBranch); err != nil {
+		return err
+	}
+	if output, err := runGit(repoDir, "merge", "--ff-only", rebased); err != nil {
+		return fmt.Errorf("failed to fast-forward %s to rebased %s: %w\nOutput: %s", targetBranch, sourceBranch, err, output)
+	}
+	return nil
+}
 
+// mergeFastForward fast-forwards the checked out target branch to the source
+// branch. Diverged branches are reported as a merge conflict, since they need
+// the same manual resolution.
+func mergeFastForward(repoDir string, sourceBranch string, targetBranch string) error {
+	if output, err := runGit(repoDir, "merge", "--ff-only", sourceBranch); err != nil {
+		if _, ancestorErr := runGit(repoDir, "merge-base", "--is-ancestor", targetBranch, sourceBranch); ancestorErr != nil {
+			return errors.NewGitMergeConflictError(
+				fmt.Errorf("cannot fast-forward, %s and %s have diverged: %w\nOutput: %s", sourceBranch, targetBranch, err, output),
+				sourceBranch, targetBranch,
+			)
+		}
+		return fmt.Errorf("failed to fast-forward %s to %s: %w\nOutput: %s", targetBranch, sourceBranch, err, output)
+	}
 	return nil
 }
 
@@ -346,6 +536,114 @@ func DeleteBranch(repoDir string, branchName string) error {
 	return nil
 }
 
+// PushBranch pushes a local branch to the branch of the same name on a remote.
+// The remote is either the name of a configured remote or a repository URL.
+func PushBranch(ctx context.Context, repoDir string, remote string, branchName string) error {
+	// Verify the repository directory is a git repository
+	if !IsGitRepository(repoDir) {
+		return fmt.Errorf("directory is not a git repository: %s", repoDir)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "push", remote, fmt.Sprintf("refs/heads/%s:refs/heads/%s", branchName, branchName))
+	cmd.Dir = repoDir
+	// Never stop to prompt for credentials, which must come from a credential helper
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to push branch %s to %s: %w\nOutput: %s", branchName, remote, err, string(output))
+	}
+
+	return nil
+}
+
+// StartMerge merges the source branch into the branch checked out in repoDir
+// without committing, leaving the merge in progress so its conflicts can be
+// resolved, and returns the files with conflicts. Committing the worktree
+// concludes the merge.
+func StartMerge(ctx context.Context, repoDir string, sourceBranch string) ([]string, error) {
+	// Verify the repository directory is a git repository
+	if !IsGitRepository(repoDir) {
+		return nil, fmt.Errorf("directory is not a git repository: %s", repoDir)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "merge", "--no-ff", "--no-commit", sourceBranch)
+	cmd.Dir = repoDir
+	output, err := cmd.CombinedOutput()
+	if err != nil && !strings.Contains(string(output), "CONFLICT") {
+		return nil, fmt.Errorf("failed to merge %s: %w\nOutput: %s", sourceBranch, err, string(output))
+	}
+
+	conflicts, err := runGit(repoDir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conflicted files: %w\nOutput: %s", err, conflicts)
+	}
+	return strings.Fields(conflicts), nil
+}
+
+// RebaseWorktree replays the commits of the branch checked out in worktreeDir
+// onto ontoBranch, carrying their git notes over to the rebased commits. If the
+// commits do not apply cleanly, the rebase is aborted so the branch is left as
+// it was, and an ErrGitMergeConflict error is returned.
+func RebaseWorktree(ctx context.Context, worktreeDir string, ontoBranch string) error {
+	// Verify the worktree directory is a git repository
+	if !IsGitRepository(worktreeDir) {
+		return fmt.Errorf("directory is not a git repository: %s", worktreeDir)
+	}
+
+	branch, err := GetCurrentBranch(worktreeDir)
+	if err != nil {
+		return fmt.Errorf("failed to get current branch: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-c", "notes.rewriteRef=refs/notes/commits", "rebase", ontoBranch)
+	cmd.Dir = worktreeDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		_, _ = runGit(worktreeDir, "rebase", "--abort")
+		if strings.Contains(string(output), "CONFLICT") || strings.Contains(string(output), "could not apply") {
+			return errors.NewGitMergeConflictError(
+				fmt.Errorf("rebase conflict detected: %w\nOutput: %s", err, string(output)),
+				branch, ontoBranch,
+			)
+		}
+		return fmt.Errorf("failed to rebase %s onto %s: %w\nOutput: %s", branch, ontoBranch, err, string(output))
+	}
+	return nil
+}
+
+// FindConflictMarkers returns the files, relative to repoDir, that still contain
+// a line starting with a merge conflict marker (<<<<<<<, ||||||| or >>>>>>>).
+// Files that no longer exist have no markers.
+func FindConflictMarkers(repoDir string, files []string) ([]string, error) {
+	var marked []string
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(repoDir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if isConflictMarker(line) {
+				marked = append(marked, file)
+				break
+			}
+		}
+	}
+	return marked, nil
+}
+
+// isConflictMarker reports whether a line opens, splits or closes a conflict
+// hunk. The ======= separator is not checked on its own, since it is also a
+// Markdown heading underline.
+func isConflictMarker(line string) bool {
+	for _, marker := range []string{"<<<<<<<", "|||||||", ">>>>>>>"} {
+		if rest, ok := strings.CutPrefix(line, marker); ok && (rest == "" || rest[0] == ' ') {
+			return true
+		}
+	}
+	return false
+}
+
 // GetCurrentBranch returns the currently checked out branch
 func GetCurrentBranch(repoDir string) (string, error) {
 	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
@@ -380,3 +678,328 @@ func BranchExists(repoDir string, branchName string) (bool, error) {
 
 	return len(strings.TrimSpace(string(output))) > 0, nil
 }
+
+// diffStatuses maps the status letters of `git diff --name-status` to the
+// statuses recorded in FileDiffStats
+var diffStatuses = map[byte]string{
+	'A': "added",
+	'M': "modified",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+	'T': "type-changed",
+}
+
+// GetDiffStats summarizes the changes between two commits: the files changed
+// with their status, and the lines inserted and deleted. Renames are detected.
+func GetDiffStats(repoDir string, fromSHA string, toSHA string) (*steps.DiffStats, error) {
+	// Verify the directory is a git repository
+	if !IsGitRepository(repoDir) {
+		return nil, fmt.Errorf("directory is not a git repository: %s", repoDir)
+	}
+
+	cmd := exec.Command("git", "diff", "--no-ext-diff", "-z", "-M", "--name-status", fromSHA, toSHA, "--")
+	cmd.Dir = repoDir
+	nameStatus, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s..%s: %w", fromSHA, toSHA, err)
+	}
+
+	cmd = exec.Command("git", "diff", "--no-ext-diff", "-z", "-M", "--numstat", fromSHA, toSHA, "--")
+	cmd.Dir = repoDir
+	numstat, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s..%s: %w", fromSHA, toSHA, err)
+	}
+
+	files, err := parseNameStatus(string(nameStatus))
+	if err != nil {
+		return nil, err
+	}
+	if err := applyNumstat(files, string(numstat)); err != nil {
+		return nil, err
+	}
+
+	stats := &steps.DiffStats{FilesChanged: len(files), Files: files}
+	for _, file := range files {
+		stats.Insertions += file.Insertions
+		stats.Deletions += file.Deletions
+	}
+	return stats, nil
+}
+
+// parseNameStatus parses the output of `git diff -z --name-status`. Each entry
+// is a status followed by the path, or by the old and new paths for renames
+// and copies.
+func parseNameStatus(output string) ([]steps.FileDiffStats, error) {
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+	if output == "" {
+		fields = nil
+	}
+
+	var files []steps.FileDiffStats
+	for i := 0; i < len(fields); i++ {
+		code := fields[i]
+		if code == "" {
+			return nil, fmt.Errorf("unexpected empty status in diff output")
+		}
+		status, ok := diffStatuses[code[0]]
+		if !ok {
+			status = "modified"
+		}
+
+		file := steps.FileDiffStats{Status: status}
+		if code[0] == 'R' || code[0] == 'C' {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("truncated diff output for status %s", code)
+			}
+			file.OldPath = fields[i+1]
+			file.Path = fields[i+2]
+			i += 2
+		} else {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("truncated diff output for status %s", code)
+			}
+			file.Path = fields[i+1]
+			i++
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// applyNumstat fills in the line counts of files from the output of
+// `git diff -z --numstat`, which lists the same files in the same order.
+// Binary files are shown with "-" counts. Renames and copies have an empty
+// path followed by the old and new paths.
+func applyNumstat(files []steps.FileDiffStats, output string) error {
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+	if output == "" {
+		fields = nil
+	}
+
+	index := 0
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("unexpected numstat line %q", fields[i])
+		}
+		if parts[2] == "" {
+			// Renamed or copied: skip the old and new paths
+			i += 2
+		}
+		if index >= len(files) {
+			return fmt.Errorf("numstat lists more files than name-status")
+		}
+
+		file := &files[index]
+		index++
+		if parts[0] == "-" && parts[1] == "-" {
+			file.Binary = true
+			continue
+		}
+		insertions, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid insertion count %q: %w", parts[0], err)
+		}
+		deletions, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid deletion count %q: %w", parts[1], err)
+		}
+		file.Insertions = insertions
+		file.Deletions = deletions
+	}
+	return nil
+}
+
+// GetDiff returns the unified diff between two commits, limited to the given
+// paths if any are passed
+func GetDiff(repoDir string, fromSHA string, toSHA string, paths ...string) (string, error) {
+	// Verify the directory is a git repository
+	if !IsGitRepository(repoDir) {
+		return "", fmt.Errorf("directory is not a git repository: %s", repoDir)
+	}
+
+	args := append([]string{"diff", "--no-ext-diff", "--no-color", "-M", fromSHA, toSHA, "--"}, paths...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoDir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s..%s: %w", fromSHA, toSHA, err)
+	}
+
+	return string(output), nil
+}
+
+// StepCommitRef returns the ref that keeps the commit a step made reachable once
+// its branch is merged and deleted, so the step's diff can still be shown after
+// a squash or rebase merge and garbage collection
+func StepCommitRef(stepID int) string {
+	return fmt.Sprintf("refs/laforge/steps/S%d/commit", stepID)
+}
+
+// StepBaseRef returns the ref to the commit a step's commit was made on top of.
+// It differs from the commit the step started from if the step was rebased
+// before it merged.
+func StepBaseRef(stepID int) string {
+	return fmt.Sprintf("refs/laforge/steps/S%d/base", stepID)
+}
+
+// KeepStepCommit points a step's refs at its commit and the commit it was made
+// on top of, replacing any earlier ones
+func KeepStepCommit(repoDir string, stepID int, baseSHA string, commitSHA string) error {
+	// Verify the directory is a git repository
+	if !IsGitRepository(repoDir) {
+		return fmt.Errorf("directory is not a git repository: %s", repoDir)
+	}
+
+	for ref, sha := range map[string]string{StepBaseRef(stepID): baseSHA, StepCommitRef(stepID): commitSHA} {
+		if output, err := runGit(repoDir, "update-ref", ref, sha); err != nil {
+			return fmt.Errorf("failed to update %s: %w\nOutput: %s", ref, err, output)
+		}
+	}
+	return nil
+}
+
+// CommitInfo describes a commit and the git note attached to it
+type CommitInfo struct {
+	SHA     string
+	Subject string
+	// Note is the commit's note in refs/notes/commits, empty if it has none
+	Note string
+}
+
+// How a commit was linked to the step that made it
+const (
+	StepSourceNote         = "note"
+	StepSourceMergeMessage = "merge_message"
+)
+
+var (
+	stepNotePattern         = regexp.MustCompile(`(?m)^Step-id: S(\d+)\s*$`)
+	stepMergeMessagePattern = regexp.MustCompile(`^Automerge step-S(\d+)\b`)
+)
+
+// StepID returns the ID of the LaForge step that made the commit, read from the
+// "Step-id: S<N>" note written on step commits or, for the merge commits of the
+// merge strategy, from the "Automerge step-S<N>" message. The source it was
+// found in is returned too; a commit made outside a step has ID 0.
+func (c *CommitInfo) StepID() (int, string) {
+	if match := stepNotePattern.FindStringSubmatch(c.Note); match != nil {
+		if id, err := strconv.Atoi(match[1]); err == nil {
+			return id, StepSourceNote
+		}
+	}
+	if match := stepMergeMessagePattern.FindStringSubmatch(c.Subject); match != nil {
+		if id, err := strconv.Atoi(match[1]); err == nil {
+			return id, StepSourceMergeMessage
+		}
+	}
+	return 0, ""
+}
+
+// GetCommitInfo resolves a commit, which may be any revision git understands,
+// and returns its full SHA, subject and note
+func GetCommitInfo(repoDir string, commit string) (*CommitInfo, error) {
+	// Verify the directory is a git repository
+	if !IsGitRepository(repoDir) {
+		return nil, fmt.Errorf("directory is not a git repository: %s", repoDir)
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", commit+"^{commit}")
+	cmd.Dir = repoDir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.NewNotFoundError("commit", commit)
+	}
+	sha := strings.TrimSpace(string(output))
+
+	cmd = exec.Command("git", "show", "-s", "--format=%s%x00%N", sha)
+	cmd.Dir = repoDir
+	output, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", sha, err)
+	}
+
+	subject, note, _ := strings.Cut(string(output), "\x00")
+	return &CommitInfo{
+		SHA:     sha,
+		Subject: subject,
+		Note:    strings.TrimSpace(note),
+	}, nil
+}
+
+// BlameLine is one line of a file and the commit that last changed it
+type BlameLine struct {
+	Line    int
+	SHA     string
+	Content string
+}
+
+// Blame returns the commit that last changed each line of a file as of the
+// given revision. A startLine of 0 blames the whole file, and an endLine of 0
+// blames from startLine to the end of the file.
+func Blame(repoDir string, revision string, path string, startLine int, endLine int) ([]BlameLine, error) {
+	// Verify the directory is a git repository
+	if !IsGitRepository(repoDir) {
+		return nil, fmt.Errorf("directory is not a git repository: %s", repoDir)
+	}
+
+	args := []string{"blame", "--porcelain"}
+	if startLine > 0 {
+		if endLine > 0 {
+			args = append(args, "-L", fmt.Sprintf("%d,%d", startLine, endLine))
+		} else {
+			args = append(args, "-L", fmt.Sprintf("%d,", startLine))
+		}
+	}
+	args = append(args, revision, "--", path)
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoDir
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr := strings.TrimSpace(string(exitErr.Stderr))
+			if strings.Contains(stderr, "no such path") || strings.Contains(stderr, "has only") {
+				return nil, errors.NewInvalidInputError(stderr)
+			}
+			return nil, fmt.Errorf("failed to blame %s: %w\nOutput: %s", path, err, stderr)
+		}
+		return nil, fmt.Errorf("failed to blame %s: %w", path, err)
+	}
+
+	return parseBlamePorcelain(string(output))
+}
+
+// parseBlamePorcelain parses the output of `git blame --porcelain`. Each line
+// of the file starts with a header of the commit SHA and the original and final
+// line numbers, followed by the commit's details the first time it appears, and
+// then the line itself prefixed by a tab.
+func parseBlamePorcelain(output string) ([]BlameLine, error) {
+	var lines []BlameLine
+	var current *BlameLine
+	for _, row := range strings.Split(output, "\n") {
+		if current == nil {
+			if row == "" {
+				continue
+			}
+			fields := strings.Fields(row)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("unexpected blame header %q", row)
+			}
+			line, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid line number in blame header %q: %w", row, err)
+			}
+			current = &BlameLine{Line: line, SHA: fields[0]}
+			continue
+		}
+		if content, ok := strings.CutPrefix(row, "\t"); ok {
+			current.Content = content
+			lines = append(lines, *current)
+			current = nil
+		}
+	}
+	return lines, nil
+}
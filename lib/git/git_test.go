@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/steps"
 )
 
 func TestCreateWorktree(t *testing.T) {
@@ -69,7 +71,7 @@ func TestCreateWorktree(t *testing.T) {
 
 	// Create worktree
 	worktreeDir := filepath.Join(tempDir, "worktree")
-	worktree, err := CreateWorktree(repoDir, worktreeDir, "test-branch")
+	worktree, err := CreateWorktree(context.Background(), repoDir, worktreeDir, "test-branch")
 	if err != nil {
 		t.Fatalf("Failed to create worktree: %v", err)
 	}
@@ -165,7 +167,7 @@ func TestCreateTempWorktree(t *testing.T) {
 	}
 
 	// Create temporary worktree
-	worktree, err := CreateTempWorktree(repoDir, "test")
+	worktree, err := CreateTempWorktree(context.Background(), repoDir, "test")
 	if err != nil {
 		t.Fatalf("Failed to create temporary worktree: %v", err)
 	}
@@ -251,7 +253,7 @@ func TestCreateTempWorktreeWithStep(t *testing.T) {
 	for _, stepNum := range testCases {
 		t.Run(fmt.Sprintf("step_S%d", stepNum), func(t *testing.T) {
 			// Create temporary worktree with step number
-			worktree, err := CreateTempWorktreeWithStep(repoDir, stepNum)
+			worktree, err := CreateTempWorktreeWithStep(context.Background(), repoDir, stepNum)
 			if err != nil {
 				t.Fatalf("Failed to create temporary worktree with step S%d: %v", stepNum, err)
 			}
@@ -382,7 +384,7 @@ func TestGetWorktrees(t *testing.T) {
 
 	// Create a new worktree
 	worktreeDir := filepath.Join(tempDir, "worktree")
-	worktree, err := CreateWorktree(repoDir, worktreeDir, "test-branch")
+	worktree, err := CreateWorktree(context.Background(), repoDir, worktreeDir, "test-branch")
 	if err != nil {
 		t.Fatalf("Failed to create worktree: %v", err)
 	}
@@ -428,7 +430,7 @@ func TestBranchOperations(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	// Initialize a git repository
-	cmd := exec.Command("git", "init")
+	cmd := exec.Command("git", "init", "-b", "main")
 	cmd.Dir = tempDir
 	if err := cmd.Run(); err != nil {
 		t.Fatalf("Failed to initialize git repository: %v", err)
@@ -601,7 +603,7 @@ func TestBranchOperations(t *testing.T) {
 		}
 
 		// Merge feature into main
-		if err := MergeBranch(tempDir, "feature", "main", "Merge feature into main"); err != nil {
+		if err := MergeBranch(context.Background(), tempDir, "feature", "main", "Merge feature into main"); err != nil {
 			t.Errorf("MergeBranch failed: %v", err)
 		}
 
@@ -615,6 +617,16 @@ func TestBranchOperations(t *testing.T) {
 		}
 	})
 
+	t.Run("MergeBranch_Interrupted", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// An interrupted merge is not started
+		if err := MergeBranch(ctx, tempDir, "feature", "main", "Merge feature into main"); err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
 	t.Run("MergeBranch_Conflict", func(t *testing.T) {
 		// Create a conflict branch
 		cmd = exec.Command("git", "checkout", "-b", "conflict")
@@ -663,7 +675,7 @@ func TestBranchOperations(t *testing.T) {
 		}
 
 		// Try to merge conflict branch (should fail with merge conflict)
-		err := MergeBranch(tempDir, "conflict", "main", "Merge conflict into main")
+		err := MergeBranch(context.Background(), tempDir, "conflict", "main", "Merge conflict into main")
 		if err == nil {
 			t.Error("Expected MergeBranch to fail with merge conflict")
 		}
@@ -835,3 +847,465 @@ func TestResetToCommitNonRepo(t *testing.T) {
 		t.Error("Expected error when resetting in non-git directory")
 	}
 }
+
+// initTestRepo creates a git repository on a "main" branch with a single commit
+// containing README.md and returns its path
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+
+	if err := exec.Command("git", "--version").Run(); err != nil {
+		t.Skip("git is not available")
+	}
+
+	repoDir := t.TempDir()
+	runTestGit(t, repoDir, "init", "-b", "main")
+	runTestGit(t, repoDir, "config", "user.name", "Test User")
+	runTestGit(t, repoDir, "config", "user.email", "test@example.com")
+
+	if err := os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("initial content\n"), 0644); err != nil {
+		t.Fatalf("Failed to create README.md: %v", err)
+	}
+	runTestGit(t, repoDir, "add", "README.md")
+	runTestGit(t, repoDir, "commit", "-m", "Initial commit")
+
+	return repoDir
+}
+
+// runTestGit runs a git command in the given directory and fails the test on error
+func runTestGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\nOutput: %s", strings.Join(args, " "), err, string(output))
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestHasUncommittedChanges(t *testing.T) {
+	repoDir := initTestRepo(t)
+
+	hasChanges, err := HasUncommittedChanges(repoDir)
+	if err != nil {
+		t.Fatalf("HasUncommittedChanges failed: %v", err)
+	}
+	if hasChanges {
+		t.Error("Expected clean repository to have no changes")
+	}
+
+	// Untracked files count as changes
+	if err := os.WriteFile(filepath.Join(repoDir, "new.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatalf("Failed to create new.txt: %v", err)
+	}
+
+	hasChanges, err = HasUncommittedChanges(repoDir)
+	if err != nil {
+		t.Fatalf("HasUncommittedChanges failed: %v", err)
+	}
+	if !hasChanges {
+		t.Error("Expected untracked file to be reported as a change")
+	}
+}
+
+// commitFile writes a file on the given branch of repoDir and commits it
+func commitFile(t *testing.T, repoDir string, branch string, name string, content string) {
+	t.Helper()
+	runTestGit(t, repoDir, "checkout", branch)
+	if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	runTestGit(t, repoDir, "add", name)
+	runTestGit(t, repoDir, "commit", "-m", "Update "+name+" on "+branch)
+}
+
+func TestMergeBranchWithStrategy(t *testing.T) {
+	// setup creates a step branch with two commits, and a commit on main unless
+	// fastForward is set, and returns to main
+	setup := func(t *testing.T, fastForward bool) string {
+		repoDir := initTestRepo(t)
+		runTestGit(t, repoDir, "branch", "step-S1")
+		commitFile(t, repoDir, "step-S1", "a.txt", "a\n")
+		commitFile(t, repoDir, "step-S1", "b.txt", "b\n")
+		runTestGit(t, repoDir, "notes", "add", "-m", "Step-id: S1", "step-S1")
+		if !fastForward {
+			commitFile(t, repoDir, "main", "c.txt", "c\n")
+		}
+		runTestGit(t, repoDir, "checkout", "main")
+		return repoDir
+	}
+
+	tests := []struct {
+		strategy MergeStrategy
+		// commits is the number of commits expected on main after the initial one
+		commits     int
+		fastForward bool
+		wantErr     bool
+	}{
+		{strategy: MergeStrategyMerge, commits: 4},
+		{strategy: MergeStrategySquash, commits: 2},
+		{strategy: MergeStrategyRebase, commits: 3},
+		{strategy: MergeStrategyFFOnly, commits: 2, fastForward: true},
+		{strategy: MergeStrategyFFOnly, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/fast-forward=%v", tt.strategy, tt.fastForward), func(t *testing.T) {
+			repoDir := setup(t, tt.fastForward)
+			before := runTestGit(t, repoDir, "rev-parse", "main")
+
+			sha, err := MergeBranchWithStrategy(context.Background(), repoDir, "step-S1", "main", "Step S1", tt.strategy)
+			if tt.wantErr {
+				if !errors.IsErrorType(err, errors.ErrGitMergeConflict) {
+					t.Fatalf("Expected a merge conflict error, got %v", err)
+				}
+				if after := runTestGit(t, repoDir, "rev-parse", "main"); after != before {
+					t.Errorf("Expected main to be unchanged, moved from %s to %s", before, after)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeBranchWithStrategy() error = %v", err)
+			}
+
+			if main := runTestGit(t, repoDir, "rev-parse", "main"); sha != main {
+				t.Errorf("Expected the returned SHA %s to be main %s", sha, main)
+			}
+			if count := runTestGit(t, repoDir, "rev-list", "--count", "main"); count != fmt.Sprint(tt.commits+1) {
+				t.Errorf("Expected %d commits on main, got %s", tt.commits+1, count)
+			}
+			for _, name := range []string{"a.txt", "b.txt"} {
+				if _, err := os.Stat(filepath.Join(repoDir, name)); err != nil {
+					t.Errorf("Expected %s on main: %v", name, err)
+				}
+			}
+			if branch, _ := GetCurrentBranch(repoDir); branch != "main" {
+				t.Errorf("Expected main to stay checked out, got %s", branch)
+			}
+			// Strategies that put the step's commits on main keep their notes
+			if tt.strategy == MergeStrategyRebase || tt.strategy == MergeStrategyFFOnly {
+				if note := runTestGit(t, repoDir, "notes", "show", "main"); note != "Step-id: S1" {
+					t.Errorf("Expected the step commit on main to keep its note, got %q", note)
+				}
+			}
+		})
+	}
+
+	t.Run("none", func(t *testing.T) {
+		repoDir := setup(t, false)
+		before := runTestGit(t, repoDir, "rev-parse", "main")
+		sha, err := MergeBranchWithStrategy(context.Background(), repoDir, "step-S1", "main", "Step S1", MergeStrategyNone)
+		if err != nil || sha != "" {
+			t.Fatalf("Expected no merge, got %q, %v", sha, err)
+		}
+		if after := runTestGit(t, repoDir, "rev-parse", "main"); after != before {
+			t.Errorf("Expected main to be unchanged")
+		}
+	})
+
+	// Conflicts are aborted, leaving main checked out and clean
+	for _, strategy := range []MergeStrategy{MergeStrategyMerge, MergeStrategySquash, MergeStrategyRebase} {
+		t.Run(string(strategy)+"/conflict", func(t *testing.T) {
+			repoDir := initTestRepo(t)
+			runTestGit(t, repoDir, "branch", "step-S1")
+			commitFile(t, repoDir, "step-S1", "README.md", "step content\n")
+			commitFile(t, repoDir, "main", "README.md", "main content\n")
+			before := runTestGit(t, repoDir, "rev-parse", "main")
+
+			_, err := MergeBranchWithStrategy(context.Background(), repoDir, "step-S1", "main", "Step S1", strategy)
+			if !errors.IsErrorType(err, errors.ErrGitMergeConflict) {
+				t.Fatalf("Expected a merge conflict error, got %v", err)
+			}
+			if after := runTestGit(t, repoDir, "rev-parse", "main"); after != before {
+				t.Errorf("Expected main to be unchanged")
+			}
+			if branch, _ := GetCurrentBranch(repoDir); branch != "main" {
+				t.Errorf("Expected main to be checked out, got %s", branch)
+			}
+			if dirty, _ := HasUncommittedChanges(repoDir); dirty {
+				t.Errorf("Expected the aborted merge to leave a clean working tree")
+			}
+		})
+	}
+}
+
+func TestParseMergeStrategy(t *testing.T) {
+	if strategy, err := ParseMergeStrategy(""); err != nil || strategy != DefaultMergeStrategy {
+		t.Errorf("Expected the default strategy, got %q, %v", strategy, err)
+	}
+	if strategy, err := ParseMergeStrategy("ff-only"); err != nil || strategy != MergeStrategyFFOnly {
+		t.Errorf("Expected ff-only, got %q, %v", strategy, err)
+	}
+	if _, err := ParseMergeStrategy("octopus"); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+}
+
+func TestPushBranch(t *testing.T) {
+	repoDir := initTestRepo(t)
+	remoteDir := t.TempDir()
+	runTestGit(t, remoteDir, "init", "--bare")
+	runTestGit(t, repoDir, "remote", "add", "origin", remoteDir)
+
+	runTestGit(t, repoDir, "branch", "step-S1")
+	commitFile(t, repoDir, "step-S1", "a.txt", "a\n")
+	runTestGit(t, repoDir, "checkout", "main")
+
+	if err := PushBranch(context.Background(), repoDir, "origin", "step-S1"); err != nil {
+		t.Fatalf("PushBranch() error = %v", err)
+	}
+	if got, want := runTestGit(t, remoteDir, "rev-parse", "step-S1"), runTestGit(t, repoDir, "rev-parse", "step-S1"); got != want {
+		t.Errorf("Expected the remote branch at %s, got %s", want, got)
+	}
+
+	if err := PushBranch(context.Background(), repoDir, "origin", "missing"); err == nil {
+		t.Error("Expected an error pushing a branch that does not exist")
+	}
+}
+
+func TestStartMerge(t *testing.T) {
+	repoDir := initTestRepo(t)
+	runTestGit(t, repoDir, "branch", "step-S1")
+	commitFile(t, repoDir, "step-S1", "README.md", "step change\n")
+	commitFile(t, repoDir, "step-S1", "a.txt", "a\n")
+	commitFile(t, repoDir, "main", "README.md", "main change\n")
+
+	conflicts, err := StartMerge(context.Background(), repoDir, "step-S1")
+	if err != nil {
+		t.Fatalf("StartMerge() error = %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0] != "README.md" {
+		t.Fatalf("Expected a conflict in README.md, got %v", conflicts)
+	}
+
+	marked, err := FindConflictMarkers(repoDir, append(conflicts, "a.txt", "missing.txt"))
+	if err != nil {
+		t.Fatalf("FindConflictMarkers() error = %v", err)
+	}
+	if len(marked) != 1 || marked[0] != "README.md" {
+		t.Errorf("Expected conflict markers in README.md, got %v", marked)
+	}
+
+	// Resolving the conflict and committing concludes the merge
+	if err := os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("main change\n=======\nstep change\n"), 0644); err != nil {
+		t.Fatalf("Failed to resolve README.md: %v", err)
+	}
+	if marked, _ := FindConflictMarkers(repoDir, conflicts); len(marked) != 0 {
+		t.Errorf("Expected no conflict markers after resolving, got %v", marked)
+	}
+	runTestGit(t, repoDir, "commit", "-am", "Merge step-S1")
+	if parents := strings.Fields(runTestGit(t, repoDir, "log", "-1", "--format=%P")); len(parents) != 2 {
+		t.Errorf("Expected a merge commit, got parents %v", parents)
+	}
+}
+
+func TestRebaseWorktree(t *testing.T) {
+	repoDir := initTestRepo(t)
+	worktree, err := CreateTempWorktreeWithStep(context.Background(), repoDir, 1)
+	if err != nil {
+		t.Fatalf("CreateTempWorktreeWithStep() error = %v", err)
+	}
+	defer RemoveWorktree(worktree)
+
+	commitFile(t, worktree.Path, "step-S1", "a.txt", "a\n")
+	runTestGit(t, worktree.Path, "notes", "add", "-m", "Step-id: S1")
+	commitFile(t, repoDir, "main", "b.txt", "b\n")
+
+	// A branch that diverged without conflicts is replayed onto main, keeping its notes
+	if err := RebaseWorktree(context.Background(), worktree.Path, "main"); err != nil {
+		t.Fatalf("RebaseWorktree() error = %v", err)
+	}
+	runTestGit(t, repoDir, "merge-base", "--is-ancestor", "main", "step-S1")
+	if note := runTestGit(t, repoDir, "notes", "show", "step-S1"); note != "Step-id: S1" {
+		t.Errorf("Expected the rebased commit to keep its note, got %q", note)
+	}
+
+	// A conflicting branch is left as it was
+	commitFile(t, worktree.Path, "step-S1", "README.md", "step change\n")
+	commitFile(t, repoDir, "main", "README.md", "main change\n")
+	before := runTestGit(t, worktree.Path, "rev-parse", "HEAD")
+	err = RebaseWorktree(context.Background(), worktree.Path, "main")
+	if !errors.IsErrorType(err, errors.ErrGitMergeConflict) {
+		t.Fatalf("Expected a merge conflict error, got %v", err)
+	}
+	if after := runTestGit(t, worktree.Path, "rev-parse", "HEAD"); after != before {
+		t.Errorf("Expected the step branch to stay at %s, got %s", before, after)
+	}
+	if status := runTestGit(t, worktree.Path, "status", "--porcelain"); status != "" {
+		t.Errorf("Expected a clean worktree after the aborted rebase, got %q", status)
+	}
+}
+
+func TestGetDiffStats(t *testing.T) {
+	repoDir := initTestRepo(t)
+	commitFile(t, repoDir, "main", "old.txt", "one\ntwo\nthree\nfour\nfive\n")
+	before := runTestGit(t, repoDir, "rev-parse", "HEAD")
+
+	commitFile(t, repoDir, "main", "README.md", "changed content\nsecond line\n")
+	runTestGit(t, repoDir, "mv", "old.txt", "new.txt")
+	runTestGit(t, repoDir, "commit", "-m", "Rename old.txt")
+	commitFile(t, repoDir, "main", "image.bin", "\x00\x01\x02")
+	commitFile(t, repoDir, "main", "added file.txt", "a\nb\n")
+	after := runTestGit(t, repoDir, "rev-parse", "HEAD")
+
+	stats, err := GetDiffStats(repoDir, before, after)
+	if err != nil {
+		t.Fatalf("GetDiffStats() error = %v", err)
+	}
+	if stats.FilesChanged != 4 || stats.Insertions != 4 || stats.Deletions != 1 {
+		t.Errorf("Expected 4 files, +4 -1, got %d files, +%d -%d", stats.FilesChanged, stats.Insertions, stats.Deletions)
+	}
+
+	files := map[string]steps.FileDiffStats{}
+	for _, file := range stats.Files {
+		files[file.Path] = file
+	}
+	if file := files["README.md"]; file.Status != "modified" || file.Insertions != 2 || file.Deletions != 1 {
+		t.Errorf("Unexpected README.md stats: %+v", file)
+	}
+	if file := files["new.txt"]; file.Status != "renamed" || file.OldPath != "old.txt" || file.Insertions != 0 {
+		t.Errorf("Unexpected new.txt stats: %+v", file)
+	}
+	if file := files["image.bin"]; file.Status != "added" || !file.Binary {
+		t.Errorf("Unexpected image.bin stats: %+v", file)
+	}
+	if file := files["added file.txt"]; file.Status != "added" || file.Insertions != 2 {
+		t.Errorf("Unexpected added file.txt stats: %+v", file)
+	}
+
+	// Identical commits have no changes
+	stats, err = GetDiffStats(repoDir, after, after)
+	if err != nil {
+		t.Fatalf("GetDiffStats() error = %v", err)
+	}
+	if stats.FilesChanged != 0 || len(stats.Files) != 0 {
+		t.Errorf("Expected no changes, got %+v", stats)
+	}
+}
+
+func TestGetDiff(t *testing.T) {
+	repoDir := initTestRepo(t)
+	before := runTestGit(t, repoDir, "rev-parse", "HEAD")
+	commitFile(t, repoDir, "main", "README.md", "changed content\n")
+	commitFile(t, repoDir, "main", "other.txt", "other\n")
+	after := runTestGit(t, repoDir, "rev-parse", "HEAD")
+
+	diff, err := GetDiff(repoDir, before, after)
+	if err != nil {
+		t.Fatalf("GetDiff() error = %v", err)
+	}
+	if !strings.Contains(diff, "+changed content") || !strings.Contains(diff, "+++ b/other.txt") {
+		t.Errorf("Expected the diff to cover both files, got:\n%s", diff)
+	}
+
+	diff, err = GetDiff(repoDir, before, after, "other.txt")
+	if err != nil {
+		t.Fatalf("GetDiff() error = %v", err)
+	}
+	if strings.Contains(diff, "README.md") || !strings.Contains(diff, "+other") {
+		t.Errorf("Expected the diff to be limited to other.txt, got:\n%s", diff)
+	}
+}
+
+func TestKeepStepCommit(t *testing.T) {
+	repoDir := initTestRepo(t)
+	base := runTestGit(t, repoDir, "rev-parse", "HEAD")
+	runTestGit(t, repoDir, "branch", "step-S3")
+	commitFile(t, repoDir, "step-S3", "a.txt", "a\n")
+	commit := runTestGit(t, repoDir, "rev-parse", "step-S3")
+
+	if err := KeepStepCommit(repoDir, 3, base, commit); err != nil {
+		t.Fatalf("KeepStepCommit() error = %v", err)
+	}
+
+	// Squash the branch away and collect its commit, which only the ref keeps
+	runTestGit(t, repoDir, "checkout", "main")
+	runTestGit(t, repoDir, "merge", "--squash", "step-S3")
+	runTestGit(t, repoDir, "commit", "-m", "Squashed step-S3")
+	runTestGit(t, repoDir, "branch", "-D", "step-S3")
+	runTestGit(t, repoDir, "reflog", "expire", "--expire=now", "--all")
+	runTestGit(t, repoDir, "gc", "--prune=now", "--quiet")
+
+	if got := runTestGit(t, repoDir, "rev-parse", StepCommitRef(3)); got != commit {
+		t.Errorf("Expected %s at %s, got %s", StepCommitRef(3), commit, got)
+	}
+	diff, err := GetDiff(repoDir, StepBaseRef(3), StepCommitRef(3))
+	if err != nil {
+		t.Fatalf("GetDiff() error = %v", err)
+	}
+	if !strings.Contains(diff, "+++ b/a.txt") {
+		t.Errorf("Expected the kept commits to diff, got:\n%s", diff)
+	}
+}
+
+func TestGetCommitInfo(t *testing.T) {
+	repoDir := initTestRepo(t)
+	runTestGit(t, repoDir, "branch", "step-S4")
+	commitFile(t, repoDir, "step-S4", "a.txt", "a\n")
+	runTestGit(t, repoDir, "notes", "add", "-m", "Step-id: S4", "step-S4")
+	runTestGit(t, repoDir, "checkout", "main")
+	runTestGit(t, repoDir, "merge", "--no-ff", "step-S4", "-m", "Automerge step-S4 into main")
+
+	tests := []struct {
+		revision string
+		subject  string
+		stepID   int
+		source   string
+	}{
+		{revision: "step-S4", subject: "Update a.txt on step-S4", stepID: 4, source: StepSourceNote},
+		{revision: "main", subject: "Automerge step-S4 into main", stepID: 4, source: StepSourceMergeMessage},
+		{revision: "main~1", subject: "Initial commit"},
+	}
+	for _, tt := range tests {
+		info, err := GetCommitInfo(repoDir, tt.revision)
+		if err != nil {
+			t.Fatalf("GetCommitInfo(%s) error = %v", tt.revision, err)
+		}
+		if info.SHA != runTestGit(t, repoDir, "rev-parse", tt.revision) || info.Subject != tt.subject {
+			t.Errorf("Unexpected commit info for %s: %+v", tt.revision, info)
+		}
+		if id, source := info.StepID(); id != tt.stepID || source != tt.source {
+			t.Errorf("Expected %s to be step %d from %q, got %d from %q", tt.revision, tt.stepID, tt.source, id, source)
+		}
+	}
+
+	if _, err := GetCommitInfo(repoDir, "no-such-branch"); !errors.IsErrorType(err, errors.ErrNotFound) {
+		t.Errorf("Expected a not found error for an unknown commit, got %v", err)
+	}
+}
+
+func TestBlame(t *testing.T) {
+	repoDir := initTestRepo(t)
+	first := runTestGit(t, repoDir, "rev-parse", "HEAD")
+	commitFile(t, repoDir, "main", "README.md", "initial content\nsecond line\nthird line\n")
+	second := runTestGit(t, repoDir, "rev-parse", "HEAD")
+
+	lines, err := Blame(repoDir, "main", "README.md", 0, 0)
+	if err != nil {
+		t.Fatalf("Blame() error = %v", err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %+v", lines)
+	}
+	if lines[0].Line != 1 || lines[0].SHA != first || lines[0].Content != "initial content" {
+		t.Errorf("Unexpected first line: %+v", lines[0])
+	}
+	if lines[2].Line != 3 || lines[2].SHA != second || lines[2].Content != "third line" {
+		t.Errorf("Unexpected third line: %+v", lines[2])
+	}
+
+	lines, err = Blame(repoDir, "main", "README.md", 2, 2)
+	if err != nil {
+		t.Fatalf("Blame() error = %v", err)
+	}
+	if len(lines) != 1 || lines[0].Line != 2 || lines[0].SHA != second {
+		t.Errorf("Expected only line 2, got %+v", lines)
+	}
+
+	if _, err := Blame(repoDir, "main", "missing.txt", 0, 0); !errors.IsErrorType(err, errors.ErrInvalidInput) {
+		t.Errorf("Expected an invalid input error for a missing file, got %v", err)
+	}
+	if _, err := Blame(repoDir, "main", "README.md", 10, 10); !errors.IsErrorType(err, errors.ErrInvalidInput) {
+		t.Errorf("Expected an invalid input error for a line past the end, got %v", err)
+	}
+}
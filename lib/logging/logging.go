@@ -30,6 +30,7 @@ type Logger struct {
 	fileOutput *log.Logger
 	stepID     string
 	projectID  string
+	redactor   *Redactor
 }
 
 // LogEntry represents a structured log entry
@@ -109,6 +110,14 @@ func (l *Logger) SetProjectID(projectID string) {
 	l.projectID = projectID
 }
 
+// SetRedactedValues sets secret values that are replaced with RedactedPlaceholder
+// in all subsequent log messages and metadata
+func (l *Logger) SetRedactedValues(values []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redactor = NewRedactor(values)
+}
+
 // log formats and outputs a log message
 func (l *Logger) log(level LogLevel, component, message string, metadata map[string]interface{}) {
 	if level < l.level {
@@ -118,6 +127,14 @@ func (l *Logger) log(level LogLevel, component, message string, metadata map[str
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	// Keep secret values out of the console and log file
+	if l.redactor != nil {
+		message = l.redactor.Redact(message)
+		if metadata != nil {
+			metadata = l.redactor.redactValue(metadata).(map[string]interface{})
+		}
+	}
+
 	// Get caller information
 	_, file, line, ok := runtime.Caller(2)
 	if ok {
@@ -2,6 +2,7 @@ package logging
 
 import (
 	"bytes"
+	"fmt"
 	"log"
 	"strings"
 	"testing"
@@ -108,3 +109,37 @@ func TestStepTimer(t *testing.T) {
 		t.Errorf("Expected log to contain 'Test operation completed', got: %s", output)
 	}
 }
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &Logger{
+		level:  DEBUG,
+		output: log.New(&buf, "", 0),
+	}
+	logger.SetRedactedValues([]string{"sk-secret", "", "sk-secret-longer"})
+
+	logger.Info("docker", "Container logs: sk-secret-longer", map[string]interface{}{
+		"logs": "token=sk-secret",
+	})
+	logger.Error("docker", "Failed", fmt.Errorf("bad key sk-secret"))
+	output := buf.String()
+	if strings.Contains(output, "sk-secret") {
+		t.Errorf("Expected secret values to be redacted, got: %s", output)
+	}
+	if !strings.Contains(output, "Container logs: [REDACTED]") || !strings.Contains(output, "bad key [REDACTED]") {
+		t.Errorf("Expected redaction placeholders, got: %s", output)
+	}
+
+	var streamed bytes.Buffer
+	writer := NewRedactingWriter(&streamed, []string{"sk-secret"})
+	line := "export KEY=sk-secret\n"
+	if n, err := writer.Write([]byte(line)); err != nil || n != len(line) {
+		t.Errorf("Write() = %d, %v", n, err)
+	}
+	if streamed.String() != "export KEY=[REDACTED]\n" {
+		t.Errorf("Unexpected redacted output %q", streamed.String())
+	}
+	if NewRedactingWriter(&streamed, nil) != &streamed {
+		t.Error("Expected the writer to be returned unchanged without secrets")
+	}
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RedactedPlaceholder replaces secret values in redacted output
+const RedactedPlaceholder = "[REDACTED]"
+
+// Redactor replaces secret values in text with RedactedPlaceholder
+type Redactor struct {
+	replacer *strings.Replacer
+}
+
+// NewRedactor creates a redactor for the given secret values. Empty values are
+// ignored, and longer values are replaced first so that a secret containing
+// another secret is redacted as a whole.
+func NewRedactor(values []string) *Redactor {
+	sorted := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" {
+			sorted = append(sorted, value)
+		}
+	}
+	if len(sorted) == 0 {
+		return nil
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	pairs := make([]string, 0, len(sorted)*2)
+	for _, value := range sorted {
+		pairs = append(pairs, value, RedactedPlaceholder)
+	}
+	return &Redactor{replacer: strings.NewReplacer(pairs...)}
+}
+
+// Redact returns s with all secret values replaced. A nil Redactor returns s unchanged.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// redactValue redacts the strings in a log metadata value
+func (r *Redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.Redact(v)
+	case error:
+		return r.Redact(v.Error())
+	case fmt.Stringer:
+		return r.Redact(v.String())
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, inner := range v {
+			redacted[key] = r.redactValue(inner)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// RedactingWriter wraps an io.Writer and redacts secret values from everything
+// written to it. Each Write is redacted on its own, so callers should write
+// whole lines, as the container log streamer does.
+type RedactingWriter struct {
+	writer   io.Writer
+	redactor *Redactor
+}
+
+// NewRedactingWriter creates a writer that redacts the given secret values. If
+// there are no values, w is returned unchanged.
+func NewRedactingWriter(w io.Writer, values []string) io.Writer {
+	redactor := NewRedactor(values)
+	if redactor == nil {
+		return w
+	}
+	return &RedactingWriter{writer: w, redactor: redactor}
+}
+
+// Write implements io.Writer by redacting p before writing it
+func (rw *RedactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.writer, rw.redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	// Return the original length to satisfy io.Writer interface
+	return len(p), nil
+}
@@ -42,16 +42,17 @@ func (sl *StepLogger) LogStepStart(projectID string) {
 }
 
 // LogStepEnd logs the completion of a step
-func (sl *StepLogger) LogStepEnd(success bool, exitCode int) {
+func (sl *StepLogger) LogStepEnd(success bool, duration time.Duration, exitCode int) {
 	status := "completed"
 	if !success {
 		status = "failed"
 	}
 
-	sl.logger.Info("step", fmt.Sprintf("LaForge step %s", status), map[string]interface{}{
+	sl.logger.Info("step", fmt.Sprintf("LaForge step %s in %v", status, duration), map[string]interface{}{
 		"project_id": sl.projectID,
 		"step_id":    sl.stepID,
 		"status":     status,
+		"duration":   duration.String(),
 		"exit_code":  exitCode,
 		"timestamp":  time.Now().Format(time.RFC3339),
 	})
@@ -2,11 +2,15 @@ package projects
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/tomyedwab/laforge/lib/egress"
 	"gopkg.in/yaml.v3"
 )
 
@@ -38,6 +42,29 @@ type AgentConfig struct {
 
 	// Working directory in the container
 	WorkingDir string `yaml:"working_dir,omitempty"`
+
+	// Format of the agent's output, selecting how it is formatted for the step
+	// log and how token usage is read from it: "claude" (the default) for Claude
+	// Code stream-json, "opencode" for `opencode run --format json`, "jsonl" to
+	// pass output through unchanged, or the name of another registered formatter
+	OutputFormat string `yaml:"output_format,omitempty"`
+
+	// Egress restricts the agent's outbound network access to listed destinations
+	Egress *EgressConfig `yaml:"egress,omitempty"`
+}
+
+// EgressConfig is an allow list of outbound destinations for the agent. When set,
+// the agent runs on an isolated network and reaches the outside only through a
+// LaForge proxy, which blocks and logs everything else. The laserve callback in
+// LATASK_URLPATH is always allowed.
+type EgressConfig struct {
+	// Allow lists destinations as "host", "host:port", "*.domain" or "*.domain:port"
+	// (e.g., "api.anthropic.com:443", "*.npmjs.org")
+	Allow []string `yaml:"allow,omitempty"`
+
+	// ProxyImage is the image the proxy sidecar runs in, with the laforge binary
+	// mounted into it. Defaults to the agent image.
+	ProxyImage string `yaml:"proxy_image,omitempty"`
 }
 
 // ResourceConfig represents resource limits for the agent container
@@ -53,6 +80,23 @@ type ResourceConfig struct {
 
 	// Maximum number of PIDs
 	PidsLimit int64 `yaml:"pids_limit,omitempty"`
+
+	// Size limit of the container's writable layer (e.g., "10g"). Only
+	// supported by some storage drivers, such as overlay2 on XFS.
+	DiskSize string `yaml:"disk_size,omitempty"`
+
+	// Size of the tmpfs mounted at /tmp (e.g., "256m")
+	TmpfsSize string `yaml:"tmpfs_size,omitempty"`
+
+	// Ulimits keyed by name, as "limit" or "soft:hard" (e.g., nofile: "1024:4096")
+	Ulimits map[string]string `yaml:"ulimits,omitempty"`
+
+	// Mount the container's root filesystem read-only. /tmp is still
+	// writable through a tmpfs mount.
+	ReadOnlyRootFS bool `yaml:"read_only_root_fs,omitempty"`
+
+	// User (and optionally group) to run as, by name or ID (e.g., "1000:1000")
+	User string `yaml:"user,omitempty"`
 }
 
 // RuntimeConfig represents container runtime configuration
@@ -84,10 +128,40 @@ type AgentsConfig struct {
 	// Default agent to use when none is specified
 	Default string `yaml:"default,omitempty"`
 
+	// Container runtime used to run agents: "docker" (the default) or "podman"
+	Runtime string `yaml:"runtime,omitempty"`
+
 	// Available agent configurations
 	Agents map[string]AgentConfig `yaml:"agents"`
+
+	// ConflictResolution configures the steps that resolve merge conflicts
+	ConflictResolution *ConflictResolutionConfig `yaml:"conflict_resolution,omitempty"`
+}
+
+// ConflictResolutionConfig configures the follow-up step that is run when a
+// step's branch conflicts with the main branch. The step runs in a worktree with
+// the conflicted merge in progress and is merged only once no conflict markers remain.
+type ConflictResolutionConfig struct {
+	// Disabled leaves conflicted step branches for manual resolution
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// Agent is the agent configuration that resolves conflicts. Defaults to the
+	// agent configuration of the conflicted step.
+	Agent string `yaml:"agent,omitempty"`
+
+	// Prompt replaces the default instructions passed to the agent in the
+	// LAFORGE_PROMPT environment variable. {branch}, {main_branch}, {task_id} and
+	// {files} are replaced with the conflicted branch, the branch it is merged
+	// into, the resolution task and the conflicted files.
+	Prompt string `yaml:"prompt,omitempty"`
 }
 
+// Container runtimes that can be selected in agents.yml
+const (
+	ContainerRuntimeDocker = "docker"
+	ContainerRuntimePodman = "podman"
+)
+
 // DefaultAgentsConfig returns a default agents configuration
 func DefaultAgentsConfig() *AgentsConfig {
 	return &AgentsConfig{
@@ -142,6 +216,28 @@ func (c *AgentConfig) Validate() error {
 		}
 	}
 
+	// Validate egress policy
+	if c.Egress != nil {
+		if err := c.Egress.Validate(); err != nil {
+			return fmt.Errorf("invalid egress configuration: %w", err)
+		}
+		switch c.Runtime.NetworkMode {
+		case "", "bridge":
+		default:
+			return fmt.Errorf("egress policy cannot be combined with network mode '%s'", c.Runtime.NetworkMode)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks if the egress configuration is valid
+func (e *EgressConfig) Validate() error {
+	for _, entry := range e.Allow {
+		if _, err := egress.ParseRule(entry); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -161,6 +257,38 @@ func (r *ResourceConfig) Validate() error {
 		}
 	}
 
+	if r.CPUShares < 0 {
+		return fmt.Errorf("CPU shares cannot be negative")
+	}
+
+	if r.PidsLimit < 0 {
+		return fmt.Errorf("PIDs limit cannot be negative")
+	}
+
+	if r.DiskSize != "" {
+		if err := validateMemoryFormat(r.DiskSize); err != nil {
+			return fmt.Errorf("invalid disk size format: %w", err)
+		}
+	}
+
+	if r.TmpfsSize != "" {
+		if err := validateMemoryFormat(r.TmpfsSize); err != nil {
+			return fmt.Errorf("invalid tmpfs size format: %w", err)
+		}
+	}
+
+	for name, value := range r.Ulimits {
+		if err := validateUlimit(name, value); err != nil {
+			return fmt.Errorf("invalid ulimit %s: %w", name, err)
+		}
+	}
+
+	if r.User != "" {
+		if err := validateUser(r.User); err != nil {
+			return fmt.Errorf("invalid user: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -199,6 +327,12 @@ func (c *AgentsConfig) Validate() error {
 		return fmt.Errorf("at least one agent configuration is required")
 	}
 
+	switch c.Runtime {
+	case "", ContainerRuntimeDocker, ContainerRuntimePodman:
+	default:
+		return fmt.Errorf("invalid container runtime '%s', must be '%s' or '%s'", c.Runtime, ContainerRuntimeDocker, ContainerRuntimePodman)
+	}
+
 	// Validate each agent configuration
 	for name, agent := range c.Agents {
 		if err := agent.Validate(); err != nil {
@@ -213,6 +347,13 @@ func (c *AgentsConfig) Validate() error {
 		}
 	}
 
+	// Validate the conflict resolution agent exists
+	if c.ConflictResolution != nil && c.ConflictResolution.Agent != "" {
+		if _, exists := c.Agents[c.ConflictResolution.Agent]; !exists {
+			return fmt.Errorf("conflict resolution agent '%s' not found", c.ConflictResolution.Agent)
+		}
+	}
+
 	return nil
 }
 
@@ -222,6 +363,19 @@ func (c *AgentsConfig) GetAgent(name string) (AgentConfig, bool) {
 	return agent, exists
 }
 
+// ContainerRuntime returns the container runtime used to run agents
+func (c *AgentsConfig) ContainerRuntime() string {
+	if c.Runtime == "" {
+		return ContainerRuntimeDocker
+	}
+	return c.Runtime
+}
+
+// ResolvesConflicts returns true if merge conflicts are resolved by a follow-up step
+func (c *AgentsConfig) ResolvesConflicts() bool {
+	return c.ConflictResolution == nil || !c.ConflictResolution.Disabled
+}
+
 // GetDefaultAgent returns the default agent configuration
 func (c *AgentsConfig) GetDefaultAgent() (AgentConfig, bool) {
 	if c.Default == "" {
@@ -368,6 +522,12 @@ func UpdateAgentsConfig(projectID string, updates *AgentsConfig) error {
 	if updates.Default != "" {
 		existing.Default = updates.Default
 	}
+	if updates.Runtime != "" {
+		existing.Runtime = updates.Runtime
+	}
+	if updates.ConflictResolution != nil {
+		existing.ConflictResolution = updates.ConflictResolution
+	}
 
 	// Merge or replace agents
 	if existing.Agents == nil {
@@ -392,12 +552,21 @@ func validateMemoryFormat(memory string) error {
 	validUnits := []string{"b", "k", "kb", "m", "mb", "g", "gb"}
 	memory = strings.ToLower(strings.TrimSpace(memory))
 
+	// Docker accepts fractional sizes such as "1.5g"
+	hasUnit := false
 	for _, unit := range validUnits {
 		if strings.HasSuffix(memory, unit) {
-			return nil
+			hasUnit = true
+			value, err := strconv.ParseFloat(strings.TrimSuffix(memory, unit), 64)
+			if err == nil && value > 0 && !math.IsInf(value, 0) {
+				return nil
+			}
 		}
 	}
 
+	if hasUnit {
+		return fmt.Errorf("memory must be a number greater than zero followed by a unit, e.g. \"512m\"")
+	}
 	return fmt.Errorf("memory must end with one of: %v", validUnits)
 }
 
@@ -406,8 +575,68 @@ func validateCPULimitFormat(cpu string) error {
 		return nil
 	}
 
-	// Simple validation for CPU limit format (should be a number)
-	// In a real implementation, you might want more sophisticated validation
+	value, err := strconv.ParseFloat(strings.TrimSpace(cpu), 64)
+	if err != nil {
+		return fmt.Errorf("CPU limit must be a number of CPUs, e.g. \"1.5\"")
+	}
+	if value <= 0 {
+		return fmt.Errorf("CPU limit must be greater than zero")
+	}
+	return nil
+}
+
+// validUlimits are the resource names accepted by "docker run --ulimit"
+var validUlimits = []string{
+	"core", "cpu", "data", "fsize", "locks", "memlock", "msgqueue", "nice",
+	"nofile", "nproc", "rss", "rtprio", "rttime", "sigpending", "stack",
+}
+
+func validateUlimit(name, value string) error {
+	known := false
+	for _, validName := range validUlimits {
+		if name == validName {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown ulimit, must be one of: %v", validUlimits)
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) > 2 {
+		return fmt.Errorf("ulimit must be in format 'limit' or 'soft:hard'")
+	}
+	limits := make([]int64, len(parts))
+	for i, part := range parts {
+		limit, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ulimit must be in format 'limit' or 'soft:hard'")
+		}
+		if limit < -1 {
+			return fmt.Errorf("ulimit cannot be less than -1 (unlimited)")
+		}
+		limits[i] = limit
+	}
+	if len(limits) == 2 && limits[1] != -1 && (limits[0] == -1 || limits[0] > limits[1]) {
+		return fmt.Errorf("soft limit cannot exceed hard limit")
+	}
+	return nil
+}
+
+// userPattern matches a user name or ID with an optional group name or ID
+var userPattern = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*$|^[0-9]+$`)
+
+func validateUser(user string) error {
+	parts := strings.Split(user, ":")
+	if len(parts) > 2 {
+		return fmt.Errorf("user must be in format 'user[:group]'")
+	}
+	for _, part := range parts {
+		if !userPattern.MatchString(part) {
+			return fmt.Errorf("user must be in format 'user[:group]' using names or numeric IDs")
+		}
+	}
 	return nil
 }
 
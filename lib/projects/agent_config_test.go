@@ -114,6 +114,36 @@ func TestAgentConfig_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid egress policy",
+			config: AgentConfig{
+				Name:   "test-agent",
+				Image:  "test:latest",
+				Egress: &EgressConfig{Allow: []string{"api.anthropic.com:443", "*.npmjs.org"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid egress rule",
+			config: AgentConfig{
+				Name:   "test-agent",
+				Image:  "test:latest",
+				Egress: &EgressConfig{Allow: []string{"https://api.anthropic.com"}},
+			},
+			wantErr: true,
+			errMsg:  "invalid egress configuration",
+		},
+		{
+			name: "egress policy with host network",
+			config: AgentConfig{
+				Name:    "test-agent",
+				Image:   "test:latest",
+				Egress:  &EgressConfig{Allow: []string{"api.anthropic.com"}},
+				Runtime: RuntimeConfig{NetworkMode: "host"},
+			},
+			wantErr: true,
+			errMsg:  "egress policy cannot be combined with network mode 'host'",
+		},
 	}
 
 	for _, tt := range tests {
@@ -166,6 +196,101 @@ func TestResourceConfig_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "non-numeric CPU limit",
+			config: ResourceConfig{
+				CPULimit: "lots",
+			},
+			wantErr: true,
+			errMsg:  "invalid CPU limit format",
+		},
+		{
+			name: "zero CPU limit",
+			config: ResourceConfig{
+				CPULimit: "0",
+			},
+			wantErr: true,
+			errMsg:  "invalid CPU limit format",
+		},
+		{
+			name: "negative PIDs limit",
+			config: ResourceConfig{
+				PidsLimit: -1,
+			},
+			wantErr: true,
+			errMsg:  "PIDs limit cannot be negative",
+		},
+		{
+			name: "valid full config",
+			config: ResourceConfig{
+				Memory:         "1g",
+				CPUShares:      512,
+				CPULimit:       "2",
+				PidsLimit:      256,
+				DiskSize:       "10g",
+				TmpfsSize:      "256m",
+				Ulimits:        map[string]string{"nofile": "1024:4096", "core": "0", "stack": "-1"},
+				ReadOnlyRootFS: true,
+				User:           "agent:1000",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid disk size",
+			config: ResourceConfig{
+				DiskSize: "10x",
+			},
+			wantErr: true,
+			errMsg:  "invalid disk size format",
+		},
+		{
+			name: "invalid tmpfs size",
+			config: ResourceConfig{
+				TmpfsSize: "big",
+			},
+			wantErr: true,
+			errMsg:  "invalid tmpfs size format",
+		},
+		{
+			name: "unknown ulimit",
+			config: ResourceConfig{
+				Ulimits: map[string]string{"files": "1024"},
+			},
+			wantErr: true,
+			errMsg:  "invalid ulimit files",
+		},
+		{
+			name: "malformed ulimit",
+			config: ResourceConfig{
+				Ulimits: map[string]string{"nofile": "1024:2048:4096"},
+			},
+			wantErr: true,
+			errMsg:  "invalid ulimit nofile",
+		},
+		{
+			name: "ulimit soft above hard",
+			config: ResourceConfig{
+				Ulimits: map[string]string{"nofile": "4096:1024"},
+			},
+			wantErr: true,
+			errMsg:  "soft limit cannot exceed hard limit",
+		},
+		{
+			name: "invalid user",
+			config: ResourceConfig{
+				User: "root;rm",
+			},
+			wantErr: true,
+			errMsg:  "invalid user",
+		},
+		{
+			name: "user with too many parts",
+			config: ResourceConfig{
+				User: "1000:1000:1000",
+			},
+			wantErr: true,
+			errMsg:  "invalid user",
+		},
 	}
 
 	for _, tt := range tests {
@@ -315,6 +440,50 @@ func TestAgentsConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "invalid agent configuration",
 		},
+		{
+			name: "podman runtime",
+			config: AgentsConfig{
+				Version: "1.0",
+				Runtime: "podman",
+				Agents: map[string]AgentConfig{
+					"test": {
+						Name:  "test",
+						Image: "test:latest",
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown runtime",
+			config: AgentsConfig{
+				Version: "1.0",
+				Runtime: "containerd",
+				Agents: map[string]AgentConfig{
+					"test": {
+						Name:  "test",
+						Image: "test:latest",
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "invalid container runtime 'containerd'",
+		},
+		{
+			name: "unknown conflict resolution agent",
+			config: AgentsConfig{
+				Version: "1.0",
+				Agents: map[string]AgentConfig{
+					"test": {
+						Name:  "test",
+						Image: "test:latest",
+					},
+				},
+				ConflictResolution: &ConflictResolutionConfig{Agent: "resolver"},
+			},
+			wantErr: true,
+			errMsg:  "conflict resolution agent 'resolver' not found",
+		},
 	}
 
 	for _, tt := range tests {
@@ -706,6 +875,21 @@ func TestValidateMemoryFormat(t *testing.T) {
 			memory:  "1gb",
 			wantErr: false,
 		},
+		{
+			name:    "fractional gigabytes",
+			memory:  "1.5g",
+			wantErr: false,
+		},
+		{
+			name:    "zero",
+			memory:  "0m",
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			memory:  "-1g",
+			wantErr: true,
+		},
 		{
 			name:    "invalid unit",
 			memory:  "512x",
@@ -716,6 +900,11 @@ func TestValidateMemoryFormat(t *testing.T) {
 			memory:  "512",
 			wantErr: true,
 		},
+		{
+			name:    "no number",
+			memory:  "big",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
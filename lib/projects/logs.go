@@ -0,0 +1,128 @@
+package projects
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/transcript"
+)
+
+// GetProjectLogsDir returns the directory holding step logs for a project
+func GetProjectLogsDir(projectID string) (string, error) {
+	projectDir, err := GetProjectDir(projectID)
+	if err != nil {
+		return "", errors.Wrap(errors.ErrUnknown, err, "failed to get project directory")
+	}
+	return filepath.Join(projectDir, "logs"), nil
+}
+
+// StepLogFileName returns the name of the log file for a step started at the given time
+func StepLogFileName(stepID int, startTime time.Time) string {
+	return fmt.Sprintf("step-S%d-%s.log", stepID, startTime.Format("20060102-150405"))
+}
+
+// FindStepLogFile returns the path of the most recent log file written for a
+// step, or an empty string if the step has no log
+func FindStepLogFile(projectID string, stepID int) (string, error) {
+	logsDir, err := GetProjectLogsDir(projectID)
+	if err != nil {
+		return "", err
+	}
+
+	// The trailing dash keeps S1 from matching the logs of S10
+	matches, err := filepath.Glob(filepath.Join(logsDir, fmt.Sprintf("step-S%d-*.log", stepID)))
+	if err != nil {
+		return "", fmt.Errorf("failed to find step log: %w", err)
+	}
+	if len(matches) == 0 {
+		return "", nil
+	}
+
+	// File names end in a sortable timestamp
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+// StepTranscriptPath returns the path of the transcript file stored beside a step log file
+func StepTranscriptPath(logPath string) string {
+	return strings.TrimSuffix(logPath, ".log") + ".transcript.jsonl"
+}
+
+// ReadStepTranscript reads the agent transcript stored beside the most recent
+// log file of a step. It returns nil if the step has no transcript.
+func ReadStepTranscript(projectID string, stepID int) ([]transcript.Entry, error) {
+	logPath, err := FindStepLogFile(projectID, stepID)
+	if err != nil {
+		return nil, err
+	}
+	if logPath == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(StepTranscriptPath(logPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open step transcript: %w", err)
+	}
+	defer file.Close()
+
+	return transcript.Read(file)
+}
+
+// StepLogChunk is a range of a step's log file
+type StepLogChunk struct {
+	Content string
+	// Offset is the byte offset of Content in the log file
+	Offset int64
+	// Size is the size of the whole log file
+	Size int64
+}
+
+// ReadStepLog reads up to limit bytes of a step's log file starting at offset. A
+// negative offset counts back from the end of the file, and a limit of zero or
+// less reads to the end. It returns nil if the step has no log.
+func ReadStepLog(projectID string, stepID int, offset int64, limit int64) (*StepLogChunk, error) {
+	path, err := FindStepLogFile(projectID, stepID)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open step log: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat step log: %w", err)
+	}
+	size := info.Size()
+
+	if offset < 0 {
+		offset = max(size+offset, 0)
+	}
+	offset = min(offset, size)
+	length := size - offset
+	if limit > 0 && limit < length {
+		length = limit
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(io.NewSectionReader(file, offset, length), content); err != nil {
+		return nil, fmt.Errorf("failed to read step log: %w", err)
+	}
+
+	return &StepLogChunk{Content: string(content), Offset: offset, Size: size}, nil
+}
@@ -0,0 +1,61 @@
+package projects
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadStepLog(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	logsDir, err := GetProjectLogsDir("test-project")
+	if err != nil {
+		t.Fatalf("GetProjectLogsDir() error = %v", err)
+	}
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatalf("Failed to create logs directory: %v", err)
+	}
+
+	if chunk, err := ReadStepLog("test-project", 1, 0, 0); err != nil || chunk != nil {
+		t.Fatalf("Expected no log for a step without one, got %v, %v", chunk, err)
+	}
+
+	// Only the latest log of S1 is read, and the log of S10 is ignored
+	started := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := map[string]string{
+		StepLogFileName(1, started):                  "old run\n",
+		StepLogFileName(1, started.Add(time.Minute)): "0123456789",
+		StepLogFileName(10, started.Add(time.Hour)):  "other step\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(logsDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write log: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		offset, limit int64
+		wantContent   string
+		wantOffset    int64
+	}{
+		{"whole log", 0, 0, "0123456789", 0},
+		{"range", 2, 3, "234", 2},
+		{"from the end", -4, 0, "6789", 6},
+		{"before the start", -20, 2, "01", 0},
+		{"past the end", 15, 0, "", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk, err := ReadStepLog("test-project", 1, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("ReadStepLog() error = %v", err)
+			}
+			if chunk.Content != tt.wantContent || chunk.Offset != tt.wantOffset || chunk.Size != 10 {
+				t.Errorf("ReadStepLog() = %+v", chunk)
+			}
+		})
+	}
+}
@@ -10,30 +10,106 @@ import (
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/forge"
+	"github.com/tomyedwab/laforge/lib/git"
 	"github.com/tomyedwab/laforge/lib/steps"
 	"github.com/tomyedwab/laforge/lib/tasks"
 )
 
 // Project represents a LaForge project
 type Project struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description"`
-	RepositoryPath string    `json:"repository_path"`
-	MainBranch     string    `json:"main_branch"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	RepositoryPath string            `json:"repository_path"`
+	MainBranch     string            `json:"main_branch"`
+	MergeStrategy  git.MergeStrategy `json:"merge_strategy"`
+	PullRequest    PullRequestConfig `json:"pull_request"`
+	Budget         BudgetConfig      `json:"budget"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
 }
 
 // ProjectConfig represents the project configuration file
 type ProjectConfig struct {
-	ID             string `json:"id"`
-	Name           string `json:"name"`
-	Description    string `json:"description"`
-	RepositoryPath string `json:"repository_path"`
-	MainBranch     string `json:"main_branch"`
-	CreatedAt      string `json:"created_at"`
-	UpdatedAt      string `json:"updated_at"`
+	ID             string             `json:"id"`
+	Name           string             `json:"name"`
+	Description    string             `json:"description"`
+	RepositoryPath string             `json:"repository_path"`
+	MainBranch     string             `json:"main_branch"`
+	MergeStrategy  string             `json:"merge_strategy,omitempty"`
+	PullRequest    *PullRequestConfig `json:"pull_request,omitempty"`
+	Budget         *BudgetConfig      `json:"budget,omitempty"`
+	CreatedAt      string             `json:"created_at"`
+	UpdatedAt      string             `json:"updated_at"`
+}
+
+// BudgetConfig holds the spending limits for a project in USD. A zero value means
+// there is no limit.
+type BudgetConfig struct {
+	// MaxCostPerDay limits the cost of all steps started on the same calendar day
+	MaxCostPerDay float64 `json:"max_cost_per_day,omitempty"`
+
+	// MaxCostPerStep is the most a single step is expected to spend. A step is only
+	// started if the remaining daily and total budgets cover this amount for it and
+	// for every step still running. It is a reservation made when the step is
+	// leased, not a limit enforced while the agent runs.
+	MaxCostPerStep float64 `json:"max_cost_per_step,omitempty"`
+
+	// MaxTotalCost limits the cost of all steps over the lifetime of the project
+	MaxTotalCost float64 `json:"max_total_cost,omitempty"`
+}
+
+// IsSet returns true if any spending limit is configured
+func (b BudgetConfig) IsSet() bool {
+	return b.MaxCostPerDay > 0 || b.MaxCostPerStep > 0 || b.MaxTotalCost > 0
+}
+
+// PullRequestConfig configures pushing the branch of each successful step to a
+// remote and opening a pull request for it. Nothing is pushed while Remote is empty.
+type PullRequestConfig struct {
+	// Remote is the name of a git remote of the repository, or a repository URL,
+	// that step branches are pushed to
+	Remote string `json:"remote,omitempty"`
+
+	// Forge is the type of service hosting the remote (see forge.Names). Branches
+	// are pushed without opening a pull request if it is empty.
+	Forge string `json:"forge,omitempty"`
+
+	// APIURL is the base URL of the forge's REST API. GitHub defaults to
+	// https://api.github.com.
+	APIURL string `json:"api_url,omitempty"`
+
+	// Repository is the forge repository to open pull requests in, as owner/name
+	Repository string `json:"repository,omitempty"`
+
+	// Token authenticates with the forge's API. It should reference a secret as
+	// ${secret:NAME} rather than hold the token itself.
+	Token string `json:"token,omitempty"`
+
+	// BaseBranch is the branch pull requests target, defaulting to the project's
+	// main branch
+	BaseBranch string `json:"base_branch,omitempty"`
+}
+
+// IsSet returns true if step branches are pushed to a remote
+func (c PullRequestConfig) IsSet() bool {
+	return c.Remote != ""
+}
+
+// Validate checks that a forge is configured completely enough to open pull requests
+func (c PullRequestConfig) Validate() error {
+	if !c.IsSet() {
+		if c.Forge != "" {
+			return fmt.Errorf("a remote is required to open pull requests")
+		}
+		return nil
+	}
+	if c.Forge == "" {
+		return nil
+	}
+	_, err := forge.New(forge.Config{Type: c.Forge, APIURL: c.APIURL, Repository: c.Repository})
+	return err
 }
 
 // GetLaForgeDir returns the LaForge directory path (~/.laforge)
@@ -129,12 +205,13 @@ func CreateProject(projectID string, name string, description string, repository
 		Description:    description,
 		RepositoryPath: repositoryPath,
 		MainBranch:     mainBranch,
+		MergeStrategy:  git.DefaultMergeStrategy,
 		CreatedAt:      now,
 		UpdatedAt:      now,
 	}
 
 	// Create project configuration file
-	if err := createProjectConfig(projectDir, project); err != nil {
+	if err := writeProjectConfig(projectDir, project); err != nil {
 		// Clean up on error
 		os.RemoveAll(projectDir)
 		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to create project configuration")
@@ -164,8 +241,8 @@ func CreateProject(projectID string, name string, description string, repository
 	return project, nil
 }
 
-// createProjectConfig creates the project configuration file
-func createProjectConfig(projectDir string, project *Project) error {
+// writeProjectConfig writes the project configuration file
+func writeProjectConfig(projectDir string, project *Project) error {
 	configPath := filepath.Join(projectDir, "project.json")
 
 	config := ProjectConfig{
@@ -174,9 +251,18 @@ func createProjectConfig(projectDir string, project *Project) error {
 		Description:    project.Description,
 		RepositoryPath: project.RepositoryPath,
 		MainBranch:     project.MainBranch,
+		MergeStrategy:  string(project.MergeStrategy),
 		CreatedAt:      project.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:      project.UpdatedAt.Format(time.RFC3339),
 	}
+	if project.PullRequest.IsSet() {
+		pullRequest := project.PullRequest
+		config.PullRequest = &pullRequest
+	}
+	if project.Budget.IsSet() {
+		budget := project.Budget
+		config.Budget = &budget
+	}
 
 	file, err := os.Create(configPath)
 	if err != nil {
@@ -267,15 +353,105 @@ func LoadProject(projectID string) (*Project, error) {
 		mainBranch = "main"
 	}
 
+	// Projects created before merge strategies were configurable use the default
+	mergeStrategy, err := git.ParseMergeStrategy(config.MergeStrategy)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to parse project configuration")
+	}
+
 	project := &Project{
 		ID:             config.ID,
 		Name:           config.Name,
 		Description:    config.Description,
 		RepositoryPath: config.RepositoryPath,
 		MainBranch:     mainBranch,
+		MergeStrategy:  mergeStrategy,
 		CreatedAt:      createdAt,
 		UpdatedAt:      updatedAt,
 	}
+	if config.PullRequest != nil {
+		project.PullRequest = *config.PullRequest
+	}
+	if config.Budget != nil {
+		project.Budget = *config.Budget
+	}
+
+	return project, nil
+}
+
+// UpdateProjectBudget replaces the spending budget in the project configuration
+func UpdateProjectBudget(projectID string, budget BudgetConfig) (*Project, error) {
+	if budget.MaxCostPerDay < 0 || budget.MaxCostPerStep < 0 || budget.MaxTotalCost < 0 {
+		return nil, errors.NewInvalidInputError("budget limits cannot be negative")
+	}
+
+	project, err := LoadProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	projectDir, err := GetProjectDir(projectID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to get project directory")
+	}
+
+	project.Budget = budget
+	project.UpdatedAt = time.Now()
+	if err := writeProjectConfig(projectDir, project); err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to write project configuration")
+	}
+
+	return project, nil
+}
+
+// UpdateProjectMergeStrategy sets how completed steps are merged into the project's main branch
+func UpdateProjectMergeStrategy(projectID string, strategy string) (*Project, error) {
+	mergeStrategy, err := git.ParseMergeStrategy(strategy)
+	if err != nil {
+		return nil, errors.NewInvalidInputError(err.Error())
+	}
+
+	project, err := LoadProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	projectDir, err := GetProjectDir(projectID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to get project directory")
+	}
+
+	project.MergeStrategy = mergeStrategy
+	project.UpdatedAt = time.Now()
+	if err := writeProjectConfig(projectDir, project); err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to write project configuration")
+	}
+
+	return project, nil
+}
+
+// UpdateProjectPullRequest replaces the pull request configuration of the
+// project. An empty configuration stops pushing step branches.
+func UpdateProjectPullRequest(projectID string, pullRequest PullRequestConfig) (*Project, error) {
+	if err := pullRequest.Validate(); err != nil {
+		return nil, errors.NewInvalidInputError(err.Error())
+	}
+
+	project, err := LoadProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	projectDir, err := GetProjectDir(projectID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to get project directory")
+	}
+
+	project.PullRequest = pullRequest
+	project.UpdatedAt = time.Now()
+	if err := writeProjectConfig(projectDir, project); err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to write project configuration")
+	}
 
 	return project, nil
 }
@@ -318,18 +494,9 @@ func OpenProjectTaskDatabase(projectID string) (*sql.DB, error) {
 		return nil, err
 	}
 
-	// Temporarily set the environment variable
-	oldDBPath := os.Getenv("TASKS_DB_PATH")
-	os.Setenv("TASKS_DB_PATH", dbPath)
-	defer func() {
-		if oldDBPath != "" {
-			os.Setenv("TASKS_DB_PATH", oldDBPath)
-		} else {
-			os.Unsetenv("TASKS_DB_PATH")
-		}
-	}()
-
-	db, err := tasks.InitDB()
+	// Pass the path explicitly rather than through TASKS_DB_PATH, since the
+	// steps of a parallel run open task databases concurrently
+	db, err := tasks.InitDBAt(dbPath)
 	if err != nil {
 		return nil, errors.Wrap(errors.ErrDatabaseConnectionFailed, err, "failed to open project task database")
 	}
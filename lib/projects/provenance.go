@@ -0,0 +1,162 @@
+package projects
+
+import (
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/git"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+// StepSourceStepRecord links a commit to a step that recorded it as its commit
+// or merge commit, such as the squash commit of a step, which has neither a
+// Step-id note nor an Automerge message
+const StepSourceStepRecord = "step_record"
+
+// CommitStep links a commit to the step that made it
+type CommitStep struct {
+	Commit *git.CommitInfo
+	// StepID is the step that made the commit, 0 if it was made outside LaForge
+	StepID int
+	// Source is how the commit was linked to the step: git.StepSourceNote,
+	// git.StepSourceMergeMessage or StepSourceStepRecord
+	Source string
+	// Step is the step's record, nil if the step is not in the step database
+	Step *steps.Step
+	// TaskIDs lists the tasks leased in the step
+	TaskIDs []int
+}
+
+// BlameRange is a run of consecutive lines last changed by the same commit
+type BlameRange struct {
+	StartLine  int
+	EndLine    int
+	CommitStep *CommitStep
+}
+
+// commitStepResolver links commits of a project's repository to its steps,
+// caching the result for each commit
+type commitStepResolver struct {
+	project       *Project
+	stepsByID     map[int]*steps.Step
+	stepsByCommit map[string]*steps.Step
+	stepTasks     map[int][]int
+	resolved      map[string]*CommitStep
+}
+
+// newCommitStepResolver loads the project and its step records
+func newCommitStepResolver(projectID string) (*commitStepResolver, error) {
+	project, err := LoadProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if !git.IsGitRepository(project.RepositoryPath) {
+		return nil, errors.Newf(errors.ErrGitRepositoryNotFound, "repository path '%s' is not a git repository", project.RepositoryPath)
+	}
+
+	sdb, err := OpenProjectStepDatabase(projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+
+	allSteps, err := sdb.ListSteps(projectID, false)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to list steps")
+	}
+	stepTasks, err := sdb.ListStepTasks(projectID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to list step tasks")
+	}
+
+	r := &commitStepResolver{
+		project:       project,
+		stepsByID:     make(map[int]*steps.Step),
+		stepsByCommit: make(map[string]*steps.Step),
+		stepTasks:     stepTasks,
+		resolved:      make(map[string]*CommitStep),
+	}
+	for _, step := range allSteps {
+		r.stepsByID[step.ID] = step
+		if step.CommitSHAAfter != "" && step.CommitSHAAfter != step.CommitSHABefore {
+			r.stepsByCommit[step.CommitSHAAfter] = step
+		}
+	}
+	// A squash that had nothing to commit records the main branch commit it
+	// found, which belongs to an earlier step, so step commits take precedence
+	// and the earliest step recording a merge commit wins
+	for _, step := range allSteps {
+		if _, ok := r.stepsByCommit[step.MergeCommitSHA]; step.MergeCommitSHA != "" && !ok {
+			r.stepsByCommit[step.MergeCommitSHA] = step
+		}
+	}
+	return r, nil
+}
+
+// resolve links a commit to the step that made it
+func (r *commitStepResolver) resolve(commit string) (*CommitStep, error) {
+	if commitStep, ok := r.resolved[commit]; ok {
+		return commitStep, nil
+	}
+
+	info, err := git.GetCommitInfo(r.project.RepositoryPath, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	commitStep := &CommitStep{Commit: info}
+	commitStep.StepID, commitStep.Source = info.StepID()
+	if commitStep.StepID != 0 {
+		commitStep.Step = r.stepsByID[commitStep.StepID]
+	} else if step, ok := r.stepsByCommit[info.SHA]; ok {
+		commitStep.StepID = step.ID
+		commitStep.Source = StepSourceStepRecord
+		commitStep.Step = step
+	}
+	if commitStep.StepID != 0 {
+		commitStep.TaskIDs = r.stepTasks[commitStep.StepID]
+	}
+
+	r.resolved[commit] = commitStep
+	r.resolved[info.SHA] = commitStep
+	return commitStep, nil
+}
+
+// FindCommitStep returns the step that made a commit of the project's
+// repository. The commit may be any revision git understands.
+func FindCommitStep(projectID string, commit string) (*CommitStep, error) {
+	r, err := newCommitStepResolver(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return r.resolve(commit)
+}
+
+// BlameFile returns the steps that last changed each line of a file on the
+// project's main branch, grouped into runs of lines changed by the same commit.
+// A startLine of 0 blames the whole file, and an endLine of 0 blames from
+// startLine to the end of the file.
+func BlameFile(projectID string, path string, startLine int, endLine int) ([]BlameRange, error) {
+	r, err := newCommitStepResolver(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := git.Blame(r.project.RepositoryPath, r.project.MainBranch, path, startLine, endLine)
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []BlameRange
+	for _, line := range lines {
+		last := len(ranges) - 1
+		if last >= 0 && ranges[last].CommitStep.Commit.SHA == line.SHA && ranges[last].EndLine == line.Line-1 {
+			ranges[last].EndLine = line.Line
+			continue
+		}
+		commitStep, err := r.resolve(line.SHA)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, BlameRange{StartLine: line.Line, EndLine: line.Line, CommitStep: commitStep})
+	}
+	return ranges, nil
+}
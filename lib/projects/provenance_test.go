@@ -0,0 +1,73 @@
+package projects
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/git"
+)
+
+func TestBlameFile(t *testing.T) {
+	projectID := "blame-test"
+	repoDir := setupRollbackProject(t, projectID)
+	sha0 := runGit(t, repoDir, "rev-parse", "HEAD")
+
+	// Step 1 commits on its branch with a Step-id note and is merged with an
+	// Automerge message
+	runGit(t, repoDir, "checkout", "-b", "step-S1")
+	step1Commit := writeAndCommit(t, repoDir, "file1.txt", "initial\nstep 1\n", "Step 1")
+	step1 := recordStep(t, projectID, sha0, step1Commit)
+	runGit(t, repoDir, "notes", "add", "-m", fmt.Sprintf("Step-id: S%d", step1), step1Commit)
+	runGit(t, repoDir, "checkout", "main")
+	runGit(t, repoDir, "merge", "--no-ff", "step-S1", "-m", fmt.Sprintf("Automerge step-S%d into main", step1))
+	mergeCommit := runGit(t, repoDir, "rev-parse", "HEAD")
+
+	// Step 2 is squashed, so only its step record links it to the commit
+	step2 := recordStep(t, projectID, mergeCommit, "0123456789abcdef")
+	squashCommit := writeAndCommit(t, repoDir, "file1.txt", "initial\nstep 1\nstep 2\n", "Add step 2 line")
+	sdb, err := OpenProjectStepDatabase(projectID)
+	if err != nil {
+		t.Fatalf("Failed to open step database: %v", err)
+	}
+	sdb.UpdateStepMerge(step2, "squash", squashCommit)
+	sdb.RecordStepTasks(step2, []int{3, 4})
+	sdb.Close()
+
+	ranges, err := BlameFile(projectID, "file1.txt", 0, 0)
+	if err != nil {
+		t.Fatalf("BlameFile failed: %v", err)
+	}
+	if len(ranges) != 3 {
+		t.Fatalf("Expected 3 ranges, got %+v", ranges)
+	}
+	if got := ranges[0].CommitStep; got.Commit.SHA != sha0 || got.StepID != 0 || got.Step != nil {
+		t.Errorf("Expected line 1 to come from the initial commit outside any step, got %+v", got)
+	}
+	if got := ranges[1].CommitStep; got.StepID != step1 || got.Source != git.StepSourceNote || got.Step == nil || got.Step.AgentConfigName != "default" {
+		t.Errorf("Expected line 2 to come from S%d via its note, got %+v", step1, got)
+	}
+	if got := ranges[2].CommitStep; got.StepID != step2 || got.Source != StepSourceStepRecord || len(got.TaskIDs) != 2 {
+		t.Errorf("Expected line 3 to come from S%d via its merge commit, got %+v", step2, got)
+	}
+
+	ranges, err = BlameFile(projectID, "file1.txt", 2, 2)
+	if err != nil {
+		t.Fatalf("BlameFile failed: %v", err)
+	}
+	if len(ranges) != 1 || ranges[0].StartLine != 2 || ranges[0].EndLine != 2 || ranges[0].CommitStep.StepID != step1 {
+		t.Errorf("Expected only line 2 from S%d, got %+v", step1, ranges)
+	}
+
+	commitStep, err := FindCommitStep(projectID, mergeCommit[:10])
+	if err != nil {
+		t.Fatalf("FindCommitStep failed: %v", err)
+	}
+	if commitStep.Commit.SHA != mergeCommit || commitStep.StepID != step1 || commitStep.Source != git.StepSourceMergeMessage {
+		t.Errorf("Expected the merge commit to map to S%d via its message, got %+v", step1, commitStep)
+	}
+
+	if _, err := FindCommitStep(projectID, "no-such-commit"); !errors.IsErrorType(err, errors.ErrNotFound) {
+		t.Errorf("Expected a not found error for an unknown commit, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package projects
+
+import (
+	"fmt"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/git"
+	"github.com/tomyedwab/laforge/lib/steps"
+)
+
+// RollbackPlan describes the changes a rollback to a given step will make
+type RollbackPlan struct {
+	Project *Project
+	// TargetStep is the first step that will be rolled back
+	TargetStep *steps.Step
+	// StepsToDeactivate lists the active steps that will be marked inactive (ID >= target)
+	StepsToDeactivate []*steps.Step
+	// ResetCommitSHA is the commit the repository's main branch will be reset to
+	ResetCommitSHA string
+	// HasTaskSnapshot is true if the task database can be restored to its pre-step state
+	HasTaskSnapshot bool
+}
+
+// RollbackResult describes the outcome of a completed rollback
+type RollbackResult struct {
+	TargetStepID         int    `json:"target_step_id"`
+	DeactivatedStepIDs   []int  `json:"deactivated_step_ids"`
+	ResetCommitSHA       string `json:"reset_commit_sha"`
+	TaskDatabaseRestored bool   `json:"task_database_restored"`
+}
+
+// PlanRollback validates that the project can be rolled back to the state before the
+// given step and returns the plan without changing anything
+func PlanRollback(projectID string, stepID int) (*RollbackPlan, error) {
+	project, err := LoadProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	sdb, err := OpenProjectStepDatabase(projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+
+	target, err := sdb.GetStep(stepID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to get step")
+	}
+	if target == nil || target.ProjectID != projectID {
+		return nil, errors.NewNotFoundError("step", fmt.Sprintf("S%d", stepID))
+	}
+	if !target.Active {
+		return nil, errors.NewInvalidInputError(fmt.Sprintf("step S%d has already been rolled back", stepID))
+	}
+
+	if err := checkNoRunningSteps(sdb, projectID); err != nil {
+		return nil, err
+	}
+
+	toDeactivate, err := listStepsToDeactivate(sdb, projectID, stepID)
+	if err != nil {
+		return nil, err
+	}
+
+	hasSnapshot, err := TaskDatabaseSnapshotExists(projectID, stepID)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to check task database snapshot")
+	}
+
+	return &RollbackPlan{
+		Project:           project,
+		TargetStep:        target,
+		StepsToDeactivate: toDeactivate,
+		ResetCommitSHA:    target.CommitSHABefore,
+		HasTaskSnapshot:   hasSnapshot,
+	}, nil
+}
+
+// ExecuteRollback applies a rollback plan: it resets the repository's main branch,
+// restores the task database snapshot and deactivates the rolled back steps.
+// Running steps are checked for again, since one may have been leased after the
+// plan was made.
+func ExecuteRollback(plan *RollbackPlan) (*RollbackResult, error) {
+	repoDir := plan.Project.RepositoryPath
+
+	if !git.IsGitRepository(repoDir) {
+		return nil, errors.Newf(errors.ErrGitRepositoryNotFound, "repository path '%s' is not a git repository", repoDir)
+	}
+
+	currentBranch, err := git.GetCurrentBranch(repoDir)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrGitOperationFailed, err, "failed to get current branch")
+	}
+	if currentBranch != plan.Project.MainBranch {
+		return nil, errors.NewInvalidInputError(fmt.Sprintf("repository must be on branch '%s' to roll back (currently on '%s')", plan.Project.MainBranch, currentBranch))
+	}
+
+	hasChanges, err := git.HasUncommittedChanges(repoDir)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrGitOperationFailed, err, "failed to check repository state")
+	}
+	if hasChanges {
+		return nil, errors.NewInvalidInputError("repository has uncommitted changes; commit or stash them before rolling back")
+	}
+
+	sdb, err := OpenProjectStepDatabase(plan.Project.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer sdb.Close()
+
+	if err := checkNoRunningSteps(sdb, plan.Project.ID); err != nil {
+		return nil, err
+	}
+	toDeactivate, err := listStepsToDeactivate(sdb, plan.Project.ID, plan.TargetStep.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := git.ResetToCommit(repoDir, plan.ResetCommitSHA); err != nil {
+		return nil, errors.Wrap(errors.ErrGitOperationFailed, err, "failed to reset repository")
+	}
+
+	result := &RollbackResult{
+		TargetStepID:       plan.TargetStep.ID,
+		DeactivatedStepIDs: []int{},
+		ResetCommitSHA:     plan.ResetCommitSHA,
+	}
+
+	if plan.HasTaskSnapshot {
+		if err := RestoreTaskDatabaseSnapshot(plan.Project.ID, plan.TargetStep.ID); err != nil {
+			return nil, err
+		}
+		result.TaskDatabaseRestored = true
+	}
+
+	if err := sdb.DeactivateStepsFromID(plan.TargetStep.ID); err != nil {
+		return nil, errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to deactivate steps")
+	}
+
+	for _, step := range toDeactivate {
+		result.DeactivatedStepIDs = append(result.DeactivatedStepIDs, step.ID)
+	}
+
+	// Deactivated steps cannot be rolled back again, so their snapshots are not
+	// needed. A snapshot left behind only takes up space, so this doesn't fail
+	// the rollback.
+	_ = RemoveTaskDatabaseSnapshots(plan.Project.ID, result.DeactivatedStepIDs)
+
+	return result, nil
+}
+
+// checkNoRunningSteps refuses to roll back while a step is running, since the
+// step would write its results on top of the rolled back state
+func checkNoRunningSteps(sdb *steps.StepDatabase, projectID string) error {
+	running, err := sdb.ListRunningSteps(projectID)
+	if err != nil {
+		return errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to list running steps")
+	}
+	if len(running) > 0 {
+		return errors.NewStepInProgressError(running[0].ID)
+	}
+	return nil
+}
+
+// listStepsToDeactivate returns the active steps from the given step onwards,
+// newest first
+func listStepsToDeactivate(sdb *steps.StepDatabase, projectID string, stepID int) ([]*steps.Step, error) {
+	activeSteps, err := sdb.ListSteps(projectID, true)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to list steps")
+	}
+
+	var toDeactivate []*steps.Step
+	for i := len(activeSteps) - 1; i >= 0; i-- {
+		if activeSteps[i].ID >= stepID {
+			toDeactivate = append(toDeactivate, activeSteps[i])
+		}
+	}
+	return toDeactivate, nil
+}
+
+// RollbackToStep reverts the project to the state before the given step ran
+func RollbackToStep(projectID string, stepID int) (*RollbackResult, error) {
+	plan, err := PlanRollback(projectID, stepID)
+	if err != nil {
+		return nil, err
+	}
+	return ExecuteRollback(plan)
+}
@@ -0,0 +1,286 @@
+package projects
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+	"github.com/tomyedwab/laforge/lib/steps"
+	"github.com/tomyedwab/laforge/lib/tasks"
+)
+
+// setupRollbackProject creates a project in a temporary HOME backed by a git
+// repository with a single commit, and returns the repository path
+func setupRollbackProject(t *testing.T, projectID string) string {
+	t.Helper()
+
+	if err := exec.Command("git", "--version").Run(); err != nil {
+		t.Skip("git is not available")
+	}
+
+	t.Setenv("HOME", t.TempDir())
+
+	repoDir := t.TempDir()
+	runGit(t, repoDir, "init", "-b", "main")
+	runGit(t, repoDir, "config", "user.name", "Test User")
+	runGit(t, repoDir, "config", "user.email", "test@example.com")
+	writeAndCommit(t, repoDir, "file1.txt", "initial\n", "Initial commit")
+
+	if _, err := CreateProject(projectID, projectID, "", repoDir, "main"); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+
+	return repoDir
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\nOutput: %s", strings.Join(args, " "), err, string(output))
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func writeAndCommit(t *testing.T, dir, name, content, message string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	runGit(t, dir, "add", name)
+	runGit(t, dir, "commit", "-m", message)
+	return runGit(t, dir, "rev-parse", "HEAD")
+}
+
+// recordStep creates a finalized step record with the given commits
+func recordStep(t *testing.T, projectID, before, after string) int {
+	t.Helper()
+	sdb, err := OpenProjectStepDatabase(projectID)
+	if err != nil {
+		t.Fatalf("Failed to open step database: %v", err)
+	}
+	defer sdb.Close()
+
+	stepID, err := sdb.CreateStep(&steps.Step{
+		Active:          true,
+		CommitSHABefore: before,
+		AgentConfigName: "default",
+		StartTime:       time.Now(),
+		ProjectID:       projectID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+	if after != "" {
+		if err := sdb.UpdateStep(stepID, after, time.Now(), 10, 0, steps.TokenUsage{}); err != nil {
+			t.Fatalf("Failed to update step: %v", err)
+		}
+	}
+	return stepID
+}
+
+func TestRollbackToStep(t *testing.T) {
+	projectID := "rollback-test"
+	repoDir := setupRollbackProject(t, projectID)
+
+	sha0 := runGit(t, repoDir, "rev-parse", "HEAD")
+
+	// Step 1 adds a task and a file
+	step1 := recordStep(t, projectID, sha0, "")
+	if err := SnapshotTaskDatabase(projectID, step1); err != nil {
+		t.Fatalf("Failed to snapshot task database: %v", err)
+	}
+	db, err := OpenProjectTaskDatabase(projectID)
+	if err != nil {
+		t.Fatalf("Failed to open task database: %v", err)
+	}
+	if _, err := tasks.AddTask(db, "Task from step 1", nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+	db.Close()
+	sha1 := writeAndCommit(t, repoDir, "file2.txt", "step 1\n", "Step 1")
+	finalizeStep(t, projectID, step1, sha1)
+
+	// Step 2 adds another task and file
+	step2 := recordStep(t, projectID, sha1, "")
+	if err := SnapshotTaskDatabase(projectID, step2); err != nil {
+		t.Fatalf("Failed to snapshot task database: %v", err)
+	}
+	db, err = OpenProjectTaskDatabase(projectID)
+	if err != nil {
+		t.Fatalf("Failed to open task database: %v", err)
+	}
+	if _, err := tasks.AddTask(db, "Task from step 2", nil); err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+	db.Close()
+	sha2 := writeAndCommit(t, repoDir, "file3.txt", "step 2\n", "Step 2")
+	finalizeStep(t, projectID, step2, sha2)
+
+	plan, err := PlanRollback(projectID, step2)
+	if err != nil {
+		t.Fatalf("PlanRollback failed: %v", err)
+	}
+	if len(plan.StepsToDeactivate) != 1 || plan.StepsToDeactivate[0].ID != step2 {
+		t.Errorf("Expected only S%d to be deactivated, got %v", step2, plan.StepsToDeactivate)
+	}
+	if !plan.HasTaskSnapshot {
+		t.Error("Expected plan to find the task database snapshot")
+	}
+
+	result, err := ExecuteRollback(plan)
+	if err != nil {
+		t.Fatalf("ExecuteRollback failed: %v", err)
+	}
+	if !result.TaskDatabaseRestored {
+		t.Error("Expected task database to be restored")
+	}
+
+	// Repository should be back at step 1's result
+	if head := runGit(t, repoDir, "rev-parse", "HEAD"); head != sha1 {
+		t.Errorf("Expected HEAD %s after rollback, got %s", sha1, head)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "file3.txt")); !os.IsNotExist(err) {
+		t.Error("file3.txt should not exist after rollback")
+	}
+
+	// Task database should only contain the task from step 1
+	db, err = OpenProjectTaskDatabase(projectID)
+	if err != nil {
+		t.Fatalf("Failed to open task database: %v", err)
+	}
+	defer db.Close()
+	taskList, err := tasks.ListTasks(db)
+	if err != nil {
+		t.Fatalf("Failed to list tasks: %v", err)
+	}
+	if len(taskList) != 1 || taskList[0].Title != "Task from step 1" {
+		t.Errorf("Expected only the step 1 task after rollback, got %v", taskList)
+	}
+
+	// Step 2 should be inactive and cannot be rolled back twice
+	sdb, err := OpenProjectStepDatabase(projectID)
+	if err != nil {
+		t.Fatalf("Failed to open step database: %v", err)
+	}
+	defer sdb.Close()
+	step, err := sdb.GetStep(step2)
+	if err != nil {
+		t.Fatalf("Failed to get step: %v", err)
+	}
+	if step.Active {
+		t.Error("Step 2 should be inactive after rollback")
+	}
+	if _, err := PlanRollback(projectID, step2); !errors.IsErrorType(err, errors.ErrInvalidInput) {
+		t.Errorf("Expected invalid input error when rolling back twice, got %v", err)
+	}
+
+	// Only the snapshot of the step that is still active is kept
+	if exists, _ := TaskDatabaseSnapshotExists(projectID, step2); exists {
+		t.Error("Snapshot of the rolled back step should be removed")
+	}
+	if exists, _ := TaskDatabaseSnapshotExists(projectID, step1); !exists {
+		t.Error("Snapshot of the active step should be kept")
+	}
+}
+
+func TestRollbackRefusesWhileStepRunning(t *testing.T) {
+	projectID := "rollback-running-test"
+	repoDir := setupRollbackProject(t, projectID)
+
+	sha0 := runGit(t, repoDir, "rev-parse", "HEAD")
+	step1 := recordStep(t, projectID, sha0, sha0)
+	recordStep(t, projectID, sha0, "") // still running
+
+	_, err := PlanRollback(projectID, step1)
+	if !errors.IsErrorType(err, errors.ErrStepInProgress) {
+		t.Errorf("Expected step in progress error, got %v", err)
+	}
+}
+
+func TestExecuteRollbackRefusesStepLeasedAfterPlan(t *testing.T) {
+	projectID := "rollback-leased-test"
+	repoDir := setupRollbackProject(t, projectID)
+
+	sha0 := runGit(t, repoDir, "rev-parse", "HEAD")
+	sha1 := writeAndCommit(t, repoDir, "file2.txt", "step 1\n", "Step 1")
+	step1 := recordStep(t, projectID, sha0, sha1)
+
+	plan, err := PlanRollback(projectID, step1)
+	if err != nil {
+		t.Fatalf("PlanRollback failed: %v", err)
+	}
+
+	// A step is leased while the rollback waits for confirmation
+	recordStep(t, projectID, sha1, "")
+
+	if _, err := ExecuteRollback(plan); !errors.IsErrorType(err, errors.ErrStepInProgress) {
+		t.Errorf("Expected step in progress error, got %v", err)
+	}
+	if head := runGit(t, repoDir, "rev-parse", "HEAD"); head != sha1 {
+		t.Errorf("Repository should not be reset while a step is running, HEAD is %s", head)
+	}
+}
+
+func TestSnapshotTaskDatabaseKeepsRecentSnapshots(t *testing.T) {
+	projectID := "snapshot-retention-test"
+	setupRollbackProject(t, projectID)
+
+	saved := maxTaskDatabaseSnapshots
+	maxTaskDatabaseSnapshots = 2
+	t.Cleanup(func() { maxTaskDatabaseSnapshots = saved })
+
+	for stepID := 1; stepID <= 3; stepID++ {
+		if err := SnapshotTaskDatabase(projectID, stepID); err != nil {
+			t.Fatalf("Failed to snapshot task database for S%d: %v", stepID, err)
+		}
+	}
+
+	for stepID, want := range map[int]bool{1: false, 2: true, 3: true} {
+		exists, err := TaskDatabaseSnapshotExists(projectID, stepID)
+		if err != nil {
+			t.Fatalf("Failed to check snapshot for S%d: %v", stepID, err)
+		}
+		if exists != want {
+			t.Errorf("Snapshot for S%d exists = %v, want %v", stepID, exists, want)
+		}
+	}
+}
+
+func TestRollbackRequiresCleanRepository(t *testing.T) {
+	projectID := "rollback-dirty-test"
+	repoDir := setupRollbackProject(t, projectID)
+
+	sha0 := runGit(t, repoDir, "rev-parse", "HEAD")
+	sha1 := writeAndCommit(t, repoDir, "file2.txt", "step 1\n", "Step 1")
+	step1 := recordStep(t, projectID, sha0, sha1)
+
+	if err := os.WriteFile(filepath.Join(repoDir, "scratch.txt"), []byte("wip\n"), 0644); err != nil {
+		t.Fatalf("Failed to write scratch file: %v", err)
+	}
+
+	if _, err := RollbackToStep(projectID, step1); err == nil {
+		t.Fatal("Expected rollback to fail with uncommitted changes")
+	}
+	if head := runGit(t, repoDir, "rev-parse", "HEAD"); head != sha1 {
+		t.Errorf("Repository should not be reset when rollback fails, HEAD is %s", head)
+	}
+}
+
+func finalizeStep(t *testing.T, projectID string, stepID int, after string) {
+	t.Helper()
+	sdb, err := OpenProjectStepDatabase(projectID)
+	if err != nil {
+		t.Fatalf("Failed to open step database: %v", err)
+	}
+	defer sdb.Close()
+	if err := sdb.UpdateStep(stepID, after, time.Now(), 10, 0, steps.TokenUsage{}); err != nil {
+		t.Fatalf("Failed to update step: %v", err)
+	}
+}
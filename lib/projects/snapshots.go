@@ -0,0 +1,189 @@
+package projects
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/tomyedwab/laforge/lib/errors"
+)
+
+// maxTaskDatabaseSnapshots is the number of task database snapshots kept for a
+// project. Older steps can still be rolled back, but their task state is not
+// restored.
+var maxTaskDatabaseSnapshots = 50
+
+// GetProjectSnapshotsDir returns the directory holding task database snapshots for a project
+func GetProjectSnapshotsDir(projectID string) (string, error) {
+	projectDir, err := GetProjectDir(projectID)
+	if err != nil {
+		return "", errors.Wrap(errors.ErrUnknown, err, "failed to get project directory")
+	}
+	return filepath.Join(projectDir, "snapshots"), nil
+}
+
+// GetTaskDatabaseSnapshotPath returns the path of the task database snapshot taken
+// before the given step started
+func GetTaskDatabaseSnapshotPath(projectID string, stepID int) (string, error) {
+	snapshotsDir, err := GetProjectSnapshotsDir(projectID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(snapshotsDir, fmt.Sprintf("tasks-S%d.db", stepID)), nil
+}
+
+// SnapshotTaskDatabase saves a copy of the project's task database as it is before
+// the given step runs, so that the task state can be restored on rollback. Only
+// the snapshots of the most recent steps are kept.
+func SnapshotTaskDatabase(projectID string, stepID int) error {
+	snapshotPath, err := GetTaskDatabaseSnapshotPath(projectID, stepID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(snapshotPath), 0755); err != nil {
+		return errors.Wrapf(errors.ErrPermissionDenied, err, "failed to create snapshots directory '%s'", filepath.Dir(snapshotPath))
+	}
+
+	// VACUUM INTO refuses to overwrite an existing file
+	if err := os.Remove(snapshotPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(errors.ErrUnknown, err, "failed to remove stale task database snapshot")
+	}
+
+	db, err := OpenProjectTaskDatabase(projectID)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// VACUUM INTO produces a consistent copy even if other connections are writing
+	if _, err := db.Exec("VACUUM INTO ?", snapshotPath); err != nil {
+		return errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to snapshot task database")
+	}
+
+	return pruneTaskDatabaseSnapshots(projectID)
+}
+
+// listTaskDatabaseSnapshots returns the IDs of the steps with a task database
+// snapshot, oldest first
+func listTaskDatabaseSnapshots(projectID string) ([]int, error) {
+	snapshotsDir, err := GetProjectSnapshotsDir(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(snapshotsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(errors.ErrUnknown, err, "failed to list task database snapshots")
+	}
+
+	var stepIDs []int
+	for _, entry := range entries {
+		var stepID int
+		if _, err := fmt.Sscanf(entry.Name(), "tasks-S%d.db", &stepID); err != nil {
+			continue
+		}
+		if entry.Name() == fmt.Sprintf("tasks-S%d.db", stepID) {
+			stepIDs = append(stepIDs, stepID)
+		}
+	}
+	sort.Ints(stepIDs)
+	return stepIDs, nil
+}
+
+// pruneTaskDatabaseSnapshots removes all but the most recent task database snapshots
+func pruneTaskDatabaseSnapshots(projectID string) error {
+	stepIDs, err := listTaskDatabaseSnapshots(projectID)
+	if err != nil {
+		return err
+	}
+	if len(stepIDs) <= maxTaskDatabaseSnapshots {
+		return nil
+	}
+	return RemoveTaskDatabaseSnapshots(projectID, stepIDs[:len(stepIDs)-maxTaskDatabaseSnapshots])
+}
+
+// RemoveTaskDatabaseSnapshots deletes the task database snapshots of the given
+// steps. Steps without a snapshot are skipped.
+func RemoveTaskDatabaseSnapshots(projectID string, stepIDs []int) error {
+	for _, stepID := range stepIDs {
+		snapshotPath, err := GetTaskDatabaseSnapshotPath(projectID, stepID)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(snapshotPath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(errors.ErrUnknown, err, "failed to remove task database snapshot for S%d", stepID)
+		}
+	}
+	return nil
+}
+
+// TaskDatabaseSnapshotExists checks if a task database snapshot exists for the given step
+func TaskDatabaseSnapshotExists(projectID string, stepID int) (bool, error) {
+	snapshotPath, err := GetTaskDatabaseSnapshotPath(projectID, stepID)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(snapshotPath)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check task database snapshot: %w", err)
+}
+
+// RestoreTaskDatabaseSnapshot replaces the project's task database with the snapshot
+// taken before the given step started
+func RestoreTaskDatabaseSnapshot(projectID string, stepID int) error {
+	snapshotPath, err := GetTaskDatabaseSnapshotPath(projectID, stepID)
+	if err != nil {
+		return err
+	}
+
+	dbPath, err := GetProjectTaskDatabase(projectID)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(snapshotPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.NewNotFoundError("task database snapshot", fmt.Sprintf("S%d", stepID))
+		}
+		return errors.Wrap(errors.ErrUnknown, err, "failed to open task database snapshot")
+	}
+	defer src.Close()
+
+	// Copy to a temporary file first and rename it into place so the task database
+	// is never left half-written
+	tmpPath := dbPath + ".restore"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrap(errors.ErrPermissionDenied, err, "failed to create temporary task database")
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to copy task database snapshot")
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to write temporary task database")
+	}
+
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(errors.ErrDatabaseOperationFailed, err, "failed to replace task database")
+	}
+
+	return nil
+}
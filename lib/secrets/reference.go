@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// referencePattern matches a ${secret:NAME} reference in an agent configuration value
+var referencePattern = regexp.MustCompile(`\$\{secret:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// References returns the sorted names of the secrets referenced by an environment
+func References(env map[string]string) []string {
+	seen := map[string]bool{}
+	for _, value := range env {
+		for _, match := range referencePattern.FindAllStringSubmatch(value, -1) {
+			seen[match[1]] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasReferences returns true if any value in an environment references a secret
+func HasReferences(env map[string]string) bool {
+	for _, value := range env {
+		if referencePattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the value of a secret by name
+type Lookup func(name string) (string, bool)
+
+// ResolveEnvironment substitutes secret references in an environment. Variables
+// without references are returned in plain; variables with references are
+// returned in secret with the values substituted, so they can be passed to the
+// container without appearing on its command line. values lists every secret
+// value that was substituted, for redacting output.
+func ResolveEnvironment(env map[string]string, lookup Lookup) (plain, secret map[string]string, values []string, err error) {
+	plain = map[string]string{}
+	secret = map[string]string{}
+
+	missing := map[string]bool{}
+	used := map[string]bool{}
+	for key, value := range env {
+		if !referencePattern.MatchString(value) {
+			plain[key] = value
+			continue
+		}
+		secret[key] = referencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+			name := referencePattern.FindStringSubmatch(reference)[1]
+			resolved, ok := lookup(name)
+			if !ok {
+				missing[name] = true
+				return ""
+			}
+			if !used[resolved] {
+				used[resolved] = true
+				values = append(values, resolved)
+			}
+			return resolved
+		})
+	}
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, nil, nil, fmt.Errorf("undefined secrets: %s (set them with 'laforge secret set')", strings.Join(names, ", "))
+	}
+	sort.Strings(values)
+	return plain, secret, values, nil
+}
+
+// FormatEnvFile formats environment variables as a file that can be sourced by
+// a POSIX shell. Values are single-quoted so they are never expanded.
+func FormatEnvFile(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	for _, key := range keys {
+		value := strings.ReplaceAll(env[key], "'", `'\''`)
+		fmt.Fprintf(&builder, "%s='%s'\n", key, value)
+	}
+	return builder.String()
+}
@@ -0,0 +1,209 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/tomyedwab/laforge/lib/projects"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnvVar supplies the store passphrase without prompting
+const PassphraseEnvVar = "LAFORGE_SECRETS_PASSPHRASE"
+
+// storeVersion is the version of the encrypted store file format
+const storeVersion = 1
+
+// scrypt parameters for deriving the store key from the passphrase
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// ErrInvalidPassphrase is returned when the store cannot be decrypted with the
+// given passphrase
+var ErrInvalidPassphrase = errors.New("invalid secrets passphrase")
+
+// namePattern matches valid secret names, which are also valid environment variable names
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// storeFile is the on-disk format of the store. The secrets are encrypted with
+// AES-256-GCM using a key derived from the passphrase with scrypt.
+type storeFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Store is a passphrase-encrypted set of named secrets
+type Store struct {
+	path       string
+	passphrase string
+	values     map[string]string
+}
+
+// GetStorePath returns the path of the secrets store (~/.laforge/secrets/secrets.enc)
+func GetStorePath() (string, error) {
+	laforgeDir, err := projects.GetLaForgeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(laforgeDir, "secrets", "secrets.enc"), nil
+}
+
+// StoreExists returns true if the store at path has been created
+func StoreExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Open decrypts the store at path. A store that does not exist yet is empty,
+// and is created with the passphrase when first saved.
+func Open(path, passphrase string) (*Store, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("secrets passphrase cannot be empty")
+	}
+
+	store := &Store{path: path, passphrase: passphrase, values: map[string]string{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets store: %w", err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets store: %w", err)
+	}
+	if file.Version != storeVersion || file.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported secrets store version %d (%s)", file.Version, file.KDF)
+	}
+
+	gcm, err := newCipher(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+	if err := json.Unmarshal(plaintext, &store.values); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets: %w", err)
+	}
+
+	return store, nil
+}
+
+// newCipher derives the store key from the passphrase and salt
+func newCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive secrets key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Save encrypts the store and writes it, readable only by the current user
+func (s *Store) Save() error {
+	plaintext, err := json.Marshal(s.values)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+
+	// Use a fresh salt and nonce for every write
+	file := storeFile{Version: storeVersion, KDF: "scrypt", Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := newCipher(s.passphrase, file.Salt)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	// Write to a temporary file and rename it so a failed write cannot corrupt the store
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets store: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write secrets store: %w", err)
+	}
+	return nil
+}
+
+// ValidateName checks that name can be used as a secret name
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid secret name '%s': must contain only letters, digits and underscores, and not start with a digit", name)
+	}
+	return nil
+}
+
+// Get returns the value of a secret
+func (s *Store) Get(name string) (string, bool) {
+	value, ok := s.values[name]
+	return value, ok
+}
+
+// Set sets the value of a secret. Call Save to persist it.
+func (s *Store) Set(name, value string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if value == "" {
+		return fmt.Errorf("secret value cannot be empty")
+	}
+	s.values[name] = value
+	return nil
+}
+
+// Delete removes a secret and returns true if it existed. Call Save to persist it.
+func (s *Store) Delete(name string) bool {
+	_, ok := s.values[name]
+	delete(s.values, name)
+	return ok
+}
+
+// Names returns the names of all secrets in sorted order
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,147 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets", "secrets.enc")
+
+	store, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if len(store.Names()) != 0 {
+		t.Errorf("Expected a new store to be empty, got %v", store.Names())
+	}
+	if err := store.Set("GITHUB_TOKEN", "ghp_123"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := store.Set("ANTHROPIC_API_KEY", "sk-ant-456"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected store file to exist: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected store file mode 0600, got %v", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "ghp_123") || strings.Contains(string(data), "GITHUB_TOKEN") {
+		t.Error("Expected secret names and values to be encrypted")
+	}
+
+	reopened, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if names := reopened.Names(); !reflect.DeepEqual(names, []string{"ANTHROPIC_API_KEY", "GITHUB_TOKEN"}) {
+		t.Errorf("Unexpected names %v", names)
+	}
+	if value, ok := reopened.Get("GITHUB_TOKEN"); !ok || value != "ghp_123" {
+		t.Errorf("Get() = %q, %v", value, ok)
+	}
+
+	if !reopened.Delete("GITHUB_TOKEN") || reopened.Delete("GITHUB_TOKEN") {
+		t.Error("Expected Delete() to report whether the secret existed")
+	}
+	if err := reopened.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	reopened, _ = Open(path, "correct horse")
+	if _, ok := reopened.Get("GITHUB_TOKEN"); ok {
+		t.Error("Expected deleted secret to stay deleted")
+	}
+}
+
+func TestOpenWithWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	store, _ := Open(path, "right")
+	store.Set("NAME", "value")
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if _, err := Open(path, "wrong"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	if _, err := Open(path, ""); err == nil {
+		t.Error("Expected an error for an empty passphrase")
+	}
+}
+
+func TestSetValidatesName(t *testing.T) {
+	store, _ := Open(filepath.Join(t.TempDir(), "secrets.enc"), "passphrase")
+	for _, name := range []string{"", "1ABC", "MY-KEY", "A B"} {
+		if err := store.Set(name, "value"); err == nil {
+			t.Errorf("Expected Set(%q) to fail", name)
+		}
+	}
+	if err := store.Set("_valid_Name1", "value"); err != nil {
+		t.Errorf("Set() error = %v", err)
+	}
+	if err := store.Set("EMPTY", ""); err == nil {
+		t.Error("Expected an empty value to be rejected")
+	}
+}
+
+func TestResolveEnvironment(t *testing.T) {
+	values := map[string]string{"TOKEN": "abc", "USER": "bob"}
+	lookup := func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+
+	env := map[string]string{
+		"MODELNAME": "claude",
+		"API_KEY":   "${secret:TOKEN}",
+		"DSN":       "postgres://${secret:USER}:${secret:TOKEN}@db",
+	}
+	if !HasReferences(env) {
+		t.Error("Expected HasReferences() to be true")
+	}
+	if refs := References(env); !reflect.DeepEqual(refs, []string{"TOKEN", "USER"}) {
+		t.Errorf("References() = %v", refs)
+	}
+
+	plain, secret, used, err := ResolveEnvironment(env, lookup)
+	if err != nil {
+		t.Fatalf("ResolveEnvironment() error = %v", err)
+	}
+	if !reflect.DeepEqual(plain, map[string]string{"MODELNAME": "claude"}) {
+		t.Errorf("Unexpected plain environment %v", plain)
+	}
+	if !reflect.DeepEqual(secret, map[string]string{"API_KEY": "abc", "DSN": "postgres://bob:abc@db"}) {
+		t.Errorf("Unexpected secret environment %v", secret)
+	}
+	if !reflect.DeepEqual(used, []string{"abc", "bob"}) {
+		t.Errorf("Unexpected secret values %v", used)
+	}
+
+	_, _, _, err = ResolveEnvironment(map[string]string{"A": "${secret:MISSING}", "B": "${secret:MISSING}"}, lookup)
+	if err == nil || !strings.Contains(err.Error(), "undefined secrets: MISSING (") {
+		t.Errorf("Expected an undefined secret error, got %v", err)
+	}
+
+	if HasReferences(map[string]string{"A": "$secret:X", "B": "${SECRET:X}"}) {
+		t.Error("Expected only ${secret:NAME} to be treated as a reference")
+	}
+}
+
+func TestFormatEnvFile(t *testing.T) {
+	got := FormatEnvFile(map[string]string{"B": "it's $HOME", "A": "plain"})
+	want := "A='plain'\nB='it'\\''s $HOME'\n"
+	if got != want {
+		t.Errorf("FormatEnvFile() = %q, want %q", got, want)
+	}
+}
@@ -5,13 +5,36 @@ import "time"
 type LeaseStepRequest struct {
 	CommitSHABefore string `json:"commit_sha_before"`
 	AgentConfigName string `json:"agent_config_name"`
+	// ParallelGroup is shared by the steps a parallel run leases together. They
+	// all get the latest step outside the group as their parent.
+	ParallelGroup string `json:"parallel_group,omitempty"`
 }
 
 type FinalizeStepRequest struct {
-	StepID         int    `json:"step_id"`
-	CommitSHAAfter string `json:"commit_sha_after"`
-	ExitCode       int    `json:"exit_code"`
-	// TODO: Capture token usage
+	StepID         int        `json:"step_id"`
+	CommitSHAAfter string     `json:"commit_sha_after"`
+	ExitCode       int        `json:"exit_code"`
+	TokenUsage     TokenUsage `json:"token_usage"`
+	// ResourceUsage is omitted when the container's resource usage was not sampled
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
+	// MergeStrategy is the strategy used to merge the step's branch, omitted if
+	// no merge was attempted
+	MergeStrategy string `json:"merge_strategy,omitempty"`
+	// MergeCommitSHA is the main branch commit after the merge, omitted if the
+	// branch was not merged
+	MergeCommitSHA string `json:"merge_commit_sha,omitempty"`
+	// PullRequestURL is the pull request opened for the step's branch, omitted
+	// if none was opened
+	PullRequestURL string `json:"pull_request_url,omitempty"`
+	// DiffStats summarizes the changes the step committed, omitted if it
+	// committed none
+	DiffStats *DiffStats `json:"diff_stats,omitempty"`
+}
+
+type FinalizeStepResponse struct {
+	Status string `json:"status"`
+	// LeasedTaskIDs lists the tasks the step held a lease on when it was finalized
+	LeasedTaskIDs []int `json:"leased_task_ids"`
 }
 
 type MetaResponse struct {
@@ -24,3 +47,10 @@ type LeaseStepResponse struct {
 	Token  string       `json:"token"`
 	Meta   MetaResponse `json:"meta"`
 }
+
+// AppendStepLogRequest carries a chunk of a running step's formatted output
+type AppendStepLogRequest struct {
+	// Offset is the byte offset of Content in the step's log file
+	Offset  int64  `json:"offset"`
+	Content string `json:"content"`
+}
@@ -59,19 +59,102 @@ func createStepSchema(db *sql.DB) error {
 		end_time TIMESTAMP,
 		duration_ms INTEGER,
 		token_usage_json TEXT NOT NULL DEFAULT '{}',
+		resource_usage_json TEXT NOT NULL DEFAULT '{}',
 		exit_code INTEGER,
 		project_id TEXT NOT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		cancel_requested_at TIMESTAMP,
+		merge_strategy TEXT NOT NULL DEFAULT '',
+		merge_commit_sha TEXT NOT NULL DEFAULT '',
+		pull_request_url TEXT NOT NULL DEFAULT '',
+		parallel_group TEXT NOT NULL DEFAULT '',
+		diff_stats_json TEXT NOT NULL DEFAULT '{}',
 		FOREIGN KEY (parent_step_id) REFERENCES steps(id)
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_steps_project_id ON steps(project_id);
 	CREATE INDEX IF NOT EXISTS idx_steps_active ON steps(active);
 	CREATE INDEX IF NOT EXISTS idx_steps_parent_step_id ON steps(parent_step_id);
-	CREATE INDEX IF NOT EXISTS idx_steps_created_at ON steps(created_at);`
+	CREATE INDEX IF NOT EXISTS idx_steps_created_at ON steps(created_at);
 
-	_, err := db.Exec(schema)
-	return err
+	CREATE TABLE IF NOT EXISTS step_tasks (
+		step_id INTEGER NOT NULL,
+		task_id INTEGER NOT NULL,
+		PRIMARY KEY (step_id, task_id),
+		FOREIGN KEY (step_id) REFERENCES steps(id)
+	);`
+
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+
+	return migrateStepSchema(db)
+}
+
+// migrateStepSchema adds columns introduced after a step database was created
+func migrateStepSchema(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(steps)")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if !columns["resource_usage_json"] {
+		if _, err := db.Exec("ALTER TABLE steps ADD COLUMN resource_usage_json TEXT NOT NULL DEFAULT '{}'"); err != nil {
+			return err
+		}
+	}
+	if !columns["cancel_requested_at"] {
+		if _, err := db.Exec("ALTER TABLE steps ADD COLUMN cancel_requested_at TIMESTAMP"); err != nil {
+			return err
+		}
+	}
+	if !columns["merge_strategy"] {
+		if _, err := db.Exec("ALTER TABLE steps ADD COLUMN merge_strategy TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	if !columns["merge_commit_sha"] {
+		if _, err := db.Exec("ALTER TABLE steps ADD COLUMN merge_commit_sha TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	if !columns["pull_request_url"] {
+		if _, err := db.Exec("ALTER TABLE steps ADD COLUMN pull_request_url TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	if !columns["parallel_group"] {
+		if _, err := db.Exec("ALTER TABLE steps ADD COLUMN parallel_group TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	if !columns["diff_stats_json"] {
+		if _, err := db.Exec("ALTER TABLE steps ADD COLUMN diff_stats_json TEXT NOT NULL DEFAULT '{}'"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // CreateStep creates a new step record
@@ -97,11 +180,12 @@ func (sdb *StepDatabase) CreateStep(step *Step) (int, error) {
 		INSERT INTO steps (
 			active, parent_step_id, commit_sha_before, commit_sha_after,
 			agent_config_name, start_time, end_time, duration_ms,
-			token_usage_json, exit_code, project_id
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			token_usage_json, resource_usage_json, exit_code, project_id, parallel_group
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		stepJSON.Active, stepJSON.ParentStepID, stepJSON.CommitSHABefore, stepJSON.CommitSHAAfter,
 		stepJSON.AgentConfigName, stepJSON.StartTime, stepJSON.EndTime, stepJSON.DurationMs,
-		stepJSON.TokenUsageJSON, stepJSON.ExitCode, stepJSON.ProjectID)
+		stepJSON.TokenUsageJSON, stepJSON.ResourceUsageJSON, stepJSON.ExitCode, stepJSON.ProjectID,
+		stepJSON.ParallelGroup)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert step: %w", err)
@@ -122,13 +206,17 @@ func (sdb *StepDatabase) GetStep(stepID int) (*Step, error) {
 	err := sdb.db.QueryRow(`
 		SELECT id, active, parent_step_id, commit_sha_before, commit_sha_after,
 		       agent_config_name, start_time, end_time, duration_ms,
-		       token_usage_json, exit_code, project_id, created_at
+		       token_usage_json, resource_usage_json, exit_code, project_id, created_at,
+		       cancel_requested_at, merge_strategy, merge_commit_sha, pull_request_url, parallel_group,
+		       diff_stats_json
 		FROM steps
 		WHERE id = ?`, stepID).Scan(
 		&stepJSON.ID, &stepJSON.Active, &stepJSON.ParentStepID, &stepJSON.CommitSHABefore,
 		&stepJSON.CommitSHAAfter, &stepJSON.AgentConfigName, &stepJSON.StartTime,
 		&stepJSON.EndTime, &stepJSON.DurationMs, &stepJSON.TokenUsageJSON,
-		&stepJSON.ExitCode, &stepJSON.ProjectID, &stepJSON.CreatedAt)
+		&stepJSON.ResourceUsageJSON, &stepJSON.ExitCode, &stepJSON.ProjectID, &stepJSON.CreatedAt,
+		&stepJSON.CancelRequestedAt, &stepJSON.MergeStrategy, &stepJSON.MergeCommitSHA,
+		&stepJSON.PullRequestURL, &stepJSON.ParallelGroup, &stepJSON.DiffStatsJSON)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -146,7 +234,9 @@ func (sdb *StepDatabase) GetLatestActiveStep(projectID string) (*Step, error) {
 	err := sdb.db.QueryRow(`
 		SELECT id, active, parent_step_id, commit_sha_before, commit_sha_after,
 		       agent_config_name, start_time, end_time, duration_ms,
-		       token_usage_json, exit_code, project_id, created_at
+		       token_usage_json, resource_usage_json, exit_code, project_id, created_at,
+		       cancel_requested_at, merge_strategy, merge_commit_sha, pull_request_url, parallel_group,
+		       diff_stats_json
 		FROM steps
 		WHERE project_id = ? AND active = TRUE
 		ORDER BY id DESC
@@ -154,7 +244,9 @@ func (sdb *StepDatabase) GetLatestActiveStep(projectID string) (*Step, error) {
 		&stepJSON.ID, &stepJSON.Active, &stepJSON.ParentStepID, &stepJSON.CommitSHABefore,
 		&stepJSON.CommitSHAAfter, &stepJSON.AgentConfigName, &stepJSON.StartTime,
 		&stepJSON.EndTime, &stepJSON.DurationMs, &stepJSON.TokenUsageJSON,
-		&stepJSON.ExitCode, &stepJSON.ProjectID, &stepJSON.CreatedAt)
+		&stepJSON.ResourceUsageJSON, &stepJSON.ExitCode, &stepJSON.ProjectID, &stepJSON.CreatedAt,
+		&stepJSON.CancelRequestedAt, &stepJSON.MergeStrategy, &stepJSON.MergeCommitSHA,
+		&stepJSON.PullRequestURL, &stepJSON.ParallelGroup, &stepJSON.DiffStatsJSON)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -166,6 +258,69 @@ func (sdb *StepDatabase) GetLatestActiveStep(projectID string) (*Step, error) {
 	return stepJSON.FromJSON()
 }
 
+// GetLatestActiveStepOutsideGroup returns the most recent active step for a
+// project that is not part of the given parallel group, so the steps of a
+// parallel run all share the parent they started from
+func (sdb *StepDatabase) GetLatestActiveStepOutsideGroup(projectID string, parallelGroup string) (*Step, error) {
+	var stepJSON StepJSON
+	err := sdb.db.QueryRow(`
+		SELECT id, active, parent_step_id, commit_sha_before, commit_sha_after,
+		       agent_config_name, start_time, end_time, duration_ms,
+		       token_usage_json, resource_usage_json, exit_code, project_id, created_at,
+		       cancel_requested_at, merge_strategy, merge_commit_sha, pull_request_url, parallel_group,
+		       diff_stats_json
+		FROM steps
+		WHERE project_id = ? AND active = TRUE AND parallel_group != ?
+		ORDER BY id DESC
+		LIMIT 1`, projectID, parallelGroup).Scan(
+		&stepJSON.ID, &stepJSON.Active, &stepJSON.ParentStepID, &stepJSON.CommitSHABefore,
+		&stepJSON.CommitSHAAfter, &stepJSON.AgentConfigName, &stepJSON.StartTime,
+		&stepJSON.EndTime, &stepJSON.DurationMs, &stepJSON.TokenUsageJSON,
+		&stepJSON.ResourceUsageJSON, &stepJSON.ExitCode, &stepJSON.ProjectID, &stepJSON.CreatedAt,
+		&stepJSON.CancelRequestedAt, &stepJSON.MergeStrategy, &stepJSON.MergeCommitSHA,
+		&stepJSON.PullRequestURL, &stepJSON.ParallelGroup, &stepJSON.DiffStatsJSON)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest active step: %w", err)
+	}
+
+	return stepJSON.FromJSON()
+}
+
+// GetSiblingStepIDs returns the IDs of the other steps in a step's parallel
+// group, which ran concurrently with it. Steps that ran on their own have none.
+func (sdb *StepDatabase) GetSiblingStepIDs(step *Step) ([]int, error) {
+	if step.ParallelGroup == "" {
+		return nil, nil
+	}
+
+	rows, err := sdb.db.Query(`
+		SELECT id FROM steps
+		WHERE project_id = ? AND parallel_group = ? AND id != ?
+		ORDER BY id ASC`, step.ProjectID, step.ParallelGroup, step.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sibling steps: %w", err)
+	}
+	defer rows.Close()
+
+	var siblingIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan sibling step: %w", err)
+		}
+		siblingIDs = append(siblingIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sibling steps: %w", err)
+	}
+
+	return siblingIDs, nil
+}
+
 // UpdateStep updates a step with completion data
 func (sdb *StepDatabase) UpdateStep(stepID int, commitSHAAfter string, endTime time.Time, durationMs int, exitCode int, tokenUsage TokenUsage) error {
 	tokenUsageJSON, err := json.Marshal(tokenUsage)
@@ -185,6 +340,75 @@ func (sdb *StepDatabase) UpdateStep(stepID int, commitSHAAfter string, endTime t
 	return nil
 }
 
+// UpdateStepResourceUsage records the container resource usage sampled while a step ran
+func (sdb *StepDatabase) UpdateStepResourceUsage(stepID int, resourceUsage ResourceUsage) error {
+	resourceUsageJSON, err := json.Marshal(resourceUsage)
+	if err != nil {
+		return fmt.Errorf("failed to serialize resource usage: %w", err)
+	}
+
+	_, err = sdb.db.Exec(`UPDATE steps SET resource_usage_json = ? WHERE id = ?`, string(resourceUsageJSON), stepID)
+	if err != nil {
+		return fmt.Errorf("failed to update step resource usage: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateStepMerge records how a step's branch was merged into the main branch
+// and the resulting main branch commit, empty if the branch was not merged
+func (sdb *StepDatabase) UpdateStepMerge(stepID int, strategy string, mergeCommitSHA string) error {
+	_, err := sdb.db.Exec(`UPDATE steps SET merge_strategy = ?, merge_commit_sha = ? WHERE id = ?`, strategy, mergeCommitSHA, stepID)
+	if err != nil {
+		return fmt.Errorf("failed to update step merge: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateStepPullRequest records the URL of the pull request opened for a step's branch
+func (sdb *StepDatabase) UpdateStepPullRequest(stepID int, pullRequestURL string) error {
+	_, err := sdb.db.Exec(`UPDATE steps SET pull_request_url = ? WHERE id = ?`, pullRequestURL, stepID)
+	if err != nil {
+		return fmt.Errorf("failed to update step pull request: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateStepDiffStats records the summary of the changes a step committed
+func (sdb *StepDatabase) UpdateStepDiffStats(stepID int, diffStats DiffStats) error {
+	diffStatsJSON, err := json.Marshal(diffStats)
+	if err != nil {
+		return fmt.Errorf("failed to serialize diff stats: %w", err)
+	}
+
+	_, err = sdb.db.Exec(`UPDATE steps SET diff_stats_json = ? WHERE id = ?`, string(diffStatsJSON), stepID)
+	if err != nil {
+		return fmt.Errorf("failed to update step diff stats: %w", err)
+	}
+
+	return nil
+}
+
+// RequestStepCancel records that a user asked for a running step to be
+// cancelled. It returns false if the step has already finished or its
+// cancellation was already requested.
+func (sdb *StepDatabase) RequestStepCancel(stepID int, requestedAt time.Time) (bool, error) {
+	result, err := sdb.db.Exec(`
+		UPDATE steps SET cancel_requested_at = ?
+		WHERE id = ? AND end_time IS NULL AND cancel_requested_at IS NULL`, requestedAt, stepID)
+	if err != nil {
+		return false, fmt.Errorf("failed to request step cancellation: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to request step cancellation: %w", err)
+	}
+	return updated > 0, nil
+}
+
 // DeactivateStep marks a step as inactive (for rollback functionality)
 func (sdb *StepDatabase) DeactivateStep(stepID int) error {
 	_, err := sdb.db.Exec(`UPDATE steps SET active = FALSE WHERE id = ?`, stepID)
@@ -208,7 +432,9 @@ func (sdb *StepDatabase) ListSteps(projectID string, activeOnly bool) ([]*Step,
 	query := `
 		SELECT id, active, parent_step_id, commit_sha_before, commit_sha_after,
 		       agent_config_name, start_time, end_time, duration_ms,
-		       token_usage_json, exit_code, project_id, created_at
+		       token_usage_json, resource_usage_json, exit_code, project_id, created_at,
+		       cancel_requested_at, merge_strategy, merge_commit_sha, pull_request_url, parallel_group,
+		       diff_stats_json
 		FROM steps
 		WHERE project_id = ?`
 
@@ -231,7 +457,9 @@ func (sdb *StepDatabase) ListSteps(projectID string, activeOnly bool) ([]*Step,
 			&stepJSON.ID, &stepJSON.Active, &stepJSON.ParentStepID, &stepJSON.CommitSHABefore,
 			&stepJSON.CommitSHAAfter, &stepJSON.AgentConfigName, &stepJSON.StartTime,
 			&stepJSON.EndTime, &stepJSON.DurationMs, &stepJSON.TokenUsageJSON,
-			&stepJSON.ExitCode, &stepJSON.ProjectID, &stepJSON.CreatedAt); err != nil {
+			&stepJSON.ResourceUsageJSON, &stepJSON.ExitCode, &stepJSON.ProjectID, &stepJSON.CreatedAt,
+			&stepJSON.CancelRequestedAt, &stepJSON.MergeStrategy, &stepJSON.MergeCommitSHA,
+			&stepJSON.PullRequestURL, &stepJSON.ParallelGroup, &stepJSON.DiffStatsJSON); err != nil {
 			return nil, fmt.Errorf("failed to scan step: %w", err)
 		}
 
@@ -250,6 +478,99 @@ func (sdb *StepDatabase) ListSteps(projectID string, activeOnly bool) ([]*Step,
 	return steps, nil
 }
 
+// ListRunningSteps returns active steps for a project that have not been finalized yet
+func (sdb *StepDatabase) ListRunningSteps(projectID string) ([]*Step, error) {
+	rows, err := sdb.db.Query(`
+		SELECT id, active, parent_step_id, commit_sha_before, commit_sha_after,
+		       agent_config_name, start_time, end_time, duration_ms,
+		       token_usage_json, resource_usage_json, exit_code, project_id, created_at,
+		       cancel_requested_at, merge_strategy, merge_commit_sha, pull_request_url, parallel_group,
+		       diff_stats_json
+		FROM steps
+		WHERE project_id = ? AND active = TRUE AND end_time IS NULL
+		ORDER BY id ASC`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query running steps: %w", err)
+	}
+	defer rows.Close()
+
+	var steps []*Step
+	for rows.Next() {
+		var stepJSON StepJSON
+		if err := rows.Scan(
+			&stepJSON.ID, &stepJSON.Active, &stepJSON.ParentStepID, &stepJSON.CommitSHABefore,
+			&stepJSON.CommitSHAAfter, &stepJSON.AgentConfigName, &stepJSON.StartTime,
+			&stepJSON.EndTime, &stepJSON.DurationMs, &stepJSON.TokenUsageJSON,
+			&stepJSON.ResourceUsageJSON, &stepJSON.ExitCode, &stepJSON.ProjectID, &stepJSON.CreatedAt,
+			&stepJSON.CancelRequestedAt, &stepJSON.MergeStrategy, &stepJSON.MergeCommitSHA,
+			&stepJSON.PullRequestURL, &stepJSON.ParallelGroup, &stepJSON.DiffStatsJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan step: %w", err)
+		}
+
+		step, err := stepJSON.FromJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize step: %w", err)
+		}
+
+		steps = append(steps, step)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate running steps: %w", err)
+	}
+
+	return steps, nil
+}
+
+// RecordStepTasks records the tasks a step worked on
+func (sdb *StepDatabase) RecordStepTasks(stepID int, taskIDs []int) error {
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, taskID := range taskIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO step_tasks (step_id, task_id) VALUES (?, ?)`, stepID, taskID); err != nil {
+			return fmt.Errorf("failed to record step task: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ListStepTasks returns the task IDs worked on by each step of a project, keyed by step ID
+func (sdb *StepDatabase) ListStepTasks(projectID string) (map[int][]int, error) {
+	rows, err := sdb.db.Query(`
+		SELECT st.step_id, st.task_id
+		FROM step_tasks st
+		JOIN steps s ON s.id = st.step_id
+		WHERE s.project_id = ?
+		ORDER BY st.step_id, st.task_id`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query step tasks: %w", err)
+	}
+	defer rows.Close()
+
+	stepTasks := make(map[int][]int)
+	for rows.Next() {
+		var stepID, taskID int
+		if err := rows.Scan(&stepID, &taskID); err != nil {
+			return nil, fmt.Errorf("failed to scan step task: %w", err)
+		}
+		stepTasks[stepID] = append(stepTasks[stepID], taskID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate step tasks: %w", err)
+	}
+
+	return stepTasks, nil
+}
+
 // GetStepCount returns the total number of steps for a project
 func (sdb *StepDatabase) GetStepCount(projectID string) (int, error) {
 	var count int
@@ -1,9 +1,11 @@
 package steps
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -278,6 +280,232 @@ func TestUpdateStep(t *testing.T) {
 	}
 }
 
+func TestUpdateStepResourceUsage(t *testing.T) {
+	sdb, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	step := &Step{
+		Active:          true,
+		CommitSHABefore: "abc123",
+		StartTime:       time.Now(),
+		ProjectID:       "test-project",
+	}
+	if _, err := sdb.CreateStep(step); err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+
+	usage := ResourceUsage{
+		PeakMemoryBytes: 512 << 20,
+		AvgMemoryBytes:  256 << 20,
+		PeakCPUPercent:  180.5,
+		AvgCPUPercent:   42.25,
+		Samples:         12,
+	}
+	if err := sdb.UpdateStepResourceUsage(step.ID, usage); err != nil {
+		t.Fatalf("Failed to update resource usage: %v", err)
+	}
+
+	updatedStep, err := sdb.GetStep(step.ID)
+	if err != nil {
+		t.Fatalf("Failed to get updated step: %v", err)
+	}
+	if updatedStep.ResourceUsage != usage {
+		t.Errorf("Resource usage mismatch: got %+v, want %+v", updatedStep.ResourceUsage, usage)
+	}
+}
+
+func TestRequestStepCancel(t *testing.T) {
+	sdb, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	step := &Step{
+		Active:          true,
+		CommitSHABefore: "abc123",
+		StartTime:       time.Now(),
+		ProjectID:       "test-project",
+	}
+	if _, err := sdb.CreateStep(step); err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+
+	requested, err := sdb.RequestStepCancel(step.ID, time.Now())
+	if err != nil || !requested {
+		t.Fatalf("RequestStepCancel() = %v, %v; want true", requested, err)
+	}
+	requested, err = sdb.RequestStepCancel(step.ID, time.Now())
+	if err != nil || requested {
+		t.Errorf("Expected a repeated request to be ignored, got %v, %v", requested, err)
+	}
+
+	updatedStep, err := sdb.GetStep(step.ID)
+	if err != nil {
+		t.Fatalf("Failed to get step: %v", err)
+	}
+	if updatedStep.CancelRequestedAt == nil {
+		t.Error("Expected cancel_requested_at to be set")
+	}
+
+	if err := sdb.UpdateStep(step.ID, "def456", time.Now(), 1000, ExitCodeCancelled, TokenUsage{}); err != nil {
+		t.Fatalf("Failed to update step: %v", err)
+	}
+	updatedStep, _ = sdb.GetStep(step.ID)
+	if !updatedStep.IsCancelled() {
+		t.Error("Expected step to be cancelled")
+	}
+
+	// Finished steps cannot be cancelled
+	finished := &Step{Active: true, CommitSHABefore: "abc123", StartTime: time.Now(), ProjectID: "test-project"}
+	sdb.CreateStep(finished)
+	sdb.UpdateStep(finished.ID, "def456", time.Now(), 1000, 0, TokenUsage{})
+	if requested, err := sdb.RequestStepCancel(finished.ID, time.Now()); err != nil || requested {
+		t.Errorf("Expected finished step not to be cancelled, got %v, %v", requested, err)
+	}
+}
+
+func TestUpdateStepMerge(t *testing.T) {
+	sdb, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	step := &Step{
+		Active:          true,
+		CommitSHABefore: "abc123",
+		StartTime:       time.Now(),
+		ProjectID:       "test-project",
+	}
+	if _, err := sdb.CreateStep(step); err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+
+	created, _ := sdb.GetStep(step.ID)
+	if created.MergeStrategy != "" || created.MergeCommitSHA != "" {
+		t.Errorf("Expected no merge for a new step, got %q %q", created.MergeStrategy, created.MergeCommitSHA)
+	}
+
+	if err := sdb.UpdateStepMerge(step.ID, "squash", "fed789"); err != nil {
+		t.Fatalf("Failed to update step merge: %v", err)
+	}
+	updatedStep, err := sdb.GetStep(step.ID)
+	if err != nil {
+		t.Fatalf("Failed to get step: %v", err)
+	}
+	if updatedStep.MergeStrategy != "squash" || updatedStep.MergeCommitSHA != "fed789" {
+		t.Errorf("Expected squash merge at fed789, got %q %q", updatedStep.MergeStrategy, updatedStep.MergeCommitSHA)
+	}
+}
+
+func TestUpdateStepPullRequest(t *testing.T) {
+	sdb, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	step := &Step{
+		Active:          true,
+		CommitSHABefore: "abc123",
+		StartTime:       time.Now(),
+		ProjectID:       "test-project",
+	}
+	if _, err := sdb.CreateStep(step); err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+
+	url := "https://git.example.com/owner/repo/pulls/3"
+	if err := sdb.UpdateStepPullRequest(step.ID, url); err != nil {
+		t.Fatalf("Failed to update step pull request: %v", err)
+	}
+	steps, err := sdb.ListSteps("test-project", false)
+	if err != nil {
+		t.Fatalf("Failed to list steps: %v", err)
+	}
+	if len(steps) != 1 || steps[0].PullRequestURL != url {
+		t.Errorf("Expected the step to link to %s, got %+v", url, steps)
+	}
+}
+
+func TestUpdateStepDiffStats(t *testing.T) {
+	sdb, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	step := &Step{
+		Active:          true,
+		CommitSHABefore: "abc123",
+		StartTime:       time.Now(),
+		ProjectID:       "test-project",
+	}
+	if _, err := sdb.CreateStep(step); err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+
+	created, _ := sdb.GetStep(step.ID)
+	if created.DiffStats.FilesChanged != 0 || created.DiffStats.Files != nil {
+		t.Errorf("Expected no diff stats for a new step, got %+v", created.DiffStats)
+	}
+
+	stats := DiffStats{
+		FilesChanged: 2,
+		Insertions:   10,
+		Deletions:    3,
+		Files: []FileDiffStats{
+			{Path: "main.go", Status: "modified", Insertions: 10, Deletions: 3},
+			{Path: "logo.png", OldPath: "old.png", Status: "renamed", Binary: true},
+		},
+	}
+	if err := sdb.UpdateStepDiffStats(step.ID, stats); err != nil {
+		t.Fatalf("Failed to update diff stats: %v", err)
+	}
+
+	steps, err := sdb.ListSteps("test-project", false)
+	if err != nil {
+		t.Fatalf("Failed to list steps: %v", err)
+	}
+	if len(steps) != 1 || !reflect.DeepEqual(steps[0].DiffStats, stats) {
+		t.Errorf("Diff stats mismatch: got %+v, want %+v", steps, stats)
+	}
+}
+
+func TestMigrateStepSchemaAddsResourceUsage(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "steps.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	// Schema from before resource usage was recorded
+	_, err = db.Exec(`
+	CREATE TABLE steps (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		active BOOLEAN DEFAULT TRUE,
+		parent_step_id INTEGER,
+		commit_sha_before TEXT NOT NULL,
+		commit_sha_after TEXT,
+		agent_config_name TEXT,
+		start_time TIMESTAMP NOT NULL,
+		end_time TIMESTAMP,
+		duration_ms INTEGER,
+		token_usage_json TEXT NOT NULL DEFAULT '{}',
+		exit_code INTEGER,
+		project_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO steps (commit_sha_before, commit_sha_after, agent_config_name, start_time, project_id)
+	VALUES ('abc123', '', 'default', CURRENT_TIMESTAMP, 'test-project');`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	sdb, err := InitStepDB(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open legacy step database: %v", err)
+	}
+	defer sdb.Close()
+
+	step, err := sdb.GetStep(1)
+	if err != nil {
+		t.Fatalf("Failed to get legacy step: %v", err)
+	}
+	if step == nil || step.ResourceUsage.Samples != 0 || step.CancelRequestedAt != nil {
+		t.Errorf("Expected legacy step with empty resource usage, got %+v", step)
+	}
+}
+
 func TestDeactivateStep(t *testing.T) {
 	sdb, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -608,6 +836,51 @@ func TestParentStepRelationship(t *testing.T) {
 	}
 }
 
+func TestParallelStepGroup(t *testing.T) {
+	sdb, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	parent := &Step{Active: true, CommitSHABefore: "abc123", StartTime: time.Now(), ProjectID: "test-project"}
+	if _, err := sdb.CreateStep(parent); err != nil {
+		t.Fatalf("Failed to create parent step: %v", err)
+	}
+	var siblings []*Step
+	for i := 0; i < 3; i++ {
+		sibling := &Step{Active: true, ParentStepID: &parent.ID, CommitSHABefore: "def456", StartTime: time.Now(), ProjectID: "test-project", ParallelGroup: "run-1"}
+		if _, err := sdb.CreateStep(sibling); err != nil {
+			t.Fatalf("Failed to create sibling step: %v", err)
+		}
+		siblings = append(siblings, sibling)
+	}
+
+	latest, err := sdb.GetLatestActiveStepOutsideGroup("test-project", "run-1")
+	if err != nil {
+		t.Fatalf("Failed to get latest active step outside group: %v", err)
+	}
+	if latest == nil || latest.ID != parent.ID {
+		t.Errorf("Expected the parent S%d outside the group, got %+v", parent.ID, latest)
+	}
+
+	retrieved, err := sdb.GetStep(siblings[1].ID)
+	if err != nil {
+		t.Fatalf("Failed to get step: %v", err)
+	}
+	if retrieved.ParallelGroup != "run-1" {
+		t.Errorf("Expected parallel group run-1, got %q", retrieved.ParallelGroup)
+	}
+	siblingIDs, err := sdb.GetSiblingStepIDs(retrieved)
+	if err != nil {
+		t.Fatalf("Failed to get sibling steps: %v", err)
+	}
+	if len(siblingIDs) != 2 || siblingIDs[0] != siblings[0].ID || siblingIDs[1] != siblings[2].ID {
+		t.Errorf("Expected siblings S%d and S%d, got %v", siblings[0].ID, siblings[2].ID, siblingIDs)
+	}
+
+	if siblingIDs, err := sdb.GetSiblingStepIDs(parent); err != nil || len(siblingIDs) != 0 {
+		t.Errorf("Expected no siblings for a step that ran on its own, got %v (%v)", siblingIDs, err)
+	}
+}
+
 func TestDeactivateStepsFromID(t *testing.T) {
 	sdb, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -716,3 +989,97 @@ func TestDeactivateStepsFromIDNonExistent(t *testing.T) {
 		t.Error("Step should still be active when deactivating from non-existent ID")
 	}
 }
+
+func TestListRunningSteps(t *testing.T) {
+	sdb, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Create three steps: one finalized, one running, one rolled back
+	var ids []int
+	for i := 0; i < 3; i++ {
+		step := &Step{
+			Active:          true,
+			CommitSHABefore: fmt.Sprintf("commit%d", i),
+			AgentConfigName: "test-config",
+			StartTime:       time.Now(),
+			ProjectID:       "test-project",
+			CreatedAt:       time.Now(),
+		}
+		id, err := sdb.CreateStep(step)
+		if err != nil {
+			t.Fatalf("Failed to create step %d: %v", i, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := sdb.UpdateStep(ids[0], "after0", time.Now(), 1000, 0, TokenUsage{}); err != nil {
+		t.Fatalf("Failed to update step: %v", err)
+	}
+	if err := sdb.DeactivateStep(ids[2]); err != nil {
+		t.Fatalf("Failed to deactivate step: %v", err)
+	}
+
+	running, err := sdb.ListRunningSteps("test-project")
+	if err != nil {
+		t.Fatalf("Failed to list running steps: %v", err)
+	}
+
+	if len(running) != 1 {
+		t.Fatalf("Expected 1 running step, got %d", len(running))
+	}
+	if running[0].ID != ids[1] {
+		t.Errorf("Expected running step %d, got %d", ids[1], running[0].ID)
+	}
+
+	// Other projects should not see this project's running steps
+	running, err = sdb.ListRunningSteps("other-project")
+	if err != nil {
+		t.Fatalf("Failed to list running steps: %v", err)
+	}
+	if len(running) != 0 {
+		t.Errorf("Expected no running steps for other project, got %d", len(running))
+	}
+}
+
+func TestRecordStepTasks(t *testing.T) {
+	sdb, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	step1, err := sdb.CreateStep(&Step{Active: true, CommitSHABefore: "abc", StartTime: time.Now(), ProjectID: "test-project"})
+	if err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+	step2, err := sdb.CreateStep(&Step{Active: true, CommitSHABefore: "def", StartTime: time.Now(), ProjectID: "test-project"})
+	if err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+	other, err := sdb.CreateStep(&Step{Active: true, CommitSHABefore: "ghi", StartTime: time.Now(), ProjectID: "other-project"})
+	if err != nil {
+		t.Fatalf("Failed to create step: %v", err)
+	}
+
+	if err := sdb.RecordStepTasks(step1, []int{3, 1}); err != nil {
+		t.Fatalf("Failed to record step tasks: %v", err)
+	}
+	// Recording the same task twice is not an error
+	if err := sdb.RecordStepTasks(step1, []int{1}); err != nil {
+		t.Fatalf("Failed to record step tasks: %v", err)
+	}
+	if err := sdb.RecordStepTasks(other, []int{7}); err != nil {
+		t.Fatalf("Failed to record step tasks: %v", err)
+	}
+
+	stepTasks, err := sdb.ListStepTasks("test-project")
+	if err != nil {
+		t.Fatalf("Failed to list step tasks: %v", err)
+	}
+	if len(stepTasks) != 1 {
+		t.Errorf("Expected tasks for 1 step, got %v", stepTasks)
+	}
+	if tasks := stepTasks[step1]; len(tasks) != 2 || tasks[0] != 1 || tasks[1] != 3 {
+		t.Errorf("Expected tasks [1 3] for S%d, got %v", step1, tasks)
+	}
+	if tasks := stepTasks[step2]; len(tasks) != 0 {
+		t.Errorf("Expected no tasks for S%d, got %v", step2, tasks)
+	}
+}
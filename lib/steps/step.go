@@ -5,46 +5,111 @@ import (
 	"time"
 )
 
+// ExitCodeCancelled is the exit code recorded for a step that was cancelled
+// before its agent finished. It is negative so it cannot be mistaken for the
+// exit code of the agent container.
+const ExitCodeCancelled = -2
+
+// ExitCodeInterrupted is the exit code recorded for a step whose laforge
+// process was interrupted by SIGINT or SIGTERM
+const ExitCodeInterrupted = -3
+
 // Step represents a single step execution in the LaForge system
 type Step struct {
-	ID              int        `json:"id"`
-	Active          bool       `json:"active"`
-	ParentStepID    *int       `json:"parent_step_id"`
-	CommitSHABefore string     `json:"commit_sha_before"`
-	CommitSHAAfter  string     `json:"commit_sha_after"`
-	AgentConfigName string     `json:"agent_config_name"`
-	StartTime       time.Time  `json:"start_time"`
-	EndTime         *time.Time `json:"end_time"`
-	DurationMs      *int       `json:"duration_ms"`
-	TokenUsage      TokenUsage `json:"token_usage"`
-	ExitCode        *int       `json:"exit_code"`
-	ProjectID       string     `json:"project_id"`
-	CreatedAt       time.Time  `json:"created_at"`
+	ID              int           `json:"id"`
+	Active          bool          `json:"active"`
+	ParentStepID    *int          `json:"parent_step_id"`
+	CommitSHABefore string        `json:"commit_sha_before"`
+	CommitSHAAfter  string        `json:"commit_sha_after"`
+	AgentConfigName string        `json:"agent_config_name"`
+	StartTime       time.Time     `json:"start_time"`
+	EndTime         *time.Time    `json:"end_time"`
+	DurationMs      *int          `json:"duration_ms"`
+	TokenUsage      TokenUsage    `json:"token_usage"`
+	ResourceUsage   ResourceUsage `json:"resource_usage"`
+	ExitCode        *int          `json:"exit_code"`
+	ProjectID       string        `json:"project_id"`
+	CreatedAt       time.Time     `json:"created_at"`
+	// CancelRequestedAt is set when a user asks for the running step to be cancelled
+	CancelRequestedAt *time.Time `json:"cancel_requested_at"`
+	// MergeStrategy is the strategy used to merge the step's branch into the main
+	// branch, empty if no merge was attempted
+	MergeStrategy string `json:"merge_strategy"`
+	// MergeCommitSHA is the main branch commit after the step's branch was
+	// merged, empty if the branch was not merged
+	MergeCommitSHA string `json:"merge_commit_sha"`
+	// PullRequestURL is the pull request opened for the step's branch, empty if
+	// none was opened
+	PullRequestURL string `json:"pull_request_url"`
+	// ParallelGroup identifies the steps leased together by a parallel run,
+	// empty for steps that ran on their own
+	ParallelGroup string `json:"parallel_group"`
+	// DiffStats summarizes the changes between CommitSHABefore and CommitSHAAfter
+	DiffStats DiffStats `json:"diff_stats"`
 }
 
 // TokenUsage represents token usage statistics for a step
 type TokenUsage struct {
 	PromptTokens     int     `json:"prompt_tokens"`
 	CompletionTokens int     `json:"completion_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
 	TotalTokens      int     `json:"total_tokens"`
 	Cost             float64 `json:"cost"`
 }
 
+// DiffStats summarizes the changes a step committed, like `git diff --stat`
+type DiffStats struct {
+	FilesChanged int             `json:"files_changed"`
+	Insertions   int             `json:"insertions"`
+	Deletions    int             `json:"deletions"`
+	Files        []FileDiffStats `json:"files,omitempty"`
+}
+
+// FileDiffStats describes the changes to one file. Binary files have no line
+// counts.
+type FileDiffStats struct {
+	Path string `json:"path"`
+	// OldPath is the path the file was renamed or copied from
+	OldPath string `json:"old_path,omitempty"`
+	// Status is added, modified, deleted, renamed, copied or type-changed
+	Status     string `json:"status"`
+	Insertions int    `json:"insertions"`
+	Deletions  int    `json:"deletions"`
+	Binary     bool   `json:"binary,omitempty"`
+}
+
+// ResourceUsage summarizes the container resource usage sampled while a step ran
+type ResourceUsage struct {
+	PeakMemoryBytes int64   `json:"peak_memory_bytes"`
+	AvgMemoryBytes  int64   `json:"avg_memory_bytes"`
+	PeakCPUPercent  float64 `json:"peak_cpu_percent"`
+	AvgCPUPercent   float64 `json:"avg_cpu_percent"`
+	Samples         int     `json:"samples"`
+}
+
 // StepJSON is used for JSON serialization/deserialization
 type StepJSON struct {
-	ID              int        `json:"id"`
-	Active          bool       `json:"active"`
-	ParentStepID    *int       `json:"parent_step_id"`
-	CommitSHABefore string     `json:"commit_sha_before"`
-	CommitSHAAfter  string     `json:"commit_sha_after"`
-	AgentConfigName string     `json:"agent_config_name"`
-	StartTime       time.Time  `json:"start_time"`
-	EndTime         *time.Time `json:"end_time"`
-	DurationMs      *int       `json:"duration_ms"`
-	TokenUsageJSON  string     `json:"token_usage_json"`
-	ExitCode        *int       `json:"exit_code"`
-	ProjectID       string     `json:"project_id"`
-	CreatedAt       time.Time  `json:"created_at"`
+	ID                int        `json:"id"`
+	Active            bool       `json:"active"`
+	ParentStepID      *int       `json:"parent_step_id"`
+	CommitSHABefore   string     `json:"commit_sha_before"`
+	CommitSHAAfter    string     `json:"commit_sha_after"`
+	AgentConfigName   string     `json:"agent_config_name"`
+	StartTime         time.Time  `json:"start_time"`
+	EndTime           *time.Time `json:"end_time"`
+	DurationMs        *int       `json:"duration_ms"`
+	TokenUsageJSON    string     `json:"token_usage_json"`
+	ResourceUsageJSON string     `json:"resource_usage_json"`
+	ExitCode          *int       `json:"exit_code"`
+	ProjectID         string     `json:"project_id"`
+	CreatedAt         time.Time  `json:"created_at"`
+	CancelRequestedAt *time.Time `json:"cancel_requested_at"`
+	MergeStrategy     string     `json:"merge_strategy"`
+	MergeCommitSHA    string     `json:"merge_commit_sha"`
+	PullRequestURL    string     `json:"pull_request_url"`
+	ParallelGroup     string     `json:"parallel_group"`
+	DiffStatsJSON     string     `json:"diff_stats_json"`
 }
 
 // ToJSON converts a Step to its JSON representation
@@ -54,20 +119,37 @@ func (s *Step) ToJSON() (*StepJSON, error) {
 		return nil, err
 	}
 
+	resourceUsageJSON, err := json.Marshal(s.ResourceUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	diffStatsJSON, err := json.Marshal(s.DiffStats)
+	if err != nil {
+		return nil, err
+	}
+
 	return &StepJSON{
-		ID:              s.ID,
-		Active:          s.Active,
-		ParentStepID:    s.ParentStepID,
-		CommitSHABefore: s.CommitSHABefore,
-		CommitSHAAfter:  s.CommitSHAAfter,
-		AgentConfigName: s.AgentConfigName,
-		StartTime:       s.StartTime,
-		EndTime:         s.EndTime,
-		DurationMs:      s.DurationMs,
-		TokenUsageJSON:  string(tokenUsageJSON),
-		ExitCode:        s.ExitCode,
-		ProjectID:       s.ProjectID,
-		CreatedAt:       s.CreatedAt,
+		ID:                s.ID,
+		Active:            s.Active,
+		ParentStepID:      s.ParentStepID,
+		CommitSHABefore:   s.CommitSHABefore,
+		CommitSHAAfter:    s.CommitSHAAfter,
+		AgentConfigName:   s.AgentConfigName,
+		StartTime:         s.StartTime,
+		EndTime:           s.EndTime,
+		DurationMs:        s.DurationMs,
+		TokenUsageJSON:    string(tokenUsageJSON),
+		ResourceUsageJSON: string(resourceUsageJSON),
+		DiffStatsJSON:     string(diffStatsJSON),
+		ExitCode:          s.ExitCode,
+		ProjectID:         s.ProjectID,
+		CreatedAt:         s.CreatedAt,
+		CancelRequestedAt: s.CancelRequestedAt,
+		MergeStrategy:     s.MergeStrategy,
+		MergeCommitSHA:    s.MergeCommitSHA,
+		PullRequestURL:    s.PullRequestURL,
+		ParallelGroup:     s.ParallelGroup,
 	}, nil
 }
 
@@ -78,19 +160,50 @@ func (s *StepJSON) FromJSON() (*Step, error) {
 		return nil, err
 	}
 
+	var resourceUsage ResourceUsage
+	if s.ResourceUsageJSON != "" {
+		if err := json.Unmarshal([]byte(s.ResourceUsageJSON), &resourceUsage); err != nil {
+			return nil, err
+		}
+	}
+
+	var diffStats DiffStats
+	if s.DiffStatsJSON != "" {
+		if err := json.Unmarshal([]byte(s.DiffStatsJSON), &diffStats); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Step{
-		ID:              s.ID,
-		Active:          s.Active,
-		ParentStepID:    s.ParentStepID,
-		CommitSHABefore: s.CommitSHABefore,
-		CommitSHAAfter:  s.CommitSHAAfter,
-		AgentConfigName: s.AgentConfigName,
-		StartTime:       s.StartTime,
-		EndTime:         s.EndTime,
-		DurationMs:      s.DurationMs,
-		TokenUsage:      tokenUsage,
-		ExitCode:        s.ExitCode,
-		ProjectID:       s.ProjectID,
-		CreatedAt:       s.CreatedAt,
+		ID:                s.ID,
+		Active:            s.Active,
+		ParentStepID:      s.ParentStepID,
+		CommitSHABefore:   s.CommitSHABefore,
+		CommitSHAAfter:    s.CommitSHAAfter,
+		AgentConfigName:   s.AgentConfigName,
+		StartTime:         s.StartTime,
+		EndTime:           s.EndTime,
+		DurationMs:        s.DurationMs,
+		TokenUsage:        tokenUsage,
+		ResourceUsage:     resourceUsage,
+		DiffStats:         diffStats,
+		ExitCode:          s.ExitCode,
+		ProjectID:         s.ProjectID,
+		CreatedAt:         s.CreatedAt,
+		CancelRequestedAt: s.CancelRequestedAt,
+		MergeStrategy:     s.MergeStrategy,
+		MergeCommitSHA:    s.MergeCommitSHA,
+		PullRequestURL:    s.PullRequestURL,
+		ParallelGroup:     s.ParallelGroup,
 	}, nil
 }
+
+// IsCancelled returns true if the step was finalized after being cancelled
+func (s *Step) IsCancelled() bool {
+	return s.ExitCode != nil && *s.ExitCode == ExitCodeCancelled
+}
+
+// IsInterrupted returns true if the step was finalized after its laforge process was interrupted
+func (s *Step) IsInterrupted() bool {
+	return s.ExitCode != nil && *s.ExitCode == ExitCodeInterrupted
+}
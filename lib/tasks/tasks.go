@@ -49,6 +49,11 @@ func InitDB() (*sql.DB, error) {
 		dbPath = "/state/tasks.db"
 	}
 
+	return InitDBAt(dbPath)
+}
+
+// InitDBAt opens the task database at dbPath, creating its schema if needed
+func InitDBAt(dbPath string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -438,7 +443,18 @@ func UpdateTaskStatus(db *sql.DB, taskID int, status string) error {
 	return nil
 }
 
+// GetNextTask returns the first task that is ready for work, or nil if none is
 func GetNextTask(db *sql.DB) (*Task, error) {
+	readyTasks, err := GetReadyTasks(db, 1)
+	if err != nil || len(readyTasks) == 0 {
+		return nil, err
+	}
+	return &readyTasks[0], nil
+}
+
+// GetReadyTasks returns up to limit tasks that are ready for work, in the order
+// GetNextTask would hand them out. A limit of 0 or less returns all of them.
+func GetReadyTasks(db *sql.DB, limit int) ([]Task, error) {
 	// Get all candidate tasks that are ready for work based on their status
 	// A task is ready if:
 	// - Status is 'todo', 'in-progress', or 'in-review' (with no pending reviews)
@@ -459,7 +475,7 @@ func GetNextTask(db *sql.DB) (*Task, error) {
 
 	rows, err := db.Query(query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get next task: %w", err)
+		return nil, fmt.Errorf("failed to get ready tasks: %w", err)
 	}
 	defer rows.Close()
 
@@ -477,6 +493,7 @@ func GetNextTask(db *sql.DB) (*Task, error) {
 	}
 
 	// Now check each candidate task to see if it's ready
+	var readyTasks []Task
 	for _, task := range candidateTasks {
 		// For in-review tasks, check that there are no pending reviews
 		if task.Status == "in-review" {
@@ -512,10 +529,13 @@ func GetNextTask(db *sql.DB) (*Task, error) {
 			continue // Skip this task if it has incomplete child tasks
 		}
 
-		return &task, nil
+		readyTasks = append(readyTasks, task)
+		if limit > 0 && len(readyTasks) >= limit {
+			break
+		}
 	}
 
-	return nil, nil
+	return readyTasks, nil
 }
 
 func AddTaskLog(db *sql.DB, taskID int, message string) error {
@@ -525,7 +545,7 @@ func AddTaskLog(db *sql.DB, taskID int, message string) error {
 
 // LeaseTask creates a lease for a task with the given step ID.
 // The lease expires after 1 hour. Returns an error if the task is already leased
-// or if the task does not exist.
+// by another step or if the task does not exist.
 func LeaseTask(db *sql.DB, taskID int, stepID int) error {
 	// Get the current task to check if it exists and get its status
 	task, err := GetTask(db, taskID)
@@ -542,19 +562,23 @@ func LeaseTask(db *sql.DB, taskID int, stepID int) error {
 	}
 	defer tx.Rollback()
 
-	// Check if task is already leased (has an active lease)
-	var hasActiveLease bool
+	// Check if task is already leased (has an active lease). Leasing it again
+	// from the step holding the lease is not an error, so a step can be handed
+	// its task before the agent leases it.
+	var leaseStepID int
 	err = tx.QueryRow(
-		"SELECT EXISTS(SELECT 1 FROM task_leases WHERE task_id = ? AND datetime(expires_at) > datetime('now'))",
+		"SELECT step_id FROM task_leases WHERE task_id = ? AND datetime(expires_at) > datetime('now') LIMIT 1",
 		taskID,
-	).Scan(&hasActiveLease)
-	if err != nil {
-		return fmt.Errorf("failed to check active leases: %w", err)
-	}
-
-	if hasActiveLease {
+	).Scan(&leaseStepID)
+	if err == nil {
+		if leaseStepID == stepID {
+			return nil
+		}
 		return fmt.Errorf("task T%d is already leased", taskID)
 	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check active leases: %w", err)
+	}
 
 	// Create a new lease with expiration time 1 hour in the future
 	expiresAt := time.Now().Add(1 * time.Hour)
@@ -603,6 +627,29 @@ func IsTaskLeased(db *sql.DB, taskID int) (bool, error) {
 	return isLeased, nil
 }
 
+// GetLeasedTaskIDsForStep returns the IDs of all tasks currently leased by the given step ID.
+func GetLeasedTaskIDsForStep(db *sql.DB, stepID int) ([]int, error) {
+	rows, err := db.Query("SELECT task_id FROM task_leases WHERE step_id = ? ORDER BY task_id", stepID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task leases: %w", err)
+	}
+	defer rows.Close()
+
+	taskIDs := []int{}
+	for rows.Next() {
+		var taskID int
+		if err := rows.Scan(&taskID); err != nil {
+			return nil, fmt.Errorf("failed to scan task lease: %w", err)
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate task leases: %w", err)
+	}
+
+	return taskIDs, nil
+}
+
 // UnleaseTasksForStepID unleases all tasks that are currently leased by the given step ID.
 // It processes any queued logs, reviews, and status updates before clearing the leases.
 func UnleaseTasksForStepID(db *sql.DB, stepID int) error {
@@ -834,3 +834,87 @@ func containsSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestGetLeasedTaskIDsForStep(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	task1, _ := AddTask(db, "Task 1", nil)
+	task2, _ := AddTask(db, "Task 2", nil)
+	task3, _ := AddTask(db, "Task 3", nil)
+
+	if err := LeaseTask(db, task2, 1); err != nil {
+		t.Fatalf("Failed to lease task: %v", err)
+	}
+	if err := LeaseTask(db, task1, 1); err != nil {
+		t.Fatalf("Failed to lease task: %v", err)
+	}
+	if err := LeaseTask(db, task3, 2); err != nil {
+		t.Fatalf("Failed to lease task: %v", err)
+	}
+
+	taskIDs, err := GetLeasedTaskIDsForStep(db, 1)
+	if err != nil {
+		t.Fatalf("Failed to get leased tasks: %v", err)
+	}
+	if len(taskIDs) != 2 || taskIDs[0] != task1 || taskIDs[1] != task2 {
+		t.Errorf("Expected tasks [%d %d] leased by step 1, got %v", task1, task2, taskIDs)
+	}
+
+	if err := UnleaseTasksForStepID(db, 1); err != nil {
+		t.Fatalf("Failed to unlease tasks: %v", err)
+	}
+	taskIDs, err = GetLeasedTaskIDsForStep(db, 1)
+	if err != nil {
+		t.Fatalf("Failed to get leased tasks: %v", err)
+	}
+	if len(taskIDs) != 0 {
+		t.Errorf("Expected no leased tasks after unlease, got %v", taskIDs)
+	}
+}
+
+func TestLeaseTaskAgainFromSameStep(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	taskID, _ := AddTask(db, "Task 1", nil)
+	if err := LeaseTask(db, taskID, 1); err != nil {
+		t.Fatalf("Failed to lease task: %v", err)
+	}
+	if err := LeaseTask(db, taskID, 1); err != nil {
+		t.Errorf("Expected the step holding the lease to lease the task again, got %v", err)
+	}
+	if err := LeaseTask(db, taskID, 2); err == nil || !contains(err.Error(), "already leased") {
+		t.Errorf("Expected another step's lease to fail, got %v", err)
+	}
+}
+
+func TestGetReadyTasks(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	task1, _ := AddTask(db, "Task 1", nil)
+	task2, _ := AddTask(db, "Task 2", nil)
+	task3, _ := AddTask(db, "Task 3", nil)
+	AddTaskWithDetails(db, "Blocked", "", "", &task3, false, nil)
+
+	if err := LeaseTask(db, task2, 1); err != nil {
+		t.Fatalf("Failed to lease task: %v", err)
+	}
+
+	readyTasks, err := GetReadyTasks(db, 0)
+	if err != nil {
+		t.Fatalf("GetReadyTasks() error = %v", err)
+	}
+	if len(readyTasks) != 2 || readyTasks[0].ID != task1 || readyTasks[1].ID != task3 {
+		t.Errorf("Expected the unleased, unblocked tasks %d and %d, got %+v", task1, task3, readyTasks)
+	}
+
+	readyTasks, err = GetReadyTasks(db, 1)
+	if err != nil {
+		t.Fatalf("GetReadyTasks() error = %v", err)
+	}
+	if len(readyTasks) != 1 || readyTasks[0].ID != task1 {
+		t.Errorf("Expected only task %d with a limit of 1, got %+v", task1, readyTasks)
+	}
+}
@@ -0,0 +1,369 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EntryType identifies the kind of a transcript entry
+type EntryType string
+
+const (
+	// EntrySession starts an agent session, with its model and working directory
+	EntrySession EntryType = "session"
+	// EntryMessage is text written by the agent, or a prompt sent to it
+	EntryMessage EntryType = "message"
+	// EntryToolCall is a tool the agent called, with its input and result
+	EntryToolCall EntryType = "tool_call"
+	// EntryUsage is the token usage of one agent turn
+	EntryUsage EntryType = "usage"
+	// EntryResult ends an agent session, with its totals
+	EntryResult EntryType = "result"
+)
+
+// Usage is the token usage of a turn or session
+type Usage struct {
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+	CacheReadTokens  int `json:"cache_read_tokens"`
+	CacheWriteTokens int `json:"cache_write_tokens"`
+}
+
+// ToolCall is a tool call made by the agent
+type ToolCall struct {
+	ID      string                 `json:"id"`
+	Name    string                 `json:"name"`
+	Input   map[string]interface{} `json:"input"`
+	Result  string                 `json:"result,omitempty"`
+	IsError bool                   `json:"is_error,omitempty"`
+}
+
+// Entry is one record of a transcript. Which fields are set depends on the type.
+type Entry struct {
+	Type EntryType `json:"type"`
+	// Turn is the agent turn the entry belongs to, counting from 1 across all
+	// sessions of the step. Session entries and prompts sent before the first
+	// turn have turn 0.
+	Turn int `json:"turn"`
+
+	// Session entries
+	SessionID string `json:"session_id,omitempty"`
+	Model     string `json:"model,omitempty"`
+	CWD       string `json:"cwd,omitempty"`
+
+	// Message entries
+	Role string `json:"role,omitempty"`
+	Text string `json:"text,omitempty"`
+
+	// Tool call entries
+	Tool *ToolCall `json:"tool,omitempty"`
+
+	// Usage and result entries
+	Usage *Usage `json:"usage,omitempty"`
+
+	// Result entries
+	IsError    bool    `json:"is_error,omitempty"`
+	NumTurns   int     `json:"num_turns,omitempty"`
+	DurationMS int     `json:"duration_ms,omitempty"`
+	CostUSD    float64 `json:"cost_usd,omitempty"`
+}
+
+// streamMessage is a line of Claude Code stream-json output
+type streamMessage struct {
+	Type         string                 `json:"type"`
+	Subtype      string                 `json:"subtype"`
+	SessionID    string                 `json:"session_id"`
+	Model        string                 `json:"model"`
+	CWD          string                 `json:"cwd"`
+	Message      json.RawMessage        `json:"message"`
+	Result       string                 `json:"result"`
+	IsError      bool                   `json:"is_error"`
+	NumTurns     int                    `json:"num_turns"`
+	DurationMS   int                    `json:"duration_ms"`
+	TotalCostUSD float64                `json:"total_cost_usd"`
+	Usage        map[string]interface{} `json:"usage"`
+}
+
+// streamContent is a message of a stream-json line
+type streamContent struct {
+	ID      string                 `json:"id"`
+	Role    string                 `json:"role"`
+	Content json.RawMessage        `json:"content"`
+	Usage   map[string]interface{} `json:"usage"`
+}
+
+// contentBlock is a block of a message's content
+type contentBlock struct {
+	Type      string                 `json:"type"`
+	Text      string                 `json:"text"`
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Input     map[string]interface{} `json:"input"`
+	ToolUseID string                 `json:"tool_use_id"`
+	Content   json.RawMessage        `json:"content"`
+	IsError   bool                   `json:"is_error"`
+}
+
+// Parse builds a transcript from Claude Code stream-json output. Lines that are
+// not stream-json are skipped. It returns nil if the output has no stream-json,
+// as for agents that write plain text.
+func Parse(output string) []Entry {
+	var entries []Entry
+	toolCalls := map[string]int{} // tool call ID to entry index
+	turn := 0
+	messageID := ""
+	// The usage of a turn is reported on each of its lines; the last is
+	// recorded once the turn ends
+	var usage *Usage
+	flushUsage := func() {
+		if usage != nil {
+			entries = append(entries, Entry{Type: EntryUsage, Turn: turn, Usage: usage})
+			usage = nil
+		}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var msg streamMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			continue
+		}
+
+		if msg.Type != "assistant" {
+			flushUsage()
+		}
+
+		switch msg.Type {
+		case "system":
+			if msg.Subtype == "init" {
+				entries = append(entries, Entry{Type: EntrySession, Turn: turn, SessionID: msg.SessionID, Model: msg.Model, CWD: msg.CWD})
+			}
+
+		case "assistant":
+			var content streamContent
+			if err := json.Unmarshal(msg.Message, &content); err != nil {
+				continue
+			}
+			// Each content block of a turn arrives as a separate line with the same message ID
+			if content.ID == "" || content.ID != messageID {
+				flushUsage()
+				turn++
+				messageID = content.ID
+			}
+			for _, block := range parseContent(content.Content) {
+				switch block.Type {
+				case "text":
+					entries = append(entries, Entry{Type: EntryMessage, Turn: turn, Role: "assistant", Text: block.Text})
+				case "tool_use":
+					toolCalls[block.ID] = len(entries)
+					entries = append(entries, Entry{Type: EntryToolCall, Turn: turn, Tool: &ToolCall{ID: block.ID, Name: block.Name, Input: block.Input}})
+				}
+			}
+			if turnUsage := parseUsage(content.Usage); turnUsage != nil {
+				usage = turnUsage
+			}
+
+		case "user":
+			var content streamContent
+			if err := json.Unmarshal(msg.Message, &content); err != nil {
+				continue
+			}
+			for _, block := range parseContent(content.Content) {
+				switch block.Type {
+				case "text":
+					entries = append(entries, Entry{Type: EntryMessage, Turn: turn, Role: "user", Text: block.Text})
+				case "tool_result":
+					if i, ok := toolCalls[block.ToolUseID]; ok {
+						entries[i].Tool.Result = contentText(block.Content)
+						entries[i].Tool.IsError = block.IsError
+					}
+				}
+			}
+
+		case "result":
+			entries = append(entries, Entry{
+				Type:       EntryResult,
+				Turn:       turn,
+				Text:       msg.Result,
+				IsError:    msg.IsError || (msg.Subtype != "" && msg.Subtype != "success"),
+				NumTurns:   msg.NumTurns,
+				DurationMS: msg.DurationMS,
+				CostUSD:    msg.TotalCostUSD,
+				Usage:      parseUsage(msg.Usage),
+			})
+		}
+	}
+	flushUsage()
+
+	return entries
+}
+
+// parseContent parses message content, which is either a string or a list of blocks
+func parseContent(raw json.RawMessage) []contentBlock {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []contentBlock{{Type: "text", Text: text}}
+	}
+	var blocks []contentBlock
+	_ = json.Unmarshal(raw, &blocks)
+	return blocks
+}
+
+// contentText returns the text of a tool result, which is either a string or a
+// list of text blocks
+func contentText(raw json.RawMessage) string {
+	var parts []string
+	for _, block := range parseContent(raw) {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// parseUsage converts Claude API usage to Usage, or returns nil if there is none
+func parseUsage(data map[string]interface{}) *Usage {
+	if len(data) == 0 {
+		return nil
+	}
+	intField := func(key string) int {
+		if val, ok := data[key].(float64); ok {
+			return int(val)
+		}
+		return 0
+	}
+	return &Usage{
+		InputTokens:      intField("input_tokens"),
+		OutputTokens:     intField("output_tokens"),
+		CacheReadTokens:  intField("cache_read_input_tokens"),
+		CacheWriteTokens: intField("cache_creation_input_tokens"),
+	}
+}
+
+// Write writes a transcript as JSON lines, one entry per line
+func Write(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write transcript: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read reads a transcript written by Write
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse transcript entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	return entries, nil
+}
+
+// Filter selects transcript entries. Empty fields match everything.
+type Filter struct {
+	// Type selects entries of one type
+	Type EntryType
+	// Tool selects the calls of the named tool. Names are compared case-insensitively.
+	Tool string
+	// Contains selects the tool calls whose input contains the text, such as "rm -rf"
+	Contains string
+}
+
+// IsEmpty returns true if the filter matches every entry
+func (f Filter) IsEmpty() bool {
+	return f.Type == "" && f.Tool == "" && f.Contains == ""
+}
+
+// Match returns true if the entry is selected by the filter
+func (f Filter) Match(entry Entry) bool {
+	if f.Type != "" && entry.Type != f.Type {
+		return false
+	}
+	if f.Tool == "" && f.Contains == "" {
+		return true
+	}
+	if entry.Tool == nil {
+		return false
+	}
+	if f.Tool != "" && !strings.EqualFold(entry.Tool.Name, f.Tool) {
+		return false
+	}
+	if f.Contains != "" {
+		input, _ := json.Marshal(entry.Tool.Input)
+		if !strings.Contains(string(input), f.Contains) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the entries selected by the filter
+func (f Filter) Apply(entries []Entry) []Entry {
+	if f.IsEmpty() {
+		return entries
+	}
+	selected := []Entry{}
+	for _, entry := range entries {
+		if f.Match(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+// Summary totals a transcript
+type Summary struct {
+	Sessions   int            `json:"sessions"`
+	Turns      int            `json:"turns"`
+	ToolCalls  int            `json:"tool_calls"`
+	ToolErrors int            `json:"tool_errors"`
+	Tools      map[string]int `json:"tools"`
+	Usage      Usage          `json:"usage"`
+	// IsError is true if any session ended with an error
+	IsError bool `json:"is_error"`
+}
+
+// Summarize totals the sessions, turns, tool calls and per-turn usage of a transcript
+func Summarize(entries []Entry) Summary {
+	summary := Summary{Tools: map[string]int{}}
+	for _, entry := range entries {
+		summary.Turns = max(summary.Turns, entry.Turn)
+		switch entry.Type {
+		case EntrySession:
+			summary.Sessions++
+		case EntryToolCall:
+			summary.ToolCalls++
+			summary.Tools[entry.Tool.Name]++
+			if entry.Tool.IsError {
+				summary.ToolErrors++
+			}
+		case EntryUsage:
+			summary.Usage.InputTokens += entry.Usage.InputTokens
+			summary.Usage.OutputTokens += entry.Usage.OutputTokens
+			summary.Usage.CacheReadTokens += entry.Usage.CacheReadTokens
+			summary.Usage.CacheWriteTokens += entry.Usage.CacheWriteTokens
+		case EntryResult:
+			summary.IsError = summary.IsError || entry.IsError
+		}
+	}
+	return summary
+}
@@ -0,0 +1,104 @@
+package transcript
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const testStream = `Starting agent...
+{"type":"system","subtype":"init","session_id":"s1","model":"claude-sonnet-4","cwd":"/workspace"}
+{"type":"user","message":{"role":"user","content":"Fix the build"}}
+{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"text","text":"Cleaning up first."}],"usage":{"input_tokens":10,"output_tokens":5}}}
+{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"rm -rf build"}}],"usage":{"input_tokens":10,"output_tokens":20,"cache_read_input_tokens":100}}}
+{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"done"}]}}
+{"type":"assistant","message":{"id":"m2","role":"assistant","content":[{"type":"tool_use","id":"t2","name":"Read","input":{"file_path":"/workspace/missing.go"}}],"usage":{"input_tokens":30,"output_tokens":8}}}
+{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t2","content":[{"type":"text","text":"File does not exist."}],"is_error":true}]}}
+{"type":"result","subtype":"success","result":"Fixed","num_turns":2,"duration_ms":1500,"total_cost_usd":0.02,"usage":{"input_tokens":40,"output_tokens":28}}
+`
+
+func TestParse(t *testing.T) {
+	entries := Parse(testStream)
+
+	var types []EntryType
+	for _, entry := range entries {
+		types = append(types, entry.Type)
+	}
+	expected := []EntryType{EntrySession, EntryMessage, EntryMessage, EntryToolCall, EntryUsage, EntryToolCall, EntryUsage, EntryResult}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("Expected entries %v, got %v", expected, types)
+	}
+
+	if entries[1].Role != "user" || entries[1].Text != "Fix the build" || entries[1].Turn != 0 {
+		t.Errorf("Unexpected prompt entry %+v", entries[1])
+	}
+	if call := entries[3].Tool; call.Name != "Bash" || call.Input["command"] != "rm -rf build" || call.Result != "done" || call.IsError || entries[3].Turn != 1 {
+		t.Errorf("Unexpected tool call %+v", call)
+	}
+	// The usage of a turn is the last reported for its message
+	if usage := entries[4].Usage; *usage != (Usage{InputTokens: 10, OutputTokens: 20, CacheReadTokens: 100}) {
+		t.Errorf("Unexpected turn usage %+v", usage)
+	}
+	if call := entries[5].Tool; call.Result != "File does not exist." || !call.IsError || entries[5].Turn != 2 {
+		t.Errorf("Unexpected failed tool call %+v", call)
+	}
+	if result := entries[7]; result.Text != "Fixed" || result.NumTurns != 2 || result.DurationMS != 1500 || result.CostUSD != 0.02 || result.IsError {
+		t.Errorf("Unexpected result entry %+v", result)
+	}
+
+	if entries := Parse("plain text output\nfrom another agent\n"); entries != nil {
+		t.Errorf("Expected no transcript for plain text output, got %+v", entries)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	entries := Parse(testStream)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, entries); err != nil {
+		t.Fatalf("Failed to write transcript: %v", err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read transcript: %v", err)
+	}
+	if !reflect.DeepEqual(read, entries) {
+		t.Errorf("Transcript changed when written and read back:\n%+v\n%+v", entries, read)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	entries := Parse(testStream)
+
+	if got := (Filter{}).Apply(entries); len(got) != len(entries) {
+		t.Errorf("Expected an empty filter to select all %d entries, got %d", len(entries), len(got))
+	}
+	if got := (Filter{Tool: "bash"}).Apply(entries); len(got) != 1 || got[0].Tool.ID != "t1" {
+		t.Errorf("Expected the Bash call, got %+v", got)
+	}
+	if got := (Filter{Contains: "rm -rf"}).Apply(entries); len(got) != 1 || got[0].Tool.ID != "t1" {
+		t.Errorf("Expected the call running rm -rf, got %+v", got)
+	}
+	if got := (Filter{Tool: "Read", Contains: "rm -rf"}).Apply(entries); len(got) != 0 {
+		t.Errorf("Expected no calls, got %+v", got)
+	}
+	if got := (Filter{Type: EntryUsage}).Apply(entries); len(got) != 2 {
+		t.Errorf("Expected 2 usage entries, got %+v", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summary := Summarize(Parse(testStream))
+
+	expected := Summary{
+		Sessions:   1,
+		Turns:      2,
+		ToolCalls:  2,
+		ToolErrors: 1,
+		Tools:      map[string]int{"Bash": 1, "Read": 1},
+		Usage:      Usage{InputTokens: 40, OutputTokens: 28, CacheReadTokens: 100},
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Expected summary %+v, got %+v", expected, summary)
+	}
+}
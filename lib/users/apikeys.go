@@ -0,0 +1,273 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrAPIKeyExists   = errors.New("API key already exists")
+	ErrInvalidAPIKey  = errors.New("invalid or revoked API key")
+)
+
+// APIKeyPrefix starts every API key, distinguishing keys from JWTs
+const APIKeyPrefix = "lfk_"
+
+// AllProjects is the project scope that grants access to every project
+const AllProjects = "*"
+
+// lastUsedResolution limits how often a key's last-used time is written
+const lastUsedResolution = time.Minute
+
+// APIKeyRole is the set of operations an API key may perform. Every role may
+// read; the writing roles are separate, so a step-runner key cannot write tasks
+// and a task-writer key cannot run steps.
+type APIKeyRole string
+
+const (
+	// RoleReadOnly keys may only read
+	RoleReadOnly APIKeyRole = "read-only"
+	// RoleTaskWriter keys may read, and create and update tasks, task logs and reviews
+	RoleTaskWriter APIKeyRole = "task-writer"
+	// RoleStepRunner keys may read, and lease and finalize steps and stream their logs
+	RoleStepRunner APIKeyRole = "step-runner"
+)
+
+// ValidAPIKeyRoles lists the roles an API key can be created with
+var ValidAPIKeyRoles = []APIKeyRole{RoleReadOnly, RoleTaskWriter, RoleStepRunner}
+
+// APIKey is a named, long-lived credential scoped to projects and a role. The
+// secret itself is never stored; only its SHA-256 hash is.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Role       APIKeyRole `json:"role"`
+	Projects   []string   `json:"projects"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// AllowsProject returns true if the key is scoped to the given project
+func (k *APIKey) AllowsProject(projectID string) bool {
+	for _, project := range k.Projects {
+		if project == AllProjects || project == projectID {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAllProjects returns true if the key is scoped to every project
+func (k *APIKey) AllowsAllProjects() bool {
+	return k.AllowsProject(AllProjects)
+}
+
+// ParseAPIKeyRole validates a role name
+func ParseAPIKeyRole(role string) (APIKeyRole, error) {
+	for _, valid := range ValidAPIKeyRoles {
+		if string(valid) == role {
+			return valid, nil
+		}
+	}
+	names := make([]string, len(ValidAPIKeyRoles))
+	for i, valid := range ValidAPIKeyRoles {
+		names[i] = string(valid)
+	}
+	return "", fmt.Errorf("invalid role '%s' (must be one of %s)", role, strings.Join(names, ", "))
+}
+
+// createAPIKeySchema creates the API key table
+func createAPIKeySchema(db *sql.DB) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		key_hash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		role TEXT NOT NULL,
+		projects TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP
+	);`
+
+	_, err := db.Exec(schema)
+	return err
+}
+
+// CreateAPIKey creates a named API key and returns it along with its secret. The
+// secret cannot be retrieved again later.
+func (udb *UserDatabase) CreateAPIKey(name string, role APIKeyRole, projectIDs []string, createdBy string) (*APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("API key name cannot be empty")
+	}
+	if _, err := ParseAPIKeyRole(string(role)); err != nil {
+		return nil, "", err
+	}
+
+	var scope []string
+	for _, projectID := range projectIDs {
+		projectID = strings.TrimSpace(projectID)
+		if projectID == "" {
+			continue
+		}
+		// The scope is stored as a comma-separated list
+		if strings.Contains(projectID, ",") {
+			return nil, "", fmt.Errorf("project ID '%s' cannot contain a comma", projectID)
+		}
+		scope = append(scope, projectID)
+	}
+	if len(scope) == 0 {
+		return nil, "", fmt.Errorf("API key must be scoped to at least one project (use '%s' for all projects)", AllProjects)
+	}
+
+	var existingID int
+	err := udb.db.QueryRow("SELECT id FROM api_keys WHERE name = ?", name).Scan(&existingID)
+	if err == nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrAPIKeyExists, name)
+	}
+	if err != sql.ErrNoRows {
+		return nil, "", fmt.Errorf("failed to query API key: %w", err)
+	}
+
+	randomBytes := make([]byte, 24)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := APIKeyPrefix + hex.EncodeToString(randomBytes)
+
+	key := &APIKey{
+		Name:      name,
+		Prefix:    secret[:len(APIKeyPrefix)+8],
+		Role:      role,
+		Projects:  scope,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+
+	result, err := udb.db.Exec(`
+		INSERT INTO api_keys (name, key_hash, prefix, role, projects, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key.Name, hashAPIKey(secret), key.Prefix, string(key.Role), strings.Join(key.Projects, ","), key.CreatedBy, key.CreatedAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to insert API key: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	key.ID = int(id)
+
+	return key, secret, nil
+}
+
+// ListAPIKeys returns all API keys ordered by name
+func (udb *UserDatabase) ListAPIKeys() ([]*APIKey, error) {
+	rows, err := udb.db.Query(`
+		SELECT id, name, prefix, role, projects, created_by, created_at, last_used_at
+		FROM api_keys
+		ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey deletes the API key with the given name
+func (udb *UserDatabase) RevokeAPIKey(name string) error {
+	result, err := udb.db.Exec("DELETE FROM api_keys WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, name)
+	}
+	return nil
+}
+
+// AuthenticateAPIKey looks up the key matching a secret and records that it was used.
+// ErrInvalidAPIKey is returned if no such key exists.
+func (udb *UserDatabase) AuthenticateAPIKey(secret string) (*APIKey, error) {
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	row := udb.db.QueryRow(`
+		SELECT id, name, prefix, role, projects, created_by, created_at, last_used_at
+		FROM api_keys
+		WHERE key_hash = ?`, hashAPIKey(secret))
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		if _, err := udb.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", now, key.ID); err != nil {
+			return nil, fmt.Errorf("failed to update API key last used time: %w", err)
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var role, projects string
+	var lastUsedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &role, &projects, &key.CreatedBy, &key.CreatedAt, &lastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan API key: %w", err)
+	}
+
+	key.Role = APIKeyRole(role)
+	key.Projects = strings.Split(projects, ",")
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return &key, nil
+}
+
+// hashAPIKey returns the hex SHA-256 hash of an API key secret. Keys are long and
+// random, so a fast hash is sufficient and allows lookup by hash.
+func hashAPIKey(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,98 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCreateAndAuthenticateAPIKey(t *testing.T) {
+	udb := setupTestDB(t)
+
+	key, secret, err := udb.CreateAPIKey("ci", RoleTaskWriter, []string{"project-a", " project-b "}, "alice")
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		t.Errorf("expected secret to start with %s, got %s", APIKeyPrefix, secret)
+	}
+	if !strings.HasPrefix(secret, key.Prefix) {
+		t.Errorf("expected secret to start with display prefix %s", key.Prefix)
+	}
+	if len(key.Projects) != 2 || key.Projects[1] != "project-b" {
+		t.Errorf("unexpected project scope: %v", key.Projects)
+	}
+
+	authenticated, err := udb.AuthenticateAPIKey(secret)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey failed: %v", err)
+	}
+	if authenticated.Name != "ci" || authenticated.Role != RoleTaskWriter || authenticated.CreatedBy != "alice" {
+		t.Errorf("unexpected key: %+v", authenticated)
+	}
+	if authenticated.LastUsedAt == nil {
+		t.Error("expected last used time to be recorded")
+	}
+	if !authenticated.AllowsProject("project-a") || authenticated.AllowsProject("project-c") || authenticated.AllowsAllProjects() {
+		t.Errorf("unexpected project scope: %v", authenticated.Projects)
+	}
+
+	if _, err := udb.AuthenticateAPIKey(secret + "x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey for wrong secret, got %v", err)
+	}
+
+	keys, err := udb.ListAPIKeys()
+	if err != nil {
+		t.Fatalf("ListAPIKeys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("expected one key with a last used time, got %+v", keys)
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	udb := setupTestDB(t)
+
+	if _, _, err := udb.CreateAPIKey("", RoleReadOnly, []string{"*"}, "cli"); err == nil {
+		t.Error("expected error for empty name")
+	}
+	if _, _, err := udb.CreateAPIKey("ci", APIKeyRole("admin"), []string{"*"}, "cli"); err == nil {
+		t.Error("expected error for invalid role")
+	}
+	if _, _, err := udb.CreateAPIKey("ci", RoleReadOnly, []string{""}, "cli"); err == nil {
+		t.Error("expected error for empty project scope")
+	}
+	if _, _, err := udb.CreateAPIKey("ci", RoleReadOnly, []string{"a,b"}, "cli"); err == nil {
+		t.Error("expected error for a project ID with a comma")
+	}
+
+	key, _, err := udb.CreateAPIKey("ci", RoleReadOnly, []string{AllProjects}, "cli")
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if !key.AllowsAllProjects() || !key.AllowsProject("anything") {
+		t.Errorf("expected key to allow all projects: %v", key.Projects)
+	}
+	if _, _, err := udb.CreateAPIKey("ci", RoleReadOnly, []string{AllProjects}, "cli"); !errors.Is(err, ErrAPIKeyExists) {
+		t.Errorf("expected ErrAPIKeyExists, got %v", err)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	udb := setupTestDB(t)
+
+	_, secret, err := udb.CreateAPIKey("ci", RoleStepRunner, []string{"project-a"}, "cli")
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+
+	if err := udb.RevokeAPIKey("ci"); err != nil {
+		t.Fatalf("RevokeAPIKey failed: %v", err)
+	}
+	if _, err := udb.AuthenticateAPIKey(secret); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("revoked key should not authenticate, got %v", err)
+	}
+	if err := udb.RevokeAPIKey("ci"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
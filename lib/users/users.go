@@ -0,0 +1,341 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/tomyedwab/laforge/lib/projects"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+// MinPasswordLength is the shortest password accepted for an account
+const MinPasswordLength = 8
+
+// User represents a laserve user account
+type User struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Admin     bool      `json:"admin"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserDatabase provides database operations for user accounts and API keys
+type UserDatabase struct {
+	db *sql.DB
+
+	// dummyHash is compared against when a login names an unknown user, so that
+	// unknown and known usernames take the same time to reject
+	dummyHash []byte
+}
+
+// GetUserDBPath returns the path to the user database (~/.laforge/users.db)
+func GetUserDBPath() (string, error) {
+	laforgeDir, err := projects.GetLaForgeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(laforgeDir, "users.db"), nil
+}
+
+// OpenUserDB opens the user database at its default location, creating it if needed
+func OpenUserDB() (*UserDatabase, error) {
+	dbPath, err := GetUserDBPath()
+	if err != nil {
+		return nil, err
+	}
+	return InitUserDB(dbPath)
+}
+
+// InitUserDB initializes a user database at the specified path
+func InitUserDB(dbPath string) (*UserDatabase, error) {
+	// Ensure directory exists
+	dbDir := filepath.Dir(dbPath)
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	// Open database
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open user database: %w", err)
+	}
+
+	// Create schema
+	if err := createUserSchema(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create user schema: %w", err)
+	}
+
+	// The database holds password hashes, so keep it private to the owner
+	if err := os.Chmod(dbPath, 0600); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to set user database permissions: %w", err)
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("laforge-dummy-password"), bcrypt.DefaultCost)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize password hashing: %w", err)
+	}
+
+	return &UserDatabase{db: db, dummyHash: dummyHash}, nil
+}
+
+// createUserSchema creates the user database schema
+func createUserSchema(db *sql.DB) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		admin BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`
+
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	if err := migrateUserSchema(db); err != nil {
+		return err
+	}
+	return createAPIKeySchema(db)
+}
+
+// migrateUserSchema adds columns missing from user databases created by older versions
+func migrateUserSchema(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(users)")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	hasAdmin := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == "admin" {
+			hasAdmin = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !hasAdmin {
+		_, err = db.Exec("ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT FALSE")
+	}
+	return err
+}
+
+// Close closes the database connection
+func (udb *UserDatabase) Close() error {
+	return udb.db.Close()
+}
+
+// AddUser creates a new user account with the given password
+func (udb *UserDatabase) AddUser(username, password string) (*User, error) {
+	return udb.AddUserWithRole(username, password, false)
+}
+
+// AddUserWithRole creates a new user account, optionally with admin rights
+func (udb *UserDatabase) AddUserWithRole(username, password string, admin bool) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, fmt.Errorf("username cannot be empty")
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := udb.GetUser(username)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUserExists, username)
+	}
+
+	now := time.Now()
+	result, err := udb.db.Exec(`
+		INSERT INTO users (username, password_hash, admin, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)`, username, string(hash), admin, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	return &User{ID: int(id), Username: username, Admin: admin, CreatedAt: now, UpdatedAt: now}, nil
+}
+
+// GetUser returns the account with the given username
+func (udb *UserDatabase) GetUser(username string) (*User, error) {
+	var user User
+	err := udb.db.QueryRow(`
+		SELECT id, username, admin, created_at, updated_at
+		FROM users
+		WHERE username = ?`, username).Scan(&user.ID, &user.Username, &user.Admin, &user.CreatedAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetUserByID returns the account with the given ID
+func (udb *UserDatabase) GetUserByID(id int) (*User, error) {
+	var user User
+	err := udb.db.QueryRow(`
+		SELECT id, username, admin, created_at, updated_at
+		FROM users
+		WHERE id = ?`, id).Scan(&user.ID, &user.Username, &user.Admin, &user.CreatedAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: id %d", ErrUserNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	return &user, nil
+}
+
+// ListUsers returns all user accounts ordered by username
+func (udb *UserDatabase) ListUsers() ([]*User, error) {
+	rows, err := udb.db.Query(`
+		SELECT id, username, admin, created_at, updated_at
+		FROM users
+		ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Admin, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+// RemoveUser deletes the account with the given username
+func (udb *UserDatabase) RemoveUser(username string) error {
+	result, err := udb.db.Exec("DELETE FROM users WHERE username = ?", username)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	return nil
+}
+
+// SetPassword replaces the password of the account with the given username
+func (udb *UserDatabase) SetPassword(username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	result, err := udb.db.Exec(`
+		UPDATE users SET password_hash = ?, updated_at = ?
+		WHERE username = ?`, string(hash), time.Now(), username)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	return nil
+}
+
+// SetAdmin grants or revokes admin rights for the account with the given username
+func (udb *UserDatabase) SetAdmin(username string, admin bool) error {
+	result, err := udb.db.Exec(`
+		UPDATE users SET admin = ?, updated_at = ?
+		WHERE username = ?`, admin, time.Now(), username)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	return nil
+}
+
+// Authenticate checks a username and password and returns the matching account.
+// ErrInvalidCredentials is returned for both unknown users and wrong passwords.
+func (udb *UserDatabase) Authenticate(username, password string) (*User, error) {
+	var user User
+	var hash string
+	err := udb.db.QueryRow(`
+		SELECT id, username, password_hash, admin, created_at, updated_at
+		FROM users
+		WHERE username = ?`, username).Scan(&user.ID, &user.Username, &hash, &user.Admin, &user.CreatedAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(udb.dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+// hashPassword validates a password and returns its bcrypt hash
+func hashPassword(password string) ([]byte, error) {
+	if len(password) < MinPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return hash, nil
+}
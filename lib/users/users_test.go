@@ -0,0 +1,147 @@
+package users
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func setupTestDB(t *testing.T) *UserDatabase {
+	udb, err := InitUserDB(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize user database: %v", err)
+	}
+	t.Cleanup(func() { udb.Close() })
+	return udb
+}
+
+func TestAddAndAuthenticateUser(t *testing.T) {
+	udb := setupTestDB(t)
+
+	user, err := udb.AddUser("alice", "correct-horse")
+	if err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	if user.Username != "alice" || user.ID == 0 {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	authenticated, err := udb.Authenticate("alice", "correct-horse")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if authenticated.ID != user.ID {
+		t.Errorf("expected user ID %d, got %d", user.ID, authenticated.ID)
+	}
+
+	if _, err := udb.Authenticate("alice", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for wrong password, got %v", err)
+	}
+	if _, err := udb.Authenticate("bob", "correct-horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials for unknown user, got %v", err)
+	}
+}
+
+func TestAddUserValidation(t *testing.T) {
+	udb := setupTestDB(t)
+
+	if _, err := udb.AddUser("", "correct-horse"); err == nil {
+		t.Error("expected error for empty username")
+	}
+	if _, err := udb.AddUser("alice", "short"); err == nil {
+		t.Error("expected error for short password")
+	}
+
+	if _, err := udb.AddUser("alice", "correct-horse"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	if _, err := udb.AddUser("alice", "another-password"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("expected ErrUserExists, got %v", err)
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	udb := setupTestDB(t)
+
+	if _, err := udb.AddUser("alice", "correct-horse"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	if err := udb.SetPassword("alice", "battery-staple"); err != nil {
+		t.Fatalf("SetPassword failed: %v", err)
+	}
+
+	if _, err := udb.Authenticate("alice", "correct-horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("old password should no longer work, got %v", err)
+	}
+	if _, err := udb.Authenticate("alice", "battery-staple"); err != nil {
+		t.Errorf("new password should work: %v", err)
+	}
+
+	if err := udb.SetPassword("bob", "battery-staple"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestRemoveUser(t *testing.T) {
+	udb := setupTestDB(t)
+
+	alice, err := udb.AddUser("alice", "correct-horse")
+	if err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	bob, err := udb.AddUser("bob", "correct-horse")
+	if err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+
+	if err := udb.RemoveUser("alice"); err != nil {
+		t.Fatalf("RemoveUser failed: %v", err)
+	}
+	if err := udb.RemoveUser("alice"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := udb.Authenticate("alice", "correct-horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("removed user should not authenticate, got %v", err)
+	}
+	if _, err := udb.GetUserByID(alice.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound for removed user ID, got %v", err)
+	}
+	if user, err := udb.GetUserByID(bob.ID); err != nil || user.Username != "bob" {
+		t.Errorf("expected bob by ID, got %+v, %v", user, err)
+	}
+
+	userList, err := udb.ListUsers()
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+	if len(userList) != 1 || userList[0].Username != "bob" {
+		t.Errorf("expected only bob to remain, got %+v", userList)
+	}
+}
+
+func TestSetAdmin(t *testing.T) {
+	udb := setupTestDB(t)
+
+	user, err := udb.AddUserWithRole("root", "correct-horse", true)
+	if err != nil {
+		t.Fatalf("AddUserWithRole failed: %v", err)
+	}
+	if !user.Admin {
+		t.Error("expected user to be an admin")
+	}
+
+	if err := udb.SetAdmin("root", false); err != nil {
+		t.Fatalf("SetAdmin failed: %v", err)
+	}
+	authenticated, err := udb.Authenticate("root", "correct-horse")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if authenticated.Admin {
+		t.Error("expected admin rights to be revoked")
+	}
+
+	if err := udb.SetAdmin("bob", true); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
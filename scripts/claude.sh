@@ -5,6 +5,13 @@ set -euo pipefail
 export NVM_DIR="$HOME/.nvm"
 [ -s "$NVM_DIR/nvm.sh" ] && \. "$NVM_DIR/nvm.sh"
 
+# Load secret environment variables mounted by laforge
+if [ -n "${LAFORGE_SECRETS_FILE:-}" ]; then
+    set -a
+    . "$LAFORGE_SECRETS_FILE"
+    set +a
+fi
+
 # Copy config files with fixed permissions
 mkdir -p ~/.claude
 cp ~/.claude-laforge/.claude.json ~/
@@ -15,7 +22,7 @@ chmod 600 ~/.claude/.credentials.json
 mkdir -p /src/.claude
 cp /bin/.claude/settings.local.json /src/.claude/
 
-claude --model $MODELNAME --output-format stream-json --verbose -p "Work on the next task."
+claude --model $MODELNAME --output-format stream-json --verbose -p "${LAFORGE_PROMPT:-Work on the next task.}"
 
 # Check if COMMIT.md file exists. If it doesn't, create it.
 if [ ! -f COMMIT.md ]; then
@@ -5,10 +5,17 @@ set -euo pipefail
 export NVM_DIR="$HOME/.nvm"
 [ -s "$NVM_DIR/nvm.sh" ] && \. "$NVM_DIR/nvm.sh"
 
+# Load secret environment variables mounted by laforge
+if [ -n "${LAFORGE_SECRETS_FILE:-}" ]; then
+    set -a
+    . "$LAFORGE_SECRETS_FILE"
+    set +a
+fi
+
 BIN=/home/laforge/.opencode/bin/opencode
-$BIN -m $MODELNAME run "Work on the next task."
+$BIN -m $MODELNAME run --format json "${LAFORGE_PROMPT:-Work on the next task.}"
 
 # Check if COMMIT.md file exists. If it doesn't, create it.
 if [ ! -f COMMIT.md ]; then
-    $BIN -m $MODELNAME run --continue "Write a commit message to COMMIT.md"
+    $BIN -m $MODELNAME run --format json --continue "Write a commit message to COMMIT.md"
 fi
@@ -1,8 +1,11 @@
 package integration
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -153,3 +156,63 @@ func TestLaForgeStepFlags(t *testing.T) {
 		})
 	}
 }
+
+// TestLaForgeStepWithFakeBackend runs a full step cycle against a stub laserve
+// using the in-memory container backend, so it does not need a Docker daemon
+func TestLaForgeStepWithFakeBackend(t *testing.T) {
+	if !commandExists("git") {
+		t.Skip("Git is not available")
+	}
+
+	// Build the laforge binary for testing
+	if err := exec.Command("go", "build", "-o", "laforge-test", "../../cmd/laforge").Run(); err != nil {
+		t.Skip("Cannot build laforge binary")
+	}
+	defer os.Remove("laforge-test")
+	binary, err := filepath.Abs("laforge-test")
+	if err != nil {
+		t.Fatalf("Failed to resolve binary path: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/projects/fake-backend-project/steps/lease":
+			w.Write([]byte(`{"step_id":1,"token":"step-token"}`))
+		case "/api/v1/projects/fake-backend-project/steps/finalize":
+			w.Write([]byte(`{"status":"ok"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// Use an isolated home directory so ~/.laforge is not touched
+	repoDir := t.TempDir()
+	env := append(os.Environ(),
+		"HOME="+t.TempDir(),
+		"LAFORGE_CONTAINER_BACKEND=fake",
+		"LAFORGE_URLPATH="+server.URL+"/api/v1",
+		"LAFORGE_API_KEY=test-key",
+	)
+	run := func(name string, args ...string) string {
+		cmd := exec.Command(name, args...)
+		cmd.Dir = repoDir
+		cmd.Env = env
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s %s failed: %v\nOutput: %s", name, strings.Join(args, " "), err, output)
+		}
+		return string(output)
+	}
+
+	run("git", "init", "-b", "main")
+	run("git", "config", "user.email", "test@example.com")
+	run("git", "config", "user.name", "Test User")
+	run("git", "commit", "--allow-empty", "-m", "Initial commit")
+	run(binary, "init", "fake-backend-project")
+
+	output := run(binary, "step", "fake-backend-project")
+	if !strings.Contains(output, "fake agent finished") {
+		t.Errorf("Expected fake agent output, got: %s", output)
+	}
+}
@@ -29,7 +29,7 @@ describe('LoginForm', () => {
     expect(screen.getByLabelText(/username/i)).toBeInTheDocument();
     expect(screen.getByLabelText(/password/i)).toBeInTheDocument();
     expect(screen.getByRole('button', { name: /login/i })).toBeInTheDocument();
-    expect(screen.getByText(/for development, any username.password will work/i)).toBeInTheDocument();
+    expect(screen.queryByText(/any username.password will work/i)).not.toBeInTheDocument();
   });
 
   it('disables submit button when fields are empty', () => {
@@ -81,7 +81,8 @@ describe('LoginForm', () => {
       json: async () => ({
         data: {
           token: 'mock-token',
-          user_id: 'testuser'
+          user_id: '1',
+          username: 'testuser'
         },
         meta: {
           timestamp: new Date().toISOString(),
@@ -124,7 +125,8 @@ describe('LoginForm', () => {
       json: async () => ({
         data: {
           token: 'mock-token',
-          user_id: 'testuser'
+          user_id: '1',
+          username: 'testuser'
         },
         meta: {
           timestamp: new Date().toISOString(),
@@ -148,12 +150,17 @@ describe('LoginForm', () => {
     });
   });
 
-  it('handles failed login and falls back to mock login', async () => {
-    const mockResponse = {
+  it('shows the error message of a rejected login', async () => {
+    (global.fetch as any).mockResolvedValueOnce({
       ok: false,
-    };
-
-    (global.fetch as any).mockResolvedValueOnce(mockResponse);
+      status: 401,
+      json: async () => ({
+        error: {
+          code: 'UNAUTHORIZED',
+          message: 'Invalid username or password'
+        }
+      })
+    });
 
     renderLoginForm();
     
@@ -162,19 +169,17 @@ describe('LoginForm', () => {
     const submitButton = screen.getByRole('button', { name: /login/i });
 
     fireEvent.input(usernameInput, { target: { value: 'testuser' } });
-    fireEvent.input(passwordInput, { target: { value: 'testpass' } });
+    fireEvent.input(passwordInput, { target: { value: 'wrongpass' } });
     fireEvent.click(submitButton);
 
     await waitFor(() => {
-      // Should attempt fetch first
-      expect(global.fetch).toHaveBeenCalled();
-      
-      // Should fall back to mock login
-      expect(mockOnSuccess).toHaveBeenCalled();
+      expect(screen.getByRole('alert')).toHaveTextContent('Invalid username or password');
     });
+    expect(mockOnSuccess).not.toHaveBeenCalled();
+    expect(localStorage.getItem('laforge_auth_token')).toBeNull();
   });
 
-  it('handles network errors and falls back to mock login', async () => {
+  it('shows an error and stays logged out on network errors', async () => {
     (global.fetch as any).mockRejectedValueOnce(new Error('Network error'));
 
     renderLoginForm();
@@ -188,8 +193,10 @@ describe('LoginForm', () => {
     fireEvent.click(submitButton);
 
     await waitFor(() => {
-      expect(mockOnSuccess).toHaveBeenCalled();
+      expect(screen.getByRole('alert')).toHaveTextContent('Could not reach the server');
     });
+    expect(mockOnSuccess).not.toHaveBeenCalled();
+    expect(localStorage.getItem('laforge_auth_token')).toBeNull();
   });
 
   it('has proper accessibility attributes', () => {
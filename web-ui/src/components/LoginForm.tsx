@@ -10,6 +10,7 @@ export function LoginForm({ onSuccess }: LoginFormProps) {
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
   const [isLoading, setIsLoading] = useState(false);
+  const [loginError, setLoginError] = useState<string | null>(null);
   const { login, error, clearError } = useAuth();
 
   const handleSubmit = async (e: Event) => {
@@ -20,11 +21,10 @@ export function LoginForm({ onSuccess }: LoginFormProps) {
     }
 
     setIsLoading(true);
+    setLoginError(null);
     clearError();
 
     try {
-      // For now, we'll use a simple hardcoded login
-      // In a real app, this would call the login API endpoint
       const response = await fetch(
         `${import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080/api/v1'}/public/login`,
         {
@@ -37,28 +37,23 @@ export function LoginForm({ onSuccess }: LoginFormProps) {
       );
 
       if (!response.ok) {
-        throw new Error('Invalid credentials');
+        // Show the server's reason, such as a wrong username or password
+        const body = await response.json().catch(() => null);
+        setLoginError(body?.error?.message || 'Login failed');
+        return;
       }
 
       const data = await response.json();
 
-      // Store the token and user info
-      login(data.token, data.user_id);
+      // Store the token and the username shown in the header
+      login(data.data.token, data.data.username);
 
       if (onSuccess) {
         onSuccess();
       }
     } catch (error) {
       console.error('Login failed:', error);
-      // For development, we'll accept any non-empty credentials
-      // and generate a mock token
-      if (username.trim() && password.trim()) {
-        const mockToken = btoa(`${username}:${Date.now()}`);
-        login(mockToken, username);
-        if (onSuccess) {
-          onSuccess();
-        }
-      }
+      setLoginError('Could not reach the server');
     } finally {
       setIsLoading(false);
     }
@@ -69,7 +64,7 @@ export function LoginForm({ onSuccess }: LoginFormProps) {
       <form onSubmit={handleSubmit}>
         <h2>Login to LaForge</h2>
 
-        {error && <div class="error-message">{error}</div>}
+        {(loginError || error) && <div class="error-message" role="alert">{loginError || error}</div>}
 
         <div class="form-group">
           <label htmlFor="username">Username</label>
@@ -101,10 +96,6 @@ export function LoginForm({ onSuccess }: LoginFormProps) {
         >
           {isLoading ? 'Logging in...' : 'Login'}
         </button>
-
-        <div class="login-help">
-          <p>For development, any username/password will work.</p>
-        </div>
       </form>
     </div>
   );
@@ -24,6 +24,17 @@ export function StepDetail({ step, onClose, formatDuration, formatCost }: StepDe
     return sha.substring(0, 8);
   };
 
+  const formatBytes = (bytes: number) => {
+    const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+    let value = bytes;
+    let unit = 0;
+    while (value >= 1024 && unit < units.length - 1) {
+      value /= 1024;
+      unit++;
+    }
+    return unit === 0 ? `${value} B` : `${value.toFixed(1)} ${units[unit]}`;
+  };
+
   const statusInfo = getStatusInfo();
 
   return (
@@ -107,16 +118,54 @@ export function StepDetail({ step, onClose, formatDuration, formatCost }: StepDe
             </div>
           </div>
           
-          {step.parent_step_id && (
+          {step.resource_samples > 0 && (
             <div class="detail-section">
-              <h4>Relationships</h4>
-              <div class="info-item">
-                <strong>Parent Step:</strong>
-                <span>S{step.parent_step_id}</span>
+              <h4>Resource Usage</h4>
+              <div class="info-grid">
+                <div class="info-item">
+                  <strong>Peak Memory:</strong>
+                  <span>{formatBytes(step.peak_memory_bytes)}</span>
+                </div>
+                <div class="info-item">
+                  <strong>Average Memory:</strong>
+                  <span>{formatBytes(step.avg_memory_bytes)}</span>
+                </div>
+                <div class="info-item">
+                  <strong>Peak CPU:</strong>
+                  <span>{step.peak_cpu_percent.toFixed(1)}%</span>
+                </div>
+                <div class="info-item">
+                  <strong>Average CPU:</strong>
+                  <span>{step.avg_cpu_percent.toFixed(1)}%</span>
+                </div>
               </div>
             </div>
           )}
           
+          {(step.parent_step_id || step.sibling_step_ids.length > 0) && (
+            <div class="detail-section">
+              <h4>Relationships</h4>
+              {step.parent_step_id && (
+                <div class="info-item">
+                  <strong>Parent Step:</strong>
+                  <span>S{step.parent_step_id}</span>
+                </div>
+              )}
+              {step.sibling_step_ids.length > 0 && (
+                <div class="info-item">
+                  <strong>Parallel With:</strong>
+                  <span>{step.sibling_step_ids.map((id) => `S${id}`).join(', ')}</span>
+                </div>
+              )}
+              {step.files_changed > 0 && (
+                <div class="info-item">
+                  <strong>Changes:</strong>
+                  <span>{`${step.files_changed} file${step.files_changed === 1 ? '' : 's'} +${step.insertions} -${step.deletions}`}</span>
+                </div>
+              )}
+            </div>
+          )}
+          
           <div class="detail-section">
             <h4>Agent Configuration</h4>
             <div class="agent-config">
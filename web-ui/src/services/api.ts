@@ -5,6 +5,9 @@ import type {
   TaskLog,
   TaskReview,
   Step,
+  StepDiff,
+  CommitStep,
+  BlameRange,
 } from '../types';
 
 const getApiBaseUrl = () => {
@@ -270,6 +273,33 @@ class ApiService {
     );
   }
 
+  async getStepDiff(id: number, path?: string): Promise<{ diff: StepDiff }> {
+    const query = path ? `?path=${encodeURIComponent(path)}` : '';
+    return this.request<{ diff: StepDiff }>(
+      `/projects/${this.projectId}/steps/${id}/diff${query}`
+    );
+  }
+
+  // Code history
+  async blameFile(
+    path: string,
+    start?: number,
+    end?: number
+  ): Promise<{ path: string; ranges: BlameRange[] }> {
+    const searchParams = new URLSearchParams({ path });
+    if (start !== undefined) searchParams.append('start', String(start));
+    if (end !== undefined) searchParams.append('end', String(end));
+    return this.request<{ path: string; ranges: BlameRange[] }>(
+      `/projects/${this.projectId}/blame?${searchParams.toString()}`
+    );
+  }
+
+  async getCommitStep(commit: string): Promise<{ commit: CommitStep }> {
+    return this.request<{ commit: CommitStep }>(
+      `/projects/${this.projectId}/commits/${encodeURIComponent(commit)}/step`
+    );
+  }
+
   // Project endpoints
   async getProjects(): Promise<{ projects: any[] }> {
     return this.request<{ projects: any[] }>('/projects');
@@ -28,7 +28,8 @@ export const mockApiResponses = {
     success: {
       data: {
         token: 'mock-token',
-        user_id: 'test-user',
+        user_id: '1',
+        username: 'test-user',
       },
     },
     error: {
@@ -47,6 +47,8 @@ export interface Step {
   project_id: string;
   active: boolean;
   parent_step_id: number | null;
+  parallel_group: string;
+  sibling_step_ids: number[];
   commit_before: string;
   commit_after: string;
   agent_config: Record<string, unknown>;
@@ -55,9 +57,56 @@ export interface Step {
   duration_ms: number;
   prompt_tokens: number;
   completion_tokens: number;
+  cache_read_tokens: number;
+  cache_write_tokens: number;
   total_tokens: number;
   cost_usd: number;
   exit_code: number;
+  peak_memory_bytes: number;
+  avg_memory_bytes: number;
+  peak_cpu_percent: number;
+  avg_cpu_percent: number;
+  resource_samples: number;
+  files_changed: number;
+  insertions: number;
+  deletions: number;
+}
+
+export interface FileDiffStats {
+  path: string;
+  old_path?: string;
+  status: 'added' | 'modified' | 'deleted' | 'renamed' | 'copied' | 'type-changed';
+  insertions: number;
+  deletions: number;
+  binary?: boolean;
+}
+
+export interface StepDiff {
+  step_id: number;
+  commit_before: string;
+  commit_after: string;
+  stats: {
+    files_changed: number;
+    insertions: number;
+    deletions: number;
+    files?: FileDiffStats[];
+  };
+  diff: string;
+}
+
+export interface CommitStep {
+  commit: string;
+  subject: string;
+  step_id: number | null;
+  source: '' | 'note' | 'merge_message' | 'step_record';
+  step: Step | null;
+  task_ids: number[];
+}
+
+export interface BlameRange {
+  start_line: number;
+  end_line: number;
+  commit: CommitStep;
 }
 
 // API Response types